@@ -0,0 +1,112 @@
+// Command bgplsdump peers with a single BGP-LS neighbor and writes received
+// update messages to stdout as JSON lines. Other events are logged to stderr.
+//
+// Interface values within an update, e.g. path attributes, nlri and link state
+// attributes, are encoded as {"type": "<type name>", "value": ...} where type
+// name is that of the bgpls package type, e.g. "LinkAttrIgpMetric".
+//
+//	bgplsdump -neighbor 172.16.1.201 -asn 64512 -local-asn 64512 -router-id 1.2.3.4
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"reflect"
+	"time"
+
+	"github.com/jwhited/bgpls"
+)
+
+type updateLine struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Neighbor  string      `json:"neighbor"`
+	Update    interface{} `json:"update"`
+}
+
+func main() {
+	var (
+		neighbor = flag.String("neighbor", "", "neighbor address")
+		asn      = flag.Uint("asn", 0, "neighbor ASN")
+		localASN = flag.Uint("local-asn", 0, "local ASN")
+		routerID = flag.String("router-id", "", "local router ID")
+		holdTime = flag.Duration("hold-time", time.Second*30, "hold time")
+		port     = flag.Uint("port", 179, "neighbor TCP port")
+	)
+	flag.Parse()
+
+	address := net.ParseIP(*neighbor)
+	if address == nil {
+		log.Fatalf("invalid neighbor address: %q", *neighbor)
+	}
+	id := net.ParseIP(*routerID)
+	if id == nil {
+		log.Fatalf("invalid router ID: %q", *routerID)
+	}
+	if *asn == 0 || *asn > 1<<32-1 || *localASN == 0 || *localASN > 1<<32-1 {
+		log.Fatal("asn and local-asn must be between 1 and 4294967295")
+	}
+	if *port == 0 || *port > 1<<16-1 {
+		log.Fatal("port must be between 1 and 65535")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	collector, err := bgpls.NewCollectorWithContext(ctx, &bgpls.CollectorConfig{
+		ASN:             uint32(*localASN),
+		RouterID:        id,
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	events, err := collector.Events()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = collector.AddNeighbor(&bgpls.NeighborConfig{
+		Address:  address,
+		ASN:      uint32(*asn),
+		HoldTime: *holdTime,
+		Port:     uint16(*port),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	// the events channel closes once the collector has stopped
+	for event := range events {
+		switch e := event.(type) {
+		case *bgpls.EventNeighborUpdateReceived:
+			err = enc.Encode(&updateLine{
+				Timestamp: e.Timestamp(),
+				Neighbor:  e.Neighbor().Address.String(),
+				Update:    typed(reflect.ValueOf(e.Message)),
+			})
+			if err != nil {
+				log.Printf("neighbor %s, error encoding update: %v", e.Neighbor().Address, err)
+			}
+		case *bgpls.EventNeighborErr:
+			log.Printf("neighbor %s, err: %v", e.Neighbor().Address, e.Err)
+		case *bgpls.EventNeighborStateTransition:
+			log.Printf("neighbor %s, state transition: %v", e.Neighbor().Address, e.State)
+		case *bgpls.EventNeighborNotificationReceived:
+			log.Printf("neighbor %s, notification message: %v, data: %x", e.Neighbor().Address, e.Message, e.Message.Data)
+		default:
+			log.Printf("neighbor %s, %v", event.Neighbor().Address, event.Type())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+)
+
+// typedElement is the JSON encoding of an interface value, e.g. a PathAttr,
+// LinkStateNlri or LinkAttr. Different concrete types may otherwise encode
+// identically, e.g. LinkAttrIgpMetric and LinkAttrDefaultTEMetric.
+type typedElement struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// typed returns a value that encodes as v does with encoding/json, except that
+// each non-nil interface value is encoded as a typedElement naming its
+// concrete type.
+func typed(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() != reflect.Interface &&
+		(v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType)) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		e := v.Elem()
+		t := e.Type()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return typedElement{Type: t.Name(), Value: typed(e)}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return typed(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		typedFields(v, fields)
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 || (v.Kind() == reflect.Slice && v.IsNil()) {
+			return v.Interface()
+		}
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			elems[i] = typed(v.Index(i))
+		}
+		return elems
+	default:
+		return v.Interface()
+	}
+}
+
+// typedFields adds the exported fields of struct v to fields, promoting the
+// fields of embedded structs as encoding/json does.
+func typedFields(v reflect.Value, fields map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if f.Anonymous {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				typedFields(fv, fields)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		fields[f.Name] = typed(fv)
+	}
+}
@@ -1,14 +1,20 @@
 package bgpls
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 )
 
 // ErrCollectorStopped is returned when an operation is not valid due to the collector being stopped
 var ErrCollectorStopped = errors.New("collector is stopped")
 
+// ErrNeighborExists is returned when adding a neighbor whose address is already configured
+var ErrNeighborExists = errors.New("neighbor exists")
+
 // Collector is a BGP Link-State collector
 //
 // Events() returns the events channel or an error if the collector has been stopped.
@@ -18,51 +24,204 @@ var ErrCollectorStopped = errors.New("collector is stopped")
 // Config() returns the configuration of the Collector.
 //
 // AddNeighbor() initializes a new bgp-ls neighbor.
-// An error is returned if the collector is stopped or the neighbor already exists.
+// Neighbors are keyed by address, a neighbor with the same address as an existing one is a
+// duplicate regardless of Port or the form of the address, e.g. IPv4-mapped IPv6, and results
+// in ErrNeighborExists.
+// An error is returned if the collector is stopped, the neighbor already exists,
+// the neighbor config fails NeighborConfig.Validate(), or the effective router ID or local ASN
+// is invalid.
+//
+// UpdateNeighbor() applies a new configuration to an existing neighbor.
+// Changes to fields that are negotiated in the OPEN message (ASN, LocalASN, HoldTime, MinHoldTime,
+// RouterID, AddressFamilies, RouteRefresh, GracefulRestart) or that affect the transport (Port)
+// reset the neighbor, other changes are applied in place without dropping the session.
+// The names of the fields that caused a reset are returned.
+// An error is returned if the collector is stopped, the neighbor does not exist,
+// the neighbor config fails NeighborConfig.Validate(), or the effective router ID or local ASN
+// is invalid.
 //
 // DeleteNeighbor() shuts down and removes a neighbor from the collector.
+// It returns once the neighbor has reached DisabledState and its events queue, if any, has been
+// discarded, no further events are sent for the neighbor after it returns. Events sent before it
+// returns may still be buffered in the events channel, they can be recognized by Event.Neighbor().
+// A consumer may safely forget the neighbor's state once it has returned and the buffered
+// events have been read. Objects retained as stale by the neighbor are purged, resulting in an
+// EventTopologyReconciled, so the events channel must be read while it is called. The same applies
+// to UpdateNeighbor() when the neighbor is reset.
 // An error is returned if the collector is stopped or the neighbor does not exist.
 //
 // Neighbors() returns the configuration of all neighbors.
 //
+// NeighborStatuses() returns a status snapshot of all neighbors.
+//
+// WaitReady() blocks until every neighbor has sent End-of-RIB for BGP-LS at least once since it
+// was added or last reset, i.e. NeighborStatus.EndOfRIB is true for all neighbors, and the
+// corresponding EventNeighborEndOfRIB has been sent on the events channel, or dropped according
+// to the EventOverflowPolicy. A neighbor is only required to send End-of-RIB if Graceful Restart
+// was negotiated, see NeighborConfig, so a neighbor that established a session without it is
+// ready once the corresponding EventNeighborStateTransition has been sent. Neighbors added or
+// reset while waiting must also become ready, a collector without neighbors is ready.
+// ctx.Err() is returned if ctx is done first, ErrCollectorStopped if the collector is stopped.
+//
+// DroppedEvents() returns the number of events dropped according to the EventOverflowPolicy,
+// it is always 0 for EventOverflowBlock.
+//
 // Stop() stops the collector and all neighbors.
+// It is called automatically when the context passed to NewCollectorWithContext is done.
 type Collector interface {
 	Events() (<-chan Event, error)
 	Config() *CollectorConfig
 	AddNeighbor(c *NeighborConfig) error
+	UpdateNeighbor(c *NeighborConfig) ([]string, error)
 	DeleteNeighbor(address net.IP) error
 	Neighbors() ([]*NeighborConfig, error)
+	NeighborStatuses() ([]NeighborStatus, error)
+	WaitReady(ctx context.Context) error
+	DroppedEvents() uint64
 	Stop()
 }
 
 // standardCollector satisifies the Collector interface.
 type standardCollector struct {
-	running   bool
-	events    chan Event
-	config    *CollectorConfig
-	neighbors map[string]neighbor
+	running bool
+	stopped chan struct{}
+	events  chan Event
+	// neighborEvents is the channel neighbors send events on, it is events
+	// unless overflow is set
+	neighborEvents chan Event
+	overflow       *eventOverflow
+	config         *CollectorConfig
+	neighbors      map[string]neighbor
+	// changed is closed and replaced whenever neighbors is modified
+	changed chan struct{}
+	// sendLock is held by senders on neighborEvents that do not hold the
+	// collector lock, Stop acquires it exclusively to close events
+	sendLock *sync.RWMutex
 	*sync.RWMutex
 }
 
 // CollectorConfig is the configuration for the Collector.
 // EventBufferSize is the size of the buffered events channel returned from the Events() Collector method.
 // It should be set to a value appropriate from a memory consumption perspective.
-// Setting this value too low can inhibit bgp io.
+// Setting this value too low can inhibit bgp io, a neighbor does not read messages while
+// waiting to send an event. Keepalives continue to be sent to established neighbors in the
+// meantime and the local hold timer is restarted on expiry, so a slow consumer delays rather
+// than resets sessions, at the cost of detecting a failed neighbor late.
+// EventOverflowPolicy selects how events are handled while the events channel is full, the zero
+// value blocks neighbors as described above. EventOverflowDropOldest and EventOverflowDropNewest
+// trade completeness for throughput, neighbors never wait on the consumer and the number of
+// dropped events is available via Collector.DroppedEvents. They require a non-zero
+// EventBufferSize. A consumer that drops events can no longer rely on them to track topology,
+// e.g. it may miss a withdrawal.
+// ASN is the local AS number advertised to neighbors that do not set their own LocalASN.
+// RouterID is the BGP Identifier advertised to neighbors that do not set their own, it must be
+// a non-zero IPv4 address if set. Neighbors added without a RouterID require it.
+// RetainRawPathAttrs causes the on-wire encoding of each received path attribute to be
+// retained and made available via PathAttr.RawBytes, e.g. for auditing. It is applied to
+// neighbors as they are added or reset.
+// RetainRawMessages causes the on-wire encoding of each received update and notification
+// message, including the message header, to be retained and made available via
+// UpdateMessage.RawBytes and NotificationMessage.RawBytes, e.g. to compare a decoded message
+// against the wire when debugging. A received message of any type that fails to decode results
+// in an EventNeighborErr whose Err is a *DecodeError retaining its encoding. It is applied to
+// neighbors as they are added or reset.
+// NeighborEventQueueSize is optional, if set each neighbor queues up to NeighborEventQueueSize
+// events while the events channel is full, so a chatty neighbor does not stall on a buffer
+// shared with other neighbors. Consecutive state transitions in a neighbor's queue are coalesced
+// into the most recent one, e.g. a flapping neighbor results in a single transition to its
+// current state rather than one per intermediate state, the consumer does not observe the
+// intermediate states. Update and other events are never coalesced or dropped, the neighbor
+// applies backpressure once its queue is full. Queued events are discarded when the neighbor is
+// deleted or reset. It is applied to neighbors as they are added or reset.
 type CollectorConfig struct {
-	ASN             uint32
-	RouterID        net.IP
-	EventBufferSize uint64
+	ASN                    uint32
+	RouterID               net.IP
+	EventBufferSize        uint64
+	EventOverflowPolicy    EventOverflowPolicy
+	RetainRawPathAttrs     bool
+	RetainRawMessages      bool
+	NeighborEventQueueSize uint64
+}
+
+// EventOverflowPolicy selects how events are handled while the events channel
+// is full.
+type EventOverflowPolicy uint8
+
+// EventOverflowPolicy values
+const (
+	// EventOverflowBlock blocks the neighbor until the event is sent.
+	EventOverflowBlock EventOverflowPolicy = iota
+	// EventOverflowDropOldest drops the oldest buffered event to make room.
+	EventOverflowDropOldest
+	// EventOverflowDropNewest drops the event that does not fit.
+	EventOverflowDropNewest
+)
+
+func (p EventOverflowPolicy) String() string {
+	switch p {
+	case EventOverflowBlock:
+		return "block"
+	case EventOverflowDropOldest:
+		return "drop-oldest"
+	case EventOverflowDropNewest:
+		return "drop-newest"
+	default:
+		return "unknown"
+	}
 }
 
 // NewCollector creates a Collector.
 func NewCollector(config *CollectorConfig) (Collector, error) {
+	return NewCollectorWithContext(context.Background(), config)
+}
+
+// NewCollectorWithContext creates a Collector that is stopped when ctx is done.
+// An error is returned if config.RouterID is set and invalid, or if
+// config.EventOverflowPolicy is invalid or drops events without an
+// EventBufferSize.
+func NewCollectorWithContext(ctx context.Context, config *CollectorConfig) (Collector, error) {
+	if config.RouterID != nil {
+		err := validateRouterID(config.RouterID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch config.EventOverflowPolicy {
+	case EventOverflowBlock:
+	case EventOverflowDropOldest, EventOverflowDropNewest:
+		if config.EventBufferSize == 0 {
+			return nil, fmt.Errorf("event overflow policy %s requires a non-zero event buffer size", config.EventOverflowPolicy)
+		}
+	default:
+		return nil, errors.New("invalid event overflow policy")
+	}
+
 	c := &standardCollector{
 		running:   true,
+		stopped:   make(chan struct{}),
 		events:    make(chan Event, config.EventBufferSize),
 		config:    config,
 		neighbors: make(map[string]neighbor),
+		changed:   make(chan struct{}),
+		sendLock:  &sync.RWMutex{},
 		RWMutex:   &sync.RWMutex{},
 	}
+	c.neighborEvents = c.events
+	if config.EventOverflowPolicy != EventOverflowBlock {
+		c.overflow = newEventOverflow(c.events, config.EventOverflowPolicy)
+		c.neighborEvents = c.overflow.in
+	}
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.Stop()
+			case <-c.stopped:
+			}
+		}()
+	}
 
 	return c, nil
 }
@@ -90,17 +249,126 @@ func (c *standardCollector) AddNeighbor(config *NeighborConfig) error {
 		return ErrCollectorStopped
 	}
 
+	err := config.Validate()
+	if err != nil {
+		return err
+	}
+
 	_, exists := c.neighbors[config.Address.String()]
 	if exists {
-		return errors.New("neighbor exists")
+		return ErrNeighborExists
+	}
+
+	routerID := c.routerID(config)
+	err = validateRouterID(routerID)
+	if err != nil {
+		return err
+	}
+	if c.localASN(config) == 0 {
+		return errors.New("local ASN cannot be 0")
 	}
 
-	n := newNeighbor(c.config.RouterID, c.config.ASN, config, c.events)
+	n := newNeighbor(routerID, c.localASN(config), c.config.RetainRawPathAttrs, c.config.RetainRawMessages, c.config.NeighborEventQueueSize, config, c.neighborEvents)
 	c.neighbors[config.Address.String()] = n
+	c.neighborsChanged()
 
 	return nil
 }
 
+// neighborsChanged wakes WaitReady callers, c must be locked for writing.
+func (c *standardCollector) neighborsChanged() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// routerID returns the BGP Identifier to advertise to the neighbor
+func (c *standardCollector) routerID(config *NeighborConfig) net.IP {
+	if config.RouterID != nil {
+		return config.RouterID
+	}
+	return c.config.RouterID
+}
+
+// localASN returns the AS number to advertise to the neighbor
+func (c *standardCollector) localASN(config *NeighborConfig) uint32 {
+	if config.LocalASN != 0 {
+		return config.LocalASN
+	}
+	return c.config.ASN
+}
+
+func (c *standardCollector) UpdateNeighbor(config *NeighborConfig) ([]string, error) {
+	// sent once the lock is released, see sendPurged
+	var purged Event
+	defer func() { c.sendPurged(purged) }()
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.running {
+		return nil, ErrCollectorStopped
+	}
+
+	n, exists := c.neighbors[config.Address.String()]
+	if !exists {
+		return nil, errors.New("neighbor does not exist")
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	routerID := c.routerID(config)
+	err = validateRouterID(routerID)
+	if err != nil {
+		return nil, err
+	}
+	if c.localASN(config) == 0 {
+		return nil, errors.New("local ASN cannot be 0")
+	}
+
+	old := n.config()
+	reset := make([]string, 0)
+	if old.ASN != config.ASN {
+		reset = append(reset, "ASN")
+	}
+	if c.localASN(old) != c.localASN(config) {
+		reset = append(reset, "LocalASN")
+	}
+	if old.HoldTime != config.HoldTime {
+		reset = append(reset, "HoldTime")
+	}
+	if old.MinHoldTime != config.MinHoldTime {
+		reset = append(reset, "MinHoldTime")
+	}
+	if !c.routerID(old).Equal(routerID) {
+		reset = append(reset, "RouterID")
+	}
+	if !equalAfiSafis(old.AddressFamilies, config.AddressFamilies) {
+		reset = append(reset, "AddressFamilies")
+	}
+	if old.RouteRefresh != config.RouteRefresh {
+		reset = append(reset, "RouteRefresh")
+	}
+	if old.GracefulRestart != config.GracefulRestart {
+		reset = append(reset, "GracefulRestart")
+	}
+	if old.port() != config.port() {
+		reset = append(reset, "Port")
+	}
+
+	if len(reset) == 0 {
+		n.setConfig(config)
+		return reset, nil
+	}
+
+	purged = c.terminateNeighbor(n)
+	c.neighbors[config.Address.String()] = newNeighbor(routerID, c.localASN(config), c.config.RetainRawPathAttrs, c.config.RetainRawMessages, c.config.NeighborEventQueueSize, config, c.neighborEvents)
+	c.neighborsChanged()
+
+	return reset, nil
+}
+
 func (c *standardCollector) Neighbors() ([]*NeighborConfig, error) {
 	c.RLock()
 	defer c.RUnlock()
@@ -117,7 +385,26 @@ func (c *standardCollector) Neighbors() ([]*NeighborConfig, error) {
 	return configs, nil
 }
 
+func (c *standardCollector) NeighborStatuses() ([]NeighborStatus, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	if !c.running {
+		return nil, ErrCollectorStopped
+	}
+
+	statuses := make([]NeighborStatus, 0, len(c.neighbors))
+	for _, n := range c.neighbors {
+		statuses = append(statuses, n.status())
+	}
+
+	return statuses, nil
+}
+
 func (c *standardCollector) DeleteNeighbor(address net.IP) error {
+	// sent once the lock is released, see sendPurged
+	var purged Event
+	defer func() { c.sendPurged(purged) }()
 	c.Lock()
 	defer c.Unlock()
 
@@ -130,12 +417,80 @@ func (c *standardCollector) DeleteNeighbor(address net.IP) error {
 		return errors.New("neighbor does not exist")
 	}
 
-	n.terminate()
+	purged = c.terminateNeighbor(n)
+	if c.overflow != nil {
+		// events received from the neighbor must reach the events channel
+		// before returning
+		c.overflow.flush()
+	}
 	delete(c.neighbors, address.String())
+	c.neighborsChanged()
 
 	return nil
 }
 
+// terminateNeighbor terminates n and purges the objects it retained as stale,
+// as they are no longer tracked by any neighbor. The resulting
+// EventTopologyReconciled is returned for sendPurged, or nil if there are none.
+func (c *standardCollector) terminateNeighbor(n neighbor) Event {
+	n.terminate()
+	return n.purgeStale(false)
+}
+
+// sendPurged sends e, the result of terminateNeighbor, if it is not nil. It must
+// be called without holding the collector lock so that a slow consumer does
+// not block other methods. It returns once e has reached the events channel,
+// or been dropped according to the EventOverflowPolicy, or the collector is
+// stopped.
+func (c *standardCollector) sendPurged(e Event) {
+	if e == nil {
+		return
+	}
+
+	c.sendLock.RLock()
+	defer c.sendLock.RUnlock()
+	select {
+	case c.neighborEvents <- e:
+	case <-c.stopped:
+		return
+	}
+	if c.overflow != nil {
+		c.overflow.flush()
+	}
+}
+
+func (c *standardCollector) WaitReady(ctx context.Context) error {
+	for {
+		c.RLock()
+		if !c.running {
+			c.RUnlock()
+			return ErrCollectorStopped
+		}
+		var pending <-chan struct{}
+		for _, n := range c.neighbors {
+			if ready := n.ready(); !isClosed(ready) {
+				pending = ready
+				break
+			}
+		}
+		changed := c.changed
+		c.RUnlock()
+
+		if pending == nil {
+			return nil
+		}
+
+		select {
+		case <-pending:
+		case <-changed:
+		case <-c.stopped:
+			return ErrCollectorStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func (c *standardCollector) Stop() {
 	c.Lock()
 	defer c.Unlock()
@@ -154,7 +509,21 @@ func (c *standardCollector) Stop() {
 		}()
 	}
 	wg.Wait()
+	if c.overflow != nil {
+		c.overflow.terminate()
+	}
 
 	c.running = false
+	close(c.stopped)
+	// senders without the collector lock return once stopped is closed
+	c.sendLock.Lock()
 	close(c.events)
+	c.sendLock.Unlock()
+}
+
+func (c *standardCollector) DroppedEvents() uint64 {
+	if c.overflow == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.overflow.dropped)
 }
@@ -1,6 +1,7 @@
 package bgpls
 
 import (
+	"context"
 	"net"
 	"testing"
 	"time"
@@ -35,7 +36,22 @@ func TestCollector(t *testing.T) {
 	}
 
 	err = c.AddNeighbor(neighborConfig)
-	assert.NotNil(t, err)
+	assert.Equal(t, err, ErrNeighborExists)
+
+	// same address on another port or in another form
+	duplicate := *neighborConfig
+	duplicate.Port = 1179
+	err = c.AddNeighbor(&duplicate)
+	assert.Equal(t, err, ErrNeighborExists)
+	for _, address := range []net.IP{
+		net.ParseIP("127.0.0.1").To4(),
+		net.ParseIP("::ffff:127.0.0.1"),
+	} {
+		duplicate = *neighborConfig
+		duplicate.Address = address
+		err = c.AddNeighbor(&duplicate)
+		assert.Equal(t, err, ErrNeighborExists)
+	}
 
 	_, err = c.Events()
 	if err != nil {
@@ -49,6 +65,15 @@ func TestCollector(t *testing.T) {
 	assert.Len(t, neighbors, 1)
 	assert.Equal(t, neighbors[0], neighborConfig)
 
+	statuses, err := c.NeighborStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, statuses[0].Config, neighborConfig)
+		assert.Equal(t, statuses[0].HoldTime, neighborConfig.HoldTime)
+	}
+
 	err = c.DeleteNeighbor(net.ParseIP("127.0.0.1"))
 	if err != nil {
 		t.Fatal(err)
@@ -68,6 +93,9 @@ func TestCollector(t *testing.T) {
 	_, err = c.Neighbors()
 	assert.Equal(t, err, ErrCollectorStopped)
 
+	_, err = c.NeighborStatuses()
+	assert.Equal(t, err, ErrCollectorStopped)
+
 	err = c.DeleteNeighbor(net.ParseIP("127.0.0.2"))
 	assert.Equal(t, err, ErrCollectorStopped)
 
@@ -82,3 +110,694 @@ func TestCollector(t *testing.T) {
 	c.Stop()
 	c.Stop()
 }
+
+func TestCollectorNeighborRouterID(t *testing.T) {
+	c, err := NewCollector(&CollectorConfig{
+		ASN:             1234,
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	// no collector or neighbor router ID
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+	})
+	assert.NotNil(t, err)
+
+	// zero neighbor router ID
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+		RouterID: net.ParseIP("0.0.0.0"),
+	})
+	assert.NotNil(t, err)
+
+	// ipv6 neighbor router ID
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+		RouterID: net.ParseIP("2001:db8::1"),
+	})
+	assert.NotNil(t, err)
+
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+		RouterID: net.ParseIP("172.16.1.106"),
+	})
+	assert.Nil(t, err)
+
+	// invalid collector router ID
+	_, err = NewCollector(&CollectorConfig{
+		ASN:      1234,
+		RouterID: net.ParseIP("2001:db8::1"),
+	})
+	assert.NotNil(t, err)
+}
+
+func TestCollectorNeighborLocalASN(t *testing.T) {
+	c, err := NewCollector(&CollectorConfig{
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	// no collector or neighbor local ASN
+	neighborConfig := &NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+	}
+	err = c.AddNeighbor(neighborConfig)
+	assert.NotNil(t, err)
+
+	neighborConfig.LocalASN = 5678
+	err = c.AddNeighbor(neighborConfig)
+	assert.Nil(t, err)
+
+	updated := *neighborConfig
+	updated.LocalASN = 0
+	_, err = c.UpdateNeighbor(&updated)
+	assert.NotNil(t, err)
+}
+
+func TestCollectorWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c, err := NewCollectorWithContext(ctx, &CollectorConfig{
+		ASN:             1234,
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := c.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	// the events channel closes once the collector has stopped
+	for range events {
+	}
+
+	_, err = c.Events()
+	assert.Equal(t, err, ErrCollectorStopped)
+}
+
+func TestCollectorEventOverflowPolicy(t *testing.T) {
+	_, err := NewCollector(&CollectorConfig{
+		ASN:                 1234,
+		RouterID:            net.ParseIP("172.16.1.106"),
+		EventOverflowPolicy: EventOverflowDropOldest,
+	})
+	assert.NotNil(t, err)
+
+	_, err = NewCollector(&CollectorConfig{
+		ASN:                 1234,
+		RouterID:            net.ParseIP("172.16.1.106"),
+		EventBufferSize:     1,
+		EventOverflowPolicy: EventOverflowDropNewest + 1,
+	})
+	assert.NotNil(t, err)
+
+	c, err := NewCollector(&CollectorConfig{
+		ASN:                 1234,
+		RouterID:            net.ParseIP("172.16.1.106"),
+		EventBufferSize:     1,
+		EventOverflowPolicy: EventOverflowDropNewest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	// the neighbor transitions through idle, connect and active without a
+	// consumer, the events that do not fit are dropped
+	address := net.ParseIP("127.0.0.1")
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  address,
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+		Port:     1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for c.DroppedEvents() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for dropped events")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err = c.DeleteNeighbor(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := <-events
+	if assert.IsType(t, &EventNeighborStateTransition{}, e) {
+		assert.Equal(t, IdleState, e.(*EventNeighborStateTransition).State)
+	}
+}
+
+func TestCollectorUpdateNeighbor(t *testing.T) {
+	c, err := NewCollector(&CollectorConfig{
+		ASN:             1234,
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	neighborConfig := &NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+	}
+
+	// neighbor does not exist
+	_, err = c.UpdateNeighbor(neighborConfig)
+	assert.NotNil(t, err)
+
+	err = c.AddNeighbor(neighborConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in place
+	updated := *neighborConfig
+	updated.PeerRouterID = net.ParseIP("127.0.0.1")
+	reset, err := c.UpdateNeighbor(&updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, reset, 0)
+
+	// requires reset
+	resetConfig := updated
+	resetConfig.ASN = 4321
+	resetConfig.HoldTime = time.Second * 90
+	resetConfig.MinHoldTime = time.Second * 9
+	resetConfig.RouterID = net.ParseIP("172.16.1.107")
+	reset, err = c.UpdateNeighbor(&resetConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reset, []string{"ASN", "HoldTime", "MinHoldTime", "RouterID"})
+
+	// explicit default port does not require reset
+	portConfig := resetConfig
+	portConfig.Port = 179
+	reset, err = c.UpdateNeighbor(&portConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, reset, 0)
+
+	nonDefaultPortConfig := portConfig
+	nonDefaultPortConfig.Port = 1790
+	reset, err = c.UpdateNeighbor(&nonDefaultPortConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reset, []string{"Port"})
+
+	familiesConfig := nonDefaultPortConfig
+	familiesConfig.AddressFamilies = []AfiSafi{{Afi: 2, Safi: 1}}
+	reset, err = c.UpdateNeighbor(&familiesConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reset, []string{"AddressFamilies"})
+
+	routeRefreshConfig := familiesConfig
+	routeRefreshConfig.RouteRefresh = true
+	reset, err = c.UpdateNeighbor(&routeRefreshConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reset, []string{"RouteRefresh"})
+
+	gracefulRestartConfig := routeRefreshConfig
+	gracefulRestartConfig.GracefulRestart = true
+	reset, err = c.UpdateNeighbor(&gracefulRestartConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reset, []string{"GracefulRestart"})
+
+	// the collector ASN is the default local ASN
+	localASNConfig := gracefulRestartConfig
+	localASNConfig.LocalASN = 1234
+	reset, err = c.UpdateNeighbor(&localASNConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, reset, 0)
+	overrideASNConfig := localASNConfig
+	overrideASNConfig.LocalASN = 5678
+	reset, err = c.UpdateNeighbor(&overrideASNConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reset, []string{"LocalASN"})
+
+	// invalid router ID
+	invalidConfig := resetConfig
+	invalidConfig.RouterID = net.ParseIP("0.0.0.0")
+	_, err = c.UpdateNeighbor(&invalidConfig)
+	assert.NotNil(t, err)
+
+	neighbors, err := c.Neighbors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, neighbors, 1) {
+		assert.Equal(t, neighbors[0].ASN, uint32(4321))
+	}
+
+	c.Stop()
+	_, err = c.UpdateNeighbor(&resetConfig)
+	assert.Equal(t, err, ErrCollectorStopped)
+}
+
+func TestCollectorNeighborPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	c, err := NewCollector(&CollectorConfig{
+		ASN:             1234,
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+		Port:     uint16(ln.Addr().(*net.TCPAddr).Port),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestCollectorDeleteNeighborEvents(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	for _, queueSize := range []uint64{0, 4} {
+		c, err := NewCollector(&CollectorConfig{
+			ASN:                    1234,
+			RouterID:               net.ParseIP("172.16.1.106"),
+			NeighborEventQueueSize: queueSize,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.AddNeighbor(&NeighborConfig{
+			Address:  net.ParseIP("127.0.0.1"),
+			ASN:      1234,
+			HoldTime: time.Second * 30,
+			Port:     uint16(ln.Addr().(*net.TCPAddr).Port),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events, err := c.Events()
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-events
+
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the neighbor is blocked sending events
+		err = c.DeleteNeighbor(net.ParseIP("127.0.0.1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case e := <-events:
+			t.Errorf("unexpected event after delete: %s", e.Type())
+		case <-time.After(time.Millisecond * 100):
+		}
+
+		conn.Close()
+		c.Stop()
+	}
+}
+
+// staleNeighbor is a neighbor that retained objects as stale.
+type staleNeighbor struct {
+	neighbor
+	stale []string
+}
+
+func (n *staleNeighbor) terminate() {}
+
+func (n *staleNeighbor) config() *NeighborConfig {
+	return &NeighborConfig{}
+}
+
+func (n *staleNeighbor) purgeStale(expired bool) Event {
+	if n.stale == nil {
+		return nil
+	}
+	e := newEventTopologyReconciled(&NeighborConfig{}, n.stale, expired)
+	n.stale = nil
+	return e
+}
+
+func TestCollectorDeleteNeighborStale(t *testing.T) {
+	c, err := NewCollector(&CollectorConfig{
+		ASN:             1234,
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	sc := c.(*standardCollector)
+
+	address := net.ParseIP("127.0.0.1")
+	sc.Lock()
+	sc.neighbors[address.String()] = &staleNeighbor{stale: []string{"a", "b"}}
+	sc.neighborsChanged()
+	sc.Unlock()
+
+	err = c.DeleteNeighbor(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := c.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if assert.IsType(t, &EventTopologyReconciled{}, e) {
+			assert.Equal(t, []string{"a", "b"}, e.(*EventTopologyReconciled).Purged)
+			assert.False(t, e.(*EventTopologyReconciled).Expired)
+		}
+	default:
+		t.Fatal("stale objects not purged on delete")
+	}
+
+	// the collector is not locked while the consumer is slow to read
+	sc.Lock()
+	sc.neighbors[address.String()] = &staleNeighbor{stale: []string{"a"}}
+	sc.events <- &EventNeighborErr{}
+	sc.Unlock()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.DeleteNeighbor(address)
+	}()
+	waitNeighbors := time.Now().Add(time.Second * 5)
+	for {
+		neighbors, err := c.Neighbors()
+		assert.Nil(t, err)
+		if len(neighbors) == 0 {
+			break
+		}
+		if time.Now().After(waitNeighbors) {
+			t.Fatal("timed out waiting for neighbor deletion")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("delete returned before the purge event was sent: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+	assert.IsType(t, &EventNeighborErr{}, <-events)
+	assert.IsType(t, &EventTopologyReconciled{}, <-events)
+	assert.Nil(t, <-done)
+}
+
+func TestCollectorNeighborIPv6(t *testing.T) {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("ipv6 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+
+	c, err := NewCollector(&CollectorConfig{
+		ASN:             1234,
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	// ipv6 router ID with ipv6 transport
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("::1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+		RouterID: net.ParseIP("2001:db8::1"),
+	})
+	assert.NotNil(t, err)
+
+	err = c.AddNeighbor(&NeighborConfig{
+		Address:  net.ParseIP("::1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+		Port:     uint16(ln.Addr().(*net.TCPAddr).Port),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msgs := make([]byte, 4096)
+	n, err := conn.Read(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := messagesFromBytes(msgs[:n], decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, m, 1) {
+		if assert.IsType(t, &openMessage{}, m[0]) {
+			assert.Equal(t, bgpIDToIP(m[0].(*openMessage).bgpID), net.ParseIP("172.16.1.106").To4())
+		}
+	}
+}
+
+func TestCollectorNeighborAddress(t *testing.T) {
+	c, err := NewCollector(&CollectorConfig{
+		ASN:             1234,
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	for _, address := range []net.IP{nil, {1, 2, 3}, net.ParseIP("0.0.0.0"), net.ParseIP("::")} {
+		err = c.AddNeighbor(&NeighborConfig{
+			Address:  address,
+			ASN:      1234,
+			HoldTime: time.Second * 30,
+		})
+		assert.NotNil(t, err)
+	}
+}
+
+func TestNeighborConfigValidate(t *testing.T) {
+	valid := NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      1234,
+		HoldTime: time.Second * 30,
+	}
+	assert.Nil(t, valid.Validate())
+
+	cases := []struct {
+		name   string
+		modify func(c *NeighborConfig)
+	}{
+		{"nil address", func(c *NeighborConfig) { c.Address = nil }},
+		{"zero asn", func(c *NeighborConfig) { c.ASN = 0 }},
+		{"zero hold time", func(c *NeighborConfig) { c.HoldTime = 0 }},
+		{"negative hold time", func(c *NeighborConfig) { c.HoldTime = -time.Second }},
+		{"hold time < 3s", func(c *NeighborConfig) { c.HoldTime = time.Second * 2 }},
+		{"hold time overflow", func(c *NeighborConfig) { c.HoldTime = time.Second * 65536 }},
+		{"min hold time < 3s", func(c *NeighborConfig) { c.MinHoldTime = time.Second * 2 }},
+		{"min hold time > hold time", func(c *NeighborConfig) { c.MinHoldTime = time.Second * 31 }},
+		{"negative open timeout", func(c *NeighborConfig) { c.OpenTimeout = -time.Second }},
+		{"zero router id", func(c *NeighborConfig) { c.RouterID = net.ParseIP("0.0.0.0") }},
+		{"ipv6 peer router id", func(c *NeighborConfig) { c.PeerRouterID = net.ParseIP("2001:db8::1") }},
+		{"invalid optional attr action", func(c *NeighborConfig) { c.UpdateErrorPolicy.OptionalAttr = 3 }},
+		{"invalid mp reach action", func(c *NeighborConfig) { c.UpdateErrorPolicy.MpReach = 3 }},
+		{"invalid duplicate attr action", func(c *NeighborConfig) { c.UpdateErrorPolicy.DuplicateAttr = 3 }},
+	}
+
+	c, err := NewCollector(&CollectorConfig{
+		ASN:             1234,
+		RouterID:        net.ParseIP("172.16.1.106"),
+		EventBufferSize: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	for _, tc := range cases {
+		config := valid
+		tc.modify(&config)
+		assert.NotNil(t, config.Validate(), tc.name)
+		assert.NotNil(t, c.AddNeighbor(&config), tc.name)
+	}
+
+	err = c.AddNeighbor(&valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := valid
+	invalid.ASN = 0
+	_, err = c.UpdateNeighbor(&invalid)
+	assert.NotNil(t, err)
+}
+
+// readyNeighbor is a neighbor whose End-of-RIB is signaled by the test.
+type readyNeighbor struct {
+	neighbor
+	eor chan struct{}
+}
+
+func (n *readyNeighbor) ready() <-chan struct{} {
+	return n.eor
+}
+
+func (n *readyNeighbor) terminate() {}
+
+func TestCollectorWaitReady(t *testing.T) {
+	c, err := NewCollector(&CollectorConfig{
+		ASN:      1234,
+		RouterID: net.ParseIP("172.16.1.106"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := c.(*standardCollector)
+
+	// no neighbors
+	assert.Nil(t, c.WaitReady(context.Background()))
+
+	a := &readyNeighbor{eor: make(chan struct{})}
+	b := &readyNeighbor{eor: make(chan struct{})}
+	sc.Lock()
+	sc.neighbors["a"] = a
+	sc.neighbors["b"] = b
+	sc.neighborsChanged()
+	sc.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.WaitReady(ctx))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.WaitReady(context.Background())
+	}()
+
+	close(a.eor)
+	select {
+	case err := <-done:
+		t.Fatalf("ready before all neighbors sent end-of-rib: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// deleting the pending neighbor makes the collector ready
+	sc.Lock()
+	delete(sc.neighbors, "b")
+	sc.neighborsChanged()
+	sc.Unlock()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for collector ready")
+	}
+
+	sc.Lock()
+	sc.neighbors["b"] = b
+	sc.neighborsChanged()
+	sc.Unlock()
+	go func() {
+		done <- c.WaitReady(context.Background())
+	}()
+	c.Stop()
+	select {
+	case err := <-done:
+		assert.Equal(t, ErrCollectorStopped, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for collector stop")
+	}
+	assert.Equal(t, ErrCollectorStopped, c.WaitReady(context.Background()))
+}
@@ -1,6 +1,11 @@
 package bgpls
 
-import "time"
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Event is a Collector event associated with a neighbor.
 //
@@ -9,6 +14,9 @@ import "time"
 // Timestamp() returns the time at which the event occurred.
 //
 // Type() returns the event type.
+//
+// EventUpdateMessage and EventNotificationMessage return the message carried by
+// an event, if any, without a type switch on the concrete event types.
 type Event interface {
 	Neighbor() *NeighborConfig
 	Timestamp() time.Time
@@ -26,6 +34,15 @@ const (
 	EventTypeNeighborStateTransition
 	EventTypeNeighborUpdateReceived
 	EventTypeNeighborNotificationReceived
+	EventTypeNeighborTimersNegotiated
+	EventTypeNeighborUpdateWarning
+	EventTypeNeighborCapabilityMismatch
+	EventTypeNeighborRouteRefreshRequested
+	EventTypeNeighborBeginRouteRefresh
+	EventTypeNeighborEndOfRIB
+	EventTypeTopologyStale
+	EventTypeTopologyReconciled
+	EventTypeNeighborConnected
 )
 
 func (e EventType) String() string {
@@ -40,11 +57,223 @@ func (e EventType) String() string {
 		return "received update message from neighbor"
 	case EventTypeNeighborNotificationReceived:
 		return "received notification message from neighbor"
+	case EventTypeNeighborTimersNegotiated:
+		return "neighbor timers negotiated"
+	case EventTypeNeighborUpdateWarning:
+		return "received questionable update message from neighbor"
+	case EventTypeNeighborCapabilityMismatch:
+		return "neighbor multiprotocol capabilities mismatch"
+	case EventTypeNeighborRouteRefreshRequested:
+		return "neighbor requested route refresh"
+	case EventTypeNeighborBeginRouteRefresh:
+		return "neighbor began route refresh"
+	case EventTypeNeighborEndOfRIB:
+		return "neighbor sent end-of-rib"
+	case EventTypeTopologyStale:
+		return "neighbor topology stale"
+	case EventTypeTopologyReconciled:
+		return "neighbor topology reconciled"
+	case EventTypeNeighborConnected:
+		return "neighbor connected"
 	default:
 		return "unknown event type"
 	}
 }
 
+// eventQueue forwards events received on in to out, queueing up to size events
+// while out is full. Consecutive state transitions in the queue are coalesced
+// into the most recent one, unless either is to EstablishedState, IdleState or
+// DisabledState, so the consumer always observes a session going up or down.
+type eventQueue struct {
+	in   chan Event
+	out  chan Event
+	size int
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newEventQueue(out chan Event, size int) *eventQueue {
+	q := &eventQueue{
+		in:   make(chan Event),
+		out:  out,
+		size: size,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go q.run()
+
+	return q
+}
+
+func (q *eventQueue) run() {
+	defer close(q.done)
+
+	var queue []Event
+	for {
+		// receiving is paused while the queue is full
+		var in chan Event
+		if len(queue) < q.size {
+			in = q.in
+		}
+
+		var out chan Event
+		var head Event
+		if len(queue) > 0 {
+			out = q.out
+			head = queue[0]
+		}
+
+		select {
+		case e := <-in:
+			if len(queue) > 0 && isCoalescable(e) && isCoalescable(queue[len(queue)-1]) {
+				queue[len(queue)-1] = e
+				continue
+			}
+			queue = append(queue, e)
+		case out <- head:
+			queue[0] = nil
+			queue = queue[1:]
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// terminate stops forwarding, queued events are discarded.
+func (q *eventQueue) terminate() {
+	q.once.Do(func() {
+		close(q.stop)
+		<-q.done
+	})
+}
+
+// eventOverflow forwards events received on in to out, dropping events
+// according to policy while out is full. It is the only sender on out.
+type eventOverflow struct {
+	// dropped is accessed atomically
+	dropped uint64
+	in      chan Event
+	out     chan Event
+	policy  EventOverflowPolicy
+	flushCh chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newEventOverflow(out chan Event, policy EventOverflowPolicy) *eventOverflow {
+	o := &eventOverflow{
+		in:      make(chan Event),
+		out:     out,
+		policy:  policy,
+		flushCh: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go o.run()
+
+	return o
+}
+
+func (o *eventOverflow) run() {
+	defer close(o.done)
+
+	for {
+		select {
+		case e := <-o.in:
+			o.forward(e)
+		case flushed := <-o.flushCh:
+			close(flushed)
+		case <-o.stop:
+			return
+		}
+	}
+}
+
+func (o *eventOverflow) forward(e Event) {
+	select {
+	case o.out <- e:
+		return
+	default:
+	}
+
+	switch o.policy {
+	case EventOverflowDropOldest:
+		select {
+		case <-o.out:
+			atomic.AddUint64(&o.dropped, 1)
+		default:
+			// the consumer made room in the meantime
+		}
+		// out is buffered and o is its only sender, this does not block
+		o.out <- e
+	default:
+		atomic.AddUint64(&o.dropped, 1)
+	}
+}
+
+// flush returns once every event received on in so far has been forwarded or
+// dropped.
+func (o *eventOverflow) flush() {
+	flushed := make(chan struct{})
+	select {
+	case o.flushCh <- flushed:
+		<-flushed
+	case <-o.done:
+	}
+}
+
+// terminate stops forwarding, senders on in must have stopped.
+func (o *eventOverflow) terminate() {
+	o.once.Do(func() {
+		close(o.stop)
+		<-o.done
+	})
+}
+
+// EventUpdateMessage returns the update message carried by e. Update messages
+// are carried by EventNeighborUpdateReceived and EventNeighborUpdateWarning.
+// The returned bool is false for all other events.
+func EventUpdateMessage(e Event) (*UpdateMessage, bool) {
+	switch e := e.(type) {
+	case *EventNeighborUpdateReceived:
+		return e.Message, e.Message != nil
+	case *EventNeighborUpdateWarning:
+		return e.Message, e.Message != nil
+	default:
+		return nil, false
+	}
+}
+
+// EventNotificationMessage returns the notification message carried by e.
+// Notification messages are carried by EventNeighborNotificationReceived. The
+// returned bool is false for all other events.
+func EventNotificationMessage(e Event) (*NotificationMessage, bool) {
+	n, ok := e.(*EventNeighborNotificationReceived)
+	if !ok || n.Message == nil {
+		return nil, false
+	}
+	return n.Message, true
+}
+
+// isCoalescable returns true if e is a state transition that may be replaced by
+// a subsequent one in an eventQueue.
+func isCoalescable(e Event) bool {
+	t, ok := e.(*EventNeighborStateTransition)
+	if !ok {
+		return false
+	}
+	switch t.State {
+	case EstablishedState, IdleState, DisabledState:
+		return false
+	default:
+		return true
+	}
+}
+
 // BaseEvent is included in every Event
 type BaseEvent struct {
 	t time.Time
@@ -61,6 +290,10 @@ func (b *BaseEvent) Neighbor() *NeighborConfig {
 	return b.n
 }
 
+func (b *BaseEvent) setTimestamp(t time.Time) {
+	b.t = t
+}
+
 // EventNeighborErr is generated when a neighbor encounters an error
 type EventNeighborErr struct {
 	BaseEvent
@@ -101,10 +334,13 @@ func newEventNeighborHoldTimerExpired(c *NeighborConfig) Event {
 	}
 }
 
-// EventNeighborStateTransition is generated when a neighbor's fsm transitions to a new state
+// EventNeighborStateTransition is generated when a neighbor's fsm transitions to a new state.
+// PeerRouterID is the BGP Identifier advertised by the neighbor, it is only set
+// for transitions to OpenConfirmState and EstablishedState.
 type EventNeighborStateTransition struct {
 	BaseEvent
-	State FSMState
+	State        FSMState
+	PeerRouterID net.IP
 }
 
 // Type returns the appropriate EventType for EventNeighborStateTransition
@@ -112,20 +348,24 @@ func (e *EventNeighborStateTransition) Type() EventType {
 	return EventTypeNeighborStateTransition
 }
 
-func newEventNeighborStateTransition(c *NeighborConfig, s FSMState) Event {
+func newEventNeighborStateTransition(c *NeighborConfig, s FSMState, peerRouterID net.IP) Event {
 	return &EventNeighborStateTransition{
 		BaseEvent: BaseEvent{
 			t: time.Now(),
 			n: c,
 		},
-		State: s,
+		State:        s,
+		PeerRouterID: peerRouterID,
 	}
 }
 
-// EventNeighborUpdateReceived is generated when an update message is received
+// EventNeighborUpdateReceived is generated when an update message is received.
+// PeerRouterID is the BGP Identifier advertised by the neighbor.
+// Message.RawBytes() returns the message as received if CollectorConfig.RetainRawMessages is set.
 type EventNeighborUpdateReceived struct {
 	BaseEvent
-	Message *UpdateMessage
+	PeerRouterID net.IP
+	Message      *UpdateMessage
 }
 
 // Type returns the appropriate EventType for EventNeighborUpdateReceived
@@ -133,20 +373,25 @@ func (e *EventNeighborUpdateReceived) Type() EventType {
 	return EventTypeNeighborUpdateReceived
 }
 
-func newEventNeighborUpdateReceived(c *NeighborConfig, u *UpdateMessage) Event {
+func newEventNeighborUpdateReceived(c *NeighborConfig, peerRouterID net.IP, u *UpdateMessage) Event {
 	return &EventNeighborUpdateReceived{
 		BaseEvent: BaseEvent{
 			t: time.Now(),
 			n: c,
 		},
-		Message: u,
+		PeerRouterID: peerRouterID,
+		Message:      u,
 	}
 }
 
-// EventNeighborNotificationReceived is generated when a notification message is received
+// EventNeighborNotificationReceived is generated when a notification message is received.
+// ShutdownCommunication is the reason included with a cease administrative shutdown or reset,
+// it is empty if none was included or it was malformed.
+// Message.RawBytes() returns the message as received if CollectorConfig.RetainRawMessages is set.
 type EventNeighborNotificationReceived struct {
 	BaseEvent
-	Message *NotificationMessage
+	Message               *NotificationMessage
+	ShutdownCommunication string
 }
 
 // Type returns the appropriate EventType for EventNeighborNotificationReceived
@@ -155,11 +400,256 @@ func (e *EventNeighborNotificationReceived) Type() EventType {
 }
 
 func newEventNeighborNotificationReceived(c *NeighborConfig, n *NotificationMessage) Event {
-	return &EventNeighborNotificationReceived{
+	e := &EventNeighborNotificationReceived{
 		BaseEvent: BaseEvent{
 			t: time.Now(),
 			n: c,
 		},
 		Message: n,
 	}
+
+	if d, err := n.DecodedData(); err == nil {
+		if s, ok := d.(*NotifDataShutdownCommunication); ok {
+			e.ShutdownCommunication = s.Communication
+		}
+	}
+
+	return e
+}
+
+// EventNeighborConnected is generated when a TCP connection with a neighbor
+// has been established and the OPEN message sent, prior to entering
+// OpenSentState. Outbound is true if the connection was initiated by the
+// collector, which is currently always the case as it does not accept
+// connections.
+type EventNeighborConnected struct {
+	BaseEvent
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	Outbound   bool
+}
+
+// Type returns the appropriate EventType for EventNeighborConnected
+func (e *EventNeighborConnected) Type() EventType {
+	return EventTypeNeighborConnected
+}
+
+func newEventNeighborConnected(c *NeighborConfig, conn net.Conn, outbound bool) Event {
+	return &EventNeighborConnected{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+		Outbound:   outbound,
+	}
+}
+
+// EventNeighborTimersNegotiated is generated when the hold and keepalive times
+// have been negotiated with a neighbor, prior to entering OpenConfirmState
+type EventNeighborTimersNegotiated struct {
+	BaseEvent
+	HoldTime      time.Duration
+	KeepAliveTime time.Duration
+}
+
+// Type returns the appropriate EventType for EventNeighborTimersNegotiated
+func (e *EventNeighborTimersNegotiated) Type() EventType {
+	return EventTypeNeighborTimersNegotiated
+}
+
+func newEventNeighborTimersNegotiated(c *NeighborConfig, holdTime, keepAliveTime time.Duration) Event {
+	return &EventNeighborTimersNegotiated{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		HoldTime:      holdTime,
+		KeepAliveTime: keepAliveTime,
+	}
+}
+
+// EventNeighborUpdateWarning is generated when an update message fails a
+// consistency check that is not fatal to the session. It precedes the
+// associated EventNeighborUpdateReceived.
+type EventNeighborUpdateWarning struct {
+	BaseEvent
+	Err     error
+	Message *UpdateMessage
+}
+
+// Type returns the appropriate EventType for EventNeighborUpdateWarning
+func (e *EventNeighborUpdateWarning) Type() EventType {
+	return EventTypeNeighborUpdateWarning
+}
+
+func newEventNeighborUpdateWarning(c *NeighborConfig, err error, u *UpdateMessage) Event {
+	return &EventNeighborUpdateWarning{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		Err:     err,
+		Message: u,
+	}
+}
+
+// EventNeighborCapabilityMismatch is generated when a neighbor's OPEN message
+// omits a required multiprotocol capability. Missing contains the AFI/SAFIs
+// required but not advertised, Extra contains the AFI/SAFIs advertised but
+// not supported.
+type EventNeighborCapabilityMismatch struct {
+	BaseEvent
+	Missing []AfiSafi
+	Extra   []AfiSafi
+}
+
+// Type returns the appropriate EventType for EventNeighborCapabilityMismatch
+func (e *EventNeighborCapabilityMismatch) Type() EventType {
+	return EventTypeNeighborCapabilityMismatch
+}
+
+func newEventNeighborCapabilityMismatch(c *NeighborConfig, missing, extra []AfiSafi) Event {
+	return &EventNeighborCapabilityMismatch{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		Missing: missing,
+		Extra:   extra,
+	}
+}
+
+// EventNeighborRouteRefreshRequested is generated when a neighbor sends a
+// ROUTE-REFRESH message for a negotiated address family, requesting the
+// re-advertisement of all routes of Family.
+type EventNeighborRouteRefreshRequested struct {
+	BaseEvent
+	Family AfiSafi
+}
+
+// Type returns the appropriate EventType for EventNeighborRouteRefreshRequested
+func (e *EventNeighborRouteRefreshRequested) Type() EventType {
+	return EventTypeNeighborRouteRefreshRequested
+}
+
+func newEventNeighborRouteRefreshRequested(c *NeighborConfig, family AfiSafi) Event {
+	return &EventNeighborRouteRefreshRequested{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		Family: family,
+	}
+}
+
+// EventNeighborBeginRouteRefresh is generated when a neighbor with which
+// enhanced route refresh was negotiated marks the beginning of the
+// re-advertisement of Family. Routes of Family received prior to it that are
+// not re-advertised by the matching EventNeighborEndOfRIB are stale.
+//
+// https://tools.ietf.org/html/rfc7313#section-4
+type EventNeighborBeginRouteRefresh struct {
+	BaseEvent
+	Family AfiSafi
+}
+
+// Type returns the appropriate EventType for EventNeighborBeginRouteRefresh
+func (e *EventNeighborBeginRouteRefresh) Type() EventType {
+	return EventTypeNeighborBeginRouteRefresh
+}
+
+func newEventNeighborBeginRouteRefresh(c *NeighborConfig, family AfiSafi) Event {
+	return &EventNeighborBeginRouteRefresh{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		Family: family,
+	}
+}
+
+// EventNeighborEndOfRIB is generated when a neighbor has completed the
+// advertisement of all routes of Family. RouteRefresh is true if it marks
+// the end of an enhanced route refresh, otherwise it is an End-of-RIB update
+// marking the end of the initial advertisement, an
+// EventNeighborUpdateReceived is generated for the update prior to it.
+//
+// https://tools.ietf.org/html/rfc4724#section-2
+//
+// https://tools.ietf.org/html/rfc7313#section-4
+type EventNeighborEndOfRIB struct {
+	BaseEvent
+	Family       AfiSafi
+	RouteRefresh bool
+}
+
+// Type returns the appropriate EventType for EventNeighborEndOfRIB
+func (e *EventNeighborEndOfRIB) Type() EventType {
+	return EventTypeNeighborEndOfRIB
+}
+
+func newEventNeighborEndOfRIB(c *NeighborConfig, family AfiSafi, routeRefresh bool) Event {
+	return &EventNeighborEndOfRIB{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		Family:       family,
+		RouteRefresh: routeRefresh,
+	}
+}
+
+// EventTopologyStale is generated when the session with a neighbor that
+// negotiated graceful restart is lost. Objects contains the keys of the stale
+// BGP-LS NLRI, see LinkStateNlri.Key(), which are retained for up to
+// RestartTime.
+type EventTopologyStale struct {
+	BaseEvent
+	Objects     []string
+	RestartTime time.Duration
+}
+
+// Type returns the appropriate EventType for EventTopologyStale
+func (e *EventTopologyStale) Type() EventType {
+	return EventTypeTopologyStale
+}
+
+func newEventTopologyStale(c *NeighborConfig, objects []string, restartTime time.Duration) Event {
+	return &EventTopologyStale{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		Objects:     objects,
+		RestartTime: restartTime,
+	}
+}
+
+// EventTopologyReconciled is generated when the stale objects of a neighbor
+// are purged. Purged contains the keys of the stale BGP-LS NLRI that were
+// neither re-advertised nor withdrawn, they should be treated as withdrawn.
+// Expired is true if they were purged due to the restart time elapsing. It is
+// also generated when a neighbor with stale objects is deleted or reset.
+type EventTopologyReconciled struct {
+	BaseEvent
+	Purged  []string
+	Expired bool
+}
+
+// Type returns the appropriate EventType for EventTopologyReconciled
+func (e *EventTopologyReconciled) Type() EventType {
+	return EventTypeTopologyReconciled
+}
+
+func newEventTopologyReconciled(c *NeighborConfig, purged []string, expired bool) Event {
+	return &EventTopologyReconciled{
+		BaseEvent: BaseEvent{
+			t: time.Now(),
+			n: c,
+		},
+		Purged:  purged,
+		Expired: expired,
+	}
 }
@@ -3,6 +3,7 @@ package bgpls
 import (
 	"errors"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,6 +16,8 @@ func TestEvent(t *testing.T) {
 		HoldTime: time.Second * 30,
 		Address:  net.ParseIP("172.16.0.1").To4(),
 	}
+	conn, _ := net.Pipe()
+	defer conn.Close()
 
 	cases := []struct {
 		event Event
@@ -24,8 +27,17 @@ func TestEvent(t *testing.T) {
 		{newEventNeighborErr(conf, errors.New("test")), EventTypeNeighborErr, "neighbor error"},
 		{newEventNeighborHoldTimerExpired(conf), EventTypeNeighborHoldTimerExpired, "neighbor hold timer expired"},
 		{newEventNeighborNotificationReceived(conf, &NotificationMessage{}), EventTypeNeighborNotificationReceived, "received notification message from neighbor"},
-		{newEventNeighborStateTransition(conf, IdleState), EventTypeNeighborStateTransition, "neighbor state changed"},
-		{newEventNeighborUpdateReceived(conf, &UpdateMessage{}), EventTypeNeighborUpdateReceived, "received update message from neighbor"},
+		{newEventNeighborStateTransition(conf, IdleState, nil), EventTypeNeighborStateTransition, "neighbor state changed"},
+		{newEventNeighborTimersNegotiated(conf, time.Second*30, time.Second*10), EventTypeNeighborTimersNegotiated, "neighbor timers negotiated"},
+		{newEventNeighborUpdateReceived(conf, net.ParseIP("172.16.0.2").To4(), &UpdateMessage{}), EventTypeNeighborUpdateReceived, "received update message from neighbor"},
+		{newEventNeighborCapabilityMismatch(conf, []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}}, nil), EventTypeNeighborCapabilityMismatch, "neighbor multiprotocol capabilities mismatch"},
+		{newEventNeighborUpdateWarning(conf, errors.New("warning"), &UpdateMessage{}), EventTypeNeighborUpdateWarning, "received questionable update message from neighbor"},
+		{newEventNeighborRouteRefreshRequested(conf, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}), EventTypeNeighborRouteRefreshRequested, "neighbor requested route refresh"},
+		{newEventNeighborBeginRouteRefresh(conf, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}), EventTypeNeighborBeginRouteRefresh, "neighbor began route refresh"},
+		{newEventNeighborEndOfRIB(conf, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}, true), EventTypeNeighborEndOfRIB, "neighbor sent end-of-rib"},
+		{newEventTopologyStale(conf, []string{"a"}, time.Second*120), EventTypeTopologyStale, "neighbor topology stale"},
+		{newEventTopologyReconciled(conf, []string{"a"}, false), EventTypeTopologyReconciled, "neighbor topology reconciled"},
+		{newEventNeighborConnected(conf, conn, true), EventTypeNeighborConnected, "neighbor connected"},
 	}
 
 	for _, c := range cases {
@@ -38,3 +50,147 @@ func TestEvent(t *testing.T) {
 	u := EventType(0)
 	assert.Equal(t, u.String(), "unknown event type")
 }
+
+func TestEventMessage(t *testing.T) {
+	conf := &NeighborConfig{
+		ASN:      64512,
+		HoldTime: time.Second * 30,
+		Address:  net.ParseIP("172.16.0.1").To4(),
+	}
+	u := &UpdateMessage{}
+	n := &NotificationMessage{Code: NotifErrCodeCease}
+
+	got, ok := EventUpdateMessage(newEventNeighborUpdateReceived(conf, net.ParseIP("172.16.0.2").To4(), u))
+	assert.True(t, ok)
+	assert.Equal(t, u, got)
+	got, ok = EventUpdateMessage(newEventNeighborUpdateWarning(conf, errors.New("warning"), u))
+	assert.True(t, ok)
+	assert.Equal(t, u, got)
+	_, ok = EventUpdateMessage(newEventNeighborNotificationReceived(conf, n))
+	assert.False(t, ok)
+
+	gotN, ok := EventNotificationMessage(newEventNeighborNotificationReceived(conf, n))
+	assert.True(t, ok)
+	assert.Equal(t, n, gotN)
+	_, ok = EventNotificationMessage(newEventNeighborUpdateReceived(conf, nil, u))
+	assert.False(t, ok)
+	_, ok = EventNotificationMessage(newEventNeighborHoldTimerExpired(conf))
+	assert.False(t, ok)
+}
+
+func TestEventQueue(t *testing.T) {
+	conf := &NeighborConfig{
+		ASN:      64512,
+		HoldTime: time.Second * 30,
+		Address:  net.ParseIP("172.16.0.1").To4(),
+	}
+
+	out := make(chan Event)
+	q := newEventQueue(out, 4)
+	defer q.terminate()
+
+	// consecutive state transitions are coalesced, except those to
+	// established, idle or disabled
+	q.in <- newEventNeighborStateTransition(conf, IdleState, nil)
+	q.in <- newEventNeighborStateTransition(conf, ConnectState, nil)
+	q.in <- newEventNeighborStateTransition(conf, ActiveState, nil)
+	q.in <- newEventNeighborErr(conf, errors.New("test"))
+	q.in <- newEventNeighborStateTransition(conf, OpenSentState, nil)
+
+	// the queue is full
+	select {
+	case q.in <- newEventNeighborErr(conf, errors.New("test")):
+		t.Fatal("event queued beyond queue size")
+	case <-time.After(time.Millisecond * 10):
+	}
+
+	assertState := func(s FSMState) {
+		e := <-out
+		if assert.IsType(t, &EventNeighborStateTransition{}, e) {
+			assert.Equal(t, s, e.(*EventNeighborStateTransition).State)
+		}
+	}
+	assertState(IdleState)
+	assertState(ActiveState)
+	assert.IsType(t, &EventNeighborErr{}, <-out)
+	assertState(OpenSentState)
+
+	// a session flap is not coalesced into a single established transition
+	for _, s := range []FSMState{EstablishedState, IdleState, ConnectState, OpenSentState} {
+		q.in <- newEventNeighborStateTransition(conf, s, nil)
+	}
+	q.in <- newEventNeighborStateTransition(conf, EstablishedState, nil)
+	assertState(EstablishedState)
+	assertState(IdleState)
+	assertState(OpenSentState)
+	assertState(EstablishedState)
+
+	q.terminate()
+	select {
+	case q.in <- newEventNeighborErr(conf, errors.New("test")):
+		t.Fatal("event queued after terminate")
+	case <-time.After(time.Millisecond * 10):
+	}
+}
+
+func TestEventOverflow(t *testing.T) {
+	conf := &NeighborConfig{
+		ASN:      64512,
+		HoldTime: time.Second * 30,
+		Address:  net.ParseIP("172.16.0.1").To4(),
+	}
+
+	for _, policy := range []EventOverflowPolicy{EventOverflowDropOldest, EventOverflowDropNewest} {
+		out := make(chan Event, 2)
+		o := newEventOverflow(out, policy)
+
+		for _, s := range []FSMState{IdleState, ConnectState, ActiveState, OpenSentState} {
+			o.in <- newEventNeighborStateTransition(conf, s, nil)
+		}
+		o.flush()
+		assert.Equal(t, uint64(2), atomic.LoadUint64(&o.dropped))
+
+		want := []FSMState{ActiveState, OpenSentState}
+		if policy == EventOverflowDropNewest {
+			want = []FSMState{IdleState, ConnectState}
+		}
+		for _, s := range want {
+			e := <-out
+			if assert.IsType(t, &EventNeighborStateTransition{}, e, policy.String()) {
+				assert.Equal(t, s, e.(*EventNeighborStateTransition).State, policy.String())
+			}
+		}
+
+		o.terminate()
+		select {
+		case o.in <- newEventNeighborErr(conf, errors.New("test")):
+			t.Fatal("event forwarded after terminate")
+		case <-time.After(time.Millisecond * 10):
+		}
+		// flush does not block once terminated
+		o.flush()
+	}
+}
+
+func TestEventNeighborNotificationReceivedShutdownCommunication(t *testing.T) {
+	conf := &NeighborConfig{}
+
+	n := &NotificationMessage{
+		Code:    NotifErrCodeCease,
+		Subcode: NotifErrSubcodeAdminShutdown,
+		Data:    append([]byte{18}, "maintenance window"...),
+	}
+	e := newEventNeighborNotificationReceived(conf, n).(*EventNeighborNotificationReceived)
+	assert.Equal(t, e.ShutdownCommunication, "maintenance window")
+
+	// malformed
+	n.Data = []byte{18}
+	e = newEventNeighborNotificationReceived(conf, n).(*EventNeighborNotificationReceived)
+	assert.Equal(t, e.ShutdownCommunication, "")
+
+	// not a shutdown
+	n.Subcode = NotifErrSubcodeOutOfResources
+	n.Data = append([]byte{2}, "ok"...)
+	e = newEventNeighborNotificationReceived(conf, n).(*EventNeighborNotificationReceived)
+	assert.Equal(t, e.ShutdownCommunication, "")
+}
@@ -2,11 +2,15 @@ package bgpls
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -67,53 +71,105 @@ type fsm interface {
 	openConfirm() FSMState
 	established() FSMState
 	terminate()
+	status() NeighborStatus
+	setConfig(c *NeighborConfig)
+	ready() <-chan struct{}
+	purgeStale(expired bool) Event
 }
 
+// dialFunc connects to the address on the named network.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
 type standardFSM struct {
 	port               int
+	retainRaw          bool
+	retainRawMessages  bool
+	dial               dialFunc
 	events             chan Event
 	disable            chan interface{}
 	neighborConfig     *NeighborConfig
 	routerID           net.IP
 	localASN           uint32
+	peerRouterID       net.IP
+	routeRefresh       bool
+	enhancedRefresh    bool
+	gracefulRestart    bool
+	retainStale        bool
+	restartTime        time.Duration
+	openDeadline       time.Time
+	families           []AfiSafi
 	conn               net.Conn
 	readerErr          chan error
 	closeReader        chan struct{}
 	readerClosed       chan struct{}
 	msgCh              chan Message
 	keepAliveTime      time.Duration
-	keepAliveTimer     *time.Timer
+	keepAliveTimer     timer
 	holdTime           time.Duration
-	holdTimer          *time.Timer
-	connectRetryTimer  *time.Timer
+	holdTimer          timer
+	readTimeout        time.Duration
+	connectRetryTimer  timer
+	clock              clock
 	running            bool
 	outboundConnErr    chan error
 	outboundConn       chan net.Conn
 	cancelOutboundDial context.CancelFunc
+	state              FSMState
+	establishedSince   time.Time
+	objects            map[string]struct{}
+	stale              map[string]struct{}
+	staleDeadline      time.Time
+	staleTimer         timer
+	stopStaleTimer     chan struct{}
+	staleTimerDone     chan struct{}
+	endOfRIB           chan struct{}
+	initialSync        chan struct{}
+	earlyUpdate        *UpdateMessage
+	lastErr            error
+	counters           *messageCounters
+	statusLock         *sync.RWMutex
 	*sync.Mutex
 }
 
-func newFSM(c *NeighborConfig, events chan Event, routerID net.IP, localASN uint32, port int) fsm {
+func newFSM(c *NeighborConfig, events chan Event, routerID net.IP, localASN uint32, port int, retainRaw, retainRawMessages bool) fsm {
+	return newStandardFSM(c, events, routerID, localASN, port, retainRaw, retainRawMessages, (&net.Dialer{}).DialContext, realClock{})
+}
+
+// newStandardFSM is newFSM but connections to the neighbor are established
+// with dial and timers are created by clk.
+func newStandardFSM(c *NeighborConfig, events chan Event, routerID net.IP, localASN uint32, port int, retainRaw, retainRawMessages bool, dial dialFunc, clk clock) *standardFSM {
 	f := &standardFSM{
 		port:              port,
+		retainRaw:         retainRaw,
+		retainRawMessages: retainRawMessages,
+		dial:              dial,
 		events:            events,
 		disable:           make(chan interface{}),
 		neighborConfig:    c,
 		routerID:          routerID,
 		localASN:          localASN,
 		keepAliveTime:     time.Duration(int64(c.HoldTime) / 3).Truncate(time.Second),
-		keepAliveTimer:    time.NewTimer(0),
+		keepAliveTimer:    clk.NewTimer(0),
 		holdTime:          c.HoldTime,
-		holdTimer:         time.NewTimer(0),
-		connectRetryTimer: time.NewTimer(0),
+		holdTimer:         clk.NewTimer(0),
+		connectRetryTimer: clk.NewTimer(0),
+		staleTimer:        clk.NewTimer(0),
+		stopStaleTimer:    make(chan struct{}),
+		staleTimerDone:    make(chan struct{}),
+		clock:             clk,
+		endOfRIB:          make(chan struct{}),
+		initialSync:       make(chan struct{}),
+		counters:          &messageCounters{},
+		statusLock:        &sync.RWMutex{},
 		Mutex:             &sync.Mutex{},
 	}
 
 	// drain all timers so they can be reset
-	drainTimers(f.keepAliveTimer, f.holdTimer, f.connectRetryTimer)
+	drainTimers(f.keepAliveTimer, f.holdTimer, f.connectRetryTimer, f.staleTimer)
 
 	f.running = true
 	go f.loop()
+	go f.runStaleTimer()
 
 	return f
 }
@@ -127,28 +183,314 @@ func (f *standardFSM) terminate() {
 
 	f.disable <- nil
 	<-f.disable
+	close(f.stopStaleTimer)
+	<-f.staleTimerDone
 	f.running = false
 }
 
+// status returns a snapshot of the fsm's current status
+func (f *standardFSM) status() NeighborStatus {
+	f.statusLock.RLock()
+	defer f.statusLock.RUnlock()
+
+	return NeighborStatus{
+		Config:           f.neighborConfig,
+		State:            f.state,
+		HoldTime:         f.holdTime,
+		PeerRouterID:     f.peerRouterID,
+		EstablishedSince: f.establishedSince,
+		Objects:          len(f.objects),
+		StaleObjects:     len(f.stale),
+		EndOfRIB:         isClosed(f.endOfRIB),
+		LastErr:          f.lastErr,
+		Counters:         f.counters.snapshot(),
+	}
+}
+
+// ready returns a channel that is closed once the neighbor's first End-of-RIB
+// for BGP-LS has been sent as an event, or once the neighbor is established
+// without graceful restart, in which case it is not required to send
+// End-of-RIB.
+//
+// https://tools.ietf.org/html/rfc4724#section-4.1
+func (f *standardFSM) ready() <-chan struct{} {
+	return f.initialSync
+}
+
+// setReady closes the channel returned by ready if it is not already closed.
+func (f *standardFSM) setReady() {
+	if !isClosed(f.initialSync) {
+		close(f.initialSync)
+	}
+}
+
+// isClosed returns true if c is closed.
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// config returns the neighbor's current configuration
+func (f *standardFSM) config() *NeighborConfig {
+	f.statusLock.RLock()
+	defer f.statusLock.RUnlock()
+	return f.neighborConfig
+}
+
+// setConfig replaces the neighbor's configuration. Changes take effect
+// the next time a field is consulted, the session is not reset.
+func (f *standardFSM) setConfig(c *NeighborConfig) {
+	f.statusLock.Lock()
+	defer f.statusLock.Unlock()
+	f.neighborConfig = c
+}
+
+// setState records the current state for status snapshots
+func (f *standardFSM) setState(s FSMState) {
+	f.statusLock.Lock()
+	defer f.statusLock.Unlock()
+
+	if s == EstablishedState {
+		f.establishedSince = f.clock.Now()
+		f.objects = make(map[string]struct{})
+	} else {
+		f.establishedSince = time.Time{}
+		f.objects = nil
+	}
+	f.state = s
+}
+
+// trackObjects applies the nlri advertised and withdrawn in u to the set of
+// objects advertised by the neighbor. An error is returned if the number of
+// objects exceeds the configured MaxObjects.
+func (f *standardFSM) trackObjects(u *UpdateMessage) error {
+	f.statusLock.Lock()
+	for _, a := range u.PathAttrs {
+		switch a := a.(type) {
+		case *PathAttrMpReach:
+			for _, n := range a.Nlri {
+				f.objects[n.Key()] = struct{}{}
+				delete(f.stale, n.Key())
+			}
+		case *PathAttrMpUnreach:
+			for _, n := range a.Nlri {
+				delete(f.objects, n.Key())
+				delete(f.stale, n.Key())
+			}
+		}
+	}
+	count := len(f.objects)
+	max := f.neighborConfig.MaxObjects
+	f.statusLock.Unlock()
+
+	if max == 0 || count <= int(max) {
+		return nil
+	}
+
+	/*
+		https://tools.ietf.org/html/rfc4486#section-4
+		If a BGP speaker decides to terminate its peering with a neighbor
+		because the number of address prefixes received from the neighbor
+		exceeds a locally configured upper bound, then the speaker MUST send
+		to the neighbor a NOTIFICATION message with the Error Code Cease and
+		the Error Subcode "Maximum Number of Prefixes Reached".  The message
+		MAY optionally include the Address Family information [BGP-MP] and
+		the upper bound in the "Data" field.
+	*/
+	data := make([]byte, 7)
+	binary.BigEndian.PutUint16(data[:2], uint16(BgpLsAfi))
+	data[2] = uint8(BgpLsSafi)
+	binary.BigEndian.PutUint32(data[3:], max)
+	return &errWithNotification{
+		error:   fmt.Errorf("neighbor exceeded maximum objects: %d", max),
+		code:    NotifErrCodeCease,
+		subcode: NotifErrSubcodeMaxPrefixesReached,
+		data:    data,
+	}
+}
+
+// markStale retains the objects advertised by the neighbor as stale following
+// the loss of the session due to err, if graceful restart was negotiated. An
+// EventTopologyStale is returned if objects were retained, otherwise nil.
+// Graceful restart does not apply if a notification was sent or received.
+//
+// https://tools.ietf.org/html/rfc4724#section-4.2
+func (f *standardFSM) markStale(err error) Event {
+	if _, isNotif := asNotification(err); isNotif || !f.gracefulRestart {
+		return nil
+	}
+
+	f.statusLock.Lock()
+	if f.stale == nil {
+		f.stale = make(map[string]struct{})
+	}
+	for k := range f.objects {
+		f.stale[k] = struct{}{}
+	}
+	f.objects = make(map[string]struct{})
+	keys := make([]string, 0, len(f.stale))
+	for k := range f.stale {
+		keys = append(keys, k)
+	}
+	f.statusLock.Unlock()
+	f.startStaleTimer()
+
+	sort.Strings(keys)
+	return newEventTopologyStale(f.config(), keys, f.restartTime)
+}
+
+// startStaleTimer (re)starts the restart time for the stale objects.
+func (f *standardFSM) startStaleTimer() {
+	f.statusLock.Lock()
+	f.staleDeadline = f.clock.Now().Add(f.restartTime)
+	f.statusLock.Unlock()
+	// runStaleTimer owns the timer's channel so it cannot be drained here, a
+	// previous expiry that is still pending is ignored by expireStale
+	f.staleTimer.Stop()
+	f.staleTimer.Reset(f.restartTime)
+}
+
+// purgeStale discards the stale objects, returning an EventTopologyReconciled
+// or nil if there are none.
+func (f *standardFSM) purgeStale(expired bool) Event {
+	f.statusLock.Lock()
+	stale := f.stale
+	f.stale = nil
+	f.statusLock.Unlock()
+	f.staleTimer.Stop()
+
+	return f.reconciled(stale, expired)
+}
+
+// expireStale discards the stale objects if they have been retained beyond
+// the neighbor's restart time, returning an EventTopologyReconciled or nil if
+// they have not.
+func (f *standardFSM) expireStale() Event {
+	f.statusLock.Lock()
+	stale := f.stale
+	if stale == nil || f.clock.Now().Before(f.staleDeadline) {
+		f.statusLock.Unlock()
+		return nil
+	}
+	f.stale = nil
+	f.statusLock.Unlock()
+
+	return f.reconciled(stale, true)
+}
+
+// reconciled returns an EventTopologyReconciled for the purged stale objects
+// or nil if there are none.
+func (f *standardFSM) reconciled(stale map[string]struct{}, expired bool) Event {
+	if stale == nil {
+		return nil
+	}
+
+	purged := make([]string, 0, len(stale))
+	for k := range stale {
+		purged = append(purged, k)
+	}
+	sort.Strings(purged)
+
+	return newEventTopologyReconciled(f.config(), purged, expired)
+}
+
+// runStaleTimer sends the result of expireStale each time the stale timer
+// expires, so the restart time is enforced regardless of the fsm's state.
+func (f *standardFSM) runStaleTimer() {
+	defer close(f.staleTimerDone)
+	for {
+		select {
+		case <-f.stopStaleTimer:
+			return
+		case <-f.staleTimer.C():
+			e := f.expireStale()
+			if e == nil {
+				continue
+			}
+			select {
+			case f.events <- e:
+			case <-f.stopStaleTimer:
+				return
+			}
+		}
+	}
+}
+
+// setReadTimeout sets the read deadline applied to each connection read,
+// a value of 0 disables the deadline
+func (f *standardFSM) setReadTimeout(d time.Duration) {
+	f.statusLock.Lock()
+	defer f.statusLock.Unlock()
+	f.readTimeout = d
+}
+
+// readDeadline returns the deadline for the next connection read. It is
+// applied by the connection rather than the fsm's timers so it is based on the
+// wall clock.
+func (f *standardFSM) readDeadline() time.Time {
+	f.statusLock.RLock()
+	defer f.statusLock.RUnlock()
+	if f.readTimeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(f.readTimeout)
+}
+
+// setLastErr records err for status snapshots
+func (f *standardFSM) setLastErr(err error) {
+	f.statusLock.Lock()
+	defer f.statusLock.Unlock()
+	f.lastErr = err
+}
+
 func (f *standardFSM) dialNeighbor() {
-	dialer := &net.Dialer{}
 	ctx, cancel := context.WithCancel(context.Background())
 	f.outboundConnErr = make(chan error)
 	f.outboundConn = make(chan net.Conn)
 	f.cancelOutboundDial = cancel
 
 	go func() {
-		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(f.neighborConfig.Address.String(), strconv.Itoa(f.port)))
+		conn, err := f.dial(ctx, "tcp", net.JoinHostPort(f.config().Address.String(), strconv.Itoa(f.port)))
 		if err != nil {
 			f.outboundConnErr <- err
 			return
 		}
+		err = setTCPKeepAlive(conn, f.config().TCPKeepAlive)
+		if err != nil {
+			conn.Close()
+			f.outboundConnErr <- fmt.Errorf("error setting tcp keepalive: %v", err)
+			return
+		}
 
 		f.outboundConn <- conn
 	}()
 }
 
+// setTCPKeepAlive sets the TCP keepalive period of conn to d, a negative d
+// disables TCP keepalives. conn is left unmodified if d is 0 or conn is not a
+// TCP connection.
+func setTCPKeepAlive(conn net.Conn, d time.Duration) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok || d == 0 {
+		return nil
+	}
+	if d < 0 {
+		return tc.SetKeepAlive(false)
+	}
+	err := tc.SetKeepAlive(true)
+	if err != nil {
+		return err
+	}
+	return tc.SetKeepAlivePeriod(d)
+}
+
 func (f *standardFSM) startReader() {
+	// the hold timer is set to a large value until the open message is received
+	f.setReadTimeout(longHoldTime)
 	f.readerErr = make(chan error)
 	f.closeReader = make(chan struct{})
 	f.readerClosed = make(chan struct{})
@@ -170,6 +512,7 @@ func (f *standardFSM) idle() FSMState {
 // cleanupConnAndReader closes the connection,
 // the reader close signal channel, and the messages channel
 func (f *standardFSM) cleanupConnAndReader() {
+	f.earlyUpdate = nil
 	f.conn.Close()
 	close(f.closeReader)
 	<-f.readerClosed
@@ -189,7 +532,7 @@ Loop:
 			case <-f.outboundConnErr:
 			}
 			return DisabledState
-		case <-f.connectRetryTimer.C:
+		case <-f.connectRetryTimer.C():
 			/*
 				In response to the ConnectRetryTimer_Expires event (Event 9), the
 				local system:
@@ -250,25 +593,42 @@ Loop:
 		}
 	}
 
-	o, err := newOpenMessage(f.localASN, f.holdTime, f.routerID)
+	o, err := newOpenMessage(f.localASN, f.holdTime, f.routerID, f.config().AddressFamilies...)
 	if err != nil {
 		f.cleanupConnAndReader()
 		return f.handleErr(fmt.Errorf("error creating open message: %v", err), IdleState)
 	}
-	b, err := o.serialize()
-	if err != nil {
-		panic("bug serializing open message")
+	if f.config().RouteRefresh {
+		o.addCapability(&capRouteRefresh{})
+		o.addCapability(&capEnhancedRouteRefresh{})
 	}
-
-	_, err = f.conn.Write(b)
+	if f.config().GracefulRestart {
+		// the collector does not advertise routes, it only supports the
+		// procedures of the receiving speaker
+		o.addCapability(&capGracefulRestart{})
+	}
+	err = f.write(o)
 	if err != nil {
 		f.cleanupConnAndReader()
 		return f.handleErr(fmt.Errorf("error sending open message: %v", err), IdleState)
 	}
 
-	f.holdTimer.Reset(longHoldTime)
+	// the negotiation deadline, if any, applies from the time the connection
+	// is established
+	f.openDeadline = time.Time{}
+	if t := f.config().OpenTimeout; t > 0 {
+		f.openDeadline = f.clock.Now().Add(t)
+	}
+	f.holdTimer.Reset(f.negotiationTimeout(longHoldTime))
+
+	next := f.sendEvent(newEventNeighborConnected(f.config(), f.conn, true), OpenSentState)
+	if next == DisabledState {
+		f.sendCease()
+		drainTimers(f.holdTimer)
+		f.cleanupConnAndReader()
+	}
 
-	return OpenSentState
+	return next
 }
 
 func (f *standardFSM) active() FSMState {
@@ -276,7 +636,7 @@ func (f *standardFSM) active() FSMState {
 	case <-f.disable:
 		drainTimers(f.connectRetryTimer)
 		return DisabledState
-	case <-f.connectRetryTimer.C:
+	case <-f.connectRetryTimer.C():
 		/*
 			In response to a ConnectRetryTimer_Expires event (Event 9), the
 			local system:
@@ -304,17 +664,57 @@ func (f *standardFSM) sendEvent(e Event, nextState FSMState) FSMState {
 	}
 }
 
+// sendEventEstablished is sendEvent for use in EstablishedState. Keepalives
+// continue to be sent while waiting on the events channel so that a slow
+// consumer does not cause the neighbor's hold timer to expire. The local hold
+// timer is restarted once the event is sent, and if it expires in the
+// meantime, as messages from the neighbor are not read until the event is
+// sent.
+func (f *standardFSM) sendEventEstablished(e Event) FSMState {
+	select {
+	case f.events <- e:
+		return EstablishedState
+	default:
+	}
+
+	for {
+		select {
+		case f.events <- e:
+			f.drainAndResetHoldTimer()
+			return EstablishedState
+		case <-f.disable:
+			return DisabledState
+		case <-f.keepAliveTimer.C():
+			// write errors surface via the reader
+			f.sendKeepAlive()
+			// does not need to be drained
+			f.keepAliveTimer.Reset(f.keepAliveTime)
+		case <-f.holdTimer.C():
+			// does not need to be drained
+			f.holdTimer.Reset(f.holdTime)
+		}
+	}
+}
+
 // handlerErr checks the provided err to see if a notification can be unwrapped
 // and if so, sends it to the neighbor.
 //
 // The provided FSMState is returned unless a disable signal is received while
 // trying to send on the events channel in which case DisabledState is returned.
 func (f *standardFSM) handleErr(err error, nextState FSMState) FSMState {
-	if err, ok := err.(*errWithNotification); ok {
-		f.sendNotification(err.code, err.subcode, err.data)
+	if n, ok := asNotification(err); ok {
+		f.sendNotification(n.code, n.subcode, n.data)
 	}
 
-	return f.sendEvent(newEventNeighborErr(f.neighborConfig, err), nextState)
+	f.setLastErr(err)
+	return f.sendEvent(newEventNeighborErr(f.config(), err), nextState)
+}
+
+// isReadTimeout returns true if err is the result of the connection read
+// deadline, which is equivalent to the hold timer expiring
+func isReadTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
 }
 
 func (f *standardFSM) handleHoldTimerExpired() FSMState {
@@ -333,19 +733,36 @@ func (f *standardFSM) handleHoldTimerExpired() FSMState {
 	f.sendHoldTimerExpired()
 	f.cleanupConnAndReader()
 
-	return f.sendEvent(newEventNeighborHoldTimerExpired(f.neighborConfig), IdleState)
+	return f.sendEvent(newEventNeighborHoldTimerExpired(f.config()), IdleState)
 }
 
 func (f *standardFSM) read() {
 	defer close(f.readerClosed)
 
+	d := newDecoder(&countingReader{r: f.conn, c: f.counters}, func() decodeOptions {
+		c := f.config()
+		return decodeOptions{
+			strict:            c.StrictAttrValidation,
+			policy:            c.UpdateErrorPolicy,
+			families:          c.AddressFamilies,
+			retainRaw:         f.retainRaw,
+			retainRawMessages: f.retainRawMessages,
+			requireWellKnown:  c.RequireWellKnownAttrs,
+		}
+	})
 	for {
 		select {
 		case <-f.closeReader:
 			return
 		default:
-			buff := make([]byte, 4096)
-			n, err := f.conn.Read(buff)
+			// a stalled connection surfaces as a read timeout rather than
+			// relying on the hold timer alone
+			f.conn.SetReadDeadline(f.readDeadline())
+
+			// messages that were fully received are delivered by the decoder
+			// before any read error so that updates preceding a connection
+			// reset are not lost
+			m, err := d.Decode()
 			if err != nil {
 				select {
 				case f.readerErr <- err:
@@ -353,29 +770,30 @@ func (f *standardFSM) read() {
 				}
 				return
 			}
-			buff = buff[:n]
-
-			msgs, err := messagesFromBytes(buff)
-			if err != nil {
-				select {
-				case f.readerErr <- err:
-				case <-f.closeReader:
-				}
 
+			f.counters.messageIn(m.MessageType())
+			select {
+			case f.msgCh <- m:
+			case <-f.closeReader:
 				return
 			}
-
-			for _, m := range msgs {
-				select {
-				case f.msgCh <- m:
-				case <-f.closeReader:
-					return
-				}
-			}
 		}
 	}
 }
 
+// countingReader adds the number of bytes read from r to the bytes in
+// counter of c.
+type countingReader struct {
+	r io.Reader
+	c *messageCounters
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.c.addBytesIn(n)
+	return n, err
+}
+
 func (f *standardFSM) sendHoldTimerExpired() error {
 	return f.sendNotification(NotifErrCodeHoldTimerExpired, 0, nil)
 }
@@ -386,7 +804,9 @@ func (f *standardFSM) handleUnexpectedMessageType(received MessageType, next FSM
 	b := make([]byte, 1)
 	b[0] = uint8(received)
 	f.sendNotification(NotifErrCodeMessageHeader, NotifErrSubcodeBadType, b)
-	return f.sendEvent(newEventNeighborErr(f.neighborConfig, fmt.Errorf("unexpected message type: %s", received)), next)
+	err := fmt.Errorf("unexpected message type: %s", received)
+	f.setLastErr(err)
+	return f.sendEvent(newEventNeighborErr(f.config(), err), next)
 }
 
 func (f *standardFSM) openSent() FSMState {
@@ -397,6 +817,10 @@ func (f *standardFSM) openSent() FSMState {
 		f.cleanupConnAndReader()
 		return DisabledState
 	case err := <-f.readerErr:
+		if isReadTimeout(err) {
+			drainTimers(f.holdTimer)
+			return f.handleHoldTimerExpired()
+		}
 		/*
 			If a TcpConnectionFails event (Event 18) is received, the local
 			system:
@@ -420,7 +844,7 @@ func (f *standardFSM) openSent() FSMState {
 		drainTimers(f.holdTimer)
 		f.cleanupConnAndReader()
 		return next
-	case <-f.holdTimer.C:
+	case <-f.holdTimer.C():
 		return f.handleHoldTimerExpired()
 	case m := <-f.msgCh:
 		open, isOpen := m.(*openMessage)
@@ -428,7 +852,7 @@ func (f *standardFSM) openSent() FSMState {
 			var next FSMState
 			notif, isNotif := m.(*NotificationMessage)
 			if isNotif {
-				next = f.sendEvent(newEventNeighborNotificationReceived(f.neighborConfig, notif), IdleState)
+				next = f.sendEvent(newEventNeighborNotificationReceived(f.config(), notif), IdleState)
 			} else {
 				next = f.handleUnexpectedMessageType(m.MessageType(), IdleState)
 			}
@@ -438,7 +862,26 @@ func (f *standardFSM) openSent() FSMState {
 			return next
 		}
 
-		err := validateOpenMessage(open, f.neighborConfig.ASN)
+		if missing, extra := multiprotoMismatch(open, f.config().AddressFamilies...); len(missing) > 0 {
+			next := f.sendEvent(newEventNeighborCapabilityMismatch(f.config(), missing, extra), OpenSentState)
+			if next == DisabledState {
+				f.sendCease()
+				drainTimers(f.holdTimer)
+				f.cleanupConnAndReader()
+				return next
+			}
+		}
+
+		err := validateOpenMessage(open, f.config().ASN, f.config().AllowMissingBgpLs, f.config().AllowUnknownOptParams)
+		if err == nil {
+			err = validateOpenBgpID(open, f.config().PeerRouterID)
+		}
+		if err == nil {
+			err = validateOpenHoldTime(open, f.config().MinHoldTime)
+		}
+		if err == nil {
+			err = validateOpenNotSelf(open, f.config().ASN, f.localASN, f.routerID)
+		}
 		if err != nil {
 			next := f.handleErr(err, IdleState)
 			drainTimers(f.holdTimer)
@@ -446,10 +889,38 @@ func (f *standardFSM) openSent() FSMState {
 			return next
 		}
 
+		// negotiate against the configured hold time so a previous session's
+		// negotiation does not carry over
+		f.statusLock.Lock()
+		f.peerRouterID = bgpIDToIP(open.bgpID)
+		f.holdTime = f.neighborConfig.HoldTime
 		if float64(open.holdTime) < f.holdTime.Seconds() {
 			f.holdTime = time.Duration(int64(open.holdTime) * int64(time.Second))
-			f.keepAliveTime = (f.holdTime / 3).Truncate(time.Second)
 		}
+		f.keepAliveTime = (f.holdTime / 3).Truncate(time.Second)
+		f.readTimeout = f.holdTime
+		f.statusLock.Unlock()
+
+		f.routeRefresh = f.config().RouteRefresh && hasCapability(open, capCodeRouteRefresh)
+		f.enhancedRefresh = f.routeRefresh && hasCapability(open, capCodeEnhancedRouteRefresh)
+
+		// objects retained across a restart are purged once the session is
+		// established unless the neighbor preserved its forwarding state, in
+		// which case they are retained until End-of-RIB for up to the restart
+		// time
+		g, family := gracefulRestartFor(open, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi})
+		f.gracefulRestart = f.config().GracefulRestart && family != nil
+		f.retainStale = f.gracefulRestart && family.forwardingState
+		if f.gracefulRestart {
+			f.restartTime = time.Duration(g.restartTime) * time.Second
+		}
+		f.statusLock.RLock()
+		stale := f.stale != nil
+		f.statusLock.RUnlock()
+		if stale {
+			f.startStaleTimer()
+		}
+		f.families = negotiatedFamilies(open, f.config().AddressFamilies...)
 
 		err = f.sendKeepAlive()
 		if err != nil {
@@ -459,19 +930,21 @@ func (f *standardFSM) openSent() FSMState {
 			return next
 		}
 
-		f.drainAndResetHoldTimer()
-		return OpenConfirmState
+		drainTimers(f.holdTimer)
+		f.holdTimer.Reset(f.negotiationTimeout(f.holdTime))
+
+		next := f.sendEvent(newEventNeighborTimersNegotiated(f.config(), f.holdTime, f.keepAliveTime), OpenConfirmState)
+		if next == DisabledState {
+			f.sendCease()
+			drainTimers(f.holdTimer)
+			f.cleanupConnAndReader()
+		}
+		return next
 	}
 }
 
 func (f *standardFSM) sendKeepAlive() error {
-	ka := &keepAliveMessage{}
-	b, err := ka.serialize()
-	if err != nil {
-		panic("bug serializing keepalive message")
-	}
-	_, err = f.conn.Write(b)
-	return err
+	return f.write(&keepAliveMessage{})
 }
 
 func (f *standardFSM) openConfirm() FSMState {
@@ -483,14 +956,35 @@ func (f *standardFSM) openConfirm() FSMState {
 			f.cleanupConnAndReader()
 			return DisabledState
 		case err := <-f.readerErr:
+			if isReadTimeout(err) {
+				drainTimers(f.holdTimer)
+				return f.handleHoldTimerExpired()
+			}
 			next := f.handleErr(err, IdleState)
 			drainTimers(f.holdTimer)
 			f.cleanupConnAndReader()
 			return next
-		case <-f.holdTimer.C:
+		case <-f.holdTimer.C():
 			return f.handleHoldTimerExpired()
 		case m := <-f.msgCh:
 			_, isKeepAlive := m.(*keepAliveMessage)
+			update, isUpdate := m.(*UpdateMessage)
+			if isUpdate && f.config().AllowEarlyUpdate {
+				/*
+					https://tools.ietf.org/html/rfc4271#section-8.2.2
+					In response to any other event (Events 9, 12-13, 20, 22, 25-28),
+					the local system:
+					  - sends a NOTIFICATION with a code of Finite State Machine
+					    Error,
+
+					A neighbor enters Established only after receiving our
+					KEEPALIVE and sends its own on entering OpenConfirm, so an
+					update here means the neighbor never sent it. The update
+					is treated as the KEEPALIVE and processed once established.
+				*/
+				f.earlyUpdate = update
+				isKeepAlive = true
+			}
 			if !isKeepAlive {
 				next := f.handleUnexpectedMessageType(m.MessageType(), IdleState)
 				drainTimers(f.holdTimer)
@@ -507,6 +1001,13 @@ func (f *standardFSM) openConfirm() FSMState {
 }
 
 func (f *standardFSM) established() FSMState {
+	if m := f.earlyUpdate; m != nil {
+		f.earlyUpdate = nil
+		if next, done := f.handleUpdate(m); done {
+			return next
+		}
+	}
+
 	for {
 		select {
 		case <-f.disable:
@@ -515,14 +1016,21 @@ func (f *standardFSM) established() FSMState {
 			f.cleanupConnAndReader()
 			return DisabledState
 		case err := <-f.readerErr:
+			if isReadTimeout(err) {
+				drainTimers(f.keepAliveTimer, f.holdTimer)
+				return f.handleHoldTimerExpired()
+			}
 			next := f.handleErr(err, IdleState)
 			drainTimers(f.keepAliveTimer, f.holdTimer)
 			f.cleanupConnAndReader()
+			if e := f.markStale(err); e != nil && next != DisabledState {
+				next = f.sendEvent(e, next)
+			}
 			return next
-		case <-f.holdTimer.C:
+		case <-f.holdTimer.C():
 			drainTimers(f.keepAliveTimer)
 			return f.handleHoldTimerExpired()
-		case <-f.keepAliveTimer.C:
+		case <-f.keepAliveTimer.C():
 			err := f.sendKeepAlive()
 			if err != nil {
 				next := f.handleErr(err, IdleState)
@@ -537,8 +1045,43 @@ func (f *standardFSM) established() FSMState {
 			case *keepAliveMessage:
 				f.drainAndResetHoldTimer()
 			case *UpdateMessage:
+				if next, done := f.handleUpdate(m); done {
+					return next
+				}
+			case *RouteRefreshMessage:
+				if !f.routeRefresh {
+					next := f.handleUnexpectedMessageType(m.MessageType(), IdleState)
+					drainTimers(f.keepAliveTimer, f.holdTimer)
+					f.cleanupConnAndReader()
+					return next
+				}
 				f.drainAndResetHoldTimer()
-				next := f.sendEvent(newEventNeighborUpdateReceived(f.neighborConfig, m), EstablishedState)
+				/*
+					rfc2918 section 4
+					If a BGP speaker receives from its peer a ROUTE-REFRESH message with
+					the <AFI, SAFI> that the speaker didn't advertise to the peer at the
+					session establishment time via capability advertisement, the speaker
+					shall ignore such a message.
+				*/
+				family := AfiSafi{Afi: m.Afi, Safi: m.Safi}
+				if !containsAfiSafi(f.families, family) {
+					break
+				}
+				// the subtype is reserved unless enhanced route refresh was negotiated
+				var e Event
+				switch {
+				case !f.enhancedRefresh || m.Subtype == RouteRefreshSubtypeRequest:
+					e = newEventNeighborRouteRefreshRequested(f.config(), family)
+				case m.Subtype == RouteRefreshSubtypeBoRR:
+					e = newEventNeighborBeginRouteRefresh(f.config(), family)
+				case m.Subtype == RouteRefreshSubtypeEoRR:
+					e = newEventNeighborEndOfRIB(f.config(), family, true)
+				default:
+					// rfc7313 section 5: a ROUTE-REFRESH message with an
+					// unknown subtype MUST be ignored
+					continue
+				}
+				next := f.sendEventEstablished(e)
 				if next == DisabledState {
 					f.sendCease()
 					drainTimers(f.keepAliveTimer, f.holdTimer)
@@ -548,7 +1091,7 @@ func (f *standardFSM) established() FSMState {
 			case *NotificationMessage:
 				drainTimers(f.keepAliveTimer, f.holdTimer)
 				f.cleanupConnAndReader()
-				return f.sendEvent(newEventNeighborNotificationReceived(f.neighborConfig, m), IdleState)
+				return f.sendEvent(newEventNeighborNotificationReceived(f.config(), m), IdleState)
 			case *openMessage:
 				next := f.handleUnexpectedMessageType(m.MessageType(), IdleState)
 				drainTimers(f.holdTimer)
@@ -559,19 +1102,103 @@ func (f *standardFSM) established() FSMState {
 	}
 }
 
+// handleUpdate processes an update received in EstablishedState. It returns
+// the next state and true if the fsm should leave EstablishedState.
+func (f *standardFSM) handleUpdate(m *UpdateMessage) (FSMState, bool) {
+	f.drainAndResetHoldTimer()
+	// errors handled during deserialization per the UpdateErrorPolicy
+	warnings := append([]error(nil), m.errs...)
+	if err := validateUpdateLinkStateAttrs(m); err != nil {
+		if f.config().StrictAttrValidation {
+			next := f.handleErr(err, IdleState)
+			drainTimers(f.keepAliveTimer, f.holdTimer)
+			f.cleanupConnAndReader()
+			return next, true
+		}
+		warnings = append(warnings, err)
+	}
+	for _, err := range warnings {
+		next := f.sendEventEstablished(newEventNeighborUpdateWarning(f.config(), err, m))
+		if next == DisabledState {
+			f.sendCease()
+			drainTimers(f.keepAliveTimer, f.holdTimer)
+			f.cleanupConnAndReader()
+			return next, true
+		}
+	}
+	if err := f.trackObjects(m); err != nil {
+		next := f.handleErr(err, IdleState)
+		drainTimers(f.keepAliveTimer, f.holdTimer)
+		f.cleanupConnAndReader()
+		return next, true
+	}
+	next := f.sendEventEstablished(newEventNeighborUpdateReceived(f.config(), f.peerRouterID, m))
+	if next == DisabledState {
+		f.sendCease()
+		drainTimers(f.keepAliveTimer, f.holdTimer)
+		f.cleanupConnAndReader()
+		return next, true
+	}
+	if family, ok := m.EndOfRIB(); ok {
+		events := []Event{newEventNeighborEndOfRIB(f.config(), family, false)}
+		// objects not re-advertised since the restart are withdrawn
+		if family.Afi == BgpLsAfi && family.Safi == BgpLsSafi {
+			if e := f.purgeStale(false); e != nil {
+				events = append(events, e)
+			}
+		}
+		for _, e := range events {
+			next := f.sendEventEstablished(e)
+			if next == DisabledState {
+				f.sendCease()
+				drainTimers(f.keepAliveTimer, f.holdTimer)
+				f.cleanupConnAndReader()
+				return next, true
+			}
+		}
+		if family.Afi == BgpLsAfi && family.Safi == BgpLsSafi && !isClosed(f.endOfRIB) {
+			close(f.endOfRIB)
+			f.setReady()
+		}
+	}
+
+	return EstablishedState, false
+}
+
 func (f *standardFSM) loop() {
 	var current FSMState
 	next := IdleState
 
 	for {
+		f.setState(next)
 		if next != DisabledState {
-			next = f.sendEvent(newEventNeighborStateTransition(f.neighborConfig, next), next)
+			var peerRouterID net.IP
+			if next == OpenConfirmState || next == EstablishedState {
+				peerRouterID = f.peerRouterID
+			}
+			send := f.sendEvent
+			if next == EstablishedState {
+				// the keepalive timer was started on leaving OpenConfirmState
+				send = func(e Event, _ FSMState) FSMState { return f.sendEventEstablished(e) }
+			}
+			next = send(newEventNeighborStateTransition(f.config(), next, peerRouterID), next)
+			// stale objects are purged once the session is re-established
+			// unless the neighbor preserved its forwarding state
+			if next == EstablishedState && !f.retainStale {
+				if e := f.purgeStale(false); e != nil {
+					next = send(e, next)
+				}
+			}
+			if next == EstablishedState && !f.gracefulRestart {
+				f.setReady()
+			}
 		}
 
 		current = next
 
 		switch current {
 		case DisabledState:
+			f.setState(current)
 			f.disable <- nil
 			return
 		case IdleState:
@@ -590,19 +1217,67 @@ func (f *standardFSM) loop() {
 
 		err := validTransition(current, next)
 		if err != nil {
-			panic(fmt.Sprintf("invalid state transition for neighbor:%s %s to %s", f.neighborConfig.Address, current, next))
+			panic(fmt.Sprintf("invalid state transition for neighbor:%s %s to %s", f.config().Address, current, next))
 		}
 	}
 }
 
-func drainTimers(timers ...*time.Timer) {
+func drainTimers(timers ...timer) {
 	for _, t := range timers {
 		if !t.Stop() {
-			<-t.C
+			<-t.C()
 		}
 	}
 }
 
+// clock creates the timers used by the fsm and provides the current time.
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) timer
+}
+
+// timer is the subset of time.Timer used by the fsm.
+type timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// realClock is a clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// negotiationTimeout returns d limited to the time remaining until the OPEN
+// negotiation deadline, see NeighborConfig.OpenTimeout.
+func (f *standardFSM) negotiationTimeout(d time.Duration) time.Duration {
+	if f.openDeadline.IsZero() {
+		return d
+	}
+	remaining := f.openDeadline.Sub(f.clock.Now())
+	if remaining < 0 {
+		return 0
+	}
+	if remaining < d {
+		return remaining
+	}
+	return d
+}
+
 func (f *standardFSM) drainAndResetHoldTimer() {
 	drainTimers(f.holdTimer)
 	f.holdTimer.Reset(f.holdTime)
@@ -619,13 +1294,91 @@ func (f *standardFSM) sendNotification(code NotifErrCode, subcode NotifErrSubcod
 		Data:    data,
 	}
 
-	b, err := n.serialize()
+	return f.write(n)
+}
+
+// write sends m to the neighbor
+func (f *standardFSM) write(m Message) error {
+	err := NewEncoder(&countingWriter{w: f.conn, c: f.counters}).Encode(m)
 	if err != nil {
 		return err
 	}
 
-	_, err = f.conn.Write(b)
-	return err
+	f.counters.messageOut(m.MessageType())
+	return nil
+}
+
+// countingWriter adds the number of bytes written to w to the bytes out
+// counter of c.
+type countingWriter struct {
+	w io.Writer
+	c *messageCounters
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.c.addBytesOut(n)
+	return n, err
+}
+
+// messageCounters are updated atomically by the fsm and its reader.
+// 64-bit fields are first to guarantee alignment.
+type messageCounters struct {
+	messagesIn     [RouteRefreshMessageType + 1]uint64
+	messagesOut    [RouteRefreshMessageType + 1]uint64
+	bytesIn        uint64
+	bytesOut       uint64
+	lastMessageIn  int64
+	lastMessageOut int64
+}
+
+func (c *messageCounters) addBytesIn(n int) {
+	if n > 0 {
+		atomic.AddUint64(&c.bytesIn, uint64(n))
+	}
+}
+
+func (c *messageCounters) addBytesOut(n int) {
+	if n > 0 {
+		atomic.AddUint64(&c.bytesOut, uint64(n))
+	}
+}
+
+func (c *messageCounters) messageIn(t MessageType) {
+	if int(t) < len(c.messagesIn) {
+		atomic.AddUint64(&c.messagesIn[t], 1)
+	}
+	atomic.StoreInt64(&c.lastMessageIn, time.Now().UnixNano())
+}
+
+func (c *messageCounters) messageOut(t MessageType) {
+	if int(t) < len(c.messagesOut) {
+		atomic.AddUint64(&c.messagesOut[t], 1)
+	}
+	atomic.StoreInt64(&c.lastMessageOut, time.Now().UnixNano())
+}
+
+func (c *messageCounters) snapshot() NeighborCounters {
+	n := NeighborCounters{
+		MessagesIn:  make(map[MessageType]uint64),
+		MessagesOut: make(map[MessageType]uint64),
+		BytesIn:     atomic.LoadUint64(&c.bytesIn),
+		BytesOut:    atomic.LoadUint64(&c.bytesOut),
+	}
+
+	for _, t := range []MessageType{OpenMessageType, UpdateMessageType, NotificationMessageType, KeepAliveMessageType, RouteRefreshMessageType} {
+		n.MessagesIn[t] = atomic.LoadUint64(&c.messagesIn[t])
+		n.MessagesOut[t] = atomic.LoadUint64(&c.messagesOut[t])
+	}
+
+	if last := atomic.LoadInt64(&c.lastMessageIn); last != 0 {
+		n.LastMessageIn = time.Unix(0, last)
+	}
+	if last := atomic.LoadInt64(&c.lastMessageOut); last != 0 {
+		n.LastMessageOut = time.Unix(0, last)
+	}
+
+	return n
 }
 
 func validTransition(current, next FSMState) error {
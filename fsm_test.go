@@ -1,9 +1,11 @@
 package bgpls
 
 import (
+	"context"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -31,6 +33,59 @@ func TestFSMString(t *testing.T) {
 	}
 }
 
+func TestIsReadTimeout(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	a.SetReadDeadline(time.Now())
+	_, err := a.Read(make([]byte, 1))
+	assert.True(t, isReadTimeout(err))
+
+	b.Close()
+	a.SetReadDeadline(time.Time{})
+	_, err = a.Read(make([]byte, 1))
+	assert.False(t, isReadTimeout(err))
+}
+
+func TestReadDeadline(t *testing.T) {
+	f := &standardFSM{
+		clock:       &fakeClock{now: time.Unix(0, 0)},
+		readTimeout: time.Second * 30,
+		statusLock:  &sync.RWMutex{},
+	}
+
+	// connection deadlines are independent of the fsm's clock
+	assert.True(t, f.readDeadline().After(time.Now()))
+
+	f.readTimeout = 0
+	assert.True(t, f.readDeadline().IsZero())
+}
+
+func TestSetTCPKeepAlive(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, d := range []time.Duration{0, time.Second * 10, -1} {
+		assert.Nil(t, setTCPKeepAlive(conn, d))
+	}
+
+	// not a tcp connection
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	assert.Nil(t, setTCPKeepAlive(a, time.Second*10))
+}
+
 type fsmTestSuite struct {
 	suite.Suite
 	neighborConfig *NeighborConfig
@@ -52,7 +107,7 @@ func (s *fsmTestSuite) readMessagesFromConn() ([]Message, error) {
 	if err != nil {
 		return nil, err
 	}
-	return messagesFromBytes(b[:n])
+	return messagesFromBytes(b[:n], decodeOptions{})
 }
 
 func (s *fsmTestSuite) sendKeepalive() error {
@@ -105,7 +160,7 @@ func (s *fsmTestSuite) advanceToOpenSentState() {
 	}
 
 	s.events = make(chan Event)
-	s.fsm = newFSM(s.neighborConfig, s.events, net.ParseIP("127.0.0.2").To4(), 64512, i)
+	s.fsm = newFSM(s.neighborConfig, s.events, net.ParseIP("127.0.0.2").To4(), 64512, i, false, false)
 
 	s.failNowIfNotStateTransition(IdleState)
 	s.failNowIfNotStateTransition(ConnectState)
@@ -115,6 +170,14 @@ func (s *fsmTestSuite) advanceToOpenSentState() {
 		assert.FailNow(s.T(), err.Error())
 	}
 
+	e := <-s.events
+	if !assert.IsType(s.T(), &EventNeighborConnected{}, e) {
+		s.T().FailNow()
+	}
+	assert.Equal(s.T(), conn.LocalAddr().String(), e.(*EventNeighborConnected).RemoteAddr.String())
+	assert.Equal(s.T(), conn.RemoteAddr().String(), e.(*EventNeighborConnected).LocalAddr.String())
+	assert.True(s.T(), e.(*EventNeighborConnected).Outbound)
+
 	s.failNowIfNotStateTransition(OpenSentState)
 
 	s.conn = conn
@@ -145,6 +208,13 @@ func (s *fsmTestSuite) advanceToOpenConfirmState() {
 		assert.IsType(s.T(), m[0], &keepAliveMessage{})
 	}
 
+	e := <-s.events
+	if assert.IsType(s.T(), &EventNeighborTimersNegotiated{}, e) {
+		f, _ := e.(*EventNeighborTimersNegotiated)
+		assert.Equal(s.T(), f.HoldTime, s.neighborConfig.HoldTime)
+		assert.Equal(s.T(), f.KeepAliveTime, s.neighborConfig.HoldTime/3)
+	}
+
 	s.failNowIfNotStateTransition(OpenConfirmState)
 }
 
@@ -171,6 +241,25 @@ func (s *fsmTestSuite) advanceToEstablishedState() {
 	s.failNowIfNotStateTransition(EstablishedState)
 }
 
+// advance to established state and check the status snapshot
+func (s *fsmTestSuite) TestFSMEstablishedStatus() {
+	s.advanceToEstablishedState()
+	status := s.fsm.status()
+	assert.Equal(s.T(), status.State, EstablishedState)
+	assert.Equal(s.T(), status.HoldTime, s.neighborConfig.HoldTime)
+	assert.Equal(s.T(), status.PeerRouterID, net.ParseIP("127.0.0.1").To4())
+	assert.False(s.T(), status.EstablishedSince.IsZero())
+	assert.Nil(s.T(), status.LastErr)
+	assert.Equal(s.T(), status.Counters.MessagesIn[OpenMessageType], uint64(1))
+	assert.Equal(s.T(), status.Counters.MessagesIn[KeepAliveMessageType], uint64(1))
+	assert.Equal(s.T(), status.Counters.MessagesOut[OpenMessageType], uint64(1))
+	assert.Equal(s.T(), status.Counters.MessagesOut[KeepAliveMessageType], uint64(1))
+	assert.NotZero(s.T(), status.Counters.BytesIn)
+	assert.NotZero(s.T(), status.Counters.BytesOut)
+	assert.False(s.T(), status.Counters.LastMessageIn.IsZero())
+	assert.False(s.T(), status.Counters.LastMessageOut.IsZero())
+}
+
 func (s *fsmTestSuite) sendInvalidMsgExpectNeighborErr() {
 	_, err := s.conn.Write([]byte{0})
 	if err != nil {
@@ -202,6 +291,9 @@ func (s *fsmTestSuite) TestFSMOpenSentReaderErr() {
 
 // advance to open sent state and wait for hold timer to expire
 func (s *fsmTestSuite) TestFSMOpenSentHoldTimerExpired() {
+	defer func(d time.Duration) {
+		longHoldTime = d
+	}(longHoldTime)
 	longHoldTime = time.Second * 1
 	s.advanceToOpenSentState()
 	e := <-s.events
@@ -265,6 +357,97 @@ func (s *fsmTestSuite) TestFSMOpenSentSendInvalidOpen() {
 	s.failNowIfNotStateTransition(IdleState)
 }
 
+func (s *fsmTestSuite) sendOpenWithoutBgpLs() {
+	o, err := newOpenMessage(s.neighborConfig.ASN, s.neighborConfig.HoldTime, net.ParseIP("127.0.0.1"))
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	o.optParams = []optParam{
+		&capabilityOptParam{
+			caps: []capability{
+				&capMultiproto{afi: 1, safi: 1},
+			},
+		},
+	}
+	b, err := o.serialize()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	_, err = s.conn.Write(b)
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+}
+
+// advance to open sent state and send an open message without the bgp-ls
+// capability, expect EventNeighborCapabilityMismatch followed by EventNeighborErr
+func (s *fsmTestSuite) TestFSMOpenSentSendOpenWithoutBgpLs() {
+	s.advanceToOpenSentState()
+	s.sendOpenWithoutBgpLs()
+
+	e := <-s.events
+	if assert.IsType(s.T(), &EventNeighborCapabilityMismatch{}, e) {
+		f, _ := e.(*EventNeighborCapabilityMismatch)
+		assert.Equal(s.T(), f.Missing, []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}})
+		assert.Equal(s.T(), f.Extra, []AfiSafi{{Afi: 1, Safi: 1}})
+	}
+	m, err := s.readMessagesFromConn()
+	assert.Nil(s.T(), err)
+	if assert.Len(s.T(), m, 1) {
+		assert.IsType(s.T(), m[0], &NotificationMessage{})
+	}
+	e = <-s.events
+	assert.IsType(s.T(), &EventNeighborErr{}, e)
+	s.failNowIfNotStateTransition(IdleState)
+}
+
+// advance to open sent state and send an open message carrying our own bgp ID
+// expect a bad bgp ID notification and IdleState
+func (s *fsmTestSuite) TestFSMOpenSentSendOpenFromSelf() {
+	s.advanceToOpenSentState()
+	o, err := newOpenMessage(s.neighborConfig.ASN, s.neighborConfig.HoldTime, net.ParseIP("127.0.0.2"))
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	b, err := o.serialize()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	_, err = s.conn.Write(b)
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+
+	m, err := s.readMessagesFromConn()
+	assert.Nil(s.T(), err)
+	if assert.Len(s.T(), m, 1) && assert.IsType(s.T(), &NotificationMessage{}, m[0]) {
+		assert.Equal(s.T(), m[0].(*NotificationMessage).Subcode, NotifErrSubcodeBadBgpID)
+	}
+	e := <-s.events
+	assert.IsType(s.T(), &EventNeighborErr{}, e)
+	s.failNowIfNotStateTransition(IdleState)
+}
+
+// same as above with AllowMissingBgpLs, expect OpenConfirmState
+func (s *fsmTestSuite) TestFSMOpenSentSendOpenWithoutBgpLsAllowed() {
+	s.advanceToOpenSentState()
+	c := *s.neighborConfig
+	c.AllowMissingBgpLs = true
+	s.fsm.setConfig(&c)
+	s.sendOpenWithoutBgpLs()
+
+	e := <-s.events
+	assert.IsType(s.T(), &EventNeighborCapabilityMismatch{}, e)
+	m, err := s.readMessagesFromConn()
+	assert.Nil(s.T(), err)
+	if assert.Len(s.T(), m, 1) {
+		assert.IsType(s.T(), m[0], &keepAliveMessage{})
+	}
+	e = <-s.events
+	assert.IsType(s.T(), &EventNeighborTimersNegotiated{}, e)
+	s.failNowIfNotStateTransition(OpenConfirmState)
+}
+
 // advance to open confirm state then cleanup
 func (s *fsmTestSuite) TestFSMOpenConfirmDisable() {
 	s.advanceToOpenConfirmState()
@@ -305,6 +488,36 @@ func (s *fsmTestSuite) TestFSMEstablishedHoldTimerExpired() {
 	s.failNowIfNotStateTransition(IdleState)
 }
 
+// advance to established state and shorten the read timeout so the read
+// deadline is reached before the hold timer expires
+func (s *fsmTestSuite) TestFSMEstablishedReadTimeout() {
+	s.advanceToEstablishedState()
+	assert.Equal(s.T(), s.fsm.(*standardFSM).readTimeout, s.neighborConfig.HoldTime)
+
+	// the new timeout applies to reads following the keepalive
+	s.fsm.(*standardFSM).setReadTimeout(time.Millisecond * 100)
+	err := s.sendKeepalive()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+
+	select {
+	case e := <-s.events:
+		assert.IsType(s.T(), &EventNeighborHoldTimerExpired{}, e)
+	case <-time.After(s.neighborConfig.HoldTime / 2):
+		assert.FailNow(s.T(), "read deadline not reached before hold timer")
+	}
+	s.failNowIfNotStateTransition(IdleState)
+
+	msgs, err := s.readMessagesFromConn()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	if assert.Len(s.T(), msgs, 1) && assert.IsType(s.T(), &NotificationMessage{}, msgs[0]) {
+		assert.Equal(s.T(), msgs[0].(*NotificationMessage).Code, NotifErrCodeHoldTimerExpired)
+	}
+}
+
 // advance to established state and send a keepalive
 func (s *fsmTestSuite) TestFSMEstablishedSendKA() {
 	s.advanceToEstablishedState()
@@ -312,6 +525,82 @@ func (s *fsmTestSuite) TestFSMEstablishedSendKA() {
 	assert.Nil(s.T(), err)
 }
 
+func (s *fsmTestSuite) nodeUpdate(asns ...uint32) *UpdateMessage {
+	nlri := make([]LinkStateNlri, 0, len(asns))
+	for _, asn := range asns {
+		nlri = append(nlri, &LinkStateNlriNode{
+			ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+			LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: asn}},
+		})
+	}
+	return &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: nlri,
+			},
+		},
+	}
+}
+
+func (s *fsmTestSuite) sendUpdate(u *UpdateMessage) {
+	b, err := u.serialize()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	_, err = s.conn.Write(b)
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+}
+
+// advance to established state with MaxObjects set and send updates
+// expect a Cease notification once the limit is exceeded
+func (s *fsmTestSuite) TestFSMEstablishedMaxObjects() {
+	s.advanceToEstablishedState()
+	c := *s.neighborConfig
+	c.MaxObjects = 2
+	s.fsm.setConfig(&c)
+
+	// duplicate nlri are counted once
+	s.sendUpdate(s.nodeUpdate(1, 2, 2))
+	e := <-s.events
+	assert.IsType(s.T(), &EventNeighborUpdateReceived{}, e)
+	assert.Equal(s.T(), s.fsm.status().Objects, 2)
+
+	// withdrawn nlri are no longer counted
+	withdraw := s.nodeUpdate(2)
+	withdraw.PathAttrs = []PathAttr{
+		&PathAttrMpUnreach{
+			Afi:  BgpLsAfi,
+			Safi: BgpLsSafi,
+			Nlri: withdraw.PathAttrs[1].(*PathAttrMpReach).Nlri,
+		},
+	}
+	s.sendUpdate(withdraw)
+	e = <-s.events
+	assert.IsType(s.T(), &EventNeighborUpdateReceived{}, e)
+	assert.Equal(s.T(), s.fsm.status().Objects, 1)
+
+	s.sendUpdate(s.nodeUpdate(3, 4))
+	m, err := s.readMessagesFromConn()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	if assert.Len(s.T(), m, 1) && assert.IsType(s.T(), &NotificationMessage{}, m[0]) {
+		n := m[0].(*NotificationMessage)
+		assert.Equal(s.T(), n.Code, NotifErrCodeCease)
+		assert.Equal(s.T(), n.Subcode, NotifErrSubcodeMaxPrefixesReached)
+		assert.Equal(s.T(), n.Data, []byte{64, 4, 71, 0, 0, 0, 2})
+	}
+	e = <-s.events
+	assert.IsType(s.T(), &EventNeighborErr{}, e)
+	s.failNowIfNotStateTransition(IdleState)
+	assert.Equal(s.T(), s.fsm.status().Objects, 0)
+}
+
 // advance to established state and send an update message
 // expect EventNeighborUpdateReceived
 func (s *fsmTestSuite) TestFSMEstablishedSendUpdate() {
@@ -331,12 +620,151 @@ func (s *fsmTestSuite) TestFSMEstablishedSendUpdate() {
 		assert.FailNow(s.T(), err.Error())
 	}
 
+	e := <-s.events
+	if assert.IsType(s.T(), &EventNeighborUpdateReceived{}, e) {
+		assert.Equal(s.T(), e.(*EventNeighborUpdateReceived).Message, u)
+		assert.Equal(s.T(), e.(*EventNeighborUpdateReceived).PeerRouterID, net.ParseIP("127.0.0.1").To4())
+	}
+}
+
+// advance to established state and send an update message split across
+// multiple writes, expect EventNeighborUpdateReceived
+func (s *fsmTestSuite) TestFSMEstablishedSendSplitUpdate() {
+	s.advanceToEstablishedState()
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrLocalPref{Preference: 100},
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+		},
+	}
+	b, err := u.serialize()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	for _, chunk := range [][]byte{b[:10], b[10:20], b[20:]} {
+		_, err = s.conn.Write(chunk)
+		if err != nil {
+			assert.FailNow(s.T(), err.Error())
+		}
+	}
+
 	e := <-s.events
 	if assert.IsType(s.T(), &EventNeighborUpdateReceived{}, e) {
 		assert.Equal(s.T(), e.(*EventNeighborUpdateReceived).Message, u)
 	}
 }
 
+// advance to established state with an attribute discard policy and send an
+// update containing a malformed link state attribute
+// expect EventNeighborUpdateWarning followed by EventNeighborUpdateReceived
+func (s *fsmTestSuite) TestFSMEstablishedSendMalformedUpdateDiscard() {
+	s.advanceToEstablishedState()
+	c := *s.neighborConfig
+	c.UpdateErrorPolicy.OptionalAttr = UpdateErrorActionAttributeDiscard
+	s.fsm.setConfig(&c)
+
+	b := prependHeader(malformedLinkStateUpdate(s.T()), UpdateMessageType)
+	_, err := s.conn.Write(b)
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+
+	e := <-s.events
+	assert.IsType(s.T(), &EventNeighborUpdateWarning{}, e)
+	e = <-s.events
+	if assert.IsType(s.T(), &EventNeighborUpdateReceived{}, e) {
+		assert.Len(s.T(), e.(*EventNeighborUpdateReceived).Message.PathAttrs, 2)
+	}
+}
+
+func (s *fsmTestSuite) mismatchedLinkStateUpdate() *UpdateMessage {
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: []LinkStateNlri{
+					&LinkStateNlriNode{
+						ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+						LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+					},
+				},
+			},
+			&PathAttrLinkState{
+				LinkAttrs: []LinkAttr{&LinkAttrIgpMetric{Metric: 10}},
+			},
+		},
+	}
+	b, err := u.serialize()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	_, err = s.conn.Write(b)
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+
+	return u
+}
+
+// advance to established state and send an update message with link attrs
+// accompanying a node nlri, expect EventNeighborUpdateWarning followed by
+// EventNeighborUpdateReceived
+func (s *fsmTestSuite) TestFSMEstablishedSendMismatchedUpdate() {
+	s.advanceToEstablishedState()
+	s.mismatchedLinkStateUpdate()
+
+	e := <-s.events
+	if assert.IsType(s.T(), &EventNeighborUpdateWarning{}, e) {
+		assert.NotNil(s.T(), e.(*EventNeighborUpdateWarning).Err)
+	}
+	e = <-s.events
+	assert.IsType(s.T(), &EventNeighborUpdateReceived{}, e)
+}
+
+// same as above with StrictAttrValidation, expect EventNeighborErr
+func (s *fsmTestSuite) TestFSMEstablishedSendMismatchedUpdateStrict() {
+	s.advanceToEstablishedState()
+	c := *s.neighborConfig
+	c.StrictAttrValidation = true
+	s.fsm.setConfig(&c)
+	s.mismatchedLinkStateUpdate()
+
+	e := <-s.events
+	assert.IsType(s.T(), &EventNeighborErr{}, e)
+	s.failNowIfNotStateTransition(IdleState)
+}
+
+// advance to established state and send an update message followed by an
+// invalid message in a single write, expect EventNeighborUpdateReceived
+// before EventNeighborErr
+func (s *fsmTestSuite) TestFSMEstablishedSendUpdateThenInvalid() {
+	s.advanceToEstablishedState()
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrLocalPref{Preference: 100},
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+		},
+	}
+	b, err := u.serialize()
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+	_, err = s.conn.Write(append(b, 0))
+	if err != nil {
+		assert.FailNow(s.T(), err.Error())
+	}
+
+	e := <-s.events
+	if assert.IsType(s.T(), &EventNeighborUpdateReceived{}, e) {
+		assert.Equal(s.T(), e.(*EventNeighborUpdateReceived).Message, u)
+	}
+	e = <-s.events
+	assert.IsType(s.T(), &EventNeighborErr{}, e)
+	s.failNowIfNotStateTransition(IdleState)
+}
+
 // advance to established state and send a notification message
 // expect EventNeighborNotificationReceived
 func (s *fsmTestSuite) TestFSMEstablishedSendNotif() {
@@ -378,3 +806,861 @@ func TestFSM(t *testing.T) {
 	s := &fsmTestSuite{}
 	suite.Run(t, s)
 }
+
+// fakeClock is a clock whose time only changes when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{
+		clock: c,
+		c:     make(chan time.Time, 1),
+	}
+	c.timers = append(c.timers, t)
+	t.reset(d)
+	return t
+}
+
+// advance moves the clock forward by d, firing the timers that expire.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		t.fireIfExpired()
+	}
+}
+
+// active returns the number of timers that have been started and have not
+// expired or been stopped.
+func (c *fakeClock) active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+// waitActive blocks until n timers are active. Timers are reset by the fsm
+// asynchronously, so this must be called before advancing the clock to a
+// timer's next expiry.
+func (c *fakeClock) waitActive(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second * 5)
+	for c.active() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d active timers", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fakeTimer is a timer created by fakeClock, it follows the semantics of
+// time.Timer where an expired timer's channel must be drained before reuse.
+type fakeTimer struct {
+	clock  *fakeClock
+	c      chan time.Time
+	when   time.Time
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.reset(d)
+}
+
+func (t *fakeTimer) reset(d time.Duration) bool {
+	wasActive := t.active
+	t.when = t.clock.now.Add(d)
+	t.active = true
+	t.fireIfExpired()
+	return wasActive
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func (t *fakeTimer) fireIfExpired() {
+	if t.active && !t.when.After(t.clock.now) {
+		t.active = false
+		t.c <- t.clock.now
+	}
+}
+
+// pipePeer is a mock neighbor connected to a standardFSM over net.Pipe.
+type pipePeer struct {
+	t      *testing.T
+	config *NeighborConfig
+	fsm    *standardFSM
+	clock  *fakeClock
+	events chan Event
+	// conns provides the fsm's end of a pipe to each dial attempt
+	conns chan net.Conn
+	conn  net.Conn
+	enc   *Encoder
+	// msgs receives the messages sent by the fsm, it is buffered so that
+	// writes by the fsm do not block on the test
+	msgs chan Message
+}
+
+// newPipePeer returns a pipePeer whose fsm has connected to it and is in
+// OpenSentState.
+func newPipePeer(t *testing.T) *pipePeer {
+	return newPipePeerWithConfig(t, &NeighborConfig{
+		Address:  net.ParseIP("127.0.0.1"),
+		ASN:      64512,
+		HoldTime: time.Second * 3,
+	})
+}
+
+// newPipePeerWithConfig is newPipePeer with the fsm configured by config.
+func newPipePeerWithConfig(t *testing.T, config *NeighborConfig) *pipePeer {
+	p := &pipePeer{
+		t:      t,
+		config: config,
+		events: make(chan Event),
+		conns:  make(chan net.Conn, 1),
+		clock:  newFakeClock(),
+	}
+	p.accept()
+
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		select {
+		case c := <-p.conns:
+			return c, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	p.fsm = newStandardFSM(p.config, p.events, net.ParseIP("127.0.0.2").To4(), 64512, 179, false, false, dial, p.clock)
+
+	p.expectState(IdleState)
+	p.expectState(ConnectState)
+	p.expectEvent(&EventNeighborConnected{})
+	p.expectState(OpenSentState)
+	p.expectMessage(&openMessage{})
+
+	return p
+}
+
+// accept provides a new pipe to the fsm's next dial attempt, replacing the
+// peer's end of any previous one.
+func (p *pipePeer) accept() {
+	local, remote := net.Pipe()
+	msgs := make(chan Message, 16)
+	p.conn = remote
+	p.enc = NewEncoder(remote)
+	p.msgs = msgs
+	p.conns <- local
+
+	go func() {
+		defer close(msgs)
+		d := NewDecoder(remote)
+		for {
+			m, err := d.Decode()
+			if err != nil {
+				return
+			}
+			msgs <- m
+		}
+	}()
+}
+
+// establish drives the fsm from OpenSentState to EstablishedState.
+func (p *pipePeer) establish(caps ...capability) {
+	o, err := newOpenMessage(p.config.ASN, p.config.HoldTime, net.ParseIP("127.0.0.1"))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	for _, c := range caps {
+		o.addCapability(c)
+	}
+	p.send(o)
+	p.expectMessage(&keepAliveMessage{})
+	p.expectEvent(&EventNeighborTimersNegotiated{})
+	p.expectState(OpenConfirmState)
+
+	p.send(&keepAliveMessage{})
+	p.expectState(EstablishedState)
+}
+
+// send writes m to the fsm.
+func (p *pipePeer) send(m Message) {
+	err := p.enc.Encode(m)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// expectMessage receives the next message from the fsm and fails the test if
+// it is not of the same type as m.
+func (p *pipePeer) expectMessage(m Message) Message {
+	got, ok := <-p.msgs
+	if !ok {
+		p.t.Fatal("connection closed")
+	}
+	if !assert.IsType(p.t, m, got) {
+		p.t.FailNow()
+	}
+	return got
+}
+
+// expectEvent receives the next event from the fsm and fails the test if it
+// is not of the same type as e.
+func (p *pipePeer) expectEvent(e Event) Event {
+	got := <-p.events
+	if !assert.IsType(p.t, e, got) {
+		p.t.FailNow()
+	}
+	return got
+}
+
+// expectState fails the test if the next event from the fsm is not a
+// transition to state.
+func (p *pipePeer) expectState(state FSMState) {
+	e := p.expectEvent(&EventNeighborStateTransition{})
+	if !assert.Equal(p.t, state, e.(*EventNeighborStateTransition).State) {
+		p.t.FailNow()
+	}
+}
+
+// close closes the peer's end of the pipe and terminates the fsm.
+func (p *pipePeer) close() {
+	p.conn.Close()
+	p.fsm.terminate()
+}
+
+func TestPipePeerUpdate(t *testing.T) {
+	p := newPipePeer(t)
+	defer p.close()
+	p.establish()
+
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: []LinkStateNlri{
+					&LinkStateNlriNode{
+						ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+						LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+					},
+				},
+			},
+		},
+	}
+	p.send(u)
+
+	e := p.expectEvent(&EventNeighborUpdateReceived{})
+	assert.Equal(t, u, e.(*EventNeighborUpdateReceived).Message)
+	assert.Equal(t, 1, p.fsm.status().Objects)
+}
+
+func TestPipePeerNotification(t *testing.T) {
+	p := newPipePeer(t)
+	defer p.close()
+	p.establish()
+
+	n := &NotificationMessage{
+		Code:    NotifErrCodeCease,
+		Subcode: NotifErrSubcodeAdminShutdown,
+	}
+	p.send(n)
+
+	e := p.expectEvent(&EventNeighborNotificationReceived{})
+	assert.Equal(t, n, e.(*EventNeighborNotificationReceived).Message)
+	p.expectState(IdleState)
+}
+
+// expectNotification receives messages from the fsm until a notification
+// is received, keepalives are skipped.
+func (p *pipePeer) expectNotification() *NotificationMessage {
+	for {
+		m, ok := <-p.msgs
+		if !ok {
+			p.t.Fatal("connection closed")
+		}
+		switch m := m.(type) {
+		case *keepAliveMessage:
+		case *NotificationMessage:
+			return m
+		default:
+			p.t.Fatalf("unexpected message type: %s", m.MessageType())
+		}
+	}
+}
+
+func TestPipePeerKeepAlive(t *testing.T) {
+	p := newPipePeer(t)
+	defer p.close()
+	p.establish()
+
+	keepAliveTime := p.config.HoldTime / 3
+	for i := 0; i < 3; i++ {
+		// keepalive and hold timers
+		p.clock.waitActive(t, 2)
+
+		p.clock.advance(keepAliveTime - time.Millisecond)
+		select {
+		case m := <-p.msgs:
+			t.Fatalf("unexpected %s message before keepalive time", m.MessageType())
+		case <-time.After(time.Millisecond * 10):
+		}
+
+		p.clock.advance(time.Millisecond)
+		p.expectMessage(&keepAliveMessage{})
+
+		// reset the hold timer
+		p.send(&keepAliveMessage{})
+	}
+}
+
+func TestPipePeerHoldTimerExpired(t *testing.T) {
+	p := newPipePeer(t)
+	defer p.close()
+	p.establish()
+
+	// advance to the hold time in keepalive intervals so the keepalive
+	// timer is reset before each advance
+	keepAliveTime := p.config.HoldTime / 3
+	for i := 0; i < 3; i++ {
+		p.clock.waitActive(t, 2)
+		p.clock.advance(keepAliveTime)
+	}
+
+	n := p.expectNotification()
+	assert.Equal(t, NotifErrCodeHoldTimerExpired, n.Code)
+	p.expectEvent(&EventNeighborHoldTimerExpired{})
+	p.expectState(IdleState)
+}
+
+func TestPipePeerSlowConsumerEstablished(t *testing.T) {
+	p := newPipePeer(t)
+	defer p.close()
+
+	o, err := newOpenMessage(p.config.ASN, p.config.HoldTime, net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.send(o)
+	p.expectMessage(&keepAliveMessage{})
+	p.expectEvent(&EventNeighborTimersNegotiated{})
+	p.expectState(OpenConfirmState)
+	p.send(&keepAliveMessage{})
+
+	// the transition to EstablishedState is not received for longer than
+	// the hold time
+	keepAliveTime := p.config.HoldTime / 3
+	for i := 0; i < 6; i++ {
+		p.clock.waitActive(t, 2)
+		p.clock.advance(keepAliveTime)
+		p.expectMessage(&keepAliveMessage{})
+	}
+
+	p.expectState(EstablishedState)
+	p.send(&keepAliveMessage{})
+	p.clock.waitActive(t, 2)
+	p.clock.advance(keepAliveTime)
+	p.expectMessage(&keepAliveMessage{})
+}
+
+func TestPipePeerSlowConsumer(t *testing.T) {
+	p := newPipePeer(t)
+	defer p.close()
+	p.establish()
+
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+		},
+	}
+	p.send(u)
+
+	// the update event is not received for longer than the hold time
+	keepAliveTime := p.config.HoldTime / 3
+	for i := 0; i < 6; i++ {
+		p.clock.waitActive(t, 2)
+		p.clock.advance(keepAliveTime)
+		p.expectMessage(&keepAliveMessage{})
+	}
+
+	p.expectEvent(&EventNeighborUpdateReceived{})
+	assert.Equal(t, EstablishedState, p.fsm.status().State)
+}
+
+func TestPipePeerRouteRefresh(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		AddressFamilies: []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSpfSafi}},
+		RouteRefresh:    true,
+	})
+	defer p.close()
+
+	o, err := newOpenMessage(p.config.ASN, p.config.HoldTime, net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.addCapability(&capRouteRefresh{})
+	p.send(o)
+	p.expectMessage(&keepAliveMessage{})
+	p.expectEvent(&EventNeighborTimersNegotiated{})
+	p.expectState(OpenConfirmState)
+	p.send(&keepAliveMessage{})
+	p.expectState(EstablishedState)
+
+	// not advertised by the neighbor, ignored
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Safi: BgpLsSpfSafi})
+
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Safi: BgpLsSafi})
+	e := p.expectEvent(&EventNeighborRouteRefreshRequested{})
+	assert.Equal(t, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}, e.(*EventNeighborRouteRefreshRequested).Family)
+	assert.Equal(t, uint64(2), p.fsm.status().Counters.MessagesIn[RouteRefreshMessageType])
+
+	// enhanced route refresh was not negotiated, the subtype is reserved
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Subtype: RouteRefreshSubtypeEoRR, Safi: BgpLsSafi})
+	p.expectEvent(&EventNeighborRouteRefreshRequested{})
+}
+
+func TestPipePeerEnhancedRouteRefresh(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:      net.ParseIP("127.0.0.1"),
+		ASN:          64512,
+		HoldTime:     time.Second * 3,
+		RouteRefresh: true,
+	})
+	defer p.close()
+
+	o, err := newOpenMessage(p.config.ASN, p.config.HoldTime, net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.addCapability(&capRouteRefresh{})
+	o.addCapability(&capEnhancedRouteRefresh{})
+	p.send(o)
+	p.expectMessage(&keepAliveMessage{})
+	p.expectEvent(&EventNeighborTimersNegotiated{})
+	p.expectState(OpenConfirmState)
+	p.send(&keepAliveMessage{})
+	p.expectState(EstablishedState)
+
+	family := AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Subtype: RouteRefreshSubtypeBoRR, Safi: BgpLsSafi})
+	e := p.expectEvent(&EventNeighborBeginRouteRefresh{})
+	assert.Equal(t, family, e.(*EventNeighborBeginRouteRefresh).Family)
+
+	// unknown subtype is ignored
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Subtype: 3, Safi: BgpLsSafi})
+
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Subtype: RouteRefreshSubtypeEoRR, Safi: BgpLsSafi})
+	e = p.expectEvent(&EventNeighborEndOfRIB{})
+	assert.Equal(t, family, e.(*EventNeighborEndOfRIB).Family)
+	assert.True(t, e.(*EventNeighborEndOfRIB).RouteRefresh)
+
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Safi: BgpLsSafi})
+	p.expectEvent(&EventNeighborRouteRefreshRequested{})
+}
+
+func TestPipePeerEndOfRIB(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		GracefulRestart: true,
+	})
+	defer p.close()
+	p.establish(&capGracefulRestart{
+		restartTime: 120,
+		families: []gracefulRestartFamily{
+			{afi: BgpLsAfi, safi: BgpLsSafi},
+		},
+	})
+	assert.False(t, p.fsm.status().EndOfRIB)
+	assert.False(t, isClosed(p.fsm.ready()))
+
+	p.send(&UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi},
+		},
+	})
+	p.expectEvent(&EventNeighborUpdateReceived{})
+	e := p.expectEvent(&EventNeighborEndOfRIB{})
+	assert.Equal(t, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}, e.(*EventNeighborEndOfRIB).Family)
+	assert.False(t, e.(*EventNeighborEndOfRIB).RouteRefresh)
+	select {
+	case <-p.fsm.ready():
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for end-of-rib")
+	}
+	assert.True(t, p.fsm.status().EndOfRIB)
+
+	p.send(&UpdateMessage{})
+	p.expectEvent(&EventNeighborUpdateReceived{})
+	e = p.expectEvent(&EventNeighborEndOfRIB{})
+	assert.Equal(t, AfiSafi{Afi: IPv4Afi, Safi: UnicastSafi}, e.(*EventNeighborEndOfRIB).Family)
+}
+
+func TestPipePeerReadyWithoutGracefulRestart(t *testing.T) {
+	p := newPipePeer(t)
+	defer p.close()
+	p.establish()
+
+	// End-of-RIB is not required without graceful restart
+	select {
+	case <-p.fsm.ready():
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for ready")
+	}
+	assert.False(t, p.fsm.status().EndOfRIB)
+}
+
+func TestPipePeerRouteRefreshNotNegotiated(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:      net.ParseIP("127.0.0.1"),
+		ASN:          64512,
+		HoldTime:     time.Second * 3,
+		RouteRefresh: true,
+	})
+	defer p.close()
+	p.establish()
+
+	p.send(&RouteRefreshMessage{Afi: BgpLsAfi, Safi: BgpLsSafi})
+	n := p.expectNotification()
+	assert.Equal(t, NotifErrCodeMessageHeader, n.Code)
+	assert.Equal(t, NotifErrSubcodeBadType, n.Subcode)
+	p.expectEvent(&EventNeighborErr{})
+	p.expectState(IdleState)
+}
+
+func TestPipePeerEarlyUpdate(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		p := newPipePeerWithConfig(t, &NeighborConfig{
+			Address:          net.ParseIP("127.0.0.1"),
+			ASN:              64512,
+			HoldTime:         time.Second * 3,
+			AllowEarlyUpdate: allow,
+		})
+		o, err := newOpenMessage(p.config.ASN, p.config.HoldTime, net.ParseIP("127.0.0.1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.send(o)
+		p.expectMessage(&keepAliveMessage{})
+		p.expectEvent(&EventNeighborTimersNegotiated{})
+		p.expectState(OpenConfirmState)
+
+		p.send(gracefulRestartNode())
+		if !allow {
+			n := p.expectNotification()
+			assert.Equal(t, NotifErrCodeMessageHeader, n.Code)
+			p.expectEvent(&EventNeighborErr{})
+			p.expectState(IdleState)
+			p.close()
+			continue
+		}
+		p.expectState(EstablishedState)
+		e := p.expectEvent(&EventNeighborUpdateReceived{})
+		assert.Len(t, e.(*EventNeighborUpdateReceived).Message.PathAttrs, 2)
+		assert.Equal(t, 1, p.fsm.status().Objects)
+
+		p.send(&keepAliveMessage{})
+		p.send(&UpdateMessage{})
+		p.expectEvent(&EventNeighborUpdateReceived{})
+		p.expectEvent(&EventNeighborEndOfRIB{})
+		p.close()
+	}
+}
+
+func gracefulRestartNode() *UpdateMessage {
+	return &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: []LinkStateNlri{
+					&LinkStateNlriNode{
+						ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+						LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// restartPipePeer establishes a graceful restart capable session with p,
+// advertises a node, then drops and re-establishes the session, returning the
+// EventTopologyStale.
+func restartPipePeer(p *pipePeer, forwardingState bool) *EventTopologyStale {
+	gr := func(forwardingState bool) capability {
+		return &capGracefulRestart{
+			restartTime: 120,
+			families: []gracefulRestartFamily{
+				{afi: BgpLsAfi, safi: BgpLsSafi, forwardingState: forwardingState},
+			},
+		}
+	}
+	p.establish(gr(false))
+	p.send(gracefulRestartNode())
+	p.expectEvent(&EventNeighborUpdateReceived{})
+
+	p.conn.Close()
+	p.expectEvent(&EventNeighborErr{})
+	stale := p.expectEvent(&EventTopologyStale{}).(*EventTopologyStale)
+	p.expectState(IdleState)
+	p.expectState(ConnectState)
+	assert.Equal(p.t, 0, p.fsm.status().Objects)
+	assert.Equal(p.t, 1, p.fsm.status().StaleObjects)
+
+	p.accept()
+	p.expectEvent(&EventNeighborConnected{})
+	p.expectState(OpenSentState)
+	p.expectMessage(&openMessage{})
+	p.establish(gr(forwardingState))
+
+	return stale
+}
+
+func TestPipePeerGracefulRestart(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		GracefulRestart: true,
+	})
+	defer p.close()
+
+	key := gracefulRestartNode().PathAttrs[1].(*PathAttrMpReach).Nlri[0].Key()
+	stale := restartPipePeer(p, true)
+	assert.Equal(t, []string{key}, stale.Objects)
+	assert.Equal(t, time.Second*120, stale.RestartTime)
+	assert.Equal(t, 1, p.fsm.status().StaleObjects)
+
+	p.send(&UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi},
+		},
+	})
+	p.expectEvent(&EventNeighborUpdateReceived{})
+	p.expectEvent(&EventNeighborEndOfRIB{})
+	e := p.expectEvent(&EventTopologyReconciled{})
+	assert.Equal(t, []string{key}, e.(*EventTopologyReconciled).Purged)
+	assert.False(t, e.(*EventTopologyReconciled).Expired)
+	assert.Equal(t, 0, p.fsm.status().StaleObjects)
+}
+
+func TestPipePeerGracefulRestartReadvertised(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		GracefulRestart: true,
+	})
+	defer p.close()
+
+	restartPipePeer(p, true)
+	p.send(gracefulRestartNode())
+	p.expectEvent(&EventNeighborUpdateReceived{})
+	assert.Equal(t, 1, p.fsm.status().Objects)
+	assert.Equal(t, 0, p.fsm.status().StaleObjects)
+
+	p.send(&UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi},
+		},
+	})
+	p.expectEvent(&EventNeighborUpdateReceived{})
+	p.expectEvent(&EventNeighborEndOfRIB{})
+	e := p.expectEvent(&EventTopologyReconciled{})
+	assert.Len(t, e.(*EventTopologyReconciled).Purged, 0)
+}
+
+func TestPipePeerGracefulRestartForwardingStateLost(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		GracefulRestart: true,
+	})
+	defer p.close()
+
+	restartPipePeer(p, false)
+	e := p.expectEvent(&EventTopologyReconciled{})
+	assert.Len(t, e.(*EventTopologyReconciled).Purged, 1)
+	assert.False(t, e.(*EventTopologyReconciled).Expired)
+}
+
+func TestPipePeerGracefulRestartExpired(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		GracefulRestart: true,
+	})
+	defer p.close()
+
+	p.establish(&capGracefulRestart{
+		restartTime: 120,
+		families: []gracefulRestartFamily{
+			{afi: BgpLsAfi, safi: BgpLsSafi},
+		},
+	})
+	p.send(gracefulRestartNode())
+	p.expectEvent(&EventNeighborUpdateReceived{})
+
+	// the session is not re-established within the restart time
+	p.conn.Close()
+	p.expectEvent(&EventNeighborErr{})
+	p.expectEvent(&EventTopologyStale{})
+	p.expectState(IdleState)
+	p.expectState(ConnectState)
+
+	// connect retry and stale timers
+	p.clock.waitActive(t, 2)
+	p.clock.advance(time.Second * 120)
+	e := p.expectEvent(&EventTopologyReconciled{})
+	assert.Len(t, e.(*EventTopologyReconciled).Purged, 1)
+	assert.True(t, e.(*EventTopologyReconciled).Expired)
+	assert.Equal(t, 0, p.fsm.status().StaleObjects)
+}
+
+func TestPipePeerGracefulRestartTerminated(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		GracefulRestart: true,
+	})
+
+	key := gracefulRestartNode().PathAttrs[1].(*PathAttrMpReach).Nlri[0].Key()
+	restartPipePeer(p, true)
+	p.close()
+
+	// stale objects remain until purged by the collector
+	e := p.fsm.purgeStale(false)
+	if assert.NotNil(t, e) {
+		assert.Equal(t, []string{key}, e.(*EventTopologyReconciled).Purged)
+		assert.False(t, e.(*EventTopologyReconciled).Expired)
+	}
+	assert.Nil(t, p.fsm.purgeStale(false))
+}
+
+func TestPipePeerGracefulRestartNotNegotiated(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:         net.ParseIP("127.0.0.1"),
+		ASN:             64512,
+		HoldTime:        time.Second * 3,
+		GracefulRestart: true,
+	})
+	defer p.close()
+
+	p.establish()
+	p.send(gracefulRestartNode())
+	p.expectEvent(&EventNeighborUpdateReceived{})
+
+	p.conn.Close()
+	p.expectEvent(&EventNeighborErr{})
+	p.expectState(IdleState)
+	assert.Equal(t, 0, p.fsm.status().StaleObjects)
+}
+
+func TestPipePeerMinHoldTime(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:     net.ParseIP("127.0.0.1"),
+		ASN:         64512,
+		HoldTime:    time.Second * 90,
+		MinHoldTime: time.Second * 30,
+	})
+	defer p.close()
+
+	o, err := newOpenMessage(p.config.ASN, time.Second*9, net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.send(o)
+	n := p.expectNotification()
+	assert.Equal(t, NotifErrCodeOpenMessage, n.Code)
+	assert.Equal(t, NotifErrSubcodeUnacceptableHoldTime, n.Subcode)
+	p.expectEvent(&EventNeighborErr{})
+	p.expectState(IdleState)
+}
+
+func TestPipePeerOpenTimeout(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:     net.ParseIP("127.0.0.1"),
+		ASN:         64512,
+		HoldTime:    time.Second * 30,
+		OpenTimeout: time.Second * 5,
+	})
+	defer p.close()
+
+	p.clock.waitActive(t, 1)
+	p.clock.advance(time.Second * 5)
+
+	n := p.expectNotification()
+	assert.Equal(t, NotifErrCodeHoldTimerExpired, n.Code)
+	p.expectEvent(&EventNeighborHoldTimerExpired{})
+	p.expectState(IdleState)
+}
+
+func TestPipePeerOpenTimeoutOpenConfirm(t *testing.T) {
+	p := newPipePeerWithConfig(t, &NeighborConfig{
+		Address:     net.ParseIP("127.0.0.1"),
+		ASN:         64512,
+		HoldTime:    time.Second * 30,
+		OpenTimeout: time.Second * 5,
+	})
+	defer p.close()
+
+	p.clock.waitActive(t, 1)
+	p.clock.advance(time.Second * 3)
+
+	o, err := newOpenMessage(p.config.ASN, p.config.HoldTime, net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.send(o)
+	p.expectMessage(&keepAliveMessage{})
+	p.expectEvent(&EventNeighborTimersNegotiated{})
+	p.expectState(OpenConfirmState)
+
+	// the remainder of the open timeout applies rather than the hold time
+	p.clock.waitActive(t, 1)
+	p.clock.advance(time.Second * 2)
+
+	n := p.expectNotification()
+	assert.Equal(t, NotifErrCodeHoldTimerExpired, n.Code)
+	p.expectEvent(&EventNeighborHoldTimerExpired{})
+	p.expectState(IdleState)
+}
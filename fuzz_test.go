@@ -0,0 +1,60 @@
+//go:build go1.18
+// +build go1.18
+
+package bgpls
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// The fuzz tests require Go 1.18, the rest of the package supports older
+// versions.
+
+func FuzzParseMessages(f *testing.F) {
+	for _, m := range []Message{
+		&keepAliveMessage{},
+		&NotificationMessage{Code: NotifErrCodeCease, Subcode: NotifErrSubcodeAdminShutdown},
+		&UpdateMessage{PathAttrs: fullTopologyPathAttrs()},
+	} {
+		b, err := m.serialize()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	o, err := newOpenMessage(64512, time.Second*30, net.ParseIP("172.16.0.1"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	b, err := o.serialize()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		messagesFromBytes(b, decodeOptions{})
+		messagesFromBytes(b, decodeOptions{strict: true})
+		messagesFromBytes(b, decodeOptions{policy: UpdateErrorPolicy{
+			OptionalAttr: UpdateErrorActionAttributeDiscard,
+			MpReach:      UpdateErrorActionTreatAsWithdraw,
+		}})
+	})
+}
+
+func FuzzParsePathAttrs(f *testing.F) {
+	b, err := (&UpdateMessage{PathAttrs: fullTopologyPathAttrs()}).serialize()
+	if err != nil {
+		f.Fatal(err)
+	}
+	// header, withdrawn routes len and path attribute len
+	f.Add(b[23:])
+	f.Add(malformedLinkStateUpdate(f)[4:])
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		deserializePathAttrs(b, decodeOptions{})
+		deserializePathAttrs(b, decodeOptions{strict: true})
+	})
+}
@@ -1,15 +1,172 @@
 package bgpls
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
 	"net"
 	"time"
 )
 
 // NeighborConfig is the configuration for a BGP-LS neighbor.
+// HoldTime is advertised to the neighbor, the negotiated hold time is the smaller of it and the
+// neighbor's. It is not enforced while an event waits on a full events channel.
+// OpenTimeout is optional, if set it bounds the time from connecting to the neighbor until the
+// session is established, otherwise a neighbor that never sends its OPEN message is dropped after
+// 4 minutes. Expiry results in an EventNeighborHoldTimerExpired.
+// MinHoldTime is optional, if set a hold time advertised by the neighbor below it is refused with
+// an Unacceptable Hold Time notification. It must be 0 or >= 3s and cannot exceed HoldTime.
+// LocalASN is optional, it overrides the CollectorConfig ASN for this neighbor.
+// RouterID is optional, it overrides the CollectorConfig RouterID for this neighbor.
+// PeerRouterID is optional, if set the BGP Identifier in the neighbor's OPEN message must match it.
+// StrictAttrValidation causes inconsistent or unknown LINK_STATE attributes and nlri descriptors to
+// be treated as an error, otherwise they result in an EventNeighborUpdateWarning or are preserved
+// as unknown TLVs, e.g. NodeAttrUnknown.
+// RequireWellKnownAttrs causes an UPDATE message advertising NLRI without ORIGIN, AS_PATH or, for
+// IPv4 unicast NLRI, NEXT_HOP to be refused with a Missing Well-known Attribute notification.
+// AllowMissingBgpLs permits a session with a neighbor that does not advertise the BGP-LS AFI/SAFI,
+// an EventNeighborCapabilityMismatch is generated regardless.
+// AllowEarlyUpdate causes an UPDATE message received in OpenConfirmState to be accepted in place of
+// the neighbor's KEEPALIVE, otherwise the session is refused with a notification.
+// AllowUnknownOptParams causes OPEN message optional parameters other than capabilities to be
+// ignored, otherwise the session is refused with an Unsupported Optional Parameter notification.
+// Address may be an IPv4 or IPv6 address, the BGP Identifier is always sourced from RouterID.
+// Port is optional, it defaults to 179.
+// TCPKeepAlive is optional, if set it is the TCP keepalive period of connections to the neighbor,
+// a negative value disables TCP keepalives. Changes apply to the next connection.
+// UpdateErrorPolicy selects how malformed update messages are handled, the zero value
+// resets the session.
+// MaxObjects is optional, if set the session is reset with a Cease notification once the
+// neighbor advertises more BGP-LS NLRI than MaxObjects.
+// AddressFamilies are optional AFI/SAFIs advertised to and accepted from the neighbor in addition
+// to BGP-LS. NLRI of families other than BGP-LS and BGP-LS-SPF are preserved undecoded in RawNlri.
+// RouteRefresh causes the Route Refresh and Enhanced Route Refresh capabilities to be advertised,
+// requests from the neighbor result in an EventNeighborRouteRefreshRequested.
+// GracefulRestart causes the Graceful Restart capability to be advertised, objects are then
+// retained as stale across a lost session and purged once the neighbor sends End-of-RIB.
 type NeighborConfig struct {
-	Address  net.IP
-	ASN      uint32
-	HoldTime time.Duration
+	Address               net.IP
+	ASN                   uint32
+	HoldTime              time.Duration
+	MinHoldTime           time.Duration
+	OpenTimeout           time.Duration
+	LocalASN              uint32
+	RouterID              net.IP
+	PeerRouterID          net.IP
+	StrictAttrValidation  bool
+	RequireWellKnownAttrs bool
+	AllowMissingBgpLs     bool
+	AllowUnknownOptParams bool
+	AllowEarlyUpdate      bool
+	Port                  uint16
+	TCPKeepAlive          time.Duration
+	UpdateErrorPolicy     UpdateErrorPolicy
+	MaxObjects            uint32
+	AddressFamilies       []AfiSafi
+	RouteRefresh          bool
+	GracefulRestart       bool
+}
+
+// port returns the TCP port used to connect to the neighbor
+func (c *NeighborConfig) port() int {
+	if c.Port == 0 {
+		return 179
+	}
+	return int(c.Port)
+}
+
+// Validate checks c for values that cannot result in a working session.
+// RouterID is only validated if set as it may be sourced from the
+// CollectorConfig.
+func (c *NeighborConfig) Validate() error {
+	err := validateNeighborAddress(c.Address)
+	if err != nil {
+		return err
+	}
+
+	if c.ASN == 0 {
+		return errors.New("neighbor ASN cannot be 0")
+	}
+
+	// the hold time is advertised in seconds and must be 0 or >= 3, a hold
+	// time of 0 disables keepalives which is not supported
+	if c.HoldTime < 3*time.Second {
+		return fmt.Errorf("hold time must be >= 3s, got %s", c.HoldTime)
+	}
+	if c.HoldTime > math.MaxUint16*time.Second {
+		return fmt.Errorf("hold time must be <= %ds, got %s", math.MaxUint16, c.HoldTime)
+	}
+	if c.MinHoldTime != 0 && c.MinHoldTime < 3*time.Second {
+		return fmt.Errorf("min hold time must be 0 or >= 3s, got %s", c.MinHoldTime)
+	}
+	if c.MinHoldTime > c.HoldTime {
+		return fmt.Errorf("min hold time %s exceeds hold time %s", c.MinHoldTime, c.HoldTime)
+	}
+	if c.OpenTimeout < 0 {
+		return fmt.Errorf("open timeout cannot be negative, got %s", c.OpenTimeout)
+	}
+
+	if c.RouterID != nil {
+		err = validateRouterID(c.RouterID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.PeerRouterID != nil {
+		err = validateRouterID(c.PeerRouterID)
+		if err != nil {
+			return fmt.Errorf("invalid peer router ID: %v", err)
+		}
+	}
+
+	if c.UpdateErrorPolicy.OptionalAttr > UpdateErrorActionAttributeDiscard {
+		return fmt.Errorf("invalid update error policy action for optional attributes: %d", c.UpdateErrorPolicy.OptionalAttr)
+	}
+	if c.UpdateErrorPolicy.MpReach > UpdateErrorActionAttributeDiscard {
+		return fmt.Errorf("invalid update error policy action for mp reach: %d", c.UpdateErrorPolicy.MpReach)
+	}
+	if c.UpdateErrorPolicy.DuplicateAttr > UpdateErrorActionAttributeDiscard {
+		return fmt.Errorf("invalid update error policy action for duplicate attributes: %d", c.UpdateErrorPolicy.DuplicateAttr)
+	}
+
+	return nil
+}
+
+// NeighborStatus is a snapshot of a BGP-LS neighbor's state.
+// HoldTime is the negotiated hold time.
+// PeerRouterID is the BGP Identifier most recently advertised by the neighbor.
+// EstablishedSince is the zero value unless State is EstablishedState.
+// Objects is the number of BGP-LS NLRI currently advertised by the neighbor, it is 0 unless
+// State is EstablishedState.
+// StaleObjects is the number of BGP-LS NLRI retained across a graceful restart of the neighbor.
+// EndOfRIB is true once the neighbor has sent End-of-RIB for BGP-LS, it remains true across
+// subsequent sessions with the neighbor until it is reset.
+// LastErr is the most recent error encountered by the neighbor, if any.
+// Counters accumulate over the lifetime of the neighbor.
+type NeighborStatus struct {
+	Config           *NeighborConfig
+	State            FSMState
+	HoldTime         time.Duration
+	PeerRouterID     net.IP
+	EstablishedSince time.Time
+	Objects          int
+	StaleObjects     int
+	EndOfRIB         bool
+	LastErr          error
+	Counters         NeighborCounters
+}
+
+// NeighborCounters are the message and byte counters for a neighbor.
+// LastMessageIn and LastMessageOut are the zero value if no message has been received or sent.
+type NeighborCounters struct {
+	MessagesIn     map[MessageType]uint64
+	MessagesOut    map[MessageType]uint64
+	BytesIn        uint64
+	BytesOut       uint64
+	LastMessageIn  time.Time
+	LastMessageOut time.Time
 }
 
 type neighbor interface {
@@ -19,19 +176,68 @@ type neighbor interface {
 
 type standardNeighbor struct {
 	fsm
-	c *NeighborConfig
+	c     *NeighborConfig
+	queue *eventQueue
 }
 
-func newNeighbor(routerID net.IP, localASN uint32, config *NeighborConfig, events chan Event) neighbor {
+// newNeighbor creates a neighbor whose events are sent on events. If
+// eventQueueSize is non-zero the events pass through an eventQueue of that
+// size.
+func newNeighbor(routerID net.IP, localASN uint32, retainRaw, retainRawMessages bool, eventQueueSize uint64, config *NeighborConfig, events chan Event) neighbor {
 	n := &standardNeighbor{
 		c: config,
 	}
 
-	n.fsm = newFSM(n.config(), events, routerID, localASN, 179)
+	if eventQueueSize > 0 {
+		n.queue = newEventQueue(events, int(eventQueueSize))
+		events = n.queue.in
+	}
+
+	n.fsm = newFSM(n.config(), events, routerID, localASN, config.port(), retainRaw, retainRawMessages)
 
 	return n
 }
 
+func (n *standardNeighbor) terminate() {
+	n.fsm.terminate()
+	if n.queue != nil {
+		n.queue.terminate()
+	}
+}
+
 func (n *standardNeighbor) config() *NeighborConfig {
 	return n.c
 }
+
+func (n *standardNeighbor) setConfig(c *NeighborConfig) {
+	n.c = c
+	n.fsm.setConfig(c)
+}
+
+// validateNeighborAddress ensures address is usable as a neighbor transport
+// address. Both IPv4 and IPv6 addresses are valid.
+func validateNeighborAddress(address net.IP) error {
+	if len(address) != net.IPv4len && len(address) != net.IPv6len {
+		return errors.New("neighbor address must be an IPv4 or IPv6 address")
+	}
+
+	if address.IsUnspecified() {
+		return errors.New("neighbor address cannot be unspecified")
+	}
+
+	return nil
+}
+
+// validateRouterID ensures id is usable as a BGP Identifier.
+func validateRouterID(id net.IP) error {
+	v4 := id.To4()
+	if v4 == nil {
+		return errors.New("router ID must be an IPv4 address")
+	}
+
+	if binary.BigEndian.Uint32(v4) == 0 {
+		return errors.New("router ID cannot be 0")
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 )
 
 // MessageType describes the type of bgp message.
@@ -15,6 +16,7 @@ const (
 	UpdateMessageType       MessageType = 2
 	NotificationMessageType MessageType = 3
 	KeepAliveMessageType    MessageType = 4
+	RouteRefreshMessageType MessageType = 5
 )
 
 func (t MessageType) String() string {
@@ -27,11 +29,25 @@ func (t MessageType) String() string {
 		return "notification"
 	case KeepAliveMessageType:
 		return "keepalive"
+	case RouteRefreshMessageType:
+		return "route refresh"
 	default:
 		return "unknown"
 	}
 }
 
+// maxMessageLen is the maximum length of a bgp message, including the header,
+// in the absence of the Extended Message capability.
+//
+// https://tools.ietf.org/html/rfc4271#section-4.1
+const maxMessageLen = 4096
+
+// maxExtendedMessageLen is the maximum length of a bgp message, including the
+// header, with the Extended Message capability.
+//
+// https://tools.ietf.org/html/rfc8654#section-4
+const maxExtendedMessageLen = 65535
+
 // Message is a bgp message.
 type Message interface {
 	MessageType() MessageType
@@ -46,85 +62,371 @@ type errWithNotification struct {
 	data    []byte
 }
 
-func messagesFromBytes(b []byte) ([]Message, error) {
+// DecodeError is the error resulting from a message that failed to decode when
+// CollectorConfig.RetainRawMessages is set, e.g. the Err of an EventNeighborErr.
+// It retains the message as received for debugging.
+type DecodeError struct {
+	Err error
+	raw []byte
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// RawBytes returns the on-wire encoding of the message that failed to decode,
+// including the message header.
+func (e *DecodeError) RawBytes() []byte {
+	return e.raw
+}
+
+// asNotification returns the errWithNotification in err's chain, if any.
+func asNotification(err error) (*errWithNotification, bool) {
+	var n *errWithNotification
+	ok := errors.As(err, &n)
+	return n, ok
+}
+
+// decodeOptions alter the behavior of message deserialization.
+type decodeOptions struct {
+	// strict causes unknown link-state attribute TLVs and nlri descriptors
+	// to be rejected rather than preserved as NodeAttrUnknown, LinkAttrUnknown,
+	// PrefixAttrUnknown, NodeDescriptorUnknown, LinkDescriptorUnknown or
+	// PrefixDescriptorUnknown
+	strict bool
+	// policy selects the handling of malformed update messages
+	policy UpdateErrorPolicy
+	// families are the non bgp-ls address families whose MP_REACH_NLRI and
+	// MP_UNREACH_NLRI nlri are preserved undecoded rather than rejected
+	families []AfiSafi
+	// retainRaw causes the on-wire encoding of each path attribute to be
+	// retained, see PathAttr.RawBytes
+	retainRaw bool
+	// retainRawMessages causes the on-wire encoding of update and
+	// notification messages to be retained, see UpdateMessage.RawBytes and
+	// NotificationMessage.RawBytes
+	retainRawMessages bool
+	// requireWellKnown causes update messages advertising nlri without the
+	// well-known mandatory path attributes to be rejected
+	requireWellKnown bool
+	// maxLen is the maximum length of a message decoded by messagesFromBytes,
+	// maxMessageLen if unset
+	maxLen int
+}
+
+// rawFamily returns true if nlri of afi/safi are to be preserved undecoded.
+func (o decodeOptions) rawFamily(afi MultiprotoAfi, safi MultiprotoSafi) bool {
+	if isBgpLsFamily(afi, safi) {
+		return false
+	}
+	return containsAfiSafi(o.families, AfiSafi{Afi: afi, Safi: safi})
+}
+
+// messagesFromBytes decodes the bgp messages in b. Messages decoded prior to
+// an error are returned along with the error.
+func messagesFromBytes(b []byte, opts decodeOptions) ([]Message, error) {
 	messages := make([]Message, 0)
+	maxLen := opts.maxLen
+	if maxLen == 0 {
+		maxLen = maxMessageLen
+	}
 
 	for {
-		if len(b) < 19 {
-			return nil, &errWithNotification{
-				error:   errors.New("message < 19 bytes"),
+		msgLen, err := validateHeader(b, maxLen)
+		if err != nil {
+			return messages, err
+		}
+		if len(b) < msgLen {
+			return messages, &errWithNotification{
+				error:   errors.New("message header length invalid"),
 				code:    NotifErrCodeMessageHeader,
 				subcode: NotifErrSubcodeBadLength,
 			}
 		}
 
-		for i := 0; i < 16; i++ {
-			if b[i] != 0xFF {
-				return nil, &errWithNotification{
-					error:   errors.New("invalid message header marker value"),
-					code:    NotifErrCodeMessageHeader,
-					subcode: NotifErrSubcodeConnNotSynch,
-				}
+		m, err := decodeMessage(MessageType(b[18]), b[19:msgLen], opts)
+		if err != nil {
+			if opts.retainRawMessages {
+				err = &DecodeError{Err: err, raw: append([]byte{}, b[:msgLen]...)}
 			}
+			return messages, err
 		}
+		if opts.retainRawMessages {
+			setMessageRawBytes(m, append([]byte{}, b[:msgLen]...))
+		}
+		messages = append(messages, m)
 
-		msgLen := binary.BigEndian.Uint16(b[16:18])
-		if len(b) < int(msgLen) || msgLen < 19 {
-			return nil, &errWithNotification{
-				error:   errors.New("message header length invalid"),
+		if len(b) > msgLen {
+			b = b[msgLen:]
+		} else {
+			break
+		}
+	}
+
+	return messages, nil
+}
+
+// validateHeader validates the marker, length and type of the message header
+// at the start of b and returns the length of the message, including the
+// header, which must not exceed maxLen. The type is validated before the
+// message body is available so that a stream that has lost synchronization is
+// detected early.
+func validateHeader(b []byte, maxLen int) (int, error) {
+	if len(b) < 19 {
+		return 0, &errWithNotification{
+			error:   errors.New("message < 19 bytes"),
+			code:    NotifErrCodeMessageHeader,
+			subcode: NotifErrSubcodeBadLength,
+		}
+	}
+
+	err := validateMarker(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// the data field of a bad length or bad type notification contains the
+	// erroneous field
+	msgLen := int(binary.BigEndian.Uint16(b[16:18]))
+	if msgLen < 19 || msgLen > maxLen {
+		return 0, &errWithNotification{
+			error:   errors.New("message header length invalid"),
+			code:    NotifErrCodeMessageHeader,
+			subcode: NotifErrSubcodeBadLength,
+			data:    append([]byte(nil), b[16:18]...),
+		}
+	}
+
+	t := MessageType(b[18])
+	if t < OpenMessageType || t > RouteRefreshMessageType {
+		return 0, &errWithNotification{
+			error:   fmt.Errorf("invalid message type %d", b[18]),
+			code:    NotifErrCodeMessageHeader,
+			subcode: NotifErrSubcodeBadType,
+			data:    []byte{b[18]},
+		}
+	}
+
+	return msgLen, nil
+}
+
+// validateMarker validates the portion of the message header marker present
+// in b.
+func validateMarker(b []byte) error {
+	for i := 0; i < 16 && i < len(b); i++ {
+		if b[i] != 0xFF {
+			return &errWithNotification{
+				error:   errors.New("invalid message header marker value"),
 				code:    NotifErrCodeMessageHeader,
-				subcode: NotifErrSubcodeBadLength,
+				subcode: NotifErrSubcodeConnNotSynch,
 			}
 		}
+	}
 
-		msgType := MessageType(b[18])
-		msgBytes := b[19:msgLen]
+	return nil
+}
 
-		switch msgType {
-		case OpenMessageType:
-			m := &openMessage{}
-			err := m.deserialize(msgBytes)
-			if err != nil {
-				return nil, err
-			}
-			messages = append(messages, m)
-		case KeepAliveMessageType:
-			m := &keepAliveMessage{}
-			err := m.deserialize(msgBytes)
+// decodeMessage decodes b, the body of a message of type t.
+func decodeMessage(t MessageType, b []byte, opts decodeOptions) (Message, error) {
+	switch t {
+	case OpenMessageType:
+		m := &openMessage{}
+		err := m.deserialize(b)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	case KeepAliveMessageType:
+		m := &keepAliveMessage{}
+		err := m.deserialize(b)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	case UpdateMessageType:
+		m := &UpdateMessage{}
+		err := m.deserializeWithOptions(b, opts)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	case NotificationMessageType:
+		m := &NotificationMessage{}
+		err := m.deserialize(b)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	case RouteRefreshMessageType:
+		m := &RouteRefreshMessage{}
+		err := m.deserialize(b)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, &errWithNotification{
+			error:   fmt.Errorf("invalid message type %d", uint8(t)),
+			code:    NotifErrCodeMessageHeader,
+			subcode: NotifErrSubcodeBadType,
+			data:    []byte{uint8(t)},
+		}
+	}
+}
+
+// setMessageRawBytes retains raw as the on-wire encoding of m. Only update and
+// notification messages retain their encoding.
+func setMessageRawBytes(m Message, raw []byte) {
+	switch m := m.(type) {
+	case *UpdateMessage:
+		m.raw = raw
+	case *NotificationMessage:
+		m.raw = raw
+	}
+}
+
+// Decoder reads and decodes bgp messages from an input stream.
+type Decoder struct {
+	r io.Reader
+	// opts is called for each message as the options may change while
+	// blocked on a read
+	opts func() decodeOptions
+	buf  []byte
+	// err is a read error or an error that leaves the stream unsynchronized,
+	// it is returned by all subsequent calls to Decode
+	err error
+	// maxLen is the maximum length of a message including the header
+	maxLen int
+}
+
+// NewDecoder returns a new Decoder that reads from r. The Decoder buffers
+// data read from r, a message may span multiple reads and a single read may
+// contain multiple messages. Messages longer than 4096 octets are rejected
+// unless permitted by SetMaxMessageLen.
+func NewDecoder(r io.Reader) *Decoder {
+	return newDecoder(r, func() decodeOptions { return decodeOptions{} })
+}
+
+func newDecoder(r io.Reader, opts func() decodeOptions) *Decoder {
+	return &Decoder{
+		r:      r,
+		opts:   opts,
+		buf:    make([]byte, 0, maxMessageLen),
+		maxLen: maxMessageLen,
+	}
+}
+
+// SetMaxMessageLen sets the maximum length of a message, including the header,
+// e.g. to 65535 to read messages of a session that negotiated the Extended
+// Message capability. n must be between 4096 and 65535. The read buffer grows
+// beyond 4096 octets only as longer messages are received.
+//
+// https://tools.ietf.org/html/rfc8654
+func (d *Decoder) SetMaxMessageLen(n int) error {
+	if n < maxMessageLen || n > maxExtendedMessageLen {
+		return fmt.Errorf("max message length %d must be between %d and %d", n, maxMessageLen, maxExtendedMessageLen)
+	}
+	d.maxLen = n
+	return nil
+}
+
+// Decode reads the next bgp message from its input. Messages that were fully
+// received prior to a read error are returned before the error. io.EOF is
+// returned if the input ends on a message boundary, otherwise
+// io.ErrUnexpectedEOF.
+func (d *Decoder) Decode() (Message, error) {
+	for {
+		if len(d.buf) >= 19 {
+			msgLen, err := validateHeader(d.buf, d.maxLen)
 			if err != nil {
+				d.err = err
 				return nil, err
 			}
-			messages = append(messages, m)
-		case UpdateMessageType:
-			m := &UpdateMessage{}
-			err := m.deserialize(msgBytes)
-			if err != nil {
-				return nil, err
+			if cap(d.buf) < msgLen {
+				// grow to the declared length, the buffer is only ever
+				// as large as the longest message received
+				buf := make([]byte, len(d.buf), msgLen)
+				copy(buf, d.buf)
+				d.buf = buf
 			}
-			messages = append(messages, m)
-		case NotificationMessageType:
-			m := &NotificationMessage{}
-			err := m.deserialize(msgBytes)
-			if err != nil {
-				return nil, err
+
+			if len(d.buf) >= msgLen {
+				// decoded messages may reference the bytes they were decoded
+				// from, so they must not share the read buffer
+				b := make([]byte, msgLen-19)
+				copy(b, d.buf[19:msgLen])
+				t := MessageType(d.buf[18])
+				opts := d.opts()
+				var raw []byte
+				if opts.retainRawMessages {
+					raw = append([]byte{}, d.buf[:msgLen]...)
+				}
+				d.buf = d.buf[:copy(d.buf, d.buf[msgLen:])]
+
+				m, err := decodeMessage(t, b, opts)
+				if err != nil {
+					if raw != nil {
+						err = &DecodeError{Err: err, raw: raw}
+					}
+					return nil, err
+				}
+				setMessageRawBytes(m, raw)
+				return m, nil
 			}
-			messages = append(messages, m)
-		default:
-			return nil, &errWithNotification{
-				error:   fmt.Errorf("invalid message type %s", msgType),
-				code:    NotifErrCodeMessageHeader,
-				subcode: NotifErrSubcodeBadType,
+		} else if err := validateMarker(d.buf); err != nil {
+			// fail early rather than waiting for the remainder of a header
+			// that can never be valid
+			d.err = err
+			return nil, err
+		}
+
+		if d.err != nil {
+			if d.err == io.EOF && len(d.buf) > 0 {
+				return nil, io.ErrUnexpectedEOF
 			}
+			return nil, d.err
 		}
 
-		if len(b) > int(msgLen) {
-			b = b[msgLen:]
-		} else {
-			break
+		n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+n]
+		if err != nil {
+			d.err = err
 		}
 	}
+}
 
-	return messages, nil
+// Encoder serializes and writes bgp messages to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes m, including the message header, to the output stream with a
+// single call to Write.
+func (e *Encoder) Encode(m Message) error {
+	if m == nil {
+		return errors.New("nil message")
+	}
+
+	b, err := m.serialize()
+	if err != nil {
+		return err
+	}
+	if len(b) > maxMessageLen {
+		return fmt.Errorf("%s message length %d exceeds maximum of %d", m.MessageType(), len(b), maxMessageLen)
+	}
+
+	_, err = e.w.Write(b)
+	return err
 }
 
 func prependHeader(b []byte, t MessageType) []byte {
@@ -14,7 +14,7 @@ func TestKeepaliveMessage(t *testing.T) {
 		t.Error(err)
 	}
 
-	m, err := messagesFromBytes(b)
+	m, err := messagesFromBytes(b, decodeOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -1,6 +1,12 @@
 package bgpls
 
-import "errors"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
 
 // NotifErrCode is a notifcation message error code.
 type NotifErrCode uint8
@@ -14,11 +20,67 @@ const (
 	NotifErrCodeHoldTimerExpired
 	NotifErrCodeFsmError
 	NotifErrCodeCease
+	NotifErrCodeRouteRefreshMessage
 )
 
+func (c NotifErrCode) String() string {
+	switch c {
+	case NotifErrCodeMessageHeader:
+		return "MessageHeader"
+	case NotifErrCodeOpenMessage:
+		return "OpenMessage"
+	case NotifErrCodeUpdateMessage:
+		return "UpdateMessage"
+	case NotifErrCodeHoldTimerExpired:
+		return "HoldTimerExpired"
+	case NotifErrCodeFsmError:
+		return "FsmError"
+	case NotifErrCodeCease:
+		return "Cease"
+	case NotifErrCodeRouteRefreshMessage:
+		return "RouteRefreshMessage"
+	default:
+		return strconv.Itoa(int(c))
+	}
+}
+
+// SubcodeString returns the name of subcode s in the context of error code c.
+// Subcode 0 is unspecific for all error codes. The decimal value of s is
+// returned if it is not defined for c.
+func (c NotifErrCode) SubcodeString(s NotifErrSubcode) string {
+	if s == 0 {
+		return "Unspecific"
+	}
+
+	var names []string
+	switch c {
+	case NotifErrCodeMessageHeader:
+		names = messageHeaderSubcodeNames
+	case NotifErrCodeOpenMessage:
+		names = openMessageSubcodeNames
+	case NotifErrCodeUpdateMessage:
+		names = updateMessageSubcodeNames
+	case NotifErrCodeCease:
+		names = ceaseSubcodeNames
+	case NotifErrCodeRouteRefreshMessage:
+		names = routeRefreshMessageSubcodeNames
+	}
+	if int(s) < len(names) && len(names[s]) > 0 {
+		return names[s]
+	}
+
+	return s.String()
+}
+
 // NotifErrSubcode is a notification message error subcode.
 type NotifErrSubcode uint8
 
+// String returns the decimal value of s. Subcode values overlap between error
+// codes, NotifErrCode.SubcodeString returns the name of a subcode.
+func (s NotifErrSubcode) String() string {
+	return strconv.Itoa(int(s))
+}
+
 // message header subcodes
 const (
 	_ NotifErrSubcode = iota
@@ -27,6 +89,12 @@ const (
 	NotifErrSubcodeBadType
 )
 
+var messageHeaderSubcodeNames = []string{
+	NotifErrSubcodeConnNotSynch: "ConnNotSynch",
+	NotifErrSubcodeBadLength:    "BadLength",
+	NotifErrSubcodeBadType:      "BadType",
+}
+
 // open message subcodes
 const (
 	_ NotifErrSubcode = iota
@@ -39,6 +107,15 @@ const (
 	NotifErrSubcodeUnsupportedCapability
 )
 
+var openMessageSubcodeNames = []string{
+	NotifErrSubcodeUnsupportedVersionNumber: "UnsupportedVersionNumber",
+	NotifErrSubcodeBadPeerAS:                "BadPeerAS",
+	NotifErrSubcodeBadBgpID:                 "BadBgpID",
+	NotifErrSubcodeUnsupportedOptParam:      "UnsupportedOptParam",
+	NotifErrSubcodeUnacceptableHoldTime:     "UnacceptableHoldTime",
+	NotifErrSubcodeUnsupportedCapability:    "UnsupportedCapability",
+}
+
 // update message subcodes
 const (
 	_ NotifErrSubcode = iota
@@ -55,6 +132,57 @@ const (
 	NotifErrSubcodeMalformedAsPath
 )
 
+var updateMessageSubcodeNames = []string{
+	NotifErrSubcodeMalformedAttr:             "MalformedAttr",
+	NotifErrSubcodeUnrecognizedWellKnownAttr: "UnrecognizedWellKnownAttr",
+	NotifErrSubcodeMissingWellKnownAttr:      "MissingWellKnownAttr",
+	NotifErrSubcodeAttrFlagsError:            "AttrFlagsError",
+	NotifErrSubcodeAttrLenError:              "AttrLenError",
+	NotifErrSubcodeInvalidOrigin:             "InvalidOrigin",
+	NotifErrSubcodeInvalidNextHop:            "InvalidNextHop",
+	NotifErrSubcodeOptionalAttrError:         "OptionalAttrError",
+	NotifErrSubcodeInvalidNetworkField:       "InvalidNetworkField",
+	NotifErrSubcodeMalformedAsPath:           "MalformedAsPath",
+}
+
+// cease subcodes
+//
+// https://tools.ietf.org/html/rfc4486#section-4
+const (
+	_ NotifErrSubcode = iota
+	NotifErrSubcodeMaxPrefixesReached
+	NotifErrSubcodeAdminShutdown
+	NotifErrSubcodePeerDeconfigured
+	NotifErrSubcodeAdminReset
+	NotifErrSubcodeConnRejected
+	NotifErrSubcodeOtherConfigChange
+	NotifErrSubcodeConnCollisionResolution
+	NotifErrSubcodeOutOfResources
+)
+
+var ceaseSubcodeNames = []string{
+	NotifErrSubcodeMaxPrefixesReached:      "MaxPrefixesReached",
+	NotifErrSubcodeAdminShutdown:           "AdminShutdown",
+	NotifErrSubcodePeerDeconfigured:        "PeerDeconfigured",
+	NotifErrSubcodeAdminReset:              "AdminReset",
+	NotifErrSubcodeConnRejected:            "ConnRejected",
+	NotifErrSubcodeOtherConfigChange:       "OtherConfigChange",
+	NotifErrSubcodeConnCollisionResolution: "ConnCollisionResolution",
+	NotifErrSubcodeOutOfResources:          "OutOfResources",
+}
+
+// route refresh message subcodes
+//
+// https://tools.ietf.org/html/rfc7313#section-5
+const (
+	_ NotifErrSubcode = iota
+	NotifErrSubcodeInvalidMessageLength
+)
+
+var routeRefreshMessageSubcodeNames = []string{
+	NotifErrSubcodeInvalidMessageLength: "InvalidMessageLength",
+}
+
 // NotificationMessage is a bgp message.
 //
 // https://tools.ietf.org/html/rfc4271#section-4.5
@@ -62,6 +190,15 @@ type NotificationMessage struct {
 	Code    NotifErrCode
 	Subcode NotifErrSubcode
 	Data    []byte
+
+	raw []byte
+}
+
+// RawBytes returns the on-wire encoding of NotificationMessage as received,
+// including the message header. It is nil unless
+// CollectorConfig.RetainRawMessages is set.
+func (n *NotificationMessage) RawBytes() []byte {
+	return n.raw
 }
 
 // MessageType returns the appropriate MessageType for NotificationMessage.
@@ -69,6 +206,12 @@ func (n *NotificationMessage) MessageType() MessageType {
 	return NotificationMessageType
 }
 
+// String returns the error code and subcode of n, e.g.
+// "OpenMessage/UnsupportedCapability".
+func (n *NotificationMessage) String() string {
+	return n.Code.String() + "/" + n.Code.SubcodeString(n.Subcode)
+}
+
 func (n *NotificationMessage) serialize() ([]byte, error) {
 	buff := make([]byte, 2)
 	buff[0] = uint8(n.Code)
@@ -96,3 +239,226 @@ func (n *NotificationMessage) deserialize(b []byte) error {
 
 	return nil
 }
+
+// DecodedData returns a typed representation of the notification's Data
+// according to its Code and Subcode. The returned value is one of:
+//
+// *NotifDataBadLength for message header bad length errors
+//
+// *NotifDataBadType for message header bad type errors
+//
+// *NotifDataUnsupportedVersion for open message unsupported version number errors
+//
+// *NotifDataUnsupportedCapability for open message unsupported capability errors
+//
+// *NotifDataShutdownCommunication for cease administrative shutdown and reset
+//
+// nil is returned if Data is empty or has no typed representation.
+// An error is returned if Data is malformed.
+func (n *NotificationMessage) DecodedData() (interface{}, error) {
+	if len(n.Data) == 0 {
+		return nil, nil
+	}
+
+	switch n.Code {
+	case NotifErrCodeMessageHeader:
+		switch n.Subcode {
+		case NotifErrSubcodeBadLength:
+			if len(n.Data) != 2 {
+				return nil, errors.New("invalid length for bad message length data")
+			}
+			return &NotifDataBadLength{Length: binary.BigEndian.Uint16(n.Data)}, nil
+		case NotifErrSubcodeBadType:
+			if len(n.Data) != 1 {
+				return nil, errors.New("invalid length for bad message type data")
+			}
+			return &NotifDataBadType{Type: MessageType(n.Data[0])}, nil
+		}
+	case NotifErrCodeOpenMessage:
+		switch n.Subcode {
+		case NotifErrSubcodeUnsupportedVersionNumber:
+			if len(n.Data) != 2 {
+				return nil, errors.New("invalid length for unsupported version number data")
+			}
+			return &NotifDataUnsupportedVersion{Version: binary.BigEndian.Uint16(n.Data)}, nil
+		case NotifErrSubcodeUnsupportedCapability:
+			d, err := deserializeNotifDataUnsupportedCapability(n.Data)
+			if err != nil {
+				return nil, err
+			}
+			return d, nil
+		}
+	case NotifErrCodeCease:
+		switch n.Subcode {
+		case NotifErrSubcodeAdminShutdown, NotifErrSubcodeAdminReset:
+			d, err := deserializeNotifDataShutdownCommunication(n.Data)
+			if err != nil {
+				return nil, err
+			}
+			return d, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// NewNotificationBadLength returns a message header bad length notification
+// containing the erroneous length field.
+func NewNotificationBadLength(length uint16) *NotificationMessage {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, length)
+	return &NotificationMessage{
+		Code:    NotifErrCodeMessageHeader,
+		Subcode: NotifErrSubcodeBadLength,
+		Data:    data,
+	}
+}
+
+// NewNotificationBadType returns a message header bad type notification
+// containing the erroneous type field.
+func NewNotificationBadType(t MessageType) *NotificationMessage {
+	return &NotificationMessage{
+		Code:    NotifErrCodeMessageHeader,
+		Subcode: NotifErrSubcodeBadType,
+		Data:    []byte{uint8(t)},
+	}
+}
+
+// NewNotificationUnsupportedVersion returns an open message unsupported version
+// number notification containing the largest locally supported version.
+func NewNotificationUnsupportedVersion(version uint16) *NotificationMessage {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, version)
+	return &NotificationMessage{
+		Code:    NotifErrCodeOpenMessage,
+		Subcode: NotifErrSubcodeUnsupportedVersionNumber,
+		Data:    data,
+	}
+}
+
+// NewNotificationUnsupportedCapability returns an open message unsupported
+// capability notification containing a multiprotocol capability for each of
+// families.
+func NewNotificationUnsupportedCapability(families ...AfiSafi) (*NotificationMessage, error) {
+	var data []byte
+	for _, f := range families {
+		b, err := (&capMultiproto{afi: f.Afi, safi: f.Safi}).serialize()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+	}
+
+	return &NotificationMessage{
+		Code:    NotifErrCodeOpenMessage,
+		Subcode: NotifErrSubcodeUnsupportedCapability,
+		Data:    data,
+	}, nil
+}
+
+// NewNotificationCeaseAdminShutdown returns a cease administrative shutdown
+// notification containing communication, which is omitted if empty. An error
+// is returned if communication is not valid utf-8 or exceeds 255 octets.
+func NewNotificationCeaseAdminShutdown(communication string) (*NotificationMessage, error) {
+	return newNotificationShutdownCommunication(NotifErrSubcodeAdminShutdown, communication)
+}
+
+// NewNotificationCeaseAdminReset returns a cease administrative reset
+// notification containing communication, which is omitted if empty. An error
+// is returned if communication is not valid utf-8 or exceeds 255 octets.
+func NewNotificationCeaseAdminReset(communication string) (*NotificationMessage, error) {
+	return newNotificationShutdownCommunication(NotifErrSubcodeAdminReset, communication)
+}
+
+func newNotificationShutdownCommunication(subcode NotifErrSubcode, communication string) (*NotificationMessage, error) {
+	n := &NotificationMessage{
+		Code:    NotifErrCodeCease,
+		Subcode: subcode,
+	}
+	if len(communication) == 0 {
+		return n, nil
+	}
+
+	if len(communication) > 255 {
+		return nil, fmt.Errorf("shutdown communication exceeds 255 octets: %d", len(communication))
+	}
+	if !utf8.ValidString(communication) {
+		return nil, errors.New("shutdown communication is not valid utf-8")
+	}
+	n.Data = append([]byte{uint8(len(communication))}, communication...)
+
+	return n, nil
+}
+
+// NotifDataBadLength is the erroneous length field of a message header.
+//
+// https://tools.ietf.org/html/rfc4271#section-6.1
+type NotifDataBadLength struct {
+	Length uint16
+}
+
+// NotifDataBadType is the erroneous type field of a message header.
+//
+// https://tools.ietf.org/html/rfc4271#section-6.1
+type NotifDataBadType struct {
+	Type MessageType
+}
+
+// NotifDataUnsupportedVersion is the largest locally supported bgp version.
+//
+// https://tools.ietf.org/html/rfc4271#section-6.2
+type NotifDataUnsupportedVersion struct {
+	Version uint16
+}
+
+// NotifDataUnsupportedCapability contains the unsupported capabilities.
+// Multiproto contains unsupported multiprotocol AFI/SAFIs, Codes contains
+// the codes of all unsupported capabilities.
+//
+// https://tools.ietf.org/html/rfc5492#section-5
+type NotifDataUnsupportedCapability struct {
+	Multiproto []AfiSafi
+	Codes      []uint8
+}
+
+func deserializeNotifDataUnsupportedCapability(b []byte) (*NotifDataUnsupportedCapability, error) {
+	c := &capabilityOptParam{}
+	err := c.deserialize(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unsupported capability data: %v", err)
+	}
+
+	d := &NotifDataUnsupportedCapability{}
+	for _, cap := range c.caps {
+		if m, ok := cap.(*capMultiproto); ok {
+			d.Multiproto = append(d.Multiproto, AfiSafi{Afi: m.afi, Safi: m.safi})
+		}
+		d.Codes = append(d.Codes, uint8(cap.capabilityCode()))
+	}
+
+	return d, nil
+}
+
+// NotifDataShutdownCommunication is the reason included with a cease
+// administrative shutdown or reset. RFC 8203 limited the communication to
+// 128 octets, RFC 9003 extends it to 255 octets, both are accepted.
+// Data following the communication is ignored.
+//
+// https://tools.ietf.org/html/rfc9003
+type NotifDataShutdownCommunication struct {
+	Communication string
+}
+
+func deserializeNotifDataShutdownCommunication(b []byte) (*NotifDataShutdownCommunication, error) {
+	l := int(b[0])
+	if len(b) < l+1 {
+		return nil, errors.New("shutdown communication length exceeds data")
+	}
+
+	msg := b[1 : l+1]
+	if !utf8.Valid(msg) {
+		return nil, errors.New("shutdown communication is not valid utf-8")
+	}
+
+	return &NotifDataShutdownCommunication{Communication: string(msg)}, nil
+}
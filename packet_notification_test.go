@@ -1,6 +1,7 @@
 package bgpls
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,7 +22,7 @@ func TestNotificationMessage(t *testing.T) {
 		t.Error(err)
 	}
 
-	m, err := messagesFromBytes(b)
+	m, err := messagesFromBytes(b, decodeOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -44,3 +45,146 @@ func TestNotificationMessage(t *testing.T) {
 		assert.Equal(t, d, f.Data[i])
 	}
 }
+
+func TestNotificationMessageString(t *testing.T) {
+	cases := []struct {
+		code    NotifErrCode
+		subcode NotifErrSubcode
+		want    string
+	}{
+		{NotifErrCodeMessageHeader, NotifErrSubcodeBadType, "MessageHeader/BadType"},
+		{NotifErrCodeOpenMessage, NotifErrSubcodeUnsupportedCapability, "OpenMessage/UnsupportedCapability"},
+		{NotifErrCodeOpenMessage, 5, "OpenMessage/5"},
+		{NotifErrCodeUpdateMessage, NotifErrSubcodeMalformedAsPath, "UpdateMessage/MalformedAsPath"},
+		{NotifErrCodeUpdateMessage, 12, "UpdateMessage/12"},
+		{NotifErrCodeHoldTimerExpired, 0, "HoldTimerExpired/Unspecific"},
+		{NotifErrCodeFsmError, 1, "FsmError/1"},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, "Cease/AdminShutdown"},
+		{NotifErrCodeCease, NotifErrSubcodeOutOfResources, "Cease/OutOfResources"},
+		{NotifErrCodeRouteRefreshMessage, NotifErrSubcodeInvalidMessageLength, "RouteRefreshMessage/InvalidMessageLength"},
+		{8, 1, "8/1"},
+	}
+
+	for _, c := range cases {
+		n := &NotificationMessage{Code: c.code, Subcode: c.subcode}
+		assert.Equal(t, c.want, n.String())
+	}
+}
+
+func TestNotificationMessageDecodedData(t *testing.T) {
+	cases := []struct {
+		code    NotifErrCode
+		subcode NotifErrSubcode
+		data    []byte
+		decoded interface{}
+		valid   bool
+	}{
+		{NotifErrCodeMessageHeader, NotifErrSubcodeBadLength, []byte{0x10, 1}, &NotifDataBadLength{Length: 4097}, true},
+		{NotifErrCodeMessageHeader, NotifErrSubcodeBadLength, []byte{1}, nil, false},
+		{NotifErrCodeMessageHeader, NotifErrSubcodeBadType, []byte{5}, &NotifDataBadType{Type: MessageType(5)}, true},
+		{NotifErrCodeMessageHeader, NotifErrSubcodeBadType, []byte{5, 5}, nil, false},
+		{NotifErrCodeOpenMessage, NotifErrSubcodeUnsupportedVersionNumber, []byte{0, 4}, &NotifDataUnsupportedVersion{Version: 4}, true},
+		{NotifErrCodeOpenMessage, NotifErrSubcodeUnsupportedVersionNumber, []byte{4}, nil, false},
+		{
+			NotifErrCodeOpenMessage,
+			NotifErrSubcodeUnsupportedCapability,
+			[]byte{1, 4, 0x40, 4, 0, 71, 70, 0},
+			&NotifDataUnsupportedCapability{
+				Multiproto: []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}},
+				Codes:      []uint8{1, 70},
+			},
+			true,
+		},
+		{NotifErrCodeOpenMessage, NotifErrSubcodeUnsupportedCapability, []byte{1, 4, 0}, nil, false},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, append([]byte{11}, "maintenance"...), &NotifDataShutdownCommunication{Communication: "maintenance"}, true},
+		{NotifErrCodeCease, NotifErrSubcodeAdminReset, []byte{0}, &NotifDataShutdownCommunication{}, true},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, []byte{5, 'a'}, nil, false},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, []byte{1, 0xff}, nil, false},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, append([]byte{255}, strings.Repeat("a", 255)...), &NotifDataShutdownCommunication{Communication: strings.Repeat("a", 255)}, true},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, append([]byte{255}, strings.Repeat("a", 128)...), nil, false},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, []byte{2, 'o', 'k', 0, 0}, &NotifDataShutdownCommunication{Communication: "ok"}, true},
+		{NotifErrCodeCease, NotifErrSubcodeMaxPrefixesReached, []byte{0, 1, 0, 0, 0, 0, 0}, nil, true},
+		{NotifErrCodeUpdateMessage, NotifErrSubcodeMalformedAttr, []byte{1}, nil, true},
+		{NotifErrCodeCease, NotifErrSubcodeAdminShutdown, nil, nil, true},
+	}
+
+	for _, c := range cases {
+		n := &NotificationMessage{Code: c.code, Subcode: c.subcode, Data: c.data}
+		d, err := n.DecodedData()
+		if c.valid {
+			assert.Nil(t, err)
+			if c.decoded == nil {
+				assert.Nil(t, d)
+			} else {
+				assert.Equal(t, c.decoded, d)
+			}
+		} else {
+			assert.NotNil(t, err)
+			assert.Nil(t, d)
+		}
+	}
+}
+
+func TestNotificationConstructors(t *testing.T) {
+	unsupportedCapability, err := NewNotificationUnsupportedCapability(AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdown, err := NewNotificationCeaseAdminShutdown("maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := NewNotificationCeaseAdminReset("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		n       *NotificationMessage
+		s       string
+		decoded interface{}
+	}{
+		{NewNotificationBadLength(4097), "MessageHeader/BadLength", &NotifDataBadLength{Length: 4097}},
+		{NewNotificationBadType(6), "MessageHeader/BadType", &NotifDataBadType{Type: 6}},
+		{NewNotificationUnsupportedVersion(4), "OpenMessage/UnsupportedVersionNumber", &NotifDataUnsupportedVersion{Version: 4}},
+		{
+			unsupportedCapability,
+			"OpenMessage/UnsupportedCapability",
+			&NotifDataUnsupportedCapability{
+				Multiproto: []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}},
+				Codes:      []uint8{uint8(capCodeMultiproto)},
+			},
+		},
+		{shutdown, "Cease/AdminShutdown", &NotifDataShutdownCommunication{Communication: "maintenance"}},
+		{reset, "Cease/AdminReset", nil},
+	}
+
+	for _, c := range cases {
+		b, err := c.n.serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := messagesFromBytes(b, decodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !assert.Len(t, m, 1) || !assert.IsType(t, &NotificationMessage{}, m[0]) {
+			continue
+		}
+		n := m[0].(*NotificationMessage)
+		assert.Equal(t, c.n, n, c.s)
+		assert.Equal(t, c.s, n.String())
+		d, err := n.DecodedData()
+		assert.Nil(t, err, c.s)
+		if c.decoded == nil {
+			assert.Nil(t, d, c.s)
+		} else {
+			assert.Equal(t, c.decoded, d, c.s)
+		}
+	}
+
+	_, err = NewNotificationCeaseAdminShutdown(strings.Repeat("a", 256))
+	assert.NotNil(t, err)
+	_, err = NewNotificationCeaseAdminReset(string([]byte{0xff}))
+	assert.NotNil(t, err)
+}
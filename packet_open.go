@@ -3,38 +3,51 @@ package bgpls
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"math"
 	"net"
 	"time"
 )
 
-func newOpenMessage(asn uint32, holdTime time.Duration, bgpID net.IP) (*openMessage, error) {
+// newOpenMessage returns an OPEN message advertising the bgp-ls address
+// family followed by any additional families.
+func newOpenMessage(asn uint32, holdTime time.Duration, bgpID net.IP, families ...AfiSafi) (*openMessage, error) {
+	caps := []capability{
+		&capFourOctetAs{
+			asn: asn,
+		},
+		&capMultiproto{
+			afi:  BgpLsAfi,
+			safi: BgpLsSafi,
+		},
+	}
+	for _, f := range families {
+		if f.Afi == BgpLsAfi && f.Safi == BgpLsSafi {
+			continue
+		}
+		caps = append(caps, &capMultiproto{
+			afi:  f.Afi,
+			safi: f.Safi,
+		})
+	}
+
 	o := &openMessage{
 		version:  4,
 		holdTime: uint16(holdTime.Seconds()),
 		optParams: []optParam{
 			&capabilityOptParam{
-				caps: []capability{
-					&capFourOctetAs{
-						asn: asn,
-					},
-					&capMultiproto{
-						afi:  BgpLsAfi,
-						safi: BgpLsSafi,
-					},
-				},
+				caps: caps,
 			},
 		},
 	}
 
-	switch len(bgpID) {
-	case 4:
-		o.bgpID = binary.BigEndian.Uint32(bgpID[0:4])
-	case 16:
-		o.bgpID = binary.BigEndian.Uint32(bgpID[12:16])
-	default:
+	// the bgp ID is always 4 octets regardless of the transport address family,
+	// only IPv4 (or IPv4-mapped IPv6) addresses are meaningful
+	v4 := bgpID.To4()
+	if v4 == nil {
 		return nil, errors.New("invalid bgp ID")
 	}
+	o.bgpID = binary.BigEndian.Uint32(v4)
 
 	/*
 		rfc4893 page2
@@ -64,6 +77,19 @@ type openMessage struct {
 	optParams []optParam
 }
 
+// addCapability appends c to the first capabilities optional parameter of o,
+// one is added if o has none.
+func (o *openMessage) addCapability(c capability) {
+	for _, p := range o.optParams {
+		if capOptParam, isCapability := p.(*capabilityOptParam); isCapability {
+			capOptParam.caps = append(capOptParam.caps, c)
+			return
+		}
+	}
+
+	o.optParams = append(o.optParams, &capabilityOptParam{caps: []capability{c}})
+}
+
 const (
 	asTrans uint16 = 23456
 )
@@ -160,8 +186,8 @@ func deserializeOptParams(b []byte) ([]optParam, error) {
 		}
 
 		paramCode := b[0]
-		paramLen := b[1]
-		if len(b) < int(paramLen)+2 {
+		paramLen := int(b[1])
+		if len(b) < paramLen+2 {
 			return nil, &errWithNotification{
 				error:   errors.New("optional parameter length does not match length field"),
 				code:    NotifErrCodeOpenMessage,
@@ -169,13 +195,10 @@ func deserializeOptParams(b []byte) ([]optParam, error) {
 			}
 		}
 
-		paramToDecode := make([]byte, 0)
-		if paramLen > 0 {
-			paramToDecode = b[2 : paramLen+2]
-		}
-
-		nextParam := 2 + int(paramLen)
-		b = b[nextParam:]
+		// the capacity is limited so that the parameter cannot be decoded
+		// beyond its length into the next parameter
+		paramToDecode := b[2 : paramLen+2 : paramLen+2]
+		b = b[paramLen+2:]
 
 		switch paramCode {
 		case uint8(capabilityOptParamType):
@@ -188,6 +211,9 @@ func deserializeOptParams(b []byte) ([]optParam, error) {
 
 			params = append(params, cap)
 		default:
+			param := &optParamUnknown{code: paramCode}
+			param.deserialize(paramToDecode)
+			params = append(params, param)
 		}
 
 		if len(b) == 0 {
@@ -198,7 +224,12 @@ func deserializeOptParams(b []byte) ([]optParam, error) {
 	return params, nil
 }
 
-func validateOpenMessage(msg *openMessage, neighborASN uint32) error {
+// validateOpenMessage validates msg against the neighbor's ASN. If
+// allowMissingBgpLs is set, the absence of the bgp-ls multiprotocol capability
+// is tolerated when other multiprotocol capabilities are present. If
+// allowUnknownOptParams is set, optional parameters other than capabilities
+// are ignored rather than rejected.
+func validateOpenMessage(msg *openMessage, neighborASN uint32, allowMissingBgpLs, allowUnknownOptParams bool) error {
 	if msg.version != 4 {
 		version := make([]byte, 2)
 		binary.BigEndian.PutUint16(version, uint16(4))
@@ -210,15 +241,31 @@ func validateOpenMessage(msg *openMessage, neighborASN uint32) error {
 		}
 	}
 
-	var fourOctetAS, fourOctetAsFound, bgpLsAfFound bool
+	/*
+		A peer with a 2-octet AS places it in the "My Autonomous System" field
+		and may omit the four-octet AS capability. A peer with a 4-octet AS
+		(not mappable to 2 octets) must place AS_TRANS in the field and carry
+		its AS in the capability.
+	*/
+	var fourOctetAS, fourOctetAsFound, bgpLsAfFound, otherAfFound bool
 	if msg.asn == asTrans {
 		fourOctetAS = true
 	} else {
-		if msg.asn != uint16(neighborASN) {
+		var err error
+		switch {
+		case neighborASN > math.MaxUint16:
+			err = fmt.Errorf("bad peer AS: expected AS_TRANS for 4-octet AS %d, got AS %d", neighborASN, msg.asn)
+		case msg.asn != uint16(neighborASN):
+			err = fmt.Errorf("bad peer AS: expected AS %d, got AS %d", neighborASN, msg.asn)
+		}
+		if err != nil {
+			data := make([]byte, 2)
+			binary.BigEndian.PutUint16(data, msg.asn)
 			return &errWithNotification{
-				error:   errors.New("bad peer AS"),
+				error:   err,
 				code:    NotifErrCodeOpenMessage,
 				subcode: NotifErrSubcodeBadPeerAS,
+				data:    data,
 			}
 		}
 	}
@@ -242,6 +289,9 @@ func validateOpenMessage(msg *openMessage, neighborASN uint32) error {
 	for _, p := range msg.optParams {
 		capOptParam, isCapability := p.(*capabilityOptParam)
 		if !isCapability {
+			if allowUnknownOptParams {
+				continue
+			}
 			return &errWithNotification{
 				error:   errors.New("non-capability optional parameter found"),
 				code:    NotifErrCodeOpenMessage,
@@ -254,22 +304,27 @@ func validateOpenMessage(msg *openMessage, neighborASN uint32) error {
 			case *capFourOctetAs:
 				fourOctetAsFound = true
 				if cap.asn != neighborASN {
+					data := make([]byte, 4)
+					binary.BigEndian.PutUint32(data, cap.asn)
 					return &errWithNotification{
-						error:   errors.New("bad peer AS"),
+						error:   fmt.Errorf("bad peer AS: expected AS %d, got AS %d in 4-octet AS capability", neighborASN, cap.asn),
 						code:    NotifErrCodeOpenMessage,
 						subcode: NotifErrSubcodeBadPeerAS,
+						data:    data,
 					}
 				}
 			case *capMultiproto:
 				if cap.afi == BgpLsAfi && cap.safi == BgpLsSafi {
 					bgpLsAfFound = true
+				} else {
+					otherAfFound = true
 				}
 			case *capUnknown:
 			}
 		}
 	}
 
-	if !bgpLsAfFound {
+	if !bgpLsAfFound && !(allowMissingBgpLs && otherAfFound) {
 		bgpLsCap := &capMultiproto{
 			afi:  BgpLsAfi,
 			safi: BgpLsSafi,
@@ -288,7 +343,7 @@ func validateOpenMessage(msg *openMessage, neighborASN uint32) error {
 
 	if fourOctetAS && !fourOctetAsFound {
 		return &errWithNotification{
-			error:   errors.New("4-octet AS indicated in as field but not found in capabilities"),
+			error:   fmt.Errorf("bad peer AS: got AS_TRANS without a 4-octet AS capability, expected AS %d", neighborASN),
 			code:    NotifErrCodeOpenMessage,
 			subcode: NotifErrSubcodeBadPeerAS,
 		}
@@ -297,6 +352,65 @@ func validateOpenMessage(msg *openMessage, neighborASN uint32) error {
 	return nil
 }
 
+// validateOpenBgpID checks the BGP Identifier of msg against expected.
+// A nil expected value matches any BGP Identifier.
+func validateOpenBgpID(msg *openMessage, expected net.IP) error {
+	if expected == nil {
+		return nil
+	}
+
+	if !bgpIDToIP(msg.bgpID).Equal(expected) {
+		return &errWithNotification{
+			error:   fmt.Errorf("bgp ID %s does not match expected %s", bgpIDToIP(msg.bgpID), expected),
+			code:    NotifErrCodeOpenMessage,
+			subcode: NotifErrSubcodeBadBgpID,
+		}
+	}
+
+	return nil
+}
+
+// validateOpenHoldTime rejects an OPEN message advertising a hold time below
+// min, a min of 0 accepts any hold time.
+//
+// https://tools.ietf.org/html/rfc4271#section-6.2
+func validateOpenHoldTime(msg *openMessage, min time.Duration) error {
+	/*
+		An implementation MAY reject connections on the basis of the Hold
+		Time.
+	*/
+	if time.Duration(msg.holdTime)*time.Second >= min {
+		return nil
+	}
+
+	return &errWithNotification{
+		error:   fmt.Errorf("hold time %ds is below minimum %s", msg.holdTime, min),
+		code:    NotifErrCodeOpenMessage,
+		subcode: NotifErrSubcodeUnacceptableHoldTime,
+	}
+}
+
+// validateOpenNotSelf rejects an OPEN message carrying our own BGP Identifier
+// from a neighbor in our own AS, which indicates we have connected to ourselves.
+// rfc6286 permits identical BGP Identifiers between different ASes.
+func validateOpenNotSelf(msg *openMessage, neighborASN, localASN uint32, localID net.IP) error {
+	if neighborASN != localASN || !bgpIDToIP(msg.bgpID).Equal(localID) {
+		return nil
+	}
+
+	return &errWithNotification{
+		error:   fmt.Errorf("bgp ID %s matches local bgp ID, neighbor is ourselves", localID),
+		code:    NotifErrCodeOpenMessage,
+		subcode: NotifErrSubcodeBadBgpID,
+	}
+}
+
+func bgpIDToIP(id uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, id)
+	return ip
+}
+
 type optParamType uint8
 
 const (
@@ -309,6 +423,29 @@ type optParam interface {
 	deserialize(b []byte) error
 }
 
+// optParamUnknown is an optional parameter other than capabilities, e.g. the
+// deprecated authentication information parameter.
+type optParamUnknown struct {
+	code uint8
+	data []byte
+}
+
+func (u *optParamUnknown) optParamType() optParamType {
+	return optParamType(u.code)
+}
+
+func (u *optParamUnknown) serialize() ([]byte, error) {
+	buff := make([]byte, 2, 2+len(u.data))
+	buff[0] = u.code
+	buff[1] = uint8(len(u.data))
+	return append(buff, u.data...), nil
+}
+
+func (u *optParamUnknown) deserialize(b []byte) error {
+	u.data = b
+	return nil
+}
+
 type capabilityOptParam struct {
 	caps []capability
 }
@@ -351,8 +488,8 @@ func (c *capabilityOptParam) deserialize(b []byte) error {
 		}
 
 		capCode := b[0]
-		capLen := b[1]
-		if len(b) < int(capLen)+2 {
+		capLen := int(b[1])
+		if len(b) < capLen+2 {
 			return &errWithNotification{
 				error:   errors.New("capability length does not match length field"),
 				code:    NotifErrCodeOpenMessage,
@@ -360,13 +497,10 @@ func (c *capabilityOptParam) deserialize(b []byte) error {
 			}
 		}
 
-		capToDecode := make([]byte, 0)
-		if capLen > 0 {
-			capToDecode = b[2 : capLen+2]
-		}
-
-		nextCap := 2 + int(capLen)
-		b = b[nextCap:]
+		// the capacity is limited so that the capability cannot be decoded
+		// beyond its length into the next capability
+		capToDecode := b[2 : capLen+2 : capLen+2]
+		b = b[capLen+2:]
 
 		switch capCode {
 		case uint8(capCodeMultiproto):
@@ -376,6 +510,30 @@ func (c *capabilityOptParam) deserialize(b []byte) error {
 				return err
 			}
 
+			c.caps = append(c.caps, cap)
+		case uint8(capCodeRouteRefresh):
+			cap := &capRouteRefresh{}
+			err := cap.deserialize(capToDecode)
+			if err != nil {
+				return err
+			}
+
+			c.caps = append(c.caps, cap)
+		case uint8(capCodeEnhancedRouteRefresh):
+			cap := &capEnhancedRouteRefresh{}
+			err := cap.deserialize(capToDecode)
+			if err != nil {
+				return err
+			}
+
+			c.caps = append(c.caps, cap)
+		case uint8(capCodeGracefulRestart):
+			cap := &capGracefulRestart{}
+			err := cap.deserialize(capToDecode)
+			if err != nil {
+				return err
+			}
+
 			c.caps = append(c.caps, cap)
 		case uint8(capCodeFourOctetAs):
 			cap := &capFourOctetAs{}
@@ -406,8 +564,11 @@ func (c *capabilityOptParam) deserialize(b []byte) error {
 type capabilityCode uint8
 
 const (
-	capCodeMultiproto  capabilityCode = 1
-	capCodeFourOctetAs capabilityCode = 65
+	capCodeMultiproto           capabilityCode = 1
+	capCodeRouteRefresh         capabilityCode = 2
+	capCodeGracefulRestart      capabilityCode = 64
+	capCodeFourOctetAs          capabilityCode = 65
+	capCodeEnhancedRouteRefresh capabilityCode = 70
 )
 
 type capability interface {
@@ -449,18 +610,190 @@ func (u *capUnknown) deserialize(b []byte) error {
 type MultiprotoAfi uint16
 
 // MultiprotoAfi values
+//
+// https://www.iana.org/assignments/address-family-numbers/address-family-numbers.xhtml
 const (
+	IPv4Afi  MultiprotoAfi = 1
+	IPv6Afi  MultiprotoAfi = 2
+	L2vpnAfi MultiprotoAfi = 25
 	BgpLsAfi MultiprotoAfi = 16388
 )
 
+func (a MultiprotoAfi) String() string {
+	switch a {
+	case IPv4Afi:
+		return "ipv4"
+	case IPv6Afi:
+		return "ipv6"
+	case L2vpnAfi:
+		return "l2vpn"
+	case BgpLsAfi:
+		return "bgp-ls"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint16(a))
+	}
+}
+
 // MultiprotoSafi identifies the subsequent address family for multiprotocol bgp.
 type MultiprotoSafi uint8
 
 // MultiprotoSafi values
+//
+// https://www.iana.org/assignments/safi-namespace/safi-namespace.xhtml
 const (
-	BgpLsSafi MultiprotoSafi = 71
+	UnicastSafi         MultiprotoSafi = 1
+	MulticastSafi       MultiprotoSafi = 2
+	LabeledUnicastSafi  MultiprotoSafi = 4
+	EvpnSafi            MultiprotoSafi = 70
+	BgpLsSafi           MultiprotoSafi = 71
+	BgpLsSpfSafi        MultiprotoSafi = 80
+	MplsVpnSafi         MultiprotoSafi = 128
+	FlowSpecUnicastSafi MultiprotoSafi = 133
 )
 
+func (s MultiprotoSafi) String() string {
+	switch s {
+	case UnicastSafi:
+		return "unicast"
+	case MulticastSafi:
+		return "multicast"
+	case LabeledUnicastSafi:
+		return "labeled-unicast"
+	case EvpnSafi:
+		return "evpn"
+	case BgpLsSafi:
+		return "bgp-ls"
+	case BgpLsSpfSafi:
+		return "bgp-ls-spf"
+	case MplsVpnSafi:
+		return "mpls-vpn"
+	case FlowSpecUnicastSafi:
+		return "flowspec"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(s))
+	}
+}
+
+// AfiSafi is a multiprotocol bgp address family and subsequent address family pair.
+type AfiSafi struct {
+	Afi  MultiprotoAfi
+	Safi MultiprotoSafi
+}
+
+// String returns the names of the address family and subsequent address
+// family separated by a slash, e.g. "bgp-ls/bgp-ls". Values without a name are
+// formatted as "unknown(<value>)".
+func (a AfiSafi) String() string {
+	return a.Afi.String() + "/" + a.Safi.String()
+}
+
+// containsAfiSafi returns true if af is present in families.
+func containsAfiSafi(families []AfiSafi, af AfiSafi) bool {
+	for _, f := range families {
+		if f == af {
+			return true
+		}
+	}
+	return false
+}
+
+// equalAfiSafis returns true if a and b contain the same address families,
+// irrespective of order.
+func equalAfiSafis(a, b []AfiSafi) bool {
+	for _, af := range a {
+		if !containsAfiSafi(b, af) {
+			return false
+		}
+	}
+	for _, af := range b {
+		if !containsAfiSafi(a, af) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBgpLsFamily returns true if afi/safi carry link state nlri.
+func isBgpLsFamily(afi MultiprotoAfi, safi MultiprotoSafi) bool {
+	return afi == BgpLsAfi && (safi == BgpLsSafi || safi == BgpLsSpfSafi)
+}
+
+// multiprotoMismatch returns the address families required by the collector
+// that msg does not advertise, and the address families advertised by msg
+// that the collector does not support. families are the additional address
+// families supported by the collector.
+func multiprotoMismatch(msg *openMessage, families ...AfiSafi) (missing, extra []AfiSafi) {
+	var bgpLsAfFound bool
+	for _, p := range msg.optParams {
+		capOptParam, isCapability := p.(*capabilityOptParam)
+		if !isCapability {
+			continue
+		}
+
+		for _, c := range capOptParam.caps {
+			cap, isMultiproto := c.(*capMultiproto)
+			if !isMultiproto {
+				continue
+			}
+			af := AfiSafi{Afi: cap.afi, Safi: cap.safi}
+			if cap.afi == BgpLsAfi && cap.safi == BgpLsSafi {
+				bgpLsAfFound = true
+			} else if !containsAfiSafi(families, af) {
+				extra = append(extra, af)
+			}
+		}
+	}
+
+	if !bgpLsAfFound {
+		missing = append(missing, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi})
+	}
+
+	return missing, extra
+}
+
+// negotiatedFamilies returns the address families advertised by msg that are
+// supported by the collector, i.e. BGP-LS and families.
+func negotiatedFamilies(msg *openMessage, families ...AfiSafi) []AfiSafi {
+	var negotiated []AfiSafi
+	for _, p := range msg.optParams {
+		capOptParam, isCapability := p.(*capabilityOptParam)
+		if !isCapability {
+			continue
+		}
+
+		for _, c := range capOptParam.caps {
+			cap, isMultiproto := c.(*capMultiproto)
+			if !isMultiproto {
+				continue
+			}
+			af := AfiSafi{Afi: cap.afi, Safi: cap.safi}
+			if (cap.afi == BgpLsAfi && cap.safi == BgpLsSafi) || containsAfiSafi(families, af) {
+				negotiated = append(negotiated, af)
+			}
+		}
+	}
+
+	return negotiated
+}
+
+// hasCapability returns true if msg advertises a capability with code.
+func hasCapability(msg *openMessage, code capabilityCode) bool {
+	for _, p := range msg.optParams {
+		capOptParam, isCapability := p.(*capabilityOptParam)
+		if !isCapability {
+			continue
+		}
+
+		for _, c := range capOptParam.caps {
+			if c.capabilityCode() == code {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 type capMultiproto struct {
 	afi  MultiprotoAfi
 	safi MultiprotoSafi
@@ -542,3 +875,179 @@ func (f *capFourOctetAs) deserialize(b []byte) error {
 func (f *capFourOctetAs) capabilityCode() capabilityCode {
 	return capCodeFourOctetAs
 }
+
+// capRouteRefresh is the Route Refresh capability.
+//
+// https://tools.ietf.org/html/rfc2918#section-2
+type capRouteRefresh struct{}
+
+func (r *capRouteRefresh) serialize() ([]byte, error) {
+	buff := make([]byte, 2)
+
+	// type
+	buff[0] = uint8(capCodeRouteRefresh)
+
+	// length
+	buff[1] = uint8(0)
+
+	return buff, nil
+}
+
+func (r *capRouteRefresh) deserialize(b []byte) error {
+	if len(b) != 0 {
+		return &errWithNotification{
+			error:   errors.New("route refresh capability length does not equal 0"),
+			code:    NotifErrCodeOpenMessage,
+			subcode: 0,
+		}
+	}
+
+	return nil
+}
+
+func (r *capRouteRefresh) capabilityCode() capabilityCode {
+	return capCodeRouteRefresh
+}
+
+// capEnhancedRouteRefresh is the Enhanced Route Refresh capability.
+//
+// https://tools.ietf.org/html/rfc7313#section-3.1
+type capEnhancedRouteRefresh struct{}
+
+func (r *capEnhancedRouteRefresh) serialize() ([]byte, error) {
+	buff := make([]byte, 2)
+
+	// type
+	buff[0] = uint8(capCodeEnhancedRouteRefresh)
+
+	// length
+	buff[1] = uint8(0)
+
+	return buff, nil
+}
+
+func (r *capEnhancedRouteRefresh) deserialize(b []byte) error {
+	if len(b) != 0 {
+		return &errWithNotification{
+			error:   errors.New("enhanced route refresh capability length does not equal 0"),
+			code:    NotifErrCodeOpenMessage,
+			subcode: 0,
+		}
+	}
+
+	return nil
+}
+
+func (r *capEnhancedRouteRefresh) capabilityCode() capabilityCode {
+	return capCodeEnhancedRouteRefresh
+}
+
+// capGracefulRestart is the Graceful Restart capability. restartTime is in
+// seconds.
+//
+// https://tools.ietf.org/html/rfc4724#section-3
+type capGracefulRestart struct {
+	restartState bool
+	restartTime  uint16
+	families     []gracefulRestartFamily
+}
+
+// gracefulRestartFamily is an address family for which a speaker supports
+// graceful restart, forwardingState is true if forwarding state has been
+// preserved across the previous restart.
+type gracefulRestartFamily struct {
+	afi             MultiprotoAfi
+	safi            MultiprotoSafi
+	forwardingState bool
+}
+
+// maxGracefulRestartTime is the largest value of the 12 bit restart time
+const maxGracefulRestartTime = 1<<12 - 1
+
+func (g *capGracefulRestart) serialize() ([]byte, error) {
+	if g.restartTime > maxGracefulRestartTime {
+		return nil, fmt.Errorf("graceful restart time exceeds maximum of %d", maxGracefulRestartTime)
+	}
+
+	buff := make([]byte, 4, 4+len(g.families)*4)
+
+	// type
+	buff[0] = uint8(capCodeGracefulRestart)
+
+	// length
+	buff[1] = uint8(2 + len(g.families)*4)
+
+	// restart flags and time
+	flagsAndTime := g.restartTime
+	if g.restartState {
+		flagsAndTime |= 0x8000
+	}
+	binary.BigEndian.PutUint16(buff[2:4], flagsAndTime)
+
+	for _, f := range g.families {
+		fb := make([]byte, 4)
+		binary.BigEndian.PutUint16(fb[:2], uint16(f.afi))
+		fb[2] = uint8(f.safi)
+		if f.forwardingState {
+			fb[3] = 0x80
+		}
+		buff = append(buff, fb...)
+	}
+
+	return buff, nil
+}
+
+func (g *capGracefulRestart) deserialize(b []byte) error {
+	if len(b) < 2 || (len(b)-2)%4 != 0 {
+		return &errWithNotification{
+			error:   errors.New("invalid graceful restart capability length"),
+			code:    NotifErrCodeOpenMessage,
+			subcode: 0,
+		}
+	}
+
+	flagsAndTime := binary.BigEndian.Uint16(b[:2])
+	g.restartState = flagsAndTime&0x8000 != 0
+	g.restartTime = flagsAndTime & maxGracefulRestartTime
+	g.families = nil
+	for b = b[2:]; len(b) > 0; b = b[4:] {
+		g.families = append(g.families, gracefulRestartFamily{
+			afi:             MultiprotoAfi(binary.BigEndian.Uint16(b[:2])),
+			safi:            MultiprotoSafi(b[2]),
+			forwardingState: b[3]&0x80 != 0,
+		})
+	}
+
+	return nil
+}
+
+func (g *capGracefulRestart) capabilityCode() capabilityCode {
+	return capCodeGracefulRestart
+}
+
+// gracefulRestartFor returns the Graceful Restart capability advertised by msg
+// and the entry for family, the entry is nil if family is not included. nil is
+// returned for both if msg does not advertise the capability.
+func gracefulRestartFor(msg *openMessage, family AfiSafi) (*capGracefulRestart, *gracefulRestartFamily) {
+	for _, p := range msg.optParams {
+		capOptParam, isCapability := p.(*capabilityOptParam)
+		if !isCapability {
+			continue
+		}
+
+		for _, c := range capOptParam.caps {
+			g, isGracefulRestart := c.(*capGracefulRestart)
+			if !isGracefulRestart {
+				continue
+			}
+			for i, f := range g.families {
+				if f.afi == family.Afi && f.safi == family.Safi {
+					return g, &g.families[i]
+				}
+			}
+			return g, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -45,6 +45,42 @@ func TestDeserializeOptParams(t *testing.T) {
 	b[1] = uint8(math.MaxUint8)
 	_, err = deserializeOptParams(b)
 	assert.NotNil(t, err)
+
+	// capability length exceeds its param length, extending into the next
+	// param
+	b = []byte{
+		uint8(capabilityOptParamType), 2, uint8(capCodeFourOctetAs), 4,
+		uint8(capabilityOptParamType), 6, uint8(capCodeFourOctetAs), 4, 0, 0, 0, 1,
+	}
+	_, err = deserializeOptParams(b)
+	assert.NotNil(t, err)
+
+	// capabilities confined to their param
+	b = []byte{
+		uint8(capabilityOptParamType), 6, uint8(capCodeFourOctetAs), 4, 0, 0, 0, 2,
+		uint8(capabilityOptParamType), 6, uint8(capCodeFourOctetAs), 4, 0, 0, 0, 1,
+	}
+	params, err := deserializeOptParams(b)
+	if assert.Nil(t, err) && assert.Len(t, params, 2) {
+		assert.Equal(t, []capability{&capFourOctetAs{asn: 2}}, params[0].(*capabilityOptParam).caps)
+		assert.Equal(t, []capability{&capFourOctetAs{asn: 1}}, params[1].(*capabilityOptParam).caps)
+	}
+
+	// capability length exceeds the remaining length of its param
+	b = []byte{uint8(capabilityOptParamType), 8, uint8(capCodeFourOctetAs), 4, 0, 0, 0, 1, uint8(capCodeFourOctetAs), 4}
+	_, err = deserializeOptParams(b)
+	assert.NotNil(t, err)
+
+	// non-capability param preserved
+	b = []byte{1, 2, 9, 9, uint8(capabilityOptParamType), 6, uint8(capCodeFourOctetAs), 4, 0, 0, 0, 1}
+	params, err = deserializeOptParams(b)
+	if assert.Nil(t, err) && assert.Len(t, params, 2) {
+		assert.Equal(t, params[0], &optParamUnknown{code: 1, data: []byte{9, 9}})
+		assert.Equal(t, params[0].optParamType(), optParamType(1))
+		p, err := params[0].serialize()
+		assert.Nil(t, err)
+		assert.Equal(t, p, b[:4])
+	}
 }
 
 func TestCapOptParam(t *testing.T) {
@@ -92,6 +128,84 @@ func TestCapMultiproto(t *testing.T) {
 	assert.Equal(t, c.capabilityCode(), capCodeMultiproto)
 }
 
+func TestCapRouteRefresh(t *testing.T) {
+	c := &capRouteRefresh{}
+	err := c.deserialize([]byte{0})
+	assert.NotNil(t, err)
+	assert.Equal(t, c.capabilityCode(), capCodeRouteRefresh)
+
+	b, err := c.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b, []byte{2, 0})
+
+	o := &capabilityOptParam{}
+	err = o.deserialize(b)
+	assert.Nil(t, err)
+	assert.Equal(t, o.caps, []capability{c})
+}
+
+func TestCapEnhancedRouteRefresh(t *testing.T) {
+	c := &capEnhancedRouteRefresh{}
+	err := c.deserialize([]byte{0})
+	assert.NotNil(t, err)
+	assert.Equal(t, c.capabilityCode(), capCodeEnhancedRouteRefresh)
+
+	b, err := c.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b, []byte{70, 0})
+
+	o := &capabilityOptParam{}
+	err = o.deserialize(b)
+	assert.Nil(t, err)
+	assert.Equal(t, o.caps, []capability{c})
+}
+
+func TestCapGracefulRestart(t *testing.T) {
+	c := &capGracefulRestart{}
+	assert.Equal(t, c.capabilityCode(), capCodeGracefulRestart)
+	assert.NotNil(t, c.deserialize([]byte{0}))
+	assert.NotNil(t, c.deserialize([]byte{0, 0, 0}))
+
+	c = &capGracefulRestart{
+		restartState: true,
+		restartTime:  120,
+		families: []gracefulRestartFamily{
+			{afi: BgpLsAfi, safi: BgpLsSafi, forwardingState: true},
+			{afi: IPv4Afi, safi: UnicastSafi},
+		},
+	}
+	b, err := c.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b, []byte{64, 10, 0x80, 120, 0x40, 0x04, 71, 0x80, 0, 1, 1, 0})
+
+	o := &capabilityOptParam{}
+	err = o.deserialize(b)
+	assert.Nil(t, err)
+	assert.Equal(t, o.caps, []capability{c})
+
+	msg := &openMessage{optParams: []optParam{o}}
+	g, f := gracefulRestartFor(msg, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi})
+	assert.Equal(t, c, g)
+	assert.Equal(t, &c.families[0], f)
+	g, f = gracefulRestartFor(msg, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSpfSafi})
+	assert.Equal(t, c, g)
+	assert.Nil(t, f)
+	g, f = gracefulRestartFor(&openMessage{}, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi})
+	assert.Nil(t, g)
+	assert.Nil(t, f)
+
+	// restart time exceeds 12 bits
+	c.restartTime = 4096
+	_, err = c.serialize()
+	assert.NotNil(t, err)
+}
+
 func TestCapFourOctetAs(t *testing.T) {
 	c := &capFourOctetAs{}
 	err := c.deserialize([]byte{0})
@@ -105,18 +219,25 @@ func TestValidateOpenMessage(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = validateOpenMessage(o, 1)
+	err = validateOpenMessage(o, 1, false, false)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// asn mimatch
-	err = validateOpenMessage(o, 2)
-	assert.NotNil(t, err)
+	err = validateOpenMessage(o, 2, false, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "bad peer AS: expected AS 2, got AS 1", err.Error())
+		assert.Equal(t, []byte{0, 1}, err.(*errWithNotification).data)
+	}
+	err = validateOpenMessage(o, 523456, false, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "bad peer AS: expected AS_TRANS for 4-octet AS 523456, got AS 1", err.Error())
+	}
 
 	// bad version
 	o.version = 2
-	err = validateOpenMessage(o, 1)
+	err = validateOpenMessage(o, 1, false, false)
 	assert.NotNil(t, err)
 
 	// bad hold time
@@ -124,7 +245,7 @@ func TestValidateOpenMessage(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = validateOpenMessage(o, 1)
+	err = validateOpenMessage(o, 1, false, false)
 	assert.NotNil(t, err)
 
 	// non-cap opt param
@@ -133,22 +254,33 @@ func TestValidateOpenMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 	o.optParams = []optParam{&fakeOptParam{}}
-	err = validateOpenMessage(o, 1)
+	err = validateOpenMessage(o, 1, false, false)
 	assert.NotNil(t, err)
 
+	// non-cap opt param tolerated
+	o, err = newOpenMessage(1, time.Second*3, net.ParseIP("172.16.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.optParams = append([]optParam{&optParamUnknown{code: 1, data: []byte{0}}}, o.optParams...)
+	err = validateOpenMessage(o, 1, false, false)
+	assert.NotNil(t, err)
+	err = validateOpenMessage(o, 1, false, true)
+	assert.Nil(t, err)
+
 	// bad bgp id
 	o, err = newOpenMessage(1, time.Second*3, []byte{0, 0, 0, 0})
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = validateOpenMessage(o, 1)
+	err = validateOpenMessage(o, 1, false, false)
 	assert.NotNil(t, err)
 
 	// bad opt params
 	o.holdTime = 3
 	o.bgpID = 1
 	o.optParams = nil
-	err = validateOpenMessage(o, 1)
+	err = validateOpenMessage(o, 1, false, false)
 	assert.NotNil(t, err)
 
 	// test 4 octet asn
@@ -156,9 +288,31 @@ func TestValidateOpenMessage(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = validateOpenMessage(o, 523456)
+	err = validateOpenMessage(o, 523456, false, false)
+	assert.Nil(t, err)
+
+	// 2 octet peer without the 4 octet cap
+	o, err = newOpenMessage(64512, time.Second*3, net.ParseIP("172.16.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.optParams = []optParam{
+		&capabilityOptParam{
+			caps: []capability{
+				&capMultiproto{
+					afi:  BgpLsAfi,
+					safi: BgpLsSafi,
+				},
+			},
+		},
+	}
+	err = validateOpenMessage(o, 64512, false, false)
 	assert.Nil(t, err)
 
+	// 4 octet neighbor asn matching the truncated as field
+	err = validateOpenMessage(o, 64512+math.MaxUint16+1, false, false)
+	assert.NotNil(t, err)
+
 	// 4 octet indicated but not found in cap
 	o, err = newOpenMessage(uint32(asTrans), time.Second*3, net.ParseIP("172.16.1.1"))
 	if err != nil {
@@ -174,8 +328,10 @@ func TestValidateOpenMessage(t *testing.T) {
 			},
 		},
 	}
-	err = validateOpenMessage(o, 5)
-	assert.NotNil(t, err)
+	err = validateOpenMessage(o, 5, false, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "bad peer AS: got AS_TRANS without a 4-octet AS capability, expected AS 5", err.Error())
+	}
 
 	// bad peer asn in 4 octet cap
 	o, err = newOpenMessage(uint32(asTrans), time.Second*3, net.ParseIP("172.16.1.1"))
@@ -195,8 +351,128 @@ func TestValidateOpenMessage(t *testing.T) {
 			},
 		},
 	}
-	err = validateOpenMessage(o, 5)
+	err = validateOpenMessage(o, 5, false, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "bad peer AS: expected AS 5, got AS 6 in 4-octet AS capability", err.Error())
+		assert.Equal(t, []byte{0, 0, 0, 6}, err.(*errWithNotification).data)
+	}
+
+	// missing bgp-ls
+	o, err = newOpenMessage(1, time.Second*3, net.ParseIP("172.16.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.optParams = []optParam{
+		&capabilityOptParam{
+			caps: []capability{
+				&capMultiproto{
+					afi:  1,
+					safi: 1,
+				},
+			},
+		},
+	}
+	err = validateOpenMessage(o, 1, false, false)
 	assert.NotNil(t, err)
+	err = validateOpenMessage(o, 1, true, false)
+	assert.Nil(t, err)
+
+	// no other address families
+	o.optParams = nil
+	err = validateOpenMessage(o, 1, true, false)
+	assert.NotNil(t, err)
+}
+
+func TestAfiSafiString(t *testing.T) {
+	cases := []struct {
+		af AfiSafi
+		s  string
+	}{
+		{AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}, "bgp-ls/bgp-ls"},
+		{AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSpfSafi}, "bgp-ls/bgp-ls-spf"},
+		{AfiSafi{Afi: IPv4Afi, Safi: UnicastSafi}, "ipv4/unicast"},
+		{AfiSafi{Afi: IPv6Afi, Safi: MplsVpnSafi}, "ipv6/mpls-vpn"},
+		{AfiSafi{Afi: L2vpnAfi, Safi: EvpnSafi}, "l2vpn/evpn"},
+		{AfiSafi{Afi: IPv4Afi, Safi: FlowSpecUnicastSafi}, "ipv4/flowspec"},
+		{AfiSafi{Afi: 3, Safi: 200}, "unknown(3)/unknown(200)"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.s, c.af.String())
+	}
+	assert.Equal(t, "unknown(3)", MultiprotoAfi(3).String())
+	assert.Equal(t, "unknown(200)", MultiprotoSafi(200).String())
+}
+
+func TestMultiprotoMismatch(t *testing.T) {
+	o, err := newOpenMessage(1, time.Second*3, net.ParseIP("172.16.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, extra := multiprotoMismatch(o)
+	assert.Len(t, missing, 0)
+	assert.Len(t, extra, 0)
+
+	o.optParams = []optParam{
+		&fakeOptParam{},
+		&capabilityOptParam{
+			caps: []capability{
+				&capFourOctetAs{asn: 1},
+				&capMultiproto{afi: 1, safi: 1},
+				&capMultiproto{afi: 2, safi: 1},
+			},
+		},
+	}
+	missing, extra = multiprotoMismatch(o)
+	assert.Equal(t, missing, []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}})
+	assert.Equal(t, extra, []AfiSafi{{Afi: 1, Safi: 1}, {Afi: 2, Safi: 1}})
+
+	// configured families are not extra
+	missing, extra = multiprotoMismatch(o, AfiSafi{Afi: 2, Safi: 1})
+	assert.Equal(t, missing, []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}})
+	assert.Equal(t, extra, []AfiSafi{{Afi: 1, Safi: 1}})
+}
+
+func TestNegotiatedFamilies(t *testing.T) {
+	o, err := newOpenMessage(1, time.Second*3, net.ParseIP("172.16.1.1"), AfiSafi{Afi: 2, Safi: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, hasCapability(o, capCodeRouteRefresh))
+	assert.True(t, hasCapability(o, capCodeFourOctetAs))
+
+	o.addCapability(&capRouteRefresh{})
+	assert.True(t, hasCapability(o, capCodeRouteRefresh))
+
+	assert.Equal(t, negotiatedFamilies(o), []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}})
+	assert.Equal(t, negotiatedFamilies(o, AfiSafi{Afi: 2, Safi: 1}, AfiSafi{Afi: 1, Safi: 1}), []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}, {Afi: 2, Safi: 1}})
+
+	// no capabilities optional parameter
+	o.optParams = nil
+	o.addCapability(&capRouteRefresh{})
+	assert.True(t, hasCapability(o, capCodeRouteRefresh))
+	assert.Len(t, negotiatedFamilies(o), 0)
+}
+
+func TestOpenMessageAddressFamilies(t *testing.T) {
+	o, err := newOpenMessage(1, time.Second*3, net.ParseIP("172.16.1.1"),
+		AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi},
+		AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSpfSafi},
+		AfiSafi{Afi: 2, Safi: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caps := o.optParams[0].(*capabilityOptParam).caps
+	assert.Equal(t, caps[1:], []capability{
+		&capMultiproto{afi: BgpLsAfi, safi: BgpLsSafi},
+		&capMultiproto{afi: BgpLsAfi, safi: BgpLsSpfSafi},
+		&capMultiproto{afi: 2, safi: 1},
+	})
+
+	missing, extra := multiprotoMismatch(o, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSpfSafi}, AfiSafi{Afi: 2, Safi: 1})
+	assert.Len(t, missing, 0)
+	assert.Len(t, extra, 0)
 }
 
 func TestOpenMessage(t *testing.T) {
@@ -208,6 +484,10 @@ func TestOpenMessage(t *testing.T) {
 	_, err := newOpenMessage(uint32(asn), holdTime, []byte{0})
 	assert.NotNil(t, err)
 
+	// ipv6 bgp id
+	_, err = newOpenMessage(uint32(asn), holdTime, net.ParseIP("2001:db8::1"))
+	assert.NotNil(t, err)
+
 	// invalid opt params
 	o := &openMessage{
 		optParams: []optParam{
@@ -244,7 +524,7 @@ func TestOpenMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	m, err := messagesFromBytes(b)
+	m, err := messagesFromBytes(b, decodeOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -292,3 +572,68 @@ func TestOpenMessage(t *testing.T) {
 	assert.Equal(t, r.afi, BgpLsAfi)
 	assert.Equal(t, r.safi, BgpLsSafi)
 }
+
+func TestValidateOpenBgpID(t *testing.T) {
+	o, err := newOpenMessage(1, time.Second*3, net.ParseIP("172.16.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, bgpIDToIP(o.bgpID), net.ParseIP("172.16.1.1").To4())
+
+	// no expected value
+	err = validateOpenBgpID(o, nil)
+	assert.Nil(t, err)
+
+	// match
+	err = validateOpenBgpID(o, net.ParseIP("172.16.1.1"))
+	assert.Nil(t, err)
+
+	// mismatch
+	err = validateOpenBgpID(o, net.ParseIP("172.16.1.2"))
+	if assert.IsType(t, &errWithNotification{}, err) {
+		assert.Equal(t, err.(*errWithNotification).subcode, NotifErrSubcodeBadBgpID)
+	}
+}
+
+func TestValidateOpenHoldTime(t *testing.T) {
+	o, err := newOpenMessage(1, time.Second*9, net.ParseIP("172.16.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no minimum
+	err = validateOpenHoldTime(o, 0)
+	assert.Nil(t, err)
+
+	// equal to minimum
+	err = validateOpenHoldTime(o, time.Second*9)
+	assert.Nil(t, err)
+
+	// below minimum
+	err = validateOpenHoldTime(o, time.Second*10)
+	if assert.IsType(t, &errWithNotification{}, err) {
+		assert.Equal(t, err.(*errWithNotification).subcode, NotifErrSubcodeUnacceptableHoldTime)
+	}
+}
+
+func TestValidateOpenNotSelf(t *testing.T) {
+	o, err := newOpenMessage(1, time.Second*3, net.ParseIP("172.16.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// different bgp ID
+	err = validateOpenNotSelf(o, 1, 1, net.ParseIP("172.16.1.2"))
+	assert.Nil(t, err)
+
+	// same bgp ID, different AS
+	err = validateOpenNotSelf(o, 1, 2, net.ParseIP("172.16.1.1"))
+	assert.Nil(t, err)
+
+	// same bgp ID and AS
+	err = validateOpenNotSelf(o, 1, 1, net.ParseIP("172.16.1.1"))
+	if assert.IsType(t, &errWithNotification{}, err) {
+		assert.Equal(t, err.(*errWithNotification).subcode, NotifErrSubcodeBadBgpID)
+	}
+}
@@ -0,0 +1,83 @@
+package bgpls
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// RouteRefreshMessage is a bgp message requesting the re-advertisement of
+// all routes of an AFI/SAFI. If the Enhanced Route Refresh capability has been
+// negotiated Subtype may also mark the beginning or end of the
+// re-advertisement, otherwise it is reserved.
+//
+// https://tools.ietf.org/html/rfc2918#section-3
+//
+// https://tools.ietf.org/html/rfc7313#section-3.2
+type RouteRefreshMessage struct {
+	Afi     MultiprotoAfi
+	Subtype RouteRefreshSubtype
+	Safi    MultiprotoSafi
+}
+
+// RouteRefreshSubtype is the message subtype of a RouteRefreshMessage.
+type RouteRefreshSubtype uint8
+
+// RouteRefreshSubtype values
+const (
+	RouteRefreshSubtypeRequest RouteRefreshSubtype = 0
+	RouteRefreshSubtypeBoRR    RouteRefreshSubtype = 1
+	RouteRefreshSubtypeEoRR    RouteRefreshSubtype = 2
+)
+
+// MessageType returns the appropriate MessageType for RouteRefreshMessage.
+func (r *RouteRefreshMessage) MessageType() MessageType {
+	return RouteRefreshMessageType
+}
+
+func (r *RouteRefreshMessage) serialize() ([]byte, error) {
+	buff := make([]byte, 4)
+	binary.BigEndian.PutUint16(buff[:2], uint16(r.Afi))
+	buff[2] = uint8(r.Subtype)
+	buff[3] = uint8(r.Safi)
+
+	buff = prependHeader(buff, RouteRefreshMessageType)
+
+	return buff, nil
+}
+
+func (r *RouteRefreshMessage) deserialize(b []byte) error {
+	/*
+		rfc7313 section 5
+		If the length, excluding the fixed-size message header, of the
+		received ROUTE-REFRESH message with Message Subtype 1 and 2 is not 4,
+		then the BGP speaker MUST send a NOTIFICATION message with the Error
+		Code of "ROUTE-REFRESH Message Error" and the subcode of "Invalid
+		Message Length".  The Data field of the NOTIFICATION message MUST
+		contain the complete ROUTE-REFRESH message.
+	*/
+	if len(b) != 4 && len(b) > 2 && (RouteRefreshSubtype(b[2]) == RouteRefreshSubtypeBoRR || RouteRefreshSubtype(b[2]) == RouteRefreshSubtypeEoRR) {
+		return &errWithNotification{
+			error:   errors.New("enhanced route refresh message invalid length"),
+			code:    NotifErrCodeRouteRefreshMessage,
+			subcode: NotifErrSubcodeInvalidMessageLength,
+			data:    prependHeader(append([]byte(nil), b...), RouteRefreshMessageType),
+		}
+	}
+	if len(b) != 4 {
+		// the data field contains the erroneous length field of the header
+		data := make([]byte, 2)
+		binary.BigEndian.PutUint16(data, uint16(len(b)+19))
+		return &errWithNotification{
+			error:   errors.New("route refresh message invalid length"),
+			code:    NotifErrCodeMessageHeader,
+			subcode: NotifErrSubcodeBadLength,
+			data:    data,
+		}
+	}
+
+	r.Afi = MultiprotoAfi(binary.BigEndian.Uint16(b[:2]))
+	r.Subtype = RouteRefreshSubtype(b[2])
+	r.Safi = MultiprotoSafi(b[3])
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package bgpls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteRefreshMessage(t *testing.T) {
+	r := &RouteRefreshMessage{
+		Afi:  BgpLsAfi,
+		Safi: BgpLsSafi,
+	}
+
+	b, err := r.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte{0x40, 0x04, 0, 0x47}, b[19:])
+
+	m, err := messagesFromBytes(b, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, m, 1) {
+		assert.Equal(t, r, m[0])
+		assert.Equal(t, RouteRefreshMessageType, m[0].MessageType())
+	}
+
+	// subtype
+	r.Subtype = RouteRefreshSubtypeEoRR
+	b, err = r.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte{0x40, 0x04, 2, 0x47}, b[19:])
+	m, err = messagesFromBytes(b, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, m, 1) {
+		assert.Equal(t, r, m[0])
+	}
+
+	// invalid length
+	err = (&RouteRefreshMessage{}).deserialize([]byte{0x40, 0x04, 0})
+	if assert.IsType(t, &errWithNotification{}, err) {
+		assert.Equal(t, NotifErrCodeMessageHeader, err.(*errWithNotification).code)
+		assert.Equal(t, NotifErrSubcodeBadLength, err.(*errWithNotification).subcode)
+		assert.Equal(t, []byte{0, 22}, err.(*errWithNotification).data)
+	}
+
+	// invalid length with an enhanced route refresh subtype
+	err = (&RouteRefreshMessage{}).deserialize([]byte{0x40, 0x04, 1, 0x47, 0})
+	if assert.IsType(t, &errWithNotification{}, err) {
+		n := err.(*errWithNotification)
+		assert.Equal(t, NotifErrCodeRouteRefreshMessage, n.code)
+		assert.Equal(t, NotifErrSubcodeInvalidMessageLength, n.subcode)
+		assert.Len(t, n.data, 24)
+		assert.Equal(t, []byte{0x40, 0x04, 1, 0x47, 0}, n.data[19:])
+	}
+}
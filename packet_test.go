@@ -1,7 +1,11 @@
 package bgpls
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,6 +16,7 @@ func TestMessageTypeString(t *testing.T) {
 	assert.Equal(t, UpdateMessageType.String(), "update")
 	assert.Equal(t, NotificationMessageType.String(), "notification")
 	assert.Equal(t, KeepAliveMessageType.String(), "keepalive")
+	assert.Equal(t, RouteRefreshMessageType.String(), "route refresh")
 }
 
 func TestMessageFromBytes(t *testing.T) {
@@ -23,23 +28,23 @@ func TestMessageFromBytes(t *testing.T) {
 
 	// invalid message header length
 	binary.BigEndian.PutUint16(b[16:18], 0)
-	_, err = messagesFromBytes(b)
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// error on keepalive deserialization
 	b = append(b, 0)
 	binary.BigEndian.PutUint16(b[16:18], 20)
-	_, err = messagesFromBytes(b)
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid marker
 	b[15] = 0
-	_, err = messagesFromBytes(b)
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// message < 19 bytes
 	b = b[:18]
-	_, err = messagesFromBytes(b)
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// error on open message deserialization
@@ -48,16 +53,19 @@ func TestMessageFromBytes(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = messagesFromBytes(b)
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
 
-	// error on update message deserialization
+	// error on update message deserialization, a truncated path attribute
 	u := &UpdateMessage{}
 	b, err = u.serialize()
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = messagesFromBytes(b)
+	b = append(b, 0)
+	binary.BigEndian.PutUint16(b[16:18], uint16(len(b)))
+	binary.BigEndian.PutUint16(b[21:23], 1)
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// error on notification message deserialization
@@ -68,13 +76,25 @@ func TestMessageFromBytes(t *testing.T) {
 	}
 	b = b[:len(b)-2]
 	binary.BigEndian.PutUint16(b[16:18], 19)
-	_, err = messagesFromBytes(b)
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid message type
-	b[18] = 5
-	_, err = messagesFromBytes(b)
+	b[18] = 6
+	_, err = messagesFromBytes(b, decodeOptions{})
+	if assert.IsType(t, &errWithNotification{}, err) {
+		n := err.(*errWithNotification)
+		assert.Equal(t, NotifErrCodeMessageHeader, n.code)
+		assert.Equal(t, NotifErrSubcodeBadType, n.subcode)
+		assert.Equal(t, []byte{6}, n.data)
+	}
+	b[18] = 0
+	_, err = messagesFromBytes(b, decodeOptions{})
 	assert.NotNil(t, err)
+	_, err = decodeMessage(6, nil, decodeOptions{})
+	if assert.IsType(t, &errWithNotification{}, err) {
+		assert.Equal(t, []byte{6}, err.(*errWithNotification).data)
+	}
 
 	// 2 messages
 	k = &keepAliveMessage{}
@@ -83,7 +103,292 @@ func TestMessageFromBytes(t *testing.T) {
 		t.Fatal(err)
 	}
 	b = append(b, b...)
-	m, err := messagesFromBytes(b)
+	m, err := messagesFromBytes(b, decodeOptions{})
 	assert.Len(t, m, 2)
 	assert.Nil(t, err)
 }
+
+// oneByteReader returns a single byte per call to Read.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return r.r.Read(p[:1])
+}
+
+func TestDecoder(t *testing.T) {
+	k, err := (&keepAliveMessage{}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := (&NotificationMessage{Code: NotifErrCodeCease, Subcode: NotifErrSubcodeAdminShutdown}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := (&UpdateMessage{PathAttrs: fullTopologyPathAttrs()}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stream []byte
+	stream = append(stream, k...)
+	stream = append(stream, u...)
+	stream = append(stream, n...)
+
+	readers := []io.Reader{
+		bytes.NewReader(stream),
+		&oneByteReader{r: bytes.NewReader(stream)},
+	}
+
+	for _, r := range readers {
+		d := NewDecoder(r)
+
+		m, err := d.Decode()
+		if assert.Nil(t, err) {
+			assert.IsType(t, &keepAliveMessage{}, m)
+		}
+		m, err = d.Decode()
+		if assert.Nil(t, err) && assert.IsType(t, &UpdateMessage{}, m) {
+			assert.Len(t, m.(*UpdateMessage).PathAttrs, len(fullTopologyPathAttrs()))
+		}
+		m, err = d.Decode()
+		if assert.Nil(t, err) && assert.IsType(t, &NotificationMessage{}, m) {
+			assert.Equal(t, NotifErrCodeCease, m.(*NotificationMessage).Code)
+		}
+
+		_, err = d.Decode()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	// message truncated by end of input
+	d := NewDecoder(bytes.NewReader(append(k, u[:100]...)))
+	_, err = d.Decode()
+	assert.Nil(t, err)
+	_, err = d.Decode()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// invalid marker is returned by subsequent calls
+	b := append([]byte{}, k...)
+	b[0] = 0
+	d = NewDecoder(bytes.NewReader(append(b, k...)))
+	_, err = d.Decode()
+	assert.NotNil(t, err)
+	_, err2 := d.Decode()
+	assert.Equal(t, err, err2)
+
+	// invalid marker in a partial header
+	_, err = NewDecoder(bytes.NewReader([]byte{0xFF, 0})).Decode()
+	assert.NotNil(t, err)
+	assert.NotEqual(t, io.ErrUnexpectedEOF, err)
+
+	// message length exceeds maximum
+	b = append([]byte{}, k...)
+	binary.BigEndian.PutUint16(b[16:18], maxMessageLen+1)
+	_, err = NewDecoder(bytes.NewReader(b)).Decode()
+	if assert.IsType(t, &errWithNotification{}, err) {
+		n := err.(*errWithNotification)
+		assert.Equal(t, NotifErrSubcodeBadLength, n.subcode)
+		assert.Equal(t, b[16:18], n.data)
+	}
+
+	// invalid message type is detected before the message body is read
+	b = append([]byte{}, k...)
+	binary.BigEndian.PutUint16(b[16:18], 100)
+	b[18] = 0xFF
+	_, err = NewDecoder(bytes.NewReader(b)).Decode()
+	if assert.IsType(t, &errWithNotification{}, err) {
+		n := err.(*errWithNotification)
+		assert.Equal(t, NotifErrSubcodeBadType, n.subcode)
+		assert.Equal(t, []byte{0xFF}, n.data)
+	}
+
+	// decoded messages do not alias the decoder's buffer
+	data := []byte{1, 2, 3, 4}
+	n, err = (&NotificationMessage{Code: NotifErrCodeCease, Data: data}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = NewDecoder(bytes.NewReader(append(n, k...)))
+	m, err := d.Decode()
+	if assert.Nil(t, err) {
+		_, err = d.Decode()
+		assert.Nil(t, err)
+		assert.Equal(t, data, m.(*NotificationMessage).Data)
+	}
+}
+
+func TestDecoderMaxMessageLen(t *testing.T) {
+	var nlri []LinkStateNlri
+	for i := 0; i < 200; i++ {
+		nlri = append(nlri, &LinkStateNlriNode{
+			ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+			LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: uint32(i)}},
+		})
+	}
+	u, err := (&UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: nlri},
+		},
+	}).serializeWithMaxLen(maxExtendedMessageLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, len(u) > maxMessageLen)
+	k, err := (&keepAliveMessage{}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := append(append(append([]byte{}, k...), u...), k...)
+
+	_, err = NewDecoder(bytes.NewReader(u)).Decode()
+	assert.NotNil(t, err)
+
+	d := NewDecoder(&oneByteReader{r: bytes.NewReader(stream)})
+	assert.NotNil(t, d.SetMaxMessageLen(maxMessageLen-1))
+	assert.NotNil(t, d.SetMaxMessageLen(maxExtendedMessageLen+1))
+	err = d.SetMaxMessageLen(maxExtendedMessageLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := d.Decode()
+	if assert.Nil(t, err) {
+		assert.IsType(t, &keepAliveMessage{}, m)
+	}
+	assert.Equal(t, maxMessageLen, cap(d.buf))
+	m, err = d.Decode()
+	if assert.Nil(t, err) && assert.IsType(t, &UpdateMessage{}, m) {
+		reach := m.(*UpdateMessage).PathAttrs[1].(*PathAttrMpReach)
+		assert.Len(t, reach.Nlri, 200)
+	}
+	assert.Equal(t, len(u), cap(d.buf))
+	m, err = d.Decode()
+	if assert.Nil(t, err) {
+		assert.IsType(t, &keepAliveMessage{}, m)
+	}
+	_, err = d.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+type errWriter struct{}
+
+func TestDecoderRawMessages(t *testing.T) {
+	k, err := (&keepAliveMessage{}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := (&NotificationMessage{Code: NotifErrCodeCease, Subcode: NotifErrSubcodeAdminShutdown}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := (&UpdateMessage{PathAttrs: fullTopologyPathAttrs()}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stream []byte
+	stream = append(stream, k...)
+	stream = append(stream, u...)
+	stream = append(stream, n...)
+
+	// not retained by default
+	msgs, err := messagesFromBytes(stream, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, msgs[1].(*UpdateMessage).RawBytes())
+	assert.Nil(t, msgs[2].(*NotificationMessage).RawBytes())
+
+	opts := decodeOptions{retainRawMessages: true}
+	msgs, err = messagesFromBytes(stream, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, u, msgs[1].(*UpdateMessage).RawBytes())
+	assert.Equal(t, n, msgs[2].(*NotificationMessage).RawBytes())
+
+	d := newDecoder(&oneByteReader{r: bytes.NewReader(stream)}, func() decodeOptions { return opts })
+	msgs = nil
+	for i := 0; i < 3; i++ {
+		m, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+	update := msgs[1].(*UpdateMessage)
+	assert.Equal(t, u, update.RawBytes())
+	assert.Equal(t, n, msgs[2].(*NotificationMessage).RawBytes())
+
+	// raw bytes do not alias the input or a clone
+	stream[len(k)+19] = ^stream[len(k)+19]
+	assert.Equal(t, u, update.RawBytes())
+	c := update.Clone()
+	c.RawBytes()[0] = 0
+	assert.Equal(t, u, update.RawBytes())
+
+	// messages that fail to decode are retained in the error
+	malformed := append(bytes.Repeat([]byte{0xff}, 16), 0, 23, uint8(UpdateMessageType), 0, 0, 0, 1)
+	_, err = messagesFromBytes(malformed, decodeOptions{})
+	assert.IsType(t, &errWithNotification{}, err)
+	_, err = messagesFromBytes(malformed, opts)
+	if assert.IsType(t, &DecodeError{}, err) {
+		assert.Equal(t, malformed, err.(*DecodeError).RawBytes())
+		n, ok := asNotification(err)
+		if assert.True(t, ok) {
+			assert.Equal(t, NotifErrCodeUpdateMessage, n.code)
+		}
+	}
+	d = newDecoder(bytes.NewReader(malformed), func() decodeOptions { return opts })
+	_, err = d.Decode()
+	if assert.IsType(t, &DecodeError{}, err) {
+		assert.Equal(t, malformed, err.(*DecodeError).RawBytes())
+		assert.IsType(t, &errWithNotification{}, err.(*DecodeError).Unwrap())
+	}
+}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write error")
+}
+
+func TestEncoder(t *testing.T) {
+	msgs := []Message{
+		&keepAliveMessage{},
+		&UpdateMessage{PathAttrs: fullTopologyPathAttrs()},
+		&NotificationMessage{Code: NotifErrCodeCease, Subcode: NotifErrSubcodeAdminShutdown},
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for _, m := range msgs {
+		assert.Nil(t, e.Encode(m))
+	}
+
+	d := NewDecoder(&buf)
+	for _, m := range msgs {
+		got, err := d.Decode()
+		if assert.Nil(t, err) {
+			assert.Equal(t, m, got)
+		}
+	}
+	_, err := d.Decode()
+	assert.Equal(t, io.EOF, err)
+
+	// nil message
+	assert.NotNil(t, e.Encode(nil))
+
+	// message exceeds maximum length
+	err = e.Encode(&NotificationMessage{Code: NotifErrCodeCease, Data: make([]byte, maxMessageLen)})
+	assert.NotNil(t, err)
+
+	// error serializing message
+	err = e.Encode(&UpdateMessage{PathAttrs: []PathAttr{&PathAttrMpReach{NextHop: net.IP{1}}}})
+	assert.NotNil(t, err)
+
+	// write error
+	assert.NotNil(t, NewEncoder(errWriter{}).Encode(&keepAliveMessage{}))
+}
@@ -2,11 +2,17 @@ package bgpls
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
 	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,6 +23,317 @@ const (
 // UpdateMessage is a bgp message.
 type UpdateMessage struct {
 	PathAttrs []PathAttr
+
+	// errs contains the errors handled without a session reset during
+	// deserialization according to an UpdateErrorPolicy
+	errs []error
+	// routes is true if the update contained withdrawn routes or nlri outside
+	// of path attributes, i.e. IPv4 unicast routes, which are not decoded
+	routes bool
+	raw    []byte
+}
+
+// RawBytes returns the on-wire encoding of UpdateMessage as received, including
+// the message header. It is nil unless CollectorConfig.RetainRawMessages is set.
+func (u *UpdateMessage) RawBytes() []byte {
+	return u.raw
+}
+
+// Clone returns a deep copy of u. The copy shares no memory with u, including
+// the backing arrays of net.IP, []byte and other slice fields, so it may be
+// retained and modified independently.
+func (u *UpdateMessage) Clone() *UpdateMessage {
+	c := deepCopy(reflect.ValueOf(u)).Interface().(*UpdateMessage)
+	c.routes = u.routes
+
+	// deepCopy cannot set unexported fields, copy the retained raw bytes
+	if u.raw != nil {
+		c.raw = append([]byte{}, u.raw...)
+	}
+	for _, a := range c.PathAttrs {
+		if raw := a.RawBytes(); raw != nil {
+			setRawBytes(a, append([]byte{}, raw...))
+		}
+	}
+
+	return c
+}
+
+// EndOfRIB returns the address family and true if u is an End-of-RIB marker.
+// The marker for IPv4 unicast is an update without withdrawn routes, path
+// attributes or nlri, for other address families it contains only an
+// MP_UNREACH_NLRI attribute without withdrawn routes. Updates in which errors
+// were handled according to an UpdateErrorPolicy are not End-of-RIB markers.
+//
+// https://tools.ietf.org/html/rfc4724#section-2
+func (u *UpdateMessage) EndOfRIB() (AfiSafi, bool) {
+	if len(u.errs) > 0 || u.routes {
+		return AfiSafi{}, false
+	}
+
+	if len(u.PathAttrs) == 0 {
+		return AfiSafi{Afi: IPv4Afi, Safi: UnicastSafi}, true
+	}
+
+	if len(u.PathAttrs) != 1 {
+		return AfiSafi{}, false
+	}
+
+	unreach, ok := u.PathAttrs[0].(*PathAttrMpUnreach)
+	if !ok || len(unreach.Nlri) > 0 || len(unreach.RawNlri) > 0 {
+		return AfiSafi{}, false
+	}
+
+	return AfiSafi{Afi: unreach.Afi, Safi: unreach.Safi}, true
+}
+
+// LinkStateObject is a link state nlri contained in an UpdateMessage along with
+// the contents of the LINK_STATE path attribute that accompanies it.
+// Withdrawn is true if the nlri is contained in an MP_UNREACH_NLRI, the
+// attributes are empty in that case.
+type LinkStateObject struct {
+	Nlri        LinkStateNlri
+	NodeAttrs   []NodeAttr
+	LinkAttrs   []LinkAttr
+	PrefixAttrs []PrefixAttr
+	Withdrawn   bool
+}
+
+// LinkStateObjects returns the link state nlri contained in u. Withdrawn nlri
+// precede advertised nlri so that the objects may be applied in order. The
+// LINK_STATE attribute applies to every advertised nlri of the update, its
+// attributes are not filtered by nlri type, see EventNeighborUpdateWarning.
+// The objects share memory with u.
+func (u *UpdateMessage) LinkStateObjects() []LinkStateObject {
+	var (
+		objects []LinkStateObject
+		reach   []LinkStateNlri
+		attrs   *PathAttrLinkState
+	)
+	for _, a := range u.PathAttrs {
+		switch a := a.(type) {
+		case *PathAttrMpUnreach:
+			for _, n := range a.Nlri {
+				objects = append(objects, LinkStateObject{Nlri: n, Withdrawn: true})
+			}
+		case *PathAttrMpReach:
+			reach = append(reach, a.Nlri...)
+		case *PathAttrLinkState:
+			attrs = a
+		}
+	}
+
+	for _, n := range reach {
+		o := LinkStateObject{Nlri: n}
+		if attrs != nil {
+			o.NodeAttrs = attrs.NodeAttrs
+			o.LinkAttrs = attrs.LinkAttrs
+			o.PrefixAttrs = attrs.PrefixAttrs
+		}
+		objects = append(objects, o)
+	}
+
+	return objects
+}
+
+// Equal returns true if o and p have equal nlri keys, attributes and
+// Withdrawn values. Attributes are compared by their serialized TLVs
+// irrespective of order, nil and empty attribute slices are equal.
+func (o LinkStateObject) Equal(p LinkStateObject) bool {
+	if o.Withdrawn != p.Withdrawn {
+		return false
+	}
+	if (o.Nlri == nil) != (p.Nlri == nil) || (o.Nlri != nil && o.Nlri.Key() != p.Nlri.Key()) {
+		return false
+	}
+	return o.attrsKey() == p.attrsKey()
+}
+
+// attrsKey returns the serialized attributes of o in sorted order, see
+// descriptorsKey.
+func (o LinkStateObject) attrsKey() string {
+	s := make([]tlvSerializer, 0, len(o.NodeAttrs)+len(o.LinkAttrs)+len(o.PrefixAttrs))
+	for _, a := range o.NodeAttrs {
+		s = append(s, a)
+	}
+	for _, a := range o.LinkAttrs {
+		s = append(s, a)
+	}
+	for _, a := range o.PrefixAttrs {
+		s = append(s, a)
+	}
+	return descriptorsKey(s)
+}
+
+// DiffLinkStateObjects compares two snapshots of a topology keyed by
+// LinkStateNlri.Key(). added contains the objects of curr whose key is absent
+// from prev, removed contains the objects of prev whose key is absent from
+// curr, and modified contains the objects of curr whose key is present in prev
+// with attributes that are not Equal. Objects with Withdrawn set or without an
+// nlri are ignored, the last object with a given key in a snapshot takes
+// precedence. added and modified are in the order of curr, removed is in the
+// order of prev.
+func DiffLinkStateObjects(prev, curr []LinkStateObject) (added, removed, modified []LinkStateObject) {
+	index := func(objects []LinkStateObject) ([]string, map[string]LinkStateObject) {
+		var keys []string
+		m := make(map[string]LinkStateObject)
+		for _, o := range objects {
+			if o.Withdrawn || o.Nlri == nil {
+				continue
+			}
+			k := o.Nlri.Key()
+			if _, ok := m[k]; !ok {
+				keys = append(keys, k)
+			}
+			m[k] = o
+		}
+		return keys, m
+	}
+
+	prevKeys, prevObjects := index(prev)
+	currKeys, currObjects := index(curr)
+
+	for _, k := range currKeys {
+		c := currObjects[k]
+		p, ok := prevObjects[k]
+		switch {
+		case !ok:
+			added = append(added, c)
+		case !p.Equal(c):
+			modified = append(modified, c)
+		}
+	}
+	for _, k := range prevKeys {
+		if _, ok := currObjects[k]; !ok {
+			removed = append(removed, prevObjects[k])
+		}
+	}
+
+	return added, removed, modified
+}
+
+// UpdateErrorAction is the action taken in response to a malformed update
+// message.
+//
+// https://tools.ietf.org/html/rfc7606#section-2
+type UpdateErrorAction uint8
+
+// UpdateErrorAction values
+const (
+	// UpdateErrorActionSessionReset sends a notification and resets the session.
+	UpdateErrorActionSessionReset UpdateErrorAction = iota
+	// UpdateErrorActionTreatAsWithdraw withdraws the nlri contained in the
+	// update and discards all other path attributes.
+	UpdateErrorActionTreatAsWithdraw
+	// UpdateErrorActionAttributeDiscard discards the malformed path attribute.
+	UpdateErrorActionAttributeDiscard
+)
+
+func (a UpdateErrorAction) String() string {
+	switch a {
+	case UpdateErrorActionSessionReset:
+		return "session reset"
+	case UpdateErrorActionTreatAsWithdraw:
+		return "treat-as-withdraw"
+	case UpdateErrorActionAttributeDiscard:
+		return "attribute discard"
+	default:
+		return "unknown"
+	}
+}
+
+// UpdateErrorPolicy selects the UpdateErrorAction taken per class of error
+// found in a received update message. The zero value resets the session for
+// all classes. Errors handled without a session reset are reported via
+// EventNeighborUpdateWarning.
+//
+// OptionalAttr applies to malformed optional path attributes other than
+// MP_REACH_NLRI and MP_UNREACH_NLRI, i.e. LINK_STATE.
+//
+// MpReach applies to an MP_REACH_NLRI path attribute with invalid flags or
+// containing nlri that fail to decode while the remaining nlri can still be
+// located. UpdateErrorActionAttributeDiscard is not permitted for MP_REACH_NLRI
+// and results in a session reset. An MP_REACH_NLRI that cannot be parsed at
+// all always results in a session reset.
+//
+// DuplicateAttr applies to a path attribute other than MP_REACH_NLRI and
+// MP_UNREACH_NLRI appearing more than once, UpdateErrorActionAttributeDiscard
+// discards all but the first occurrence. A repeated MP_REACH_NLRI or
+// MP_UNREACH_NLRI always results in a session reset.
+//
+// https://tools.ietf.org/html/rfc7606#section-3
+type UpdateErrorPolicy struct {
+	OptionalAttr  UpdateErrorAction
+	MpReach       UpdateErrorAction
+	DuplicateAttr UpdateErrorAction
+}
+
+// Validate checks u for problems that would cause a neighbor to reject it,
+// without sending it, e.g. before sending an update constructed by hand. All
+// problems found are returned, Validate returns nil if there are none.
+//
+// The structure of u is checked: path attributes must not be repeated, nlri in
+// a PathAttrMpReach require a PathAttrOrigin and PathAttrAsPath, and a
+// PathAttrLinkState requires a PathAttrMpReach containing nlri of a single
+// protocol and of the types its node, link and prefix attributes describe.
+// u is then serialized, any error doing so is included. The flags of path
+// attributes are not checked, they are set according to each attribute's
+// category when serialized.
+func (u *UpdateMessage) Validate() []error {
+	var errs []error
+	var reach *PathAttrMpReach
+	var ls *PathAttrLinkState
+	seen := make(map[PathAttrType]bool)
+	for _, a := range u.PathAttrs {
+		if a == nil {
+			return append(errs, errors.New("nil path attribute"))
+		}
+		if seen[a.Type()] {
+			errs = append(errs, fmt.Errorf("duplicate path attribute type %d", a.Type()))
+		}
+		seen[a.Type()] = true
+		switch a := a.(type) {
+		case *PathAttrMpReach:
+			reach = a
+		case *PathAttrLinkState:
+			ls = a
+		}
+	}
+
+	if reach != nil && (len(reach.Nlri) > 0 || len(reach.RawNlri) > 0) {
+		if !seen[PathAttrOriginType] {
+			errs = append(errs, errors.New("mp reach nlri without an origin path attribute"))
+		}
+		if !seen[PathAttrAsPathType] {
+			errs = append(errs, errors.New("mp reach nlri without an as path path attribute"))
+		}
+	}
+
+	if ls != nil {
+		if reach == nil || len(reach.Nlri) == 0 {
+			errs = append(errs, errors.New("link state path attribute without mp reach nlri"))
+		} else {
+			// the link state attribute is decoded according to the protocol
+			// of the first nlri
+			protocol := reach.Nlri[0].Protocol()
+			for _, n := range reach.Nlri[1:] {
+				if n.Protocol() != protocol {
+					errs = append(errs, fmt.Errorf("mp reach nlri protocol %s differs from %s with a link state path attribute", n.Protocol(), protocol))
+					break
+				}
+			}
+		}
+		if err := validateUpdateLinkStateAttrs(u); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// serialize a copy as serialization sets the flags of path attributes
+	if _, err := u.Clone().serialize(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
 }
 
 // MessageType returns the appropriate MessageType for UpdateMessage.
@@ -25,33 +342,231 @@ func (u *UpdateMessage) MessageType() MessageType {
 }
 
 func (u *UpdateMessage) serialize() ([]byte, error) {
-	buff := make([]byte, 4)
+	return u.serializeWithMaxLen(maxMessageLen)
+}
 
-	// withdrawn routes len
-	binary.BigEndian.PutUint16(buff[0:2], 0)
+// serializeWithMaxLen serializes the update message, returning an error if
+// the resulting message including the header would exceed maxLen bytes.
+func (u *UpdateMessage) serializeWithMaxLen(maxLen int) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	err := u.serializeInto(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if buf.Len() > maxLen {
+		return nil, fmt.Errorf("update message length %d exceeds maximum of %d, nlri must be split across multiple updates", buf.Len(), maxLen)
+	}
+
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// serializeInto writes the update message, including the header, to buf.
+func (u *UpdateMessage) serializeInto(buf *bytes.Buffer) error {
+	start := buf.Len()
+
+	// header, withdrawn routes len (always 0) and path attribute len
+	var h [23]byte
+	for i := 0; i < 16; i++ {
+		h[i] = 0xFF
+	}
+	h[18] = uint8(UpdateMessageType)
+	buf.Write(h[:])
+
+	err := validateUpdateLinkStateProtocol(u)
+	if err != nil {
+		return err
+	}
 
-	params := make([]byte, 0, 512)
 	for _, p := range u.PathAttrs {
-		b, err := p.serialize()
+		err := serializeInto(buf, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	b := buf.Bytes()[start:]
+	binary.BigEndian.PutUint16(b[16:18], uint16(len(b)))
+	binary.BigEndian.PutUint16(b[21:23], uint16(len(b)-len(h)))
+
+	return nil
+}
+
+// LinkStateRoute is a LinkStateNlri and its associated LINK_STATE attribute.
+// LinkState may be nil.
+type LinkStateRoute struct {
+	Nlri      LinkStateNlri
+	LinkState *PathAttrLinkState
+}
+
+// PackUpdateMessages packs routes into UpdateMessages that each fit within
+// the maximum message length. Routes with identical LINK_STATE attributes
+// share UpdateMessages, which are filled greedily in the order the routes
+// are provided. attrs, e.g. PathAttrOrigin, are included in every
+// UpdateMessage.
+func PackUpdateMessages(routes []LinkStateRoute, attrs ...PathAttr) ([]*UpdateMessage, error) {
+	return packUpdateMessages(routes, maxMessageLen, attrs...)
+}
+
+// NewNodeUpdate returns an UpdateMessage advertising a single Node NLRI
+// identified by protocol, asn and routerID, with attrs carried in a LINK_STATE
+// path attribute. routerID must be an IGP router ID node descriptor matching
+// protocol, or a NodeDescriptorBgpRouterID for LinkStateNlriBgpProtocolID. The
+// UpdateMessage also carries an IGP ORIGIN and an empty AS_PATH. MP_REACH_NLRI
+// precedes LINK_STATE as the latter is decoded according to the protocol of
+// the former.
+func NewNodeUpdate(protocol LinkStateNlriProtocolID, asn uint32, routerID NodeDescriptor, attrs ...NodeAttr) (*UpdateMessage, error) {
+	var valid bool
+	switch routerID.(type) {
+	case *NodeDescriptorIgpRouterIDOspfNonPseudo, *NodeDescriptorIgpRouterIDOspfPseudo:
+		valid = nlriProtocolIsOspf(protocol) || protocol == LinkStateNlriDirectProtocolID || protocol == LinkStateNlriStaticProtocolID
+	case *NodeDescriptorIgpRouterIDIsIsNonPseudo, *NodeDescriptorIgpRouterIDIsIsPseudo:
+		valid = nlriProtocolIsIsIs(protocol) || protocol == LinkStateNlriDirectProtocolID || protocol == LinkStateNlriStaticProtocolID
+	case *NodeDescriptorBgpRouterID:
+		valid = protocol == LinkStateNlriBgpProtocolID
+	}
+	if !valid {
+		return nil, fmt.Errorf("router ID node descriptor %T is invalid for protocol %s", routerID, protocol)
+	}
+
+	pathAttrs := []PathAttr{
+		&PathAttrOrigin{Origin: OriginCodeIGP},
+		&PathAttrAsPath{},
+		&PathAttrMpReach{
+			Afi:  BgpLsAfi,
+			Safi: BgpLsSafi,
+			Nlri: []LinkStateNlri{
+				&LinkStateNlriNode{
+					ProtocolID: protocol,
+					LocalNodeDescriptors: []NodeDescriptor{
+						&NodeDescriptorASN{ASN: asn},
+						routerID,
+					},
+				},
+			},
+		},
+	}
+	if len(attrs) > 0 {
+		pathAttrs = append(pathAttrs, &PathAttrLinkState{NodeAttrs: attrs})
+	}
+
+	u := &UpdateMessage{PathAttrs: pathAttrs}
+	if _, err := u.serialize(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func packUpdateMessages(routes []LinkStateRoute, maxLen int, attrs ...PathAttr) ([]*UpdateMessage, error) {
+	// header, withdrawn routes len, path attribute len
+	baseLen := 19 + 4
+	for _, a := range attrs {
+		b, err := a.serialize()
 		if err != nil {
 			return nil, err
 		}
+		baseLen += len(b)
+	}
 
-		params = append(params, b...)
+	type group struct {
+		ls      *PathAttrLinkState
+		lsLen   int
+		nlri    []LinkStateNlri
+		nlriLen []int
 	}
 
-	// path attribute length
-	binary.BigEndian.PutUint16(buff[2:4], uint16(len(params)))
+	groups := make([]*group, 0)
+	groupsByLS := make(map[string]*group)
+	for _, r := range routes {
+		if r.Nlri == nil {
+			return nil, errors.New("route missing nlri")
+		}
+
+		var lsBytes []byte
+		if r.LinkState != nil {
+			var err error
+			lsBytes, err = r.LinkState.serialize()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		n, err := r.Nlri.serialize()
+		if err != nil {
+			return nil, err
+		}
 
-	// path attributes
-	buff = append(buff, params...)
+		g, ok := groupsByLS[string(lsBytes)]
+		if !ok {
+			g = &group{
+				ls:    r.LinkState,
+				lsLen: len(lsBytes),
+			}
+			groupsByLS[string(lsBytes)] = g
+			groups = append(groups, g)
+		}
+		g.nlri = append(g.nlri, r.Nlri)
+		g.nlriLen = append(g.nlriLen, len(n))
+	}
+
+	// mpReachLen returns the serialized length of a PathAttrMpReach carrying
+	// nlriLen bytes of nlri
+	mpReachLen := func(nlriLen int) int {
+		// afi, safi, next hop len, reserved
+		attrLen := 5 + nlriLen
+		if attrLen > math.MaxUint8 {
+			return attrLen + 4
+		}
+		return attrLen + 3
+	}
+
+	updates := make([]*UpdateMessage, 0)
+	for _, g := range groups {
+		var nlri []LinkStateNlri
+		nlriLen := 0
+
+		flush := func() {
+			pathAttrs := make([]PathAttr, 0, len(attrs)+2)
+			pathAttrs = append(pathAttrs, attrs...)
+			pathAttrs = append(pathAttrs, &PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: nlri,
+			})
+			if g.ls != nil {
+				pathAttrs = append(pathAttrs, g.ls)
+			}
+			updates = append(updates, &UpdateMessage{PathAttrs: pathAttrs})
+			nlri = nil
+			nlriLen = 0
+		}
 
-	buff = prependHeader(buff, UpdateMessageType)
+		for i, n := range g.nlri {
+			if len(nlri) > 0 && baseLen+g.lsLen+mpReachLen(nlriLen+g.nlriLen[i]) > maxLen {
+				flush()
+			}
+			if baseLen+g.lsLen+mpReachLen(nlriLen+g.nlriLen[i]) > maxLen {
+				return nil, fmt.Errorf("route with nlri key %s exceeds maximum message length of %d", n.Key(), maxLen)
+			}
+			nlri = append(nlri, n)
+			nlriLen += g.nlriLen[i]
+		}
+		if len(nlri) > 0 {
+			flush()
+		}
+	}
 
-	return buff, nil
+	return updates, nil
 }
 
 func (u *UpdateMessage) deserialize(b []byte) error {
+	return u.deserializeWithOptions(b, decodeOptions{})
+}
+
+func (u *UpdateMessage) deserializeWithOptions(b []byte, opts decodeOptions) error {
 	tooShortErr := &errWithNotification{
 		error:   errors.New("update message is too short"),
 		code:    NotifErrCodeUpdateMessage,
@@ -74,163 +589,595 @@ func (u *UpdateMessage) deserialize(b []byte) error {
 	}
 	b = b[2:]
 
-	attrs, err := deserializePathAttrs(b[:pathAttrLen])
-	if err != nil {
-		return err
+	// an update without path attributes is an End-of-RIB marker or withdraws
+	// IPv4 unicast routes
+	u.PathAttrs = []PathAttr{}
+	if pathAttrLen > 0 {
+		attrs, errs, err := deserializePathAttrs(b[:pathAttrLen], opts)
+		if err != nil {
+			return err
+		}
+		u.PathAttrs = attrs
+		u.errs = errs
+	}
+	u.routes = withdrawnRoutesLen > 0 || len(b) > int(pathAttrLen)
+
+	if opts.requireWellKnown {
+		return validateWellKnownAttrs(u.PathAttrs, b[:pathAttrLen], len(b) > int(pathAttrLen))
+	}
+
+	return nil
+}
+
+// validateWellKnownAttrs returns an error if an update advertising nlri is
+// missing a well-known mandatory path attribute. attrs are the decoded path
+// attributes, raw their on-wire encoding, and ipv4Nlri is true if the update
+// advertises IPv4 unicast nlri outside of MP_REACH_NLRI.
+//
+// NEXT_HOP is not decoded, its presence is determined from raw. It is only
+// mandatory alongside IPv4 unicast nlri, the next hop of MP_REACH_NLRI nlri is
+// carried within the attribute.
+//
+// https://tools.ietf.org/html/rfc4271#section-6.3
+// https://tools.ietf.org/html/rfc4760#section-3
+func validateWellKnownAttrs(attrs []PathAttr, raw []byte, ipv4Nlri bool) error {
+	/*
+		If any of the well-known mandatory attributes are not present, then
+		the Error Subcode MUST be set to Missing Well-known Attribute.  The
+		Data field MUST contain the Attribute Type Code of the missing,
+		well-known attribute.
+	*/
+	reachable := ipv4Nlri
+	var origin, asPath bool
+	for _, a := range attrs {
+		switch a := a.(type) {
+		case *PathAttrOrigin:
+			origin = true
+		case *PathAttrAsPath:
+			asPath = true
+		case *PathAttrMpReach:
+			if len(a.Nlri) > 0 || len(a.RawNlri) > 0 {
+				reachable = true
+			}
+		}
+	}
+	if !reachable {
+		return nil
+	}
+
+	missing := func(t uint8, name string) error {
+		return &errWithNotification{
+			error:   fmt.Errorf("update message is missing well-known attribute %s", name),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMissingWellKnownAttr,
+			data:    []byte{t},
+		}
+	}
+	if !origin {
+		return missing(uint8(PathAttrOriginType), "ORIGIN")
+	}
+	if !asPath {
+		return missing(uint8(PathAttrAsPathType), "AS_PATH")
+	}
+	if ipv4Nlri && !hasPathAttr(raw, pathAttrNextHopType) {
+		return missing(pathAttrNextHopType, "NEXT_HOP")
 	}
-	u.PathAttrs = attrs
 
 	return nil
 }
 
-// extractNlriProtocolFromAttrs traverses the provided attrs in search of
-// PathAttrMp(Un)Reach. If found, searches the nlri for the first protocol ID.
-// If no nlri protocol ID is found an error is returned.
-func extractNlriProtocolFromAttrs(attrs []PathAttr) (LinkStateNlriProtocolID, error) {
+// pathAttrNextHopType is the type code of the NEXT_HOP path attribute, which
+// is not decoded.
+const pathAttrNextHopType = 3
+
+// hasPathAttr returns true if the path attributes encoded in b, which have
+// been validated by deserializePathAttrs, include one of type t.
+func hasPathAttr(b []byte, t uint8) bool {
+	for len(b) >= 3 {
+		attrLen, hdrLen := int(b[2]), 3
+		if pathAttrFlagsFromByte(b[0]).ExtendedLength {
+			if len(b) < 4 {
+				return false
+			}
+			attrLen, hdrLen = int(binary.BigEndian.Uint16(b[2:])), 4
+		}
+		if b[1] == t {
+			return true
+		}
+		if len(b) < hdrLen+attrLen {
+			return false
+		}
+		b = b[hdrLen+attrLen:]
+	}
+	return false
+}
+
+// treatAsWithdraw converts the nlri of any PathAttrMpReach in attrs to withdrawn
+// nlri and discards all other path attributes.
+//
+// https://tools.ietf.org/html/rfc7606#section-2
+func treatAsWithdraw(attrs []PathAttr) []PathAttr {
+	var reach *PathAttrMpReach
+	var unreach *PathAttrMpUnreach
+	for _, a := range attrs {
+		switch a := a.(type) {
+		case *PathAttrMpReach:
+			reach = a
+		case *PathAttrMpUnreach:
+			unreach = a
+		}
+	}
+
+	if reach == nil || (len(reach.Nlri) == 0 && len(reach.RawNlri) == 0) {
+		if unreach == nil {
+			return []PathAttr{}
+		}
+		return []PathAttr{unreach}
+	}
+
+	// nlri can only be withdrawn within their own address family
+	if unreach == nil || unreach.Afi != reach.Afi || unreach.Safi != reach.Safi {
+		withdrawn := &PathAttrMpUnreach{
+			f:    PathAttrFlags{Optional: true},
+			Afi:  reach.Afi,
+			Safi: reach.Safi,
+		}
+		withdrawn.Nlri = append(withdrawn.Nlri, reach.Nlri...)
+		withdrawn.RawNlri = append(withdrawn.RawNlri, reach.RawNlri...)
+		if unreach == nil {
+			return []PathAttr{withdrawn}
+		}
+		return []PathAttr{unreach, withdrawn}
+	}
+
+	unreach.Nlri = append(unreach.Nlri, reach.Nlri...)
+	unreach.RawNlri = append(unreach.RawNlri, reach.RawNlri...)
+	return []PathAttr{unreach}
+}
+
+// extractNlriFromAttrs traverses the provided attrs in search of
+// PathAttrMp(Un)Reach. If found, returns the first nlri.
+// If no nlri is found an error is returned.
+func extractNlriFromAttrs(attrs []PathAttr) (LinkStateNlri, error) {
 	for _, a := range attrs {
 		switch a := a.(type) {
 		case *PathAttrMpReach:
 			for _, b := range a.Nlri {
-				return b.Protocol(), nil
+				return b, nil
 			}
 		case *PathAttrMpUnreach:
 			for _, b := range a.Nlri {
-				return b.Protocol(), nil
+				return b, nil
 			}
 		}
 	}
 
-	return 0, &errWithNotification{
+	return nil, &errWithNotification{
 		error:   errors.New("no NLRI protocol found"),
 		code:    NotifErrCodeUpdateMessage,
 		subcode: NotifErrSubcodeMalformedAttr,
 	}
 }
 
-func deserializePathAttrs(b []byte) ([]PathAttr, error) {
-	attrs := make([]PathAttr, 0)
-
-	tooShortErr := &errWithNotification{
-		error:   errors.New("path attribute too short"),
-		code:    NotifErrCodeUpdateMessage,
-		subcode: 0,
+// validateUpdateLinkStateAttrs verifies that the node, link and prefix
+// attributes of any PathAttrLinkState correspond to an nlri type present in
+// PathAttrMpReach, that SRv6 End.X SIDs carry an End.X endpoint behavior, and
+// that only prefix nlri of OSPF carry an OSPF route type.
+func validateUpdateLinkStateAttrs(u *UpdateMessage) error {
+	var ls *PathAttrLinkState
+	nlriTypes := make(map[LinkStateNlriType]bool)
+	var nlri []LinkStateNlri
+	for _, a := range u.PathAttrs {
+		switch a := a.(type) {
+		case *PathAttrLinkState:
+			ls = a
+		case *PathAttrMpReach:
+			for _, n := range a.Nlri {
+				nlriTypes[n.Type()] = true
+			}
+			nlri = append(nlri, a.Nlri...)
+		case *PathAttrMpUnreach:
+			nlri = append(nlri, a.Nlri...)
+		}
 	}
 
-	for {
-		if len(b) < 2 {
-			return nil, tooShortErr
+	for _, n := range nlri {
+		var prefix *LinkStateNlriPrefix
+		switch n := n.(type) {
+		case *LinkStateNlriIPv4Prefix:
+			prefix = &n.LinkStateNlriPrefix
+		case *LinkStateNlriIPv6Prefix:
+			prefix = &n.LinkStateNlriPrefix
+		default:
+			continue
 		}
-
-		flags := pathAttrFlagsFromByte(b[0])
-		attrType := b[1]
-
-		/*
-			The fourth high-order bit (bit 3) of the Attribute Flags octet
-			is the Extended Length bit.  It defines whether the Attribute
-			Length is one octet (if set to 0) or two octets (if set to 1).
-		*/
-		var attrLen int
-		if flags.ExtendedLength {
-			attrLen = int(binary.BigEndian.Uint16(b[2:4]))
-			b = b[4:]
-		} else {
-			attrLen = int(b[2])
-			b = b[3:]
+		if nlriProtocolIsOspf(prefix.ProtocolID) {
+			continue
 		}
-		if len(b) < attrLen {
-			return nil, tooShortErr
+		for _, d := range prefix.PrefixDescriptors {
+			if _, ok := d.(*PrefixDescriptorOspfRouteType); ok {
+				return &errWithNotification{
+					error:   fmt.Errorf("ospf route type prefix descriptor in nlri of non-ospf protocol %s", prefix.ProtocolID),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
+			}
 		}
+	}
 
-		attrToDecode := b[:attrLen]
+	if ls == nil {
+		return nil
+	}
 
-		switch attrType {
-		case uint8(PathAttrOriginType):
-			err := validatePathAttrFlags(flags, pathAttrCatWellKnownMandatory)
-			if err != nil {
-				return nil, err
-			}
+	errMismatch := func(attrs string) error {
+		return &errWithNotification{
+			error:   fmt.Errorf("link state path attribute contains %s attributes without a corresponding nlri", attrs),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	nodeAttrs := ls.NodeAttrs
+	if nlriTypes[LinkStateNlriLinkType] {
+		// the local router ID tlvs are also link attributes
+		//
+		// https://tools.ietf.org/html/rfc7752#section-3.3.2
+		nodeAttrs = nil
+		for _, a := range ls.NodeAttrs {
+			switch a.Code() {
+			case NodeAttrCodeLocalIPv4RouterID, NodeAttrCodeLocalIPv6RouterID:
+				continue
+			}
+			nodeAttrs = append(nodeAttrs, a)
+		}
+	}
+	if len(nodeAttrs) > 0 && !nlriTypes[LinkStateNlriNodeType] && !nlriTypes[LinkStateNlriSRv6SIDType] {
+		return errMismatch("node")
+	}
+	linkAttrs := ls.LinkAttrs
+	if nlriTypes[LinkStateNlriSRv6SIDType] {
+		// the srv6 bgp peer node sid tlv is an attribute of srv6 sid nlri
+		//
+		// https://tools.ietf.org/html/rfc9514#section-7.2
+		linkAttrs = nil
+		for _, a := range ls.LinkAttrs {
+			if a.Code() == LinkAttrCodeSRv6PeerNodeSID {
+				continue
+			}
+			linkAttrs = append(linkAttrs, a)
+		}
+	}
+	if len(linkAttrs) > 0 && !nlriTypes[LinkStateNlriLinkType] {
+		return errMismatch("link")
+	}
+	if len(ls.PrefixAttrs) > 0 && !nlriTypes[LinkStateNlriIPv4PrefixType] && !nlriTypes[LinkStateNlriIPv6PrefixType] {
+		return errMismatch("prefix")
+	}
+
+	for _, a := range ls.LinkAttrs {
+		if a, ok := a.(*LinkAttrSRv6EndXSID); ok {
+			// code points assigned after rfc8986 may be End.X flavors
+			if a.EndpointBehavior == 0 || (a.EndpointBehavior.Known() && !a.EndpointBehavior.isEndX()) {
+				return &errWithNotification{
+					error:   fmt.Errorf("srv6 end.x sid with endpoint behavior %s", a.EndpointBehavior),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateUpdateLinkStateProtocol verifies that the protocol specific flags of
+// the attributes in any PathAttrLinkState correspond to the protocol of the
+// nlri it is decoded according to, i.e. the first nlri of the preceding
+// PathAttrMpReach or PathAttrMpUnreach, see extractNlriFromAttrs.
+func validateUpdateLinkStateProtocol(u *UpdateMessage) error {
+	for i, a := range u.PathAttrs {
+		ls, ok := a.(*PathAttrLinkState)
+		if !ok {
+			continue
+		}
+		nlri, err := extractNlriFromAttrs(u.PathAttrs[:i])
+		if err != nil {
+			return errors.New("link state path attribute is not preceded by nlri")
+		}
+		err = validateLinkStateAttrsProtocol(ls, nlri.Protocol())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateLinkStateAttrsProtocol verifies that the protocol specific flags of
+// the attributes in ls correspond to protocol.
+func validateLinkStateAttrsProtocol(ls *PathAttrLinkState, protocol LinkStateNlriProtocolID) error {
+	err := validateLinkAttrsProtocol(ls.LinkAttrs, protocol)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range ls.PrefixAttrs {
+		var valid bool
+		switch a := a.(type) {
+		case *PrefixAttrPrefixSID:
+			valid = a.Flags == nil ||
+				(a.Flags.Type() == PrefixAttrPrefixSIDFlagsTypeIsIs && nlriProtocolIsIsIs(protocol)) ||
+				(a.Flags.Type() == PrefixAttrPrefixSIDFlagsTypeOspf && nlriProtocolIsOspf(protocol))
+		case *PrefixAttrRange:
+			valid = a.Flags == nil ||
+				(a.Flags.Type() == PrefixAttrRangeFlagsTypeIsIs && nlriProtocolIsIsIs(protocol)) ||
+				(a.Flags.Type() == PrefixAttrRangeFlagsTypeOspf && nlriProtocolIsOspf(protocol))
+		case *PrefixAttrFlagsIsIs:
+			valid = nlriProtocolIsIsIs(protocol)
+		case *PrefixAttrFlagsOSPFv2:
+			valid = protocol == LinkStateNlriOSPFv2ProtocolID
+		case *PrefixAttrFlagsOSPFv3:
+			valid = protocol == LinkStateNlriOSPFv3ProtocolID
+		default:
+			valid = true
+		}
+		if !valid {
+			return fmt.Errorf("prefix attribute %T is inconsistent with nlri protocol %s", a, protocol)
+		}
+	}
+
+	return nil
+}
+
+// validateLinkAttrsProtocol verifies that the adjacency SID flags of attrs,
+// including those of layer 2 bundle members, correspond to protocol.
+func validateLinkAttrsProtocol(attrs []LinkAttr, protocol LinkStateNlriProtocolID) error {
+	validFlags := func(f LinkAttrAdjSIDFlags) bool {
+		return f == nil ||
+			(f.Type() == LinkAttrAdjSIDFlagsTypeIsIs && nlriProtocolIsIsIs(protocol)) ||
+			(f.Type() == LinkAttrAdjSIDFlagsTypeOspf && nlriProtocolIsOspf(protocol))
+	}
+
+	for _, a := range attrs {
+		valid := true
+		switch a := a.(type) {
+		case *LinkAttrAdjSID:
+			valid = validFlags(a.Flags)
+		case *LinkAttrLanAdjSID:
+			valid = validFlags(a.Flags)
+		case *LinkAttrL2BundleMember:
+			err := validateLinkAttrsProtocol(a.LinkAttrs, protocol)
+			if err != nil {
+				return err
+			}
+		}
+		if !valid {
+			return fmt.Errorf("link attribute %T flags are inconsistent with nlri protocol %s", a, protocol)
+		}
+	}
+
+	return nil
+}
+
+// deserializePathAttrs decodes the path attributes in b. Errors handled
+// according to opts.policy without a session reset are returned in errs.
+func deserializePathAttrs(b []byte, opts decodeOptions) (attrs []PathAttr, errs []error, err error) {
+	attrs = make([]PathAttr, 0)
+	var withdraw bool
+	var seen [256]bool
+
+	tooShortErr := &errWithNotification{
+		error:   errors.New("path attribute too short"),
+		code:    NotifErrCodeUpdateMessage,
+		subcode: 0,
+	}
+
+	for {
+		if len(b) < 2 {
+			return nil, nil, tooShortErr
+		}
+
+		start, decoded := b, len(attrs)
+		flags := pathAttrFlagsFromByte(b[0])
+		attrType := b[1]
+
+		/*
+			The fourth high-order bit (bit 3) of the Attribute Flags octet
+			is the Extended Length bit.  It defines whether the Attribute
+			Length is one octet (if set to 0) or two octets (if set to 1).
+		*/
+		var attrLen int
+		if flags.ExtendedLength {
+			if len(b) < 4 {
+				return nil, nil, tooShortErr
+			}
+			attrLen = int(binary.BigEndian.Uint16(b[2:4]))
+			b = b[4:]
+		} else {
+			if len(b) < 3 {
+				return nil, nil, tooShortErr
+			}
+			attrLen = int(b[2])
+			b = b[3:]
+		}
+		if len(b) < attrLen {
+			return nil, nil, tooShortErr
+		}
+
+		attrToDecode := b[:attrLen]
+
+		if seen[attrType] {
+			/*
+				https://tools.ietf.org/html/rfc7606#section-3
+				g. If the MP_REACH_NLRI attribute or the MP_UNREACH_NLRI
+				   [RFC4760] attribute appears more than once in the UPDATE
+				   message, then a NOTIFICATION message MUST be sent with the
+				   Error Subcode "Malformed Attribute List".  If any other
+				   attribute (whether recognized or unrecognized) appears more
+				   than once in an UPDATE message, then all the occurrences of
+				   the attribute other than the first one SHALL be discarded
+				   and the UPDATE message will continue to be processed.
+			*/
+			err := &errWithNotification{
+				error:   fmt.Errorf("path attribute %d appears more than once", attrType),
+				code:    NotifErrCodeUpdateMessage,
+				subcode: NotifErrSubcodeMalformedAttr,
+			}
+			if attrType == uint8(PathAttrMpReachType) || attrType == uint8(PathAttrMpUnreachType) {
+				return nil, nil, err
+			}
+			switch opts.policy.DuplicateAttr {
+			case UpdateErrorActionAttributeDiscard:
+				errs = append(errs, fmt.Errorf("discarded duplicate path attribute: %v", err))
+			case UpdateErrorActionTreatAsWithdraw:
+				withdraw = true
+				errs = append(errs, fmt.Errorf("treating update as withdraw due to duplicate path attribute: %v", err))
+			default:
+				return nil, nil, err
+			}
+			b = b[attrLen:]
+			if len(b) == 0 {
+				break
+			}
+			continue
+		}
+		seen[attrType] = true
+
+		switch attrType {
+		case uint8(PathAttrOriginType):
+			err := validatePathAttrFlags(flags, pathAttrCatWellKnownMandatory)
+			if err != nil {
+				return nil, nil, err
+			}
 
 			attr := &PathAttrOrigin{}
 			err = attr.deserialize(flags, attrToDecode)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			attrs = append(attrs, attr)
 		case uint8(PathAttrAsPathType):
 			err := validatePathAttrFlags(flags, pathAttrCatWellKnownMandatory)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			attr := &PathAttrAsPath{}
 			err = attr.deserialize(flags, attrToDecode)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			attrs = append(attrs, attr)
 		case uint8(PathAttrLocalPrefType):
 			err := validatePathAttrFlags(flags, pathAttrCatWellKnownDiscretionary)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			attr := &PathAttrLocalPref{}
 			err = attr.deserialize(flags, attrToDecode)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			attrs = append(attrs, attr)
 		case uint8(PathAttrMpReachType):
+			recoverable := opts.policy.MpReach == UpdateErrorActionTreatAsWithdraw
 			err := validatePathAttrFlags(flags, pathAttrCatOptionalNonTransitive)
 			if err != nil {
-				return nil, err
+				if !recoverable {
+					return nil, nil, err
+				}
+				withdraw = true
+				errs = append(errs, fmt.Errorf("treating update as withdraw due to malformed mp reach path attribute: %v", err))
 			}
 
 			attr := &PathAttrMpReach{}
-			err = attr.deserialize(flags, attrToDecode)
+			malformed, err := attr.deserializeRecoverable(flags, attrToDecode, opts)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+			if len(malformed) > 0 {
+				if !recoverable {
+					return nil, nil, malformed[0]
+				}
+				withdraw = true
+				for _, m := range malformed {
+					errs = append(errs, fmt.Errorf("treating update as withdraw due to malformed mp reach nlri: %v", m))
+				}
 			}
 			attrs = append(attrs, attr)
 		case uint8(PathAttrMpUnreachType):
 			err := validatePathAttrFlags(flags, pathAttrCatOptionalNonTransitive)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			attr := &PathAttrMpUnreach{}
-			err = attr.deserialize(flags, attrToDecode)
+			err = attr.deserializeWithOptions(flags, attrToDecode, opts)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			attrs = append(attrs, attr)
 		case uint8(PathAttrLinkStateType):
-			err := validatePathAttrFlags(flags, pathAttrCatOptionalNonTransitive)
-			if err != nil {
-				return nil, err
-			}
-
-			nlriProtocol, err := extractNlriProtocolFromAttrs(attrs)
-			if err != nil {
-				return nil, err
+			if withdraw {
+				// discarded by treat-as-withdraw
+				break
 			}
 
-			attr := &PathAttrLinkState{}
-			err = attr.deserialize(flags, attrToDecode, nlriProtocol)
+			attr, err := deserializeLinkStateAttr(flags, attrToDecode, attrs, opts)
 			if err != nil {
-				return nil, err
+				switch opts.policy.OptionalAttr {
+				case UpdateErrorActionAttributeDiscard:
+					errs = append(errs, fmt.Errorf("discarded malformed link state path attribute: %v", err))
+				case UpdateErrorActionTreatAsWithdraw:
+					withdraw = true
+					errs = append(errs, fmt.Errorf("treating update as withdraw due to malformed link state path attribute: %v", err))
+				default:
+					return nil, nil, err
+				}
+				break
 			}
 			attrs = append(attrs, attr)
 		}
 
 		b = b[attrLen:]
+		if opts.retainRaw && len(attrs) > decoded {
+			raw := start[:len(start)-len(b)]
+			setRawBytes(attrs[len(attrs)-1], append([]byte{}, raw...))
+		}
 
 		if len(b) == 0 {
 			break
 		}
 	}
 
-	return attrs, nil
+	if withdraw {
+		attrs = treatAsWithdraw(attrs)
+	}
+
+	return attrs, errs, nil
+}
+
+// deserializeLinkStateAttr decodes a LINK_STATE path attribute using the
+// protocol and type of the nlri found in the preceding attrs.
+func deserializeLinkStateAttr(flags PathAttrFlags, b []byte, attrs []PathAttr, opts decodeOptions) (*PathAttrLinkState, error) {
+	err := validatePathAttrFlags(flags, pathAttrCatOptionalNonTransitive)
+	if err != nil {
+		return nil, err
+	}
+
+	nlri, err := extractNlriFromAttrs(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	attr := &PathAttrLinkState{}
+	err = attr.deserialize(flags, b, nlri.Protocol(), nlri.Type(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return attr, nil
 }
 
 type pathAttrCategory uint8
@@ -339,6 +1286,107 @@ type PathAttr interface {
 	serialize() ([]byte, error)
 	Flags() PathAttrFlags
 	Type() PathAttrType
+	RawBytes() []byte
+}
+
+// setRawBytes retains raw as the on-wire encoding of a.
+func setRawBytes(a PathAttr, raw []byte) {
+	switch a := a.(type) {
+	case *PathAttrOrigin:
+		a.raw = raw
+	case *PathAttrAsPath:
+		a.raw = raw
+	case *PathAttrLocalPref:
+		a.raw = raw
+	case *PathAttrMpReach:
+		a.raw = raw
+	case *PathAttrMpUnreach:
+		a.raw = raw
+	case *PathAttrLinkState:
+		a.raw = raw
+	}
+}
+
+// serializer is implemented by every serializable message component.
+type serializer interface {
+	serialize() ([]byte, error)
+}
+
+// bufferSerializer is implemented by message components on the serialize hot
+// path, they write directly into buf instead of allocating intermediate
+// slices.
+type bufferSerializer interface {
+	serializeInto(buf *bytes.Buffer) error
+}
+
+// serializeInto writes s to buf, avoiding an intermediate allocation if s
+// implements bufferSerializer.
+func serializeInto(buf *bytes.Buffer, s serializer) error {
+	if bs, ok := s.(bufferSerializer); ok {
+		return bs.serializeInto(buf)
+	}
+
+	b, err := s.serialize()
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+
+	return nil
+}
+
+// serializeWithBuffer serializes s using a pooled buffer and returns a copy of
+// the result.
+func serializeWithBuffer(s bufferSerializer) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	err := s.serializeInto(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// beginTLV writes a bgp-ls TLV type and a placeholder length to buf. The
+// returned offset is passed to endTLV once the value has been written.
+func beginTLV(buf *bytes.Buffer, t uint16) int {
+	var h [4]byte
+	binary.BigEndian.PutUint16(h[:2], t)
+	buf.Write(h[:])
+	return buf.Len() - 2
+}
+
+// endTLV sets the length of the TLV started by beginTLV.
+func endTLV(buf *bytes.Buffer, off int) {
+	binary.BigEndian.PutUint16(buf.Bytes()[off:], uint16(buf.Len()-off-2))
+}
+
+// serializePathAttrInto writes a path attribute of type t to buf, its value
+// is written by fn. The extended length flag is set on f only if required.
+func serializePathAttrInto(buf *bytes.Buffer, f *PathAttrFlags, t PathAttrType, fn func() error) error {
+	start := buf.Len()
+	buf.Write([]byte{0, byte(t), 0, 0})
+
+	err := fn()
+	if err != nil {
+		return err
+	}
+
+	b := buf.Bytes()[start:]
+	l := len(b) - 4
+	if l > math.MaxUint8 {
+		f.ExtendedLength = true
+		binary.BigEndian.PutUint16(b[2:4], uint16(l))
+	} else {
+		b[2] = uint8(l)
+		copy(b[3:], b[4:])
+		buf.Truncate(buf.Len() - 1)
+	}
+	b[0] = f.serialize()
+
+	return nil
 }
 
 // PathAttrType describes the type of a bgp path attribute.
@@ -359,6 +1407,7 @@ const (
 // https://tools.ietf.org/html/rfc7752#section-3.3
 type PathAttrLinkState struct {
 	f           PathAttrFlags
+	raw         []byte
 	NodeAttrs   []NodeAttr
 	LinkAttrs   []LinkAttr
 	PrefixAttrs []PrefixAttr
@@ -374,7 +1423,16 @@ func (p *PathAttrLinkState) Type() PathAttrType {
 	return PathAttrLinkStateType
 }
 
-func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) ([]NodeAttr, []LinkAttr, []PrefixAttr, error) {
+// RawBytes returns the on-wire encoding of PathAttrLinkState as received, including
+// the attribute header. It is nil unless CollectorConfig.RetainRawPathAttrs is set.
+func (p *PathAttrLinkState) RawBytes() []byte {
+	return p.raw
+}
+
+// deserializeLinkStateAttrs decodes the node, link and prefix attributes in b.
+// Unknown attribute TLVs are preserved according to nlriType unless opts.strict
+// is set.
+func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID, nlriType LinkStateNlriType, opts decodeOptions) ([]NodeAttr, []LinkAttr, []PrefixAttr, error) {
 	var nodeAttr []NodeAttr
 	var linkAttr []LinkAttr
 	var prefixAttr []PrefixAttr
@@ -389,11 +1447,13 @@ func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) (
 		subcode: NotifErrSubcodeMalformedAttr,
 	}
 
-	if len(b) < 4 {
-		return nil, nil, nil, tooShortErr
-	}
-
 	for {
+		// b may end with a partial tlv header, e.g. a nested l2 bundle member
+		// whose length does not cover its sub-tlvs
+		if len(b) < 4 {
+			return nil, nil, nil, tooShortErr
+		}
+
 		lsAttrType := binary.BigEndian.Uint16(b[:2])
 		lsAttrLen := int(binary.BigEndian.Uint16(b[2:4]))
 		b = b[4:]
@@ -405,6 +1465,33 @@ func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) (
 		attrToDecode := b[:lsAttrLen]
 		b = b[lsAttrLen:]
 
+		if ext, ok := newAttrExtension(lsAttrType, nlriType); ok {
+			switch attr := ext.(type) {
+			case *NodeAttrExtension:
+				err := attr.deserialize(attrToDecode)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				nodeAttr = append(nodeAttr, attr)
+			case *LinkAttrExtension:
+				err := attr.deserialize(attrToDecode)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				linkAttr = append(linkAttr, attr)
+			case *PrefixAttrExtension:
+				err := attr.deserialize(attrToDecode)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				prefixAttr = append(prefixAttr, attr)
+			}
+			if len(b) == 0 {
+				break
+			}
+			continue
+		}
+
 		switch lsAttrType {
 		case uint16(NodeAttrCodeIsIsAreaID):
 			attr := &NodeAttrIsIsAreaID{}
@@ -483,6 +1570,52 @@ func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) (
 				return nil, nil, nil, err
 			}
 			nodeAttr = append(nodeAttr, attr)
+		case uint16(NodeAttrCodeSpfCapability):
+			attr := &NodeAttrSpfCapability{}
+			err := attr.deserialize(attrToDecode)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			nodeAttr = append(nodeAttr, attr)
+		case uint16(NodeAttrCodeSRv6EndpointBehavior):
+			attr := &NodeAttrSRv6EndpointBehavior{}
+			err := attr.deserialize(attrToDecode)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			nodeAttr = append(nodeAttr, attr)
+		case uint16(NodeAttrCodeSpfStatus):
+			// the spf status tlv shares a code point across node, link and
+			// prefix attributes, the nlri type determines which one it is
+			switch nlriType {
+			case LinkStateNlriNodeType:
+				attr := &NodeAttrSpfStatus{}
+				err := attr.deserialize(attrToDecode)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				nodeAttr = append(nodeAttr, attr)
+			case LinkStateNlriLinkType:
+				attr := &LinkAttrSpfStatus{}
+				err := attr.deserialize(attrToDecode)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				linkAttr = append(linkAttr, attr)
+			case LinkStateNlriIPv4PrefixType, LinkStateNlriIPv6PrefixType:
+				attr := &PrefixAttrSpfStatus{}
+				err := attr.deserialize(attrToDecode)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				prefixAttr = append(prefixAttr, attr)
+			default:
+				return nil, nil, nil, &errWithNotification{
+					error:   errors.New("invalid nlri type for spf status"),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
+			}
 		case uint16(LinkAttrCodeAdminGroup):
 			attr := &LinkAttrAdminGroup{}
 			err := attr.deserialize(attrToDecode)
@@ -595,6 +1728,20 @@ func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) (
 				return nil, nil, nil, err
 			}
 			linkAttr = append(linkAttr, attr)
+		case uint16(LinkAttrCodeSRv6EndXSID):
+			attr := &LinkAttrSRv6EndXSID{}
+			err := attr.deserialize(attrToDecode)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			linkAttr = append(linkAttr, attr)
+		case uint16(LinkAttrCodeSRv6PeerNodeSID):
+			attr := &LinkAttrSRv6PeerNodeSID{}
+			err := attr.deserialize(attrToDecode)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			linkAttr = append(linkAttr, attr)
 		case uint16(LinkAttrCodeAdjSID):
 			attr := &LinkAttrAdjSID{}
 			err := attr.deserialize(attrToDecode, nlriProtocol)
@@ -660,7 +1807,7 @@ func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) (
 			linkAttr = append(linkAttr, attr)
 		case uint16(LinkAttrCodeL2BundleMember):
 			attr := &LinkAttrL2BundleMember{}
-			err := attr.deserialize(attrToDecode, nlriProtocol)
+			err := attr.deserialize(attrToDecode, nlriProtocol, opts)
 			if err != nil {
 				return nil, nil, nil, err
 			}
@@ -757,12 +1904,39 @@ func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) (
 				return nil, nil, nil, err
 			}
 			prefixAttr = append(prefixAttr, attr)
-		default:
-			return nil, nil, nil, &errWithNotification{
-				error:   errors.New("unknown link state attr type"),
+		case uint16(PrefixAttrCodeFlexAlgoPrefixMetric):
+			attr := &PrefixAttrFlexAlgoPrefixMetric{}
+			err := attr.deserialize(attrToDecode)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			prefixAttr = append(prefixAttr, attr)
+		default:
+			unknownErr := &errWithNotification{
+				error:   errors.New("unknown link state attr type"),
 				code:    NotifErrCodeUpdateMessage,
 				subcode: NotifErrSubcodeMalformedAttr,
 			}
+			if opts.strict {
+				return nil, nil, nil, unknownErr
+			}
+
+			switch nlriType {
+			case LinkStateNlriNodeType, LinkStateNlriSRv6SIDType:
+				attr := &NodeAttrUnknown{Type: NodeAttrCode(lsAttrType)}
+				attr.deserialize(attrToDecode)
+				nodeAttr = append(nodeAttr, attr)
+			case LinkStateNlriLinkType:
+				attr := &LinkAttrUnknown{Type: LinkAttrCode(lsAttrType)}
+				attr.deserialize(attrToDecode)
+				linkAttr = append(linkAttr, attr)
+			case LinkStateNlriIPv4PrefixType, LinkStateNlriIPv6PrefixType:
+				attr := &PrefixAttrUnknown{Type: PrefixAttrCode(lsAttrType)}
+				attr.deserialize(attrToDecode)
+				prefixAttr = append(prefixAttr, attr)
+			default:
+				return nil, nil, nil, unknownErr
+			}
 		}
 
 		if len(b) == 0 {
@@ -773,10 +1947,29 @@ func deserializeLinkStateAttrs(b []byte, nlriProtocol LinkStateNlriProtocolID) (
 	return nodeAttr, linkAttr, prefixAttr, nil
 }
 
-func (p *PathAttrLinkState) deserialize(f PathAttrFlags, b []byte, nlriProtocol LinkStateNlriProtocolID) error {
+// DecodeLinkStateAttr decodes the value of a LINK_STATE path attribute
+// outside the context of an UpdateMessage. protocol is the protocol ID of the
+// associated nlri. Unknown attribute TLVs result in an error as the nlri type
+// is not known.
+func DecodeLinkStateAttr(flags PathAttrFlags, data []byte, protocol LinkStateNlriProtocolID) (*PathAttrLinkState, error) {
+	err := validatePathAttrFlags(flags, pathAttrCatOptionalNonTransitive)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PathAttrLinkState{}
+	err = p.deserialize(flags, data, protocol, 0, decodeOptions{strict: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *PathAttrLinkState) deserialize(f PathAttrFlags, b []byte, nlriProtocol LinkStateNlriProtocolID, nlriType LinkStateNlriType, opts decodeOptions) error {
 	p.f = f
 
-	nodeAttr, linkAttr, prefixAttr, err := deserializeLinkStateAttrs(b, nlriProtocol)
+	nodeAttr, linkAttr, prefixAttr, err := deserializeLinkStateAttrs(b, nlriProtocol, nlriType, opts)
 	if err != nil {
 		return err
 	}
@@ -789,60 +1982,345 @@ func (p *PathAttrLinkState) deserialize(f PathAttrFlags, b []byte, nlriProtocol
 }
 
 func (p *PathAttrLinkState) serialize() ([]byte, error) {
+	return serializeWithBuffer(p)
+}
+
+func (p *PathAttrLinkState) serializeInto(buf *bytes.Buffer) error {
 	p.f = PathAttrFlags{
 		Optional: true,
 	}
 
-	// node attrs
-	nodeAttrs := make([]byte, 0, 512)
-	for _, n := range p.NodeAttrs {
-		b, err := n.serialize()
-		if err != nil {
-			return nil, err
+	return serializePathAttrInto(buf, &p.f, PathAttrLinkStateType, func() error {
+		for _, n := range p.NodeAttrs {
+			err := serializeInto(buf, n)
+			if err != nil {
+				return err
+			}
 		}
-		nodeAttrs = append(nodeAttrs, b...)
-	}
 
-	// link attrs
-	linkAttrs := make([]byte, 0, 512)
-	for _, l := range p.LinkAttrs {
-		b, err := l.serialize()
-		if err != nil {
-			return nil, err
+		for _, l := range p.LinkAttrs {
+			err := serializeInto(buf, l)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, p := range p.PrefixAttrs {
+			err := serializeInto(buf, p)
+			if err != nil {
+				return err
+			}
 		}
-		linkAttrs = append(linkAttrs, b...)
+
+		return nil
+	})
+}
+
+// NodeAttrUnknown is a node attribute of a type that is not otherwise supported.
+// Value is the raw attribute value.
+type NodeAttrUnknown struct {
+	Type  NodeAttrCode
+	Value []byte
+}
+
+// Code returns the NodeAttrCode for NodeAttrUnknown.
+func (n *NodeAttrUnknown) Code() NodeAttrCode {
+	return n.Type
+}
+
+func (n *NodeAttrUnknown) deserialize(b []byte) error {
+	n.Value = make([]byte, len(b))
+	copy(n.Value, b)
+	return nil
+}
+
+func (n *NodeAttrUnknown) serialize() ([]byte, error) {
+	return serializeBgpLsTLV(uint16(n.Type), n.Value), nil
+}
+
+// LinkAttrUnknown is a link attribute of a type that is not otherwise supported.
+// Value is the raw attribute value.
+type LinkAttrUnknown struct {
+	Type  LinkAttrCode
+	Value []byte
+}
+
+// Code returns the LinkAttrCode for LinkAttrUnknown.
+func (l *LinkAttrUnknown) Code() LinkAttrCode {
+	return l.Type
+}
+
+func (l *LinkAttrUnknown) deserialize(b []byte) error {
+	l.Value = make([]byte, len(b))
+	copy(l.Value, b)
+	return nil
+}
+
+func (l *LinkAttrUnknown) serialize() ([]byte, error) {
+	return serializeBgpLsTLV(uint16(l.Type), l.Value), nil
+}
+
+// PrefixAttrUnknown is a prefix attribute of a type that is not otherwise supported.
+// Value is the raw attribute value.
+type PrefixAttrUnknown struct {
+	Type  PrefixAttrCode
+	Value []byte
+}
+
+// Code returns the PrefixAttrCode for PrefixAttrUnknown.
+func (p *PrefixAttrUnknown) Code() PrefixAttrCode {
+	return p.Type
+}
+
+func (p *PrefixAttrUnknown) deserialize(b []byte) error {
+	p.Value = make([]byte, len(b))
+	copy(p.Value, b)
+	return nil
+}
+
+func (p *PrefixAttrUnknown) serialize() ([]byte, error) {
+	return serializeBgpLsTLV(uint16(p.Type), p.Value), nil
+}
+
+// TLVCodec encodes and decodes the value of a TLV type that is not supported
+// by this package, e.g. one defined by a newer RFC or a vendor. MarshalBinary
+// and UnmarshalBinary operate on the TLV value, excluding the type and length.
+type TLVCodec interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// TLVCodecFactory returns a new, empty TLVCodec to decode a TLV into.
+type TLVCodecFactory func() TLVCodec
+
+type extensionKind uint8
+
+const (
+	extensionNodeAttr extensionKind = iota
+	extensionLinkAttr
+	extensionPrefixAttr
+	extensionNodeDescriptor
+	extensionLinkDescriptor
+	extensionPrefixDescriptor
+)
+
+var extensionKindNames = map[extensionKind]string{
+	extensionNodeAttr:         "node attr",
+	extensionLinkAttr:         "link attr",
+	extensionPrefixAttr:       "prefix attr",
+	extensionNodeDescriptor:   "node descriptor",
+	extensionLinkDescriptor:   "link descriptor",
+	extensionPrefixDescriptor: "prefix descriptor",
+}
+
+type extensionKey struct {
+	kind extensionKind
+	code uint16
+}
+
+var extensions = struct {
+	sync.RWMutex
+	m map[extensionKey]TLVCodecFactory
+}{
+	m: make(map[extensionKey]TLVCodecFactory),
+}
+
+// RegisterNodeAttr registers f for node attributes of type code, replacing
+// any existing factory. Registered factories are consulted before the
+// attributes supported by this package, matching attributes are decoded as
+// NodeAttrExtension. A nil f removes the factory for code.
+func RegisterNodeAttr(code NodeAttrCode, f TLVCodecFactory) {
+	registerExtension(extensionNodeAttr, uint16(code), f)
+}
+
+// RegisterLinkAttr registers f for link attributes of type code, replacing
+// any existing factory. Registered factories are consulted before the
+// attributes supported by this package, matching attributes are decoded as
+// LinkAttrExtension. A nil f removes the factory for code.
+func RegisterLinkAttr(code LinkAttrCode, f TLVCodecFactory) {
+	registerExtension(extensionLinkAttr, uint16(code), f)
+}
+
+// RegisterPrefixAttr registers f for prefix attributes of type code,
+// replacing any existing factory. Registered factories are consulted before
+// the attributes supported by this package, matching attributes are decoded as
+// PrefixAttrExtension. A nil f removes the factory for code.
+func RegisterPrefixAttr(code PrefixAttrCode, f TLVCodecFactory) {
+	registerExtension(extensionPrefixAttr, uint16(code), f)
+}
+
+// RegisterNodeDescriptor registers f for node descriptors of type code,
+// replacing any existing factory. Registered factories are consulted before
+// the descriptors supported by this package, matching descriptors are decoded
+// as NodeDescriptorExtension. A nil f removes the factory for code.
+func RegisterNodeDescriptor(code NodeDescriptorCode, f TLVCodecFactory) {
+	registerExtension(extensionNodeDescriptor, uint16(code), f)
+}
+
+// RegisterLinkDescriptor registers f for link descriptors of type code,
+// replacing any existing factory. Registered factories are consulted before
+// the descriptors supported by this package, matching descriptors are decoded
+// as LinkDescriptorExtension. A nil f removes the factory for code.
+func RegisterLinkDescriptor(code LinkDescriptorCode, f TLVCodecFactory) {
+	registerExtension(extensionLinkDescriptor, uint16(code), f)
+}
+
+// RegisterPrefixDescriptor registers f for prefix descriptors of type code,
+// replacing any existing factory. Registered factories are consulted before
+// the descriptors supported by this package, matching descriptors are decoded
+// as PrefixDescriptorExtension. A nil f removes the factory for code.
+func RegisterPrefixDescriptor(code PrefixDescriptorCode, f TLVCodecFactory) {
+	registerExtension(extensionPrefixDescriptor, uint16(code), f)
+}
+
+func registerExtension(kind extensionKind, code uint16, f TLVCodecFactory) {
+	extensions.Lock()
+	defer extensions.Unlock()
+	if f == nil {
+		delete(extensions.m, extensionKey{kind, code})
+		return
+	}
+	extensions.m[extensionKey{kind, code}] = f
+}
+
+// newExtension returns a new TLVCodec from the factory registered for kind and
+// code, if any.
+func newExtension(kind extensionKind, code uint16) (TLVCodec, bool) {
+	extensions.RLock()
+	f, ok := extensions.m[extensionKey{kind, code}]
+	extensions.RUnlock()
+	if !ok {
+		return nil, false
 	}
+	return f(), true
+}
 
-	// prefix attrs
-	prefixAttrs := make([]byte, 0, 512)
-	for _, p := range p.PrefixAttrs {
-		b, err := p.serialize()
-		if err != nil {
-			return nil, err
+// newAttrExtension returns a NodeAttrExtension, LinkAttrExtension or
+// PrefixAttrExtension for code if a factory is registered. Attribute codes are
+// shared across node, link and prefix attributes, the factory for the kind of
+// attribute matching nlriType is preferred.
+func newAttrExtension(code uint16, nlriType LinkStateNlriType) (interface{}, bool) {
+	kinds := []extensionKind{extensionNodeAttr, extensionLinkAttr, extensionPrefixAttr}
+	switch nlriType {
+	case LinkStateNlriLinkType:
+		kinds[0], kinds[1] = kinds[1], kinds[0]
+	case LinkStateNlriIPv4PrefixType, LinkStateNlriIPv6PrefixType:
+		kinds[0], kinds[2] = kinds[2], kinds[0]
+	}
+
+	for _, kind := range kinds {
+		v, ok := newExtension(kind, code)
+		if !ok {
+			continue
+		}
+		switch kind {
+		case extensionNodeAttr:
+			return &NodeAttrExtension{Type: NodeAttrCode(code), Value: v}, true
+		case extensionLinkAttr:
+			return &LinkAttrExtension{Type: LinkAttrCode(code), Value: v}, true
+		default:
+			return &PrefixAttrExtension{Type: PrefixAttrCode(code), Value: v}, true
 		}
-		prefixAttrs = append(prefixAttrs, b...)
 	}
 
-	nodeAttrs = append(nodeAttrs, linkAttrs...)
-	nodeAttrs = append(nodeAttrs, prefixAttrs...)
-	if len(nodeAttrs) > math.MaxUint8 {
-		p.f.ExtendedLength = true
+	return nil, false
+}
+
+func deserializeExtension(kind extensionKind, code uint16, v TLVCodec, b []byte) error {
+	if v == nil {
+		return fmt.Errorf("nil value for %s extension %d", extensionKindNames[kind], code)
 	}
-	flags := p.f.serialize()
+	err := v.UnmarshalBinary(b)
+	if err != nil {
+		return &errWithNotification{
+			error:   fmt.Errorf("invalid %s extension %d: %v", extensionKindNames[kind], code, err),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+	return nil
+}
 
-	b := make([]byte, 2)
-	b[0] = flags
-	b[1] = byte(PathAttrLinkStateType)
-	if p.f.ExtendedLength {
-		l := make([]byte, 2)
-		binary.BigEndian.PutUint16(l, uint16(len(nodeAttrs)))
-		b = append(b, l...)
-	} else {
-		b = append(b, uint8(len(nodeAttrs)))
+func serializeExtension(kind extensionKind, code uint16, v TLVCodec) ([]byte, error) {
+	if v == nil {
+		return nil, fmt.Errorf("nil value for %s extension %d", extensionKindNames[kind], code)
+	}
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("error serializing %s extension %d: %v", extensionKindNames[kind], code, err)
 	}
-	b = append(b, nodeAttrs...)
+	if len(b) > math.MaxUint16 {
+		return nil, fmt.Errorf("%s extension %d too long", extensionKindNames[kind], code)
+	}
+	return serializeBgpLsTLV(code, b), nil
+}
 
-	return b, nil
+// NodeAttrExtension is a node attribute decoded by the TLVCodec registered
+// with RegisterNodeAttr.
+type NodeAttrExtension struct {
+	Type  NodeAttrCode
+	Value TLVCodec
+}
+
+// Code returns the NodeAttrCode for NodeAttrExtension.
+func (n *NodeAttrExtension) Code() NodeAttrCode {
+	return n.Type
+}
+
+func (n *NodeAttrExtension) deserialize(b []byte) error {
+	return deserializeExtension(extensionNodeAttr, uint16(n.Type), n.Value, b)
+}
+
+func (n *NodeAttrExtension) serialize() ([]byte, error) {
+	return serializeExtension(extensionNodeAttr, uint16(n.Type), n.Value)
+}
+
+// LinkAttrExtension is a link attribute decoded by the TLVCodec registered
+// with RegisterLinkAttr.
+type LinkAttrExtension struct {
+	Type  LinkAttrCode
+	Value TLVCodec
+}
+
+// Code returns the LinkAttrCode for LinkAttrExtension.
+func (l *LinkAttrExtension) Code() LinkAttrCode {
+	return l.Type
+}
+
+func (l *LinkAttrExtension) deserialize(b []byte) error {
+	return deserializeExtension(extensionLinkAttr, uint16(l.Type), l.Value, b)
+}
+
+func (l *LinkAttrExtension) serialize() ([]byte, error) {
+	return serializeExtension(extensionLinkAttr, uint16(l.Type), l.Value)
+}
+
+// PrefixAttrExtension is a prefix attribute decoded by the TLVCodec registered
+// with RegisterPrefixAttr.
+type PrefixAttrExtension struct {
+	Type  PrefixAttrCode
+	Value TLVCodec
+}
+
+// Code returns the PrefixAttrCode for PrefixAttrExtension.
+func (p *PrefixAttrExtension) Code() PrefixAttrCode {
+	return p.Type
+}
+
+func (p *PrefixAttrExtension) deserialize(b []byte) error {
+	return deserializeExtension(extensionPrefixAttr, uint16(p.Type), p.Value, b)
+}
+
+func (p *PrefixAttrExtension) serialize() ([]byte, error) {
+	return serializeExtension(extensionPrefixAttr, uint16(p.Type), p.Value)
+}
+
+// 2 octet type and 2 octet length
+func serializeBgpLsTLV(t uint16, v []byte) []byte {
+	b := make([]byte, 4, 4+len(v))
+	binary.BigEndian.PutUint16(b[:2], t)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(v)))
+	return append(b, v...)
 }
 
 // 2 octet type and 2 octet length
@@ -890,7 +2368,15 @@ func deserializeIPv4Addr(b []byte) (net.IP, error) {
 		return nil, errors.New("invalid length for ipv4 address")
 	}
 
-	return net.IP(b), nil
+	return copyIP(b), nil
+}
+
+// copyIP returns b as a net.IP with its own backing array so that decoded
+// values do not alias the read buffer.
+func copyIP(b []byte) net.IP {
+	ip := make(net.IP, len(b))
+	copy(ip, b)
+	return ip
 }
 
 func deserializeIPv6Addr(b []byte) (net.IP, error) {
@@ -898,7 +2384,7 @@ func deserializeIPv6Addr(b []byte) (net.IP, error) {
 		return nil, errors.New("invalid length for ipv6 address")
 	}
 
-	return net.IP(b), nil
+	return copyIP(b), nil
 }
 
 // NodeAttrCode describes the type of node attribute contained in a bgp-ls attribute
@@ -919,6 +2405,10 @@ const (
 	NodeAttrCodeSRAlgo            NodeAttrCode = 1035
 	NodeAttrCodeSRLocalBlock      NodeAttrCode = 1036
 	NodeAttrCodeSRMSPref          NodeAttrCode = 1037
+	NodeAttrCodeSpfCapability     NodeAttrCode = 1180
+	NodeAttrCodeSpfStatus         NodeAttrCode = 1184
+
+	NodeAttrCodeSRv6EndpointBehavior NodeAttrCode = 1250
 )
 
 // NodeAttr is a node attribute contained in a bgp-ls attribute.
@@ -1031,6 +2521,11 @@ func (n *NodeAttrOpaqueNodeAttr) Code() NodeAttrCode {
 	return NodeAttrCodeOpaqueNodeAttr
 }
 
+// TLVs decodes Data as a sequence of sub-TLVs, see OpaqueTLV.
+func (n *NodeAttrOpaqueNodeAttr) TLVs() ([]OpaqueTLV, error) {
+	return decodeOpaqueTLVs(uint16(n.Code()), n.Data)
+}
+
 func (n *NodeAttrOpaqueNodeAttr) deserialize(b []byte) error {
 	if len(b) < 1 {
 		return &errWithNotification{
@@ -1054,6 +2549,89 @@ func (n *NodeAttrOpaqueNodeAttr) serialize() ([]byte, error) {
 	return b, nil
 }
 
+// OpaqueTLV is a sub-TLV contained in the Data of a NodeAttrOpaqueNodeAttr,
+// LinkAttrOpaqueLinkAttr or PrefixAttrOpaquePrefixAttribute. The contents of
+// opaque attributes are not standardized, sub-TLVs are assumed to use the
+// bgp-ls encoding of a 2 octet type and 2 octet length.
+//
+// Decoded and Err are the result of the OpaqueTLVDecoder registered for Type,
+// if any. Value is always populated.
+type OpaqueTLV struct {
+	Type    uint16
+	Value   []byte
+	Decoded interface{}
+	Err     error
+}
+
+// OpaqueTLVDecoder decodes the value of an OpaqueTLV, e.g. a vendor extension.
+type OpaqueTLVDecoder func(value []byte) (interface{}, error)
+
+var opaqueTLVDecoders = struct {
+	sync.RWMutex
+	m map[[2]uint16]OpaqueTLVDecoder
+}{
+	m: make(map[[2]uint16]OpaqueTLVDecoder),
+}
+
+// RegisterNodeOpaqueTLVDecoder registers d for sub-TLVs of type t contained in
+// a NodeAttrOpaqueNodeAttr, replacing any existing decoder. A nil d removes
+// the decoder for t.
+func RegisterNodeOpaqueTLVDecoder(t uint16, d OpaqueTLVDecoder) {
+	registerOpaqueTLVDecoder(uint16(NodeAttrCodeOpaqueNodeAttr), t, d)
+}
+
+// RegisterLinkOpaqueTLVDecoder registers d for sub-TLVs of type t contained in
+// a LinkAttrOpaqueLinkAttr, replacing any existing decoder. A nil d removes
+// the decoder for t.
+func RegisterLinkOpaqueTLVDecoder(t uint16, d OpaqueTLVDecoder) {
+	registerOpaqueTLVDecoder(uint16(LinkAttrCodeOpaqueLinkAttr), t, d)
+}
+
+// RegisterPrefixOpaqueTLVDecoder registers d for sub-TLVs of type t contained
+// in a PrefixAttrOpaquePrefixAttribute, replacing any existing decoder. A nil d
+// removes the decoder for t.
+func RegisterPrefixOpaqueTLVDecoder(t uint16, d OpaqueTLVDecoder) {
+	registerOpaqueTLVDecoder(uint16(PrefixAttrCodeOpaquePrefixAttribute), t, d)
+}
+
+func registerOpaqueTLVDecoder(attr, t uint16, d OpaqueTLVDecoder) {
+	opaqueTLVDecoders.Lock()
+	defer opaqueTLVDecoders.Unlock()
+	if d == nil {
+		delete(opaqueTLVDecoders.m, [2]uint16{attr, t})
+		return
+	}
+	opaqueTLVDecoders.m[[2]uint16{attr, t}] = d
+}
+
+func decodeOpaqueTLVs(attr uint16, b []byte) ([]OpaqueTLV, error) {
+	opaqueTLVDecoders.RLock()
+	defer opaqueTLVDecoders.RUnlock()
+
+	var tlvs []OpaqueTLV
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, errors.New("opaque sub-tlv too short")
+		}
+		t := binary.BigEndian.Uint16(b[:2])
+		l := int(binary.BigEndian.Uint16(b[2:4]))
+		if len(b[4:]) < l {
+			return nil, errors.New("opaque sub-tlv too short")
+		}
+		tlv := OpaqueTLV{
+			Type:  t,
+			Value: append([]byte{}, b[4:4+l]...),
+		}
+		if d, ok := opaqueTLVDecoders.m[[2]uint16{attr, t}]; ok {
+			tlv.Decoded, tlv.Err = d(tlv.Value)
+		}
+		tlvs = append(tlvs, tlv)
+		b = b[4+l:]
+	}
+
+	return tlvs, nil
+}
+
 // NodeAttrNodeName is a node attribute contained in a bgp-ls attribute.
 //
 // https://tools.ietf.org/html/rfc7752#section-3.3.1.3
@@ -1299,28 +2877,26 @@ func deserializeRangeSIDLabel(b []byte) ([]RangeSIDLabel, error) {
 	}
 
 	for {
+		// range size (3 octets), SID/Label sub-TLV type and length, and the
+		// shortest SID/Label value (3 octets)
 		if len(b) < 10 {
 			return nil, errInvalidLen
 		}
 
-		s := b[:3]
-		b = b[3:]
-		s = append([]byte{0}, s...)
 		r := RangeSIDLabel{}
-		r.RangeSize = binary.BigEndian.Uint32(s)
+		r.RangeSize = uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
 
-		if binary.BigEndian.Uint16(b) != sidLabelCode {
+		if binary.BigEndian.Uint16(b[3:5]) != sidLabelCode {
 			return nil, &errWithNotification{
 				error:   errors.New("invalid type for SIDLabel"),
 				code:    NotifErrCodeUpdateMessage,
 				subcode: NotifErrSubcodeMalformedAttr,
 			}
 		}
-		b = b[2:]
 
-		attrLen := binary.BigEndian.Uint16(b)
-		b = b[2:]
-		if len(b) < int(attrLen) {
+		attrLen := int(binary.BigEndian.Uint16(b[5:7]))
+		b = b[7:]
+		if len(b) < attrLen {
 			return nil, errInvalidLen
 		}
 		switch attrLen {
@@ -1529,6 +3105,93 @@ func (n *NodeAttrSRMSPref) deserialize(b []byte) error {
 	return nil
 }
 
+// NodeAttrSpfCapability is a node attribute contained in a bgp-ls attribute.
+// Algorithm identifies the spf algorithm, 0 being standard dijkstra.
+//
+// https://www.rfc-editor.org/rfc/rfc9815
+type NodeAttrSpfCapability struct {
+	Algorithm uint8
+}
+
+// Code returns the appropriate NodeAttrCode for NodeAttrSpfCapability
+func (n *NodeAttrSpfCapability) Code() NodeAttrCode {
+	return NodeAttrCodeSpfCapability
+}
+
+func (n *NodeAttrSpfCapability) serialize() ([]byte, error) {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint16(b[:2], uint16(n.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(1))
+	b[4] = n.Algorithm
+	return b, nil
+}
+
+func (n *NodeAttrSpfCapability) deserialize(b []byte) error {
+	if len(b) != 1 {
+		return &errWithNotification{
+			error:   errors.New("NodeAttrSpfCapability invalid length"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+	n.Algorithm = b[0]
+	return nil
+}
+
+// NodeAttrSpfStatus is a node attribute contained in a bgp-ls attribute.
+//
+// https://www.rfc-editor.org/rfc/rfc9815
+type NodeAttrSpfStatus struct {
+	Status SpfStatus
+}
+
+// Code returns the appropriate NodeAttrCode for NodeAttrSpfStatus
+func (n *NodeAttrSpfStatus) Code() NodeAttrCode {
+	return NodeAttrCodeSpfStatus
+}
+
+func (n *NodeAttrSpfStatus) serialize() ([]byte, error) {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint16(b[:2], uint16(n.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(1))
+	b[4] = uint8(n.Status)
+	return b, nil
+}
+
+func (n *NodeAttrSpfStatus) deserialize(b []byte) error {
+	if len(b) != 1 {
+		return &errWithNotification{
+			error:   errors.New("NodeAttrSpfStatus invalid length"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+	n.Status = SpfStatus(b[0])
+	return nil
+}
+
+// SpfStatus describes the status carried in a bgp-ls-spf status tlv.
+//
+// https://www.rfc-editor.org/rfc/rfc9815
+type SpfStatus uint8
+
+// SpfStatus values. SpfStatusNoTransit only applies to nodes.
+const (
+	SpfStatusUnreachable SpfStatus = 1
+	SpfStatusNoTransit   SpfStatus = 2
+)
+
+func (s SpfStatus) String() string {
+	switch s {
+	case SpfStatusUnreachable:
+		return "unreachable"
+	case SpfStatusNoTransit:
+		return "no-transit"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(s))
+	}
+}
+
 // LinkAttr is a link attribute contained in a bgp-ls attribute.
 type LinkAttr interface {
 	Code() LinkAttrCode
@@ -1560,6 +3223,7 @@ const (
 	LinkAttrCodePeerNodeSID                LinkAttrCode = 1101
 	LinkAttrCodePeerAdjSID                 LinkAttrCode = 1102
 	LinkAttrCodePeerSetSID                 LinkAttrCode = 1103
+	LinkAttrCodeSRv6EndXSID                LinkAttrCode = 1106
 	LinkAttrCodeUniLinkDelay               LinkAttrCode = 1114
 	LinkAttrCodeMinMaxUniLinkDelay         LinkAttrCode = 1115
 	LinkAttrCodeUniDelayVariation          LinkAttrCode = 1116
@@ -1568,6 +3232,8 @@ const (
 	LinkAttrCodeUniAvailableBandwidth      LinkAttrCode = 1119
 	LinkAttrCodeUniBandwidthUtil           LinkAttrCode = 1120
 	LinkAttrCodeL2BundleMember             LinkAttrCode = 1172
+	LinkAttrCodeSpfStatus                  LinkAttrCode = 1184
+	LinkAttrCodeSRv6PeerNodeSID            LinkAttrCode = 1251
 )
 
 // LinkAttrRemoteIPv4RouterID is a link attribute contained in a bgp-ls attribute.
@@ -1691,6 +3357,18 @@ type LinkAttrMaxLinkBandwidth struct {
 	BytesPerSecond float32
 }
 
+// BitsPerSecond returns BytesPerSecond as bits per second. An error is
+// returned if BytesPerSecond is negative or not finite.
+func (l *LinkAttrMaxLinkBandwidth) BitsPerSecond() (uint64, error) {
+	return bytesPerSecondToBits(l.BytesPerSecond)
+}
+
+// SetBitsPerSecond sets BytesPerSecond from bits per second, rounding to
+// the nearest representable value.
+func (l *LinkAttrMaxLinkBandwidth) SetBitsPerSecond(bps uint64) {
+	l.BytesPerSecond = bitsToBytesPerSecond(bps)
+}
+
 // Code returns the appropriate LinkAttrCode for LinkAttrMaxLinkBandwidth.
 func (l *LinkAttrMaxLinkBandwidth) Code() LinkAttrCode {
 	return LinkAttrCodeMaxLinkBandwidth
@@ -1733,6 +3411,18 @@ type LinkAttrMaxReservableLinkBandwidth struct {
 	BytesPerSecond float32
 }
 
+// BitsPerSecond returns BytesPerSecond as bits per second. An error is
+// returned if BytesPerSecond is negative or not finite.
+func (l *LinkAttrMaxReservableLinkBandwidth) BitsPerSecond() (uint64, error) {
+	return bytesPerSecondToBits(l.BytesPerSecond)
+}
+
+// SetBitsPerSecond sets BytesPerSecond from bits per second, rounding to
+// the nearest representable value.
+func (l *LinkAttrMaxReservableLinkBandwidth) SetBitsPerSecond(bps uint64) {
+	l.BytesPerSecond = bitsToBytesPerSecond(bps)
+}
+
 // Code returns the appropriate LinkAttrCode for LinkAttrMaxReservableLinkBandwidth.
 func (l *LinkAttrMaxReservableLinkBandwidth) Code() LinkAttrCode {
 	return LinkAttrCodeMaxReservableLinkBandwidth
@@ -1776,6 +3466,28 @@ type LinkAttrUnreservedBandwidth struct {
 	BytesPerSecond [8]float32
 }
 
+// BitsPerSecond returns BytesPerSecond as bits per second for each priority
+// level. An error is returned if any value is negative or not finite.
+func (l *LinkAttrUnreservedBandwidth) BitsPerSecond() ([8]uint64, error) {
+	var bps [8]uint64
+	for i, f := range l.BytesPerSecond {
+		b, err := bytesPerSecondToBits(f)
+		if err != nil {
+			return bps, err
+		}
+		bps[i] = b
+	}
+	return bps, nil
+}
+
+// SetBitsPerSecond sets BytesPerSecond for each priority level from bits per
+// second, rounding to the nearest representable value.
+func (l *LinkAttrUnreservedBandwidth) SetBitsPerSecond(bps [8]uint64) {
+	for i, b := range bps {
+		l.BytesPerSecond[i] = bitsToBytesPerSecond(b)
+	}
+}
+
 // Code returns the appropriate LinkAttrCode for LinkAttrUnreservedBandwidth.
 func (l *LinkAttrUnreservedBandwidth) Code() LinkAttrCode {
 	return LinkAttrCodeUnreservedBandwidth
@@ -1953,6 +3665,10 @@ func (l *LinkAttrMplsProtocolMask) serialize() ([]byte, error) {
 }
 
 // LinkAttrIgpMetric is a link attribute contained in a bgp-ls attribute.
+// Type determines the width of Metric on the wire and is inferred from the
+// length when decoding, so it round-trips regardless of the metric value.
+// Metric must fit the width of Type: 6 bits for IS-IS small metrics, 16 bits
+// for OSPF and 24 bits for IS-IS wide metrics.
 //
 // https://tools.ietf.org/html/rfc7752#section-3.3.2.4
 type LinkAttrIgpMetric struct {
@@ -1996,7 +3712,8 @@ func (l *LinkAttrIgpMetric) deserialize(b []byte) error {
 	switch len(b) {
 	case 1:
 		l.Type = LinkAttrIgpMetricIsIsSmallType
-		b = append([]byte{0, 0, 0}, b...)
+		// the two most significant bits are ignored
+		b = []byte{0, 0, 0, b[0] & 0x3f}
 	case 2:
 		l.Type = LinkAttrIgpMetricOspfType
 		b = append([]byte{0, 0}, b...)
@@ -2019,15 +3736,24 @@ func (l *LinkAttrIgpMetric) serialize() ([]byte, error) {
 	b := make([]byte, 4)
 	binary.BigEndian.PutUint16(b[:2], uint16(l.Code()))
 
+	var max uint32
 	c := make([]byte, 4)
 	binary.BigEndian.PutUint32(c, l.Metric)
 	switch l.Type {
 	case LinkAttrIgpMetricIsIsSmallType:
+		max = 1<<6 - 1
 		c = c[3:]
 	case LinkAttrIgpMetricOspfType:
+		max = 1<<16 - 1
 		c = c[2:]
 	case LinkAttrIgpMetricIsIsWideType:
+		max = 1<<24 - 1
 		c = c[1:]
+	default:
+		return nil, fmt.Errorf("invalid igp metric type: %d", l.Type)
+	}
+	if l.Metric > max {
+		return nil, fmt.Errorf("igp metric %d exceeds maximum of %d for type", l.Metric, max)
 	}
 
 	binary.BigEndian.PutUint16(b[2:], uint16(len(c)))
@@ -2092,6 +3818,11 @@ func (l *LinkAttrOpaqueLinkAttr) Code() LinkAttrCode {
 	return LinkAttrCodeOpaqueLinkAttr
 }
 
+// TLVs decodes Data as a sequence of sub-TLVs, see OpaqueTLV.
+func (l *LinkAttrOpaqueLinkAttr) TLVs() ([]OpaqueTLV, error) {
+	return decodeOpaqueTLVs(uint16(l.Code()), l.Data)
+}
+
 func (l *LinkAttrOpaqueLinkAttr) deserialize(b []byte) error {
 	if len(b) < 1 {
 		return &errWithNotification{
@@ -2197,11 +3928,26 @@ func (l *SIDIndexLabelLabel) serialize() ([]byte, error) {
 	return b[1:], nil
 }
 
-func deserializeSIDIndexLabel(b []byte) (SIDIndexLabel, error) {
-	switch len(b) {
-	case 3:
-		sil := &SIDIndexLabelLabel{}
-		err := sil.deserialize(b)
+// validateSIDIndexLabelAttrLen validates that b, the value of the attribute
+// named attr, consists of headerLen octets followed by a 3 or 4 octet
+// SID/Index/Label.
+func validateSIDIndexLabelAttrLen(b []byte, headerLen int, attr string) error {
+	if len(b) != headerLen+3 && len(b) != headerLen+4 {
+		return &errWithNotification{
+			error:   fmt.Errorf("invalid length for %s: %d, expected %d or %d", attr, len(b), headerLen+3, headerLen+4),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	return nil
+}
+
+func deserializeSIDIndexLabel(b []byte) (SIDIndexLabel, error) {
+	switch len(b) {
+	case 3:
+		sil := &SIDIndexLabelLabel{}
+		err := sil.deserialize(b)
 		return sil, err
 	case 4:
 		sil := &SIDIndexLabelOffset{}
@@ -2209,7 +3955,7 @@ func deserializeSIDIndexLabel(b []byte) (SIDIndexLabel, error) {
 		return sil, err
 	default:
 		return nil, &errWithNotification{
-			error:   errors.New("invalid length for SIDIndexLabel"),
+			error:   fmt.Errorf("invalid length for SIDIndexLabel: %d", len(b)),
 			code:    NotifErrCodeUpdateMessage,
 			subcode: NotifErrSubcodeMalformedAttr,
 		}
@@ -2245,6 +3991,90 @@ func (l *SIDIndexLabelOffset) serialize() ([]byte, error) {
 	return b, nil
 }
 
+const srv6SIDStructureCode = 1252
+
+// SRv6SIDStructure describes the structure of an SRv6 SID in bits. It is
+// contained as a sub-TLV in the SRv6 SID attributes.
+//
+// https://tools.ietf.org/html/rfc9514#section-8
+type SRv6SIDStructure struct {
+	LocatorBlockLength uint8
+	LocatorNodeLength  uint8
+	FunctionLength     uint8
+	ArgumentLength     uint8
+}
+
+func (s *SRv6SIDStructure) deserialize(b []byte) error {
+	if len(b) != 4 {
+		return &errWithNotification{
+			error:   errors.New("invalid length for SRv6SIDStructure"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	s.LocatorBlockLength = b[0]
+	s.LocatorNodeLength = b[1]
+	s.FunctionLength = b[2]
+	s.ArgumentLength = b[3]
+	return nil
+}
+
+func (s *SRv6SIDStructure) serialize() ([]byte, error) {
+	if int(s.LocatorBlockLength)+int(s.LocatorNodeLength)+int(s.FunctionLength)+int(s.ArgumentLength) > 128 {
+		return nil, errors.New("SRv6SIDStructure lengths exceed 128 bits")
+	}
+
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint16(b, uint16(srv6SIDStructureCode))
+	binary.BigEndian.PutUint16(b[2:], uint16(4))
+	b[4] = s.LocatorBlockLength
+	b[5] = s.LocatorNodeLength
+	b[6] = s.FunctionLength
+	b[7] = s.ArgumentLength
+	return b, nil
+}
+
+// deserializeSRv6SIDSubTLVs decodes the sub-TLVs trailing an SRv6 SID
+// attribute. A nil SRv6SIDStructure is returned if none is present, unknown
+// sub-TLVs are skipped.
+func deserializeSRv6SIDSubTLVs(b []byte) (*SRv6SIDStructure, error) {
+	var structure *SRv6SIDStructure
+
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, &errWithNotification{
+				error:   errors.New("SRv6 SID sub-TLV too short"),
+				code:    NotifErrCodeUpdateMessage,
+				subcode: NotifErrSubcodeMalformedAttr,
+			}
+		}
+
+		subTLVType := binary.BigEndian.Uint16(b)
+		subTLVLen := int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if len(b) < subTLVLen {
+			return nil, &errWithNotification{
+				error:   errors.New("SRv6 SID sub-TLV length exceeds attribute"),
+				code:    NotifErrCodeUpdateMessage,
+				subcode: NotifErrSubcodeMalformedAttr,
+			}
+		}
+
+		if subTLVType == srv6SIDStructureCode {
+			structure = &SRv6SIDStructure{}
+			err := structure.deserialize(b[:subTLVLen])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		b = b[subTLVLen:]
+	}
+
+	return structure, nil
+}
+
 // LinkAttrAdjSIDFlagsType describes the type of LinkAttrAdjSIDFlags
 type LinkAttrAdjSIDFlagsType uint8
 
@@ -2355,17 +4185,11 @@ func (l *LinkAttrAdjSIDFlagsOspf) serialize() byte {
 }
 
 func nlriProtocolIsOspf(nlriProtocol LinkStateNlriProtocolID) bool {
-	if nlriProtocol == LinkStateNlriOSPFv2ProtocolID || nlriProtocol == LinkStateNlriOSPFv3ProtocolID {
-		return true
-	}
-	return false
+	return nlriProtocol.IsOSPF()
 }
 
 func nlriProtocolIsIsIs(nlriProtocol LinkStateNlriProtocolID) bool {
-	if nlriProtocol == LinkStateNlriIsIsL1ProtocolID || nlriProtocol == LinkStateNlriIsIsL2ProtocolID {
-		return true
-	}
-	return false
+	return nlriProtocol.IsIsIs()
 }
 
 func deserializeLinkAttrAdjSIDFlags(b byte, nlriProtocol LinkStateNlriProtocolID) (LinkAttrAdjSIDFlags, error) {
@@ -2401,12 +4225,10 @@ func (l *LinkAttrAdjSID) Code() LinkAttrCode {
 }
 
 func (l *LinkAttrAdjSID) deserialize(b []byte, nlriProtocol LinkStateNlriProtocolID) error {
-	if len(b) < 7 {
-		return &errWithNotification{
-			error:   errors.New("invalid length for LinkAttrAdjSID"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
+	// flags, weight/algorithm, reserved and a 3 or 4 octet SID/Index/Label
+	err := validateSIDIndexLabelAttrLen(b, 4, "LinkAttrAdjSID")
+	if err != nil {
+		return err
 	}
 
 	flags, err := deserializeLinkAttrAdjSIDFlags(b[0], nlriProtocol)
@@ -2546,7 +4368,7 @@ func (l *LinkAttrLanAdjSID) Code() LinkAttrCode {
 }
 
 func (l *LinkAttrLanAdjSID) deserialize(b []byte, nlriProtocol LinkStateNlriProtocolID) error {
-	if len(b) < 11 {
+	if len(b) < 1 {
 		return &errWithNotification{
 			error:   errors.New("invalid length for LinkAttrLanAdjSID"),
 			code:    NotifErrCodeUpdateMessage,
@@ -2558,6 +4380,18 @@ func (l *LinkAttrLanAdjSID) deserialize(b []byte, nlriProtocol LinkStateNlriProt
 	if err != nil {
 		return err
 	}
+
+	// flags, weight, reserved, an OSPF neighbor ID or IS-IS system ID and a 3
+	// or 4 octet SID/Label/Index
+	headerLen := 10
+	if nlriProtocolIsOspf(nlriProtocol) {
+		headerLen = 8
+	}
+	err = validateSIDIndexLabelAttrLen(b, headerLen, "LinkAttrLanAdjSID")
+	if err != nil {
+		return err
+	}
+
 	l.Flags = flags
 	l.Weight = b[1]
 
@@ -2632,12 +4466,10 @@ func (l *LinkAttrPeerNodeSID) Code() LinkAttrCode {
 }
 
 func (l *LinkAttrPeerNodeSID) deserialize(b []byte) error {
-	if len(b) < 7 {
-		return &errWithNotification{
-			error:   errors.New("invalid length for LinkAttrPeerNodeSID"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
+	// flags, weight/algorithm, reserved and a 3 or 4 octet SID/Index/Label
+	err := validateSIDIndexLabelAttrLen(b, 4, "LinkAttrPeerNodeSID")
+	if err != nil {
+		return err
 	}
 
 	l.Weight = b[1]
@@ -2685,12 +4517,10 @@ func (l *LinkAttrPeerAdjSID) Code() LinkAttrCode {
 }
 
 func (l *LinkAttrPeerAdjSID) deserialize(b []byte) error {
-	if len(b) < 7 {
-		return &errWithNotification{
-			error:   errors.New("invalid length for LinkAttrPeerAdjSID"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
+	// flags, weight/algorithm, reserved and a 3 or 4 octet SID/Index/Label
+	err := validateSIDIndexLabelAttrLen(b, 4, "LinkAttrPeerAdjSID")
+	if err != nil {
+		return err
 	}
 
 	l.Value = (b[0] & 128) != 0
@@ -2751,12 +4581,10 @@ func (l *LinkAttrPeerSetSID) Code() LinkAttrCode {
 }
 
 func (l *LinkAttrPeerSetSID) deserialize(b []byte) error {
-	if len(b) < 7 {
-		return &errWithNotification{
-			error:   errors.New("invalid length for LinkAttrPeerSetSID"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
+	// flags, weight/algorithm, reserved and a 3 or 4 octet SID/Index/Label
+	err := validateSIDIndexLabelAttrLen(b, 4, "LinkAttrPeerSetSID")
+	if err != nil {
+		return err
 	}
 
 	l.Weight = b[1]
@@ -2786,6 +4614,275 @@ func (l *LinkAttrPeerSetSID) serialize() ([]byte, error) {
 	return b, nil
 }
 
+// EndpointBehavior is an SRv6 endpoint behavior code point, it determines how
+// a node processes packets destined to an SRv6 SID.
+//
+// https://tools.ietf.org/html/rfc8986#section-10.2
+type EndpointBehavior uint16
+
+// EndpointBehavior values, code points for the flavors of these behaviors are
+// not named but are Known.
+const (
+	EndpointBehaviorEnd            EndpointBehavior = 1
+	EndpointBehaviorEndX           EndpointBehavior = 5
+	EndpointBehaviorEndT           EndpointBehavior = 9
+	EndpointBehaviorEndB6Encaps    EndpointBehavior = 14
+	EndpointBehaviorEndBM          EndpointBehavior = 15
+	EndpointBehaviorEndDX6         EndpointBehavior = 16
+	EndpointBehaviorEndDX4         EndpointBehavior = 17
+	EndpointBehaviorEndDT6         EndpointBehavior = 18
+	EndpointBehaviorEndDT4         EndpointBehavior = 19
+	EndpointBehaviorEndDT46        EndpointBehavior = 20
+	EndpointBehaviorEndDX2         EndpointBehavior = 21
+	EndpointBehaviorEndDX2V        EndpointBehavior = 22
+	EndpointBehaviorEndDT2U        EndpointBehavior = 23
+	EndpointBehaviorEndDT2M        EndpointBehavior = 24
+	EndpointBehaviorEndB6EncapsRed EndpointBehavior = 27
+	EndpointBehaviorOpaque         EndpointBehavior = 65535
+)
+
+var endpointBehaviorNames = map[EndpointBehavior]string{
+	1:     "End",
+	2:     "End with PSP",
+	3:     "End with USP",
+	4:     "End with PSP & USP",
+	5:     "End.X",
+	6:     "End.X with PSP",
+	7:     "End.X with USP",
+	8:     "End.X with PSP & USP",
+	9:     "End.T",
+	10:    "End.T with PSP",
+	11:    "End.T with USP",
+	12:    "End.T with PSP & USP",
+	14:    "End.B6.Encaps",
+	15:    "End.BM",
+	16:    "End.DX6",
+	17:    "End.DX4",
+	18:    "End.DT6",
+	19:    "End.DT4",
+	20:    "End.DT46",
+	21:    "End.DX2",
+	22:    "End.DX2V",
+	23:    "End.DT2U",
+	24:    "End.DT2M",
+	27:    "End.B6.Encaps.Red",
+	28:    "End with USD",
+	29:    "End with PSP & USD",
+	30:    "End with USP & USD",
+	31:    "End with PSP, USP & USD",
+	32:    "End.X with USD",
+	33:    "End.X with PSP & USD",
+	34:    "End.X with USP & USD",
+	35:    "End.X with PSP, USP & USD",
+	36:    "End.T with USD",
+	37:    "End.T with PSP & USD",
+	38:    "End.T with USP & USD",
+	39:    "End.T with PSP, USP & USD",
+	65535: "Opaque",
+}
+
+// Known returns true if b is a code point assigned by RFC 8986. Code points
+// assigned since, e.g. for compressed SIDs, are not Known.
+func (b EndpointBehavior) Known() bool {
+	_, ok := endpointBehaviorNames[b]
+	return ok
+}
+
+// String returns the name of b, or its value if it is not Known.
+func (b EndpointBehavior) String() string {
+	if s, ok := endpointBehaviorNames[b]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown(%d)", uint16(b))
+}
+
+// isEndX returns true if b is End.X or one of its flavors.
+func (b EndpointBehavior) isEndX() bool {
+	return (b >= 5 && b <= 8) || (b >= 32 && b <= 35)
+}
+
+// LinkAttrSRv6EndXSID is a link attribute contained in a bgp-ls attribute.
+// It advertises SRv6 End.X SIDs, including the SRv6 BGP EPE Peer Adjacency SID.
+//
+// https://tools.ietf.org/html/rfc9514#section-4.1
+type LinkAttrSRv6EndXSID struct {
+	EndpointBehavior EndpointBehavior
+	Backup           bool
+	Set              bool
+	Persistent       bool
+	Algorithm        uint8
+	Weight           uint8
+	SID              net.IP
+	SIDStructure     *SRv6SIDStructure
+}
+
+// Code returns the appropriate LinkAttrCode for LinkAttrSRv6EndXSID
+func (l *LinkAttrSRv6EndXSID) Code() LinkAttrCode {
+	return LinkAttrCodeSRv6EndXSID
+}
+
+func (l *LinkAttrSRv6EndXSID) deserialize(b []byte) error {
+	if len(b) < 22 {
+		return &errWithNotification{
+			error:   errors.New("invalid length for LinkAttrSRv6EndXSID"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	l.EndpointBehavior = EndpointBehavior(binary.BigEndian.Uint16(b))
+	l.Backup = (b[2] & 128) != 0
+	l.Set = (b[2] & 64) != 0
+	l.Persistent = (b[2] & 32) != 0
+	l.Algorithm = b[3]
+	l.Weight = b[4]
+	l.SID = copyIP(b[6:22])
+
+	structure, err := deserializeSRv6SIDSubTLVs(b[22:])
+	if err != nil {
+		return err
+	}
+	l.SIDStructure = structure
+
+	return nil
+}
+
+func (l *LinkAttrSRv6EndXSID) serialize() ([]byte, error) {
+	sid := l.SID.To16()
+	if sid == nil {
+		return nil, errors.New("invalid SID for LinkAttrSRv6EndXSID")
+	}
+
+	var subTLVs []byte
+	if l.SIDStructure != nil {
+		var err error
+		subTLVs, err = l.SIDStructure.serialize()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b := make([]byte, 10)
+	binary.BigEndian.PutUint16(b, uint16(l.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(22+len(subTLVs)))
+	binary.BigEndian.PutUint16(b[4:], uint16(l.EndpointBehavior))
+	if l.Backup {
+		b[6] += 128
+	}
+	if l.Set {
+		b[6] += 64
+	}
+	if l.Persistent {
+		b[6] += 32
+	}
+	b[7] = l.Algorithm
+	b[8] = l.Weight
+	b = append(b, sid...)
+	b = append(b, subTLVs...)
+	return b, nil
+}
+
+// LinkAttrSRv6PeerNodeSID is a link attribute contained in a bgp-ls attribute.
+// It accompanies SRv6 BGP EPE Peer Node and Peer Set SIDs, which are advertised
+// as SRv6 SID nlri.
+//
+// https://tools.ietf.org/html/rfc9514#section-7.2
+type LinkAttrSRv6PeerNodeSID struct {
+	Backup       bool
+	Set          bool
+	Persistent   bool
+	Weight       uint8
+	PeerASN      uint32
+	PeerRouterID net.IP
+}
+
+// Code returns the appropriate LinkAttrCode for LinkAttrSRv6PeerNodeSID
+func (l *LinkAttrSRv6PeerNodeSID) Code() LinkAttrCode {
+	return LinkAttrCodeSRv6PeerNodeSID
+}
+
+func (l *LinkAttrSRv6PeerNodeSID) deserialize(b []byte) error {
+	if len(b) != 12 {
+		return &errWithNotification{
+			error:   errors.New("invalid length for LinkAttrSRv6PeerNodeSID"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	l.Backup = (b[0] & 128) != 0
+	l.Set = (b[0] & 64) != 0
+	l.Persistent = (b[0] & 32) != 0
+	l.Weight = b[1]
+	l.PeerASN = binary.BigEndian.Uint32(b[4:])
+	l.PeerRouterID = copyIP(b[8:12])
+	return nil
+}
+
+func (l *LinkAttrSRv6PeerNodeSID) serialize() ([]byte, error) {
+	routerID := l.PeerRouterID.To4()
+	if routerID == nil {
+		return nil, errors.New("invalid peer router ID for LinkAttrSRv6PeerNodeSID")
+	}
+
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint16(b, uint16(l.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(12))
+	if l.Backup {
+		b[4] += 128
+	}
+	if l.Set {
+		b[4] += 64
+	}
+	if l.Persistent {
+		b[4] += 32
+	}
+	b[5] = l.Weight
+	binary.BigEndian.PutUint32(b[8:], l.PeerASN)
+	b = append(b, routerID...)
+	return b, nil
+}
+
+// NodeAttrSRv6EndpointBehavior is a node attribute contained in a bgp-ls
+// attribute. It accompanies SRv6 SID nlri and describes the behavior of the SID.
+//
+// https://tools.ietf.org/html/rfc9514#section-7.1
+type NodeAttrSRv6EndpointBehavior struct {
+	EndpointBehavior EndpointBehavior
+	Flags            uint8
+	Algorithm        uint8
+}
+
+// Code returns the appropriate NodeAttrCode for NodeAttrSRv6EndpointBehavior
+func (n *NodeAttrSRv6EndpointBehavior) Code() NodeAttrCode {
+	return NodeAttrCodeSRv6EndpointBehavior
+}
+
+func (n *NodeAttrSRv6EndpointBehavior) deserialize(b []byte) error {
+	if len(b) != 4 {
+		return &errWithNotification{
+			error:   errors.New("invalid length for NodeAttrSRv6EndpointBehavior"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	n.EndpointBehavior = EndpointBehavior(binary.BigEndian.Uint16(b))
+	n.Flags = b[2]
+	n.Algorithm = b[3]
+	return nil
+}
+
+func (n *NodeAttrSRv6EndpointBehavior) serialize() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint16(b, uint16(n.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(4))
+	binary.BigEndian.PutUint16(b[4:], uint16(n.EndpointBehavior))
+	b[6] = n.Flags
+	b[7] = n.Algorithm
+	return b, nil
+}
+
 func deserializeMicrosecondDelay(b []byte) (time.Duration, error) {
 	if len(b) != 3 {
 		return 0, &errWithNotification{
@@ -2804,6 +4901,9 @@ func serializeMicrosecondDelay(d time.Duration) ([]byte, error) {
 	if us > maxUint24 {
 		return nil, errors.New("delay overflows 3 octets")
 	}
+	if us < 0 {
+		return nil, errors.New("negative delay")
+	}
 	b := make([]byte, 4)
 	binary.BigEndian.PutUint32(b, uint32(us))
 	return b[1:], nil
@@ -2860,6 +4960,9 @@ func (l *LinkAttrUniLinkDelay) serialize() ([]byte, error) {
 
 // LinkAttrMinMaxUniLinkDelay is a link attribute contained in a bgp-ls attribute.
 //
+// The wire format carries a single A-flag for the pair of values, it is not
+// possible to determine whether MinDelay or MaxDelay caused it to be set.
+//
 // https://tools.ietf.org/html/draft-ietf-idr-te-pm-bgp-08#section-3.2
 type LinkAttrMinMaxUniLinkDelay struct {
 	Anomalous bool
@@ -2872,6 +4975,18 @@ func (l *LinkAttrMinMaxUniLinkDelay) Code() LinkAttrCode {
 	return LinkAttrCodeMinMaxUniLinkDelay
 }
 
+/*
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|        Type                   |           Length              |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|A| RESERVED    |                   Min Delay                   |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|   RESERVED    |                   Max Delay                   |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
 func (l *LinkAttrMinMaxUniLinkDelay) deserialize(b []byte) error {
 	if len(b) != 8 {
 		return &errWithNotification{
@@ -2917,6 +5032,7 @@ func (l *LinkAttrMinMaxUniLinkDelay) serialize() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	// reserved octet preceding max delay
 	b = append(b, 0)
 	b = append(b, c...)
 
@@ -3053,6 +5169,30 @@ func serializeFloat32(f float32) ([]byte, error) {
 	return b.Bytes(), err
 }
 
+// bytesPerSecondToBits converts an ieee floating point bytes per second value
+// to bits per second. An error is returned if the value is negative, NaN,
+// infinite, or overflows uint64.
+func bytesPerSecondToBits(f float32) (uint64, error) {
+	bits := float64(f) * 8
+	if math.IsNaN(bits) || math.IsInf(bits, 0) {
+		return 0, errors.New("bandwidth is not a finite number")
+	}
+	if bits < 0 {
+		return 0, errors.New("bandwidth is negative")
+	}
+	if bits >= math.MaxUint64 {
+		return 0, errors.New("bandwidth overflows uint64")
+	}
+	return uint64(bits), nil
+}
+
+// bitsToBytesPerSecond converts bits per second to the nearest ieee floating
+// point bytes per second value. float32 has a 24 bit significand, values
+// exceeding 2^27 bits per second may not be represented exactly.
+func bitsToBytesPerSecond(bps uint64) float32 {
+	return float32(float64(bps) / 8)
+}
+
 // LinkAttrUniResidualBandwidth is a link attribute contained in a bgp-ls attribute.
 //
 // https://tools.ietf.org/html/draft-ietf-idr-te-pm-bgp-08#section-3.5
@@ -3060,6 +5200,18 @@ type LinkAttrUniResidualBandwidth struct {
 	BytesPerSecond float32
 }
 
+// BitsPerSecond returns BytesPerSecond as bits per second. An error is
+// returned if BytesPerSecond is negative or not finite.
+func (l *LinkAttrUniResidualBandwidth) BitsPerSecond() (uint64, error) {
+	return bytesPerSecondToBits(l.BytesPerSecond)
+}
+
+// SetBitsPerSecond sets BytesPerSecond from bits per second, rounding to
+// the nearest representable value.
+func (l *LinkAttrUniResidualBandwidth) SetBitsPerSecond(bps uint64) {
+	l.BytesPerSecond = bitsToBytesPerSecond(bps)
+}
+
 // Code returns the appropriate LinkAttrCode for LinkAttrUniResidualBandwidth
 func (l *LinkAttrUniResidualBandwidth) Code() LinkAttrCode {
 	return LinkAttrCodeUniResidualBandwidth
@@ -3103,6 +5255,18 @@ type LinkAttrUniAvailableBandwidth struct {
 	BytesPerSecond float32
 }
 
+// BitsPerSecond returns BytesPerSecond as bits per second. An error is
+// returned if BytesPerSecond is negative or not finite.
+func (l *LinkAttrUniAvailableBandwidth) BitsPerSecond() (uint64, error) {
+	return bytesPerSecondToBits(l.BytesPerSecond)
+}
+
+// SetBitsPerSecond sets BytesPerSecond from bits per second, rounding to
+// the nearest representable value.
+func (l *LinkAttrUniAvailableBandwidth) SetBitsPerSecond(bps uint64) {
+	l.BytesPerSecond = bitsToBytesPerSecond(bps)
+}
+
 // Code returns the appropriate LinkAttrCode for LinkAttrUniAvailableBandwidth
 func (l *LinkAttrUniAvailableBandwidth) Code() LinkAttrCode {
 	return LinkAttrCodeUniAvailableBandwidth
@@ -3146,6 +5310,18 @@ type LinkAttrUniBandwidthUtil struct {
 	BytesPerSecond float32
 }
 
+// BitsPerSecond returns BytesPerSecond as bits per second. An error is
+// returned if BytesPerSecond is negative or not finite.
+func (l *LinkAttrUniBandwidthUtil) BitsPerSecond() (uint64, error) {
+	return bytesPerSecondToBits(l.BytesPerSecond)
+}
+
+// SetBitsPerSecond sets BytesPerSecond from bits per second, rounding to
+// the nearest representable value.
+func (l *LinkAttrUniBandwidthUtil) SetBitsPerSecond(bps uint64) {
+	l.BytesPerSecond = bitsToBytesPerSecond(bps)
+}
+
 // Code returns the appropriate LinkAttrCode for LinkAttrUniBandwidthUtil
 func (l *LinkAttrUniBandwidthUtil) Code() LinkAttrCode {
 	return LinkAttrCodeUniBandwidthUtil
@@ -3195,7 +5371,7 @@ func (l *LinkAttrL2BundleMember) Code() LinkAttrCode {
 	return LinkAttrCodeL2BundleMember
 }
 
-func (l *LinkAttrL2BundleMember) deserialize(b []byte, nlriProtocol LinkStateNlriProtocolID) error {
+func (l *LinkAttrL2BundleMember) deserialize(b []byte, nlriProtocol LinkStateNlriProtocolID, opts decodeOptions) error {
 	if len(b) < 8 {
 		return &errWithNotification{
 			error:   errors.New("invalid length for LinkAttrL2BundleMember"),
@@ -3206,7 +5382,9 @@ func (l *LinkAttrL2BundleMember) deserialize(b []byte, nlriProtocol LinkStateNlr
 
 	l.MemberDescriptor = binary.BigEndian.Uint32(b)
 
-	node, link, prefix, err := deserializeLinkStateAttrs(b[4:], nlriProtocol)
+	// b is confined to the member's length, sub-tlvs extending beyond it are
+	// rejected rather than read from sibling attributes
+	node, link, prefix, err := deserializeLinkStateAttrs(b[4:], nlriProtocol, LinkStateNlriLinkType, opts)
 	if err != nil {
 		return err
 	}
@@ -3240,6 +5418,38 @@ func (l *LinkAttrL2BundleMember) serialize() ([]byte, error) {
 	return b, nil
 }
 
+// LinkAttrSpfStatus is a link attribute contained in a bgp-ls attribute.
+//
+// https://www.rfc-editor.org/rfc/rfc9815
+type LinkAttrSpfStatus struct {
+	Status SpfStatus
+}
+
+// Code returns the appropriate LinkAttrCode for LinkAttrSpfStatus
+func (l *LinkAttrSpfStatus) Code() LinkAttrCode {
+	return LinkAttrCodeSpfStatus
+}
+
+func (l *LinkAttrSpfStatus) serialize() ([]byte, error) {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint16(b[:2], uint16(l.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(1))
+	b[4] = uint8(l.Status)
+	return b, nil
+}
+
+func (l *LinkAttrSpfStatus) deserialize(b []byte) error {
+	if len(b) != 1 {
+		return &errWithNotification{
+			error:   errors.New("LinkAttrSpfStatus invalid length"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+	l.Status = SpfStatus(b[0])
+	return nil
+}
+
 // PrefixAttr is a prefix attribute contained in a bgp-ls attribute.
 type PrefixAttr interface {
 	Code() PrefixAttrCode
@@ -3263,6 +5473,8 @@ const (
 	PrefixAttrCodeRange                 PrefixAttrCode = 1159
 	PrefixAttrCodeFlags                 PrefixAttrCode = 1170
 	PrefixAttrCodeSourceRouterID        PrefixAttrCode = 1171
+	PrefixAttrCodeFlexAlgoPrefixMetric  PrefixAttrCode = 1044
+	PrefixAttrCodeSpfStatus             PrefixAttrCode = 1184
 )
 
 // PrefixAttrIgpFlags is a prefix attribute contained in a bgp-ls attribute.
@@ -3469,7 +5681,7 @@ func (p *PrefixAttrOspfForwardingAddress) deserialize(b []byte) error {
 		}
 	}
 
-	p.Address = net.IP(b)
+	p.Address = copyIP(b)
 	return nil
 }
 
@@ -3484,22 +5696,276 @@ func (p *PrefixAttrOspfForwardingAddress) serialize() ([]byte, error) {
 }
 
 // PrefixAttrOpaquePrefixAttribute is a prefix attribute contained in a bgp-ls attribute.
+// Data is the raw attribute value, see Ospfv2ExtendedPrefix and
+// Ospfv3ExtendedPrefix for nlri of the OSPFv2 and OSPFv3 protocols and TLVs
+// for other protocols.
 type PrefixAttrOpaquePrefixAttribute struct {
 	Data []byte
 }
 
-// Code returns the appropriate PrefixAttrCode for PrefixAttrOpaquePrefixAttribute.
-func (p *PrefixAttrOpaquePrefixAttribute) Code() PrefixAttrCode {
-	return PrefixAttrCodeOpaquePrefixAttribute
+// Ospfv2ExtendedPrefix decodes Data as the value of an OSPFv2 Extended Prefix
+// TLV, Data does not include the TLV type and length. It should only be used for
+// nlri with a LinkStateNlriOSPFv2ProtocolID, the contents are opaque for other
+// protocols. Data is not modified.
+func (p *PrefixAttrOpaquePrefixAttribute) Ospfv2ExtendedPrefix() (*Ospfv2ExtendedPrefix, error) {
+	e := &Ospfv2ExtendedPrefix{}
+	err := e.deserialize(p.Data)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
 }
 
-func (p *PrefixAttrOpaquePrefixAttribute) deserialize(b []byte) error {
-	if len(b) < 1 {
-		return &errWithNotification{
-			error:   errors.New("prefix attr opaque too short"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
+// Ospfv2ExtendedPrefix is the value of an OSPFv2 Extended Prefix TLV carried in
+// a PrefixAttrOpaquePrefixAttribute. Attach and Node are the A-Flag and N-Flag.
+// Sub-TLVs, e.g. the Prefix SID Sub-TLV, are preserved undecoded. OSPF route
+// tags are not carried in the Extended Prefix TLV, they are contained in
+// PrefixAttrIgpRouteTag and PrefixAttrIgpExtendedRouteTag.
+//
+// https://tools.ietf.org/html/rfc7684#section-2.1
+type Ospfv2ExtendedPrefix struct {
+	RouteType     Ospfv2ExtendedPrefixRouteType
+	PrefixLength  uint8
+	AddressFamily uint8
+	Attach        bool
+	Node          bool
+	Prefix        net.IP
+	SubTLVs       []Ospfv2ExtendedPrefixSubTLV
+}
+
+// Ospfv2ExtendedPrefixRouteType is the route type of an Ospfv2ExtendedPrefix.
+type Ospfv2ExtendedPrefixRouteType uint8
+
+// Ospfv2ExtendedPrefixRouteType values
+const (
+	Ospfv2ExtendedPrefixRouteTypeUnspecified  Ospfv2ExtendedPrefixRouteType = 0
+	Ospfv2ExtendedPrefixRouteTypeIntraArea    Ospfv2ExtendedPrefixRouteType = 1
+	Ospfv2ExtendedPrefixRouteTypeInterArea    Ospfv2ExtendedPrefixRouteType = 3
+	Ospfv2ExtendedPrefixRouteTypeASExternal   Ospfv2ExtendedPrefixRouteType = 5
+	Ospfv2ExtendedPrefixRouteTypeNSSAExternal Ospfv2ExtendedPrefixRouteType = 7
+)
+
+// Ospfv2ExtendedPrefixSubTLV is a sub-TLV of an Ospfv2ExtendedPrefix.
+type Ospfv2ExtendedPrefixSubTLV struct {
+	Type  uint16
+	Value []byte
+}
+
+/*
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|              Type             |             Length            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|  Route Type   | Prefix Length |     AF        |     Flags     |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                     Address Prefix (variable)                 |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                      Sub-TLVs (variable)                      |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+	Address Prefix
+		For the address family IPv4 unicast, the prefix itself is
+		encoded as a 32-bit value.  The default route is represented by
+		a prefix of length 0.  Prefix encoding for other address
+		families is beyond the scope of this specification.
+
+	b is the TLV value, excluding the type and length.
+*/
+func (e *Ospfv2ExtendedPrefix) deserialize(b []byte) error {
+	if len(b) < 4 {
+		return errors.New("ospfv2 extended prefix too short")
+	}
+
+	e.RouteType = Ospfv2ExtendedPrefixRouteType(b[0])
+	e.PrefixLength = b[1]
+	e.AddressFamily = b[2]
+	e.Attach = b[3]&0x80 != 0
+	e.Node = b[3]&0x40 != 0
+	b = b[4:]
+
+	if e.AddressFamily != 0 {
+		return fmt.Errorf("unsupported ospfv2 extended prefix address family: %d", e.AddressFamily)
+	}
+	if e.PrefixLength > 32 {
+		return fmt.Errorf("invalid ospfv2 extended prefix length: %d", e.PrefixLength)
+	}
+	if len(b) < 4 {
+		return errors.New("ospfv2 extended prefix address prefix too short")
+	}
+	e.Prefix = copyIP(b[:4])
+	b = b[4:]
+
+	err := deserializeOspfSubTLVs(b, func(t uint16, v []byte) {
+		e.SubTLVs = append(e.SubTLVs, Ospfv2ExtendedPrefixSubTLV{Type: t, Value: v})
+	})
+	if err != nil {
+		return fmt.Errorf("ospfv2 extended prefix %v", err)
+	}
+
+	return nil
+}
+
+// deserializeOspfSubTLVs calls f with the type and a copy of the value of each
+// sub-TLV in b. Sub-TLV values are padded to 32-bit alignment.
+func deserializeOspfSubTLVs(b []byte, f func(t uint16, v []byte)) error {
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return errors.New("sub-tlv too short")
+		}
+		t := binary.BigEndian.Uint16(b[:2])
+		l := int(binary.BigEndian.Uint16(b[2:4]))
+		padded := (l + 3) &^ 3
+		if len(b[4:]) < l {
+			return errors.New("sub-tlv too short")
+		}
+		f(t, append([]byte{}, b[4:4+l]...))
+		if len(b[4:]) < padded {
+			padded = l
+		}
+		b = b[4+padded:]
+	}
+
+	return nil
+}
+
+// Ospfv3ExtendedPrefix decodes Data as the value of an OSPFv3 Inter-Area-Prefix,
+// External-Prefix or Intra-Area-Prefix TLV of an extended LSA, as given by t.
+// Data does not include the TLV type and length. It should only be used for
+// nlri with a LinkStateNlriOSPFv3ProtocolID, the contents are opaque for other
+// protocols. Data is not modified.
+func (p *PrefixAttrOpaquePrefixAttribute) Ospfv3ExtendedPrefix(t Ospfv3ExtendedPrefixType) (*Ospfv3ExtendedPrefix, error) {
+	e := &Ospfv3ExtendedPrefix{}
+	err := e.deserialize(t, p.Data)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Ospfv3ExtendedPrefix is an OSPFv3 extended LSA prefix TLV carried in a
+// PrefixAttrOpaquePrefixAttribute. Prefix is zero padded to 16 octets.
+// External, ForwardingAddress and RouteTag are the E-bit, F-bit and T-bit of
+// an External-Prefix TLV, they are false for other TLV types. Sub-TLVs, e.g.
+// the Forwarding Address and Route Tag Sub-TLVs, are preserved undecoded.
+//
+// https://tools.ietf.org/html/rfc8362#section-3.4
+type Ospfv3ExtendedPrefix struct {
+	Type              Ospfv3ExtendedPrefixType
+	Metric            uint32
+	External          bool
+	ForwardingAddress bool
+	RouteTag          bool
+	PrefixLength      uint8
+	Options           PrefixAttrFlagsOSPFv3
+	Prefix            net.IP
+	SubTLVs           []Ospfv3ExtendedPrefixSubTLV
+}
+
+// Ospfv3ExtendedPrefixType is the TLV type of an Ospfv3ExtendedPrefix.
+type Ospfv3ExtendedPrefixType uint16
+
+// Ospfv3ExtendedPrefixType values
+const (
+	Ospfv3ExtendedPrefixTypeInterArea Ospfv3ExtendedPrefixType = 3
+	Ospfv3ExtendedPrefixTypeExternal  Ospfv3ExtendedPrefixType = 5
+	Ospfv3ExtendedPrefixTypeIntraArea Ospfv3ExtendedPrefixType = 6
+)
+
+// Ospfv3ExtendedPrefixSubTLV is a sub-TLV of an Ospfv3ExtendedPrefix.
+type Ospfv3ExtendedPrefixSubTLV struct {
+	Type  uint16
+	Value []byte
+}
+
+/*
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|              Type             |              Length           |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|   Flags/0     |                 Metric                        |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	| PrefixLength  | PrefixOptions |               0               |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                 Address Prefix                                |
+	|                 ...                                           |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	.                                                               .
+	.                            Sub-TLVs                           .
+	.                                                               .
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+	The Flags octet is only present in the External-Prefix TLV.
+
+	Address Prefix
+		The address prefix is encoded in an even multiple of 32-bit
+		words, padded with zero bits as necessary.
+
+	b is the TLV value, excluding the type and length.
+*/
+func (e *Ospfv3ExtendedPrefix) deserialize(t Ospfv3ExtendedPrefixType, b []byte) error {
+	e.Type = t
+	switch e.Type {
+	case Ospfv3ExtendedPrefixTypeInterArea, Ospfv3ExtendedPrefixTypeExternal, Ospfv3ExtendedPrefixTypeIntraArea:
+	default:
+		return fmt.Errorf("unsupported ospfv3 extended prefix tlv type: %d", e.Type)
+	}
+
+	if len(b) < 8 {
+		return errors.New("ospfv3 extended prefix too short")
+	}
+	if e.Type == Ospfv3ExtendedPrefixTypeExternal {
+		e.External = b[0]&0x04 != 0
+		e.ForwardingAddress = b[0]&0x02 != 0
+		e.RouteTag = b[0]&0x01 != 0
+	}
+	e.Metric = binary.BigEndian.Uint32(b[:4]) & 0x00FFFFFF
+	e.PrefixLength = b[4]
+	e.Options.deserialize(b[5:6])
+	b = b[8:]
+
+	if e.PrefixLength > 128 {
+		return fmt.Errorf("invalid ospfv3 extended prefix length: %d", e.PrefixLength)
+	}
+	prefixLen := (int(e.PrefixLength) + 31) / 32 * 4
+	if len(b) < prefixLen {
+		return errors.New("ospfv3 extended prefix address prefix too short")
+	}
+	e.Prefix = make(net.IP, net.IPv6len)
+	copy(e.Prefix, b[:prefixLen])
+	b = b[prefixLen:]
+
+	err := deserializeOspfSubTLVs(b, func(t uint16, v []byte) {
+		e.SubTLVs = append(e.SubTLVs, Ospfv3ExtendedPrefixSubTLV{Type: t, Value: v})
+	})
+	if err != nil {
+		return fmt.Errorf("ospfv3 extended prefix %v", err)
+	}
+
+	return nil
+}
+
+// Code returns the appropriate PrefixAttrCode for PrefixAttrOpaquePrefixAttribute.
+func (p *PrefixAttrOpaquePrefixAttribute) Code() PrefixAttrCode {
+	return PrefixAttrCodeOpaquePrefixAttribute
+}
+
+// TLVs decodes Data as a sequence of sub-TLVs, see OpaqueTLV. It should not be
+// used for nlri with a LinkStateNlriOSPFv2ProtocolID or
+// LinkStateNlriOSPFv3ProtocolID, see Ospfv2ExtendedPrefix and
+// Ospfv3ExtendedPrefix.
+func (p *PrefixAttrOpaquePrefixAttribute) TLVs() ([]OpaqueTLV, error) {
+	return decodeOpaqueTLVs(uint16(p.Code()), p.Data)
+}
+
+func (p *PrefixAttrOpaquePrefixAttribute) deserialize(b []byte) error {
+	if len(b) < 1 {
+		return &errWithNotification{
+			error:   errors.New("prefix attr opaque too short"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
 	}
 
 	p.Data = b
@@ -3646,12 +6112,10 @@ func (p *PrefixAttrPrefixSID) Code() PrefixAttrCode {
 }
 
 func (p *PrefixAttrPrefixSID) deserialize(b []byte, nlriProtocol LinkStateNlriProtocolID) error {
-	if len(b) < 7 {
-		return &errWithNotification{
-			error:   errors.New("invalid length for PrefixAttrPrefixSID"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
+	// flags, weight/algorithm, reserved and a 3 or 4 octet SID/Index/Label
+	err := validateSIDIndexLabelAttrLen(b, 4, "PrefixAttrPrefixSID")
+	if err != nil {
+		return err
 	}
 
 	if nlriProtocolIsIsIs(nlriProtocol) {
@@ -3828,7 +6292,8 @@ func (p *PrefixAttrRange) deserialize(b []byte, nlriProtocol LinkStateNlriProtoc
 	b = b[4:]
 
 	if len(b) > 0 {
-		node, link, prefix, err := deserializeLinkStateAttrs(b, nlriProtocol)
+		// only prefix sids are valid, unknown attrs are rejected regardless of mode
+		node, link, prefix, err := deserializeLinkStateAttrs(b, nlriProtocol, 0, decodeOptions{strict: true})
 		if err != nil {
 			return err
 		}
@@ -3865,8 +6330,18 @@ func (p *PrefixAttrRange) serialize() ([]byte, error) {
 		return nil, errors.New("missing flags")
 	}
 
+	// the flags of the range and its prefix sids are interpreted according to
+	// the same nlri protocol
+	sidFlagsType := PrefixAttrPrefixSIDFlagsTypeIsIs
+	if p.Flags.Type() == PrefixAttrRangeFlagsTypeOspf {
+		sidFlagsType = PrefixAttrPrefixSIDFlagsTypeOspf
+	}
+
 	psid := make([]byte, 0)
 	for _, a := range p.PrefixSID {
+		if a.Flags != nil && a.Flags.Type() != sidFlagsType {
+			return nil, errors.New("prefix sid flags do not match the protocol of the range flags")
+		}
 		b, err := a.serialize()
 		if err != nil {
 			return nil, err
@@ -4078,14 +6553,110 @@ func (p *PrefixAttrSourceRouterID) serialize() ([]byte, error) {
 	return serializeBgpLsIPv4TLV(uint16(p.Code()), addr)
 }
 
+// PrefixAttrFlexAlgoPrefixMetric is a prefix attribute contained in a bgp-ls attribute.
+// External is set when the metric is an external metric.
+//
+// https://tools.ietf.org/html/rfc9351#section-5
+type PrefixAttrFlexAlgoPrefixMetric struct {
+	Algorithm uint8
+	External  bool
+	Metric    uint32
+}
+
+// Code returns the appropriate PrefixAttrCode for PrefixAttrFlexAlgoPrefixMetric
+func (p *PrefixAttrFlexAlgoPrefixMetric) Code() PrefixAttrCode {
+	return PrefixAttrCodeFlexAlgoPrefixMetric
+}
+
+/*
+	0                   1                   2                   3
+	0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|              Type             |             Length            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|  Flex-Algorithm |     Flags     |            Reserved          |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                             Metric                            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+func (p *PrefixAttrFlexAlgoPrefixMetric) deserialize(b []byte) error {
+	if len(b) != 8 {
+		return &errWithNotification{
+			error:   errors.New("invalid length for PrefixAttrFlexAlgoPrefixMetric"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	p.Algorithm = b[0]
+	p.External = (b[1] & 128) != 0
+	p.Metric = binary.BigEndian.Uint32(b[4:8])
+
+	return nil
+}
+
+func (p *PrefixAttrFlexAlgoPrefixMetric) serialize() ([]byte, error) {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint16(b[:2], uint16(p.Code()))
+	binary.BigEndian.PutUint16(b[2:4], 8)
+	b[4] = p.Algorithm
+	if p.External {
+		b[5] += 128
+	}
+	binary.BigEndian.PutUint32(b[8:], p.Metric)
+
+	return b, nil
+}
+
+// PrefixAttrSpfStatus is a prefix attribute contained in a bgp-ls attribute.
+//
+// https://www.rfc-editor.org/rfc/rfc9815
+type PrefixAttrSpfStatus struct {
+	Status SpfStatus
+}
+
+// Code returns the appropriate PrefixAttrCode for PrefixAttrSpfStatus
+func (p *PrefixAttrSpfStatus) Code() PrefixAttrCode {
+	return PrefixAttrCodeSpfStatus
+}
+
+func (p *PrefixAttrSpfStatus) serialize() ([]byte, error) {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint16(b[:2], uint16(p.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(1))
+	b[4] = uint8(p.Status)
+	return b, nil
+}
+
+func (p *PrefixAttrSpfStatus) deserialize(b []byte) error {
+	if len(b) != 1 {
+		return &errWithNotification{
+			error:   errors.New("PrefixAttrSpfStatus invalid length"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+	p.Status = SpfStatus(b[0])
+	return nil
+}
+
 // PathAttrMpReach is a path attribute.
 //
 // https://tools.ietf.org/html/rfc4760#section-3
 type PathAttrMpReach struct {
 	f    PathAttrFlags
+	raw  []byte
 	Afi  MultiprotoAfi
 	Safi MultiprotoSafi
-	Nlri []LinkStateNlri
+	// NextHop is an IPv4 or IPv6 address, it may be nil. A received next hop
+	// carrying both a global and link-local IPv6 address is decoded to the
+	// global address.
+	NextHop net.IP
+	Nlri    []LinkStateNlri
+	// RawNlri holds the undecoded nlri of a non bgp-ls address family listed
+	// in NeighborConfig.AddressFamilies, Nlri is empty in that case.
+	RawNlri []byte
 }
 
 /*
@@ -4104,6 +6675,21 @@ type PathAttrMpReach struct {
 	+---------------------------------------------------------+
 */
 func (p *PathAttrMpReach) deserialize(f PathAttrFlags, b []byte) error {
+	malformed, err := p.deserializeRecoverable(f, b, decodeOptions{})
+	if err != nil {
+		return err
+	}
+	if len(malformed) > 0 {
+		return malformed[0]
+	}
+
+	return nil
+}
+
+// deserializeRecoverable is deserialize but nlri that fail to decode while
+// the remaining nlri can still be located are skipped. Their errors are
+// returned in malformed.
+func (p *PathAttrMpReach) deserializeRecoverable(f PathAttrFlags, b []byte, opts decodeOptions) (malformed []error, err error) {
 	p.f = f
 
 	tooShortErr := &errWithNotification{
@@ -4113,7 +6699,7 @@ func (p *PathAttrMpReach) deserialize(f PathAttrFlags, b []byte) error {
 	}
 
 	if len(b) < 5 {
-		return tooShortErr
+		return nil, tooShortErr
 	}
 
 	p.Afi = MultiprotoAfi(binary.BigEndian.Uint16(b[:2]))
@@ -4121,24 +6707,50 @@ func (p *PathAttrMpReach) deserialize(f PathAttrFlags, b []byte) error {
 	nhLen := int(b[3])
 	b = b[4:]
 	if len(b) < nhLen+1 {
-		return tooShortErr
+		return nil, tooShortErr
+	}
+	switch nhLen {
+	case 4, 16:
+		p.NextHop = copyIP(b[:nhLen])
+	case 32:
+		p.NextHop = copyIP(b[:16])
 	}
 	b = b[nhLen+1:]
 
-	nlri, err := deserializeLinkStateNlri(p.Afi, p.Safi, b)
+	if opts.rawFamily(p.Afi, p.Safi) {
+		p.RawNlri = append([]byte{}, b...)
+		return nil, nil
+	}
+
+	nlri, malformed, err := deserializeLinkStateNlriRecoverable(p.Afi, p.Safi, b, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, n := range nlri {
 		p.Nlri = append(p.Nlri, n)
 	}
 
-	return nil
+	return malformed, nil
 }
 
-func deserializeLinkStateNlri(afi MultiprotoAfi, safi MultiprotoSafi, b []byte) ([]LinkStateNlri, error) {
-	if afi != BgpLsAfi || safi != BgpLsSafi {
-		return nil, &errWithNotification{
+func deserializeLinkStateNlri(afi MultiprotoAfi, safi MultiprotoSafi, b []byte, opts decodeOptions) ([]LinkStateNlri, error) {
+	nlri, malformed, err := deserializeLinkStateNlriRecoverable(afi, safi, b, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(malformed) > 0 {
+		return nil, malformed[0]
+	}
+
+	return nlri, nil
+}
+
+// deserializeLinkStateNlriRecoverable decodes the link state nlri in b. Nlri
+// with a valid type and length that fail to decode are skipped and their
+// errors returned in malformed. err is set if the nlri cannot be located.
+func deserializeLinkStateNlriRecoverable(afi MultiprotoAfi, safi MultiprotoSafi, b []byte, opts decodeOptions) (nlri []LinkStateNlri, malformed []error, err error) {
+	if !isBgpLsFamily(afi, safi) {
+		return nil, nil, &errWithNotification{
 			error:   errors.New("non bgp-ls afi/safi"),
 			code:    NotifErrCodeUpdateMessage,
 			subcode: NotifErrSubcodeMalformedAttr,
@@ -4152,21 +6764,28 @@ func deserializeLinkStateNlri(afi MultiprotoAfi, safi MultiprotoSafi, b []byte)
 	}
 
 	if len(b) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
-	if len(b) < 4 {
-		return nil, tooShortErr
+
+	// the safi is left unset for BgpLsSafi, see linkStateNlriSafi
+	var nlriSafi MultiprotoSafi
+	if safi != BgpLsSafi {
+		nlriSafi = safi
 	}
 
-	nlri := make([]LinkStateNlri, 0)
+	nlri = make([]LinkStateNlri, 0)
 
 	for {
+		if len(b) < 4 {
+			return nil, nil, tooShortErr
+		}
+
 		lsNlriType := binary.BigEndian.Uint16(b[:2])
 		lsNlriLen := int(binary.BigEndian.Uint16(b[2:4]))
 		b = b[4:]
 
 		if len(b) < lsNlriLen {
-			return nil, tooShortErr
+			return nil, nil, tooShortErr
 		}
 
 		NlriToDecode := b[:lsNlriLen]
@@ -4175,38 +6794,55 @@ func deserializeLinkStateNlri(afi MultiprotoAfi, safi MultiprotoSafi, b []byte)
 		switch lsNlriType {
 		case uint16(LinkStateNlriNodeType):
 			node := &LinkStateNlriNode{}
-			err := node.deserialize(NlriToDecode)
+			err := node.deserializeWithOptions(NlriToDecode, opts)
 			if err != nil {
-				return nil, err
+				malformed = append(malformed, err)
+				break
 			}
+			node.safi = nlriSafi
 			nlri = append(nlri, node)
 		case uint16(LinkStateNlriLinkType):
 			link := &LinkStateNlriLink{}
-			err := link.deserialize(NlriToDecode)
+			err := link.deserializeWithOptions(NlriToDecode, opts)
 			if err != nil {
-				return nil, err
+				malformed = append(malformed, err)
+				break
 			}
+			link.safi = nlriSafi
 			nlri = append(nlri, link)
 		case uint16(LinkStateNlriIPv4PrefixType):
 			prefix := &LinkStateNlriIPv4Prefix{}
-			err := prefix.deserialize(NlriToDecode)
+			err := prefix.deserializeWithOptions(NlriToDecode, opts)
 			if err != nil {
-				return nil, err
+				malformed = append(malformed, err)
+				break
 			}
+			prefix.safi = nlriSafi
 			nlri = append(nlri, prefix)
 		case uint16(LinkStateNlriIPv6PrefixType):
 			prefix := &LinkStateNlriIPv6Prefix{}
-			err := prefix.deserialize(NlriToDecode)
+			err := prefix.deserializeWithOptions(NlriToDecode, opts)
 			if err != nil {
-				return nil, err
+				malformed = append(malformed, err)
+				break
 			}
+			prefix.safi = nlriSafi
 			nlri = append(nlri, prefix)
+		case uint16(LinkStateNlriSRv6SIDType):
+			sid := &LinkStateNlriSRv6SID{}
+			err := sid.deserializeWithOptions(NlriToDecode, opts)
+			if err != nil {
+				malformed = append(malformed, err)
+				break
+			}
+			sid.safi = nlriSafi
+			nlri = append(nlri, sid)
 		default:
-			return nil, &errWithNotification{
+			malformed = append(malformed, &errWithNotification{
 				error:   errors.New("unknown link state nlri type"),
 				code:    NotifErrCodeUpdateMessage,
 				subcode: NotifErrSubcodeMalformedAttr,
-			}
+			})
 		}
 
 		if len(b) == 0 {
@@ -4214,51 +6850,45 @@ func deserializeLinkStateNlri(afi MultiprotoAfi, safi MultiprotoSafi, b []byte)
 		}
 	}
 
-	return nlri, nil
+	return nlri, malformed, nil
 }
 
 func (p *PathAttrMpReach) serialize() ([]byte, error) {
+	return serializeWithBuffer(p)
+}
+
+func (p *PathAttrMpReach) serializeInto(buf *bytes.Buffer) error {
 	p.f = PathAttrFlags{
 		Optional: true,
 	}
 
-	b := make([]byte, 0, 512)
-	for _, n := range p.Nlri {
-		nlri, err := n.serialize()
-		if err != nil {
-			return nil, err
-		}
-		b = append(b, nlri...)
+	nh := p.NextHop.To4()
+	if nh == nil {
+		nh = p.NextHop.To16()
 	}
-
-	// prepend reserved byte, nh len, safi, afi
-	b = append([]byte{0}, b...)
-	b = append([]byte{0}, b...)
-	b = append([]byte{byte(p.Safi)}, b...)
-	afi := make([]byte, 2)
-	binary.BigEndian.PutUint16(afi, uint16(p.Afi))
-	b = append(afi, b...)
-
-	if len(b) > math.MaxUint8 {
-		p.f.ExtendedLength = true
+	if nh == nil && p.NextHop != nil {
+		return errors.New("invalid mp reach next hop")
 	}
-	flags := p.f.serialize()
-
-	c := make([]byte, 2)
-	c[0] = flags
-	c[1] = byte(PathAttrMpReachType)
 
-	if p.f.ExtendedLength {
-		attrLen := make([]byte, 2)
-		binary.BigEndian.PutUint16(attrLen, uint16(len(b)))
-		c = append(c, attrLen...)
-	} else {
-		c = append(c, []byte{uint8(len(b))}...)
-	}
+	return serializePathAttrInto(buf, &p.f, PathAttrMpReachType, func() error {
+		// afi, safi, next hop length, next hop of up to 16 bytes and reserved byte
+		var h [21]byte
+		binary.BigEndian.PutUint16(h[:2], uint16(p.Afi))
+		h[2] = byte(p.Safi)
+		h[3] = uint8(len(nh))
+		copy(h[4:], nh)
+		buf.Write(h[:4+len(nh)+1])
 
-	c = append(c, b...)
+		for _, n := range p.Nlri {
+			err := serializeInto(buf, n)
+			if err != nil {
+				return err
+			}
+		}
+		buf.Write(p.RawNlri)
 
-	return c, nil
+		return nil
+	})
 }
 
 // Flags returns the PathAttrFlags for PathAttrMpReach.
@@ -4271,14 +6901,33 @@ func (p *PathAttrMpReach) Type() PathAttrType {
 	return PathAttrMpReachType
 }
 
+// RawBytes returns the on-wire encoding of PathAttrMpReach as received, including
+// the attribute header. It is nil unless CollectorConfig.RetainRawPathAttrs is set.
+func (p *PathAttrMpReach) RawBytes() []byte {
+	return p.raw
+}
+
 // PathAttrMpUnreach is a path attribute.
 //
+// An MP_UNREACH_NLRI without withdrawn routes does not withdraw all routes of
+// its address family, there is no such signal in BGP. When it is the only path
+// attribute of an update it is an End-of-RIB marker, see UpdateMessage.EndOfRIB
+// and EventNeighborEndOfRIB, which indicates that the initial routing update or
+// a route refresh is complete. The routes retained across a graceful restart
+// that were not re-advertised by then are reported by EventTopologyReconciled.
+//
 // https://tools.ietf.org/html/rfc4760#section-4
+// https://tools.ietf.org/html/rfc4724#section-2
 type PathAttrMpUnreach struct {
 	f    PathAttrFlags
+	raw  []byte
 	Afi  MultiprotoAfi
 	Safi MultiprotoSafi
 	Nlri []LinkStateNlri
+	// RawNlri holds the undecoded withdrawn routes of a non bgp-ls address
+	// family listed in NeighborConfig.AddressFamilies, Nlri is empty in that
+	// case.
+	RawNlri []byte
 }
 
 /*
@@ -4291,6 +6940,10 @@ type PathAttrMpUnreach struct {
 	+---------------------------------------------------------+
 */
 func (p *PathAttrMpUnreach) deserialize(f PathAttrFlags, b []byte) error {
+	return p.deserializeWithOptions(f, b, decodeOptions{})
+}
+
+func (p *PathAttrMpUnreach) deserializeWithOptions(f PathAttrFlags, b []byte, opts decodeOptions) error {
 	p.f = f
 
 	tooShortErr := &errWithNotification{
@@ -4307,7 +6960,12 @@ func (p *PathAttrMpUnreach) deserialize(f PathAttrFlags, b []byte) error {
 	p.Safi = MultiprotoSafi(b[2])
 	b = b[3:]
 
-	nlri, err := deserializeLinkStateNlri(p.Afi, p.Safi, b)
+	if opts.rawFamily(p.Afi, p.Safi) {
+		p.RawNlri = append([]byte{}, b...)
+		return nil
+	}
+
+	nlri, err := deserializeLinkStateNlri(p.Afi, p.Safi, b, opts)
 	if err != nil {
 		return err
 	}
@@ -4319,67 +6977,113 @@ func (p *PathAttrMpUnreach) deserialize(f PathAttrFlags, b []byte) error {
 }
 
 func (p *PathAttrMpUnreach) serialize() ([]byte, error) {
+	return serializeWithBuffer(p)
+}
+
+func (p *PathAttrMpUnreach) serializeInto(buf *bytes.Buffer) error {
 	p.f = PathAttrFlags{
 		Optional: true,
 	}
 
-	b := make([]byte, 0, 512)
-	for _, n := range p.Nlri {
-		nlri, err := n.serialize()
-		if err != nil {
-			return nil, err
-		}
-		b = append(b, nlri...)
-	}
+	return serializePathAttrInto(buf, &p.f, PathAttrMpUnreachType, func() error {
+		// afi and safi
+		var h [3]byte
+		binary.BigEndian.PutUint16(h[:2], uint16(p.Afi))
+		h[2] = byte(p.Safi)
+		buf.Write(h[:])
 
-	// prepend safi and afi
-	b = append([]byte{byte(p.Safi)}, b...)
-	afi := make([]byte, 2)
-	binary.BigEndian.PutUint16(afi, uint16(p.Afi))
-	b = append(afi, b...)
+		for _, n := range p.Nlri {
+			err := serializeInto(buf, n)
+			if err != nil {
+				return err
+			}
+		}
+		buf.Write(p.RawNlri)
 
-	if len(b) > math.MaxUint8 {
-		p.f.ExtendedLength = true
-	}
-	flags := p.f.serialize()
+		return nil
+	})
+}
 
-	c := make([]byte, 2)
-	c[0] = flags
-	c[1] = byte(PathAttrMpUnreachType)
-
-	if p.f.ExtendedLength {
-		attrLen := make([]byte, 2)
-		binary.BigEndian.PutUint16(attrLen, uint16(len(b)))
-		c = append(c, attrLen...)
-	} else {
-		c = append(c, []byte{uint8(len(b))}...)
-	}
-
-	c = append(c, b...)
-
-	return c, nil
-}
-
-// Flags returns the PathAttrFlags for PathAttrMpUnreach.
-func (p *PathAttrMpUnreach) Flags() PathAttrFlags {
-	return p.f
-}
+// Flags returns the PathAttrFlags for PathAttrMpUnreach.
+func (p *PathAttrMpUnreach) Flags() PathAttrFlags {
+	return p.f
+}
 
 // Type returns the appropriate PathAttrType for PathAttrMpUnreach.
 func (p *PathAttrMpUnreach) Type() PathAttrType {
 	return PathAttrMpUnreachType
 }
 
+// RawBytes returns the on-wire encoding of PathAttrMpUnreach as received, including
+// the attribute header. It is nil unless CollectorConfig.RetainRawPathAttrs is set.
+func (p *PathAttrMpUnreach) RawBytes() []byte {
+	return p.raw
+}
+
 // LinkStateNlri contains nlri of link-state type.
+//
+// Key() returns a canonical representation of the nlri's type, protocol,
+// identifier and descriptors suitable for use as a map key. Descriptor
+// ordering does not affect the key.
 type LinkStateNlri interface {
 	Type() LinkStateNlriType
 	Protocol() LinkStateNlriProtocolID
 	Afi() MultiprotoAfi
 	Safi() MultiprotoSafi
+	Key() string
 	serialize() ([]byte, error)
 	deserialize(b []byte) error
 }
 
+type tlvSerializer interface {
+	serialize() ([]byte, error)
+}
+
+// descriptorsKey returns the hex encoded serialized descriptors in sorted order.
+// Descriptors that fail to serialize are represented by their Go syntax.
+func descriptorsKey(descriptors []tlvSerializer) string {
+	keys := make([]string, 0, len(descriptors))
+	for _, d := range descriptors {
+		b, err := d.serialize()
+		if err != nil {
+			keys = append(keys, fmt.Sprintf("%#v", d))
+			continue
+		}
+		keys = append(keys, hex.EncodeToString(b))
+	}
+	sort.Strings(keys)
+
+	return strings.Join(keys, ",")
+}
+
+func nodeDescriptorsKey(descriptors []NodeDescriptor) string {
+	s := make([]tlvSerializer, 0, len(descriptors))
+	for _, d := range descriptors {
+		s = append(s, d)
+	}
+	return descriptorsKey(s)
+}
+
+// linkStateNlriKey returns the key of an nlri. Nlri received with a safi other
+// than BgpLsSafi, i.e. BgpLsSpfSafi, are distinct from those with identical
+// descriptors received with BgpLsSafi, so their keys are prefixed by the safi.
+func linkStateNlriKey(s MultiprotoSafi, t LinkStateNlriType, p LinkStateNlriProtocolID, id uint64, descriptors ...string) string {
+	key := fmt.Sprintf("%d:%d:%d:%s", t, p, id, strings.Join(descriptors, ":"))
+	if s != BgpLsSafi {
+		key = fmt.Sprintf("%d/%s", s, key)
+	}
+	return key
+}
+
+// linkStateNlriSafi returns the safi an nlri was received with, s is unset for
+// BgpLsSafi and for nlri that were not decoded.
+func linkStateNlriSafi(s MultiprotoSafi) MultiprotoSafi {
+	if s == 0 {
+		return BgpLsSafi
+	}
+	return s
+}
+
 // LinkStateNlriType describes the type of bgp-ls nlri.
 //
 // https://tools.ietf.org/html/rfc7752#section-3.2 figure 6
@@ -4392,6 +7096,8 @@ const (
 	LinkStateNlriLinkType
 	LinkStateNlriIPv4PrefixType
 	LinkStateNlriIPv6PrefixType
+	// https://www.rfc-editor.org/rfc/rfc9514#section-6
+	LinkStateNlriSRv6SIDType LinkStateNlriType = 6
 )
 
 // LinkStateNlriProtocolID describes the protocol of the link state nlri.
@@ -4411,13 +7117,57 @@ const (
 	LinkStateNlriBgpProtocolID
 )
 
+func (p LinkStateNlriProtocolID) String() string {
+	switch p {
+	case LinkStateNlriIsIsL1ProtocolID:
+		return "isis-l1"
+	case LinkStateNlriIsIsL2ProtocolID:
+		return "isis-l2"
+	case LinkStateNlriOSPFv2ProtocolID:
+		return "ospfv2"
+	case LinkStateNlriDirectProtocolID:
+		return "direct"
+	case LinkStateNlriStaticProtocolID:
+		return "static"
+	case LinkStateNlriOSPFv3ProtocolID:
+		return "ospfv3"
+	case LinkStateNlriBgpProtocolID:
+		return "bgp"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(p))
+	}
+}
+
+// IsIGP returns true if p is IS-IS or OSPF.
+func (p LinkStateNlriProtocolID) IsIGP() bool {
+	return p.IsIsIs() || p.IsOSPF()
+}
+
+// IsIsIs returns true if p is IS-IS level 1 or level 2.
+func (p LinkStateNlriProtocolID) IsIsIs() bool {
+	return p == LinkStateNlriIsIsL1ProtocolID || p == LinkStateNlriIsIsL2ProtocolID
+}
+
+// IsOSPF returns true if p is OSPFv2 or OSPFv3.
+func (p LinkStateNlriProtocolID) IsOSPF() bool {
+	return p == LinkStateNlriOSPFv2ProtocolID || p == LinkStateNlriOSPFv3ProtocolID
+}
+
+// IsBGP returns true if p is BGP, e.g. for BGP Egress Peer Engineering.
+func (p LinkStateNlriProtocolID) IsBGP() bool {
+	return p == LinkStateNlriBgpProtocolID
+}
+
 // LinkStateNlriNode is a link state nlri.
+// ID is the Identifier field, it distinguishes routing universes such as
+// IS-IS multi-instance (rfc8202) instances.
 //
 // https://tools.ietf.org/html/rfc7752#section-3.2 figure 7
 type LinkStateNlriNode struct {
 	ProtocolID           LinkStateNlriProtocolID
 	ID                   uint64
 	LocalNodeDescriptors []NodeDescriptor
+	safi                 MultiprotoSafi
 }
 
 // Type returns the appropriate LinkStateNlriType for LinkStateNlriNode
@@ -4435,9 +7185,15 @@ func (n *LinkStateNlriNode) Afi() MultiprotoAfi {
 	return BgpLsAfi
 }
 
-// Safi returns the appropriate MultiprotoAfi for LinkStateNlriNode
+// Safi returns the MultiprotoSafi LinkStateNlriNode was received with, BgpLsSafi unless
+// it was decoded from BgpLsSpfSafi
 func (n *LinkStateNlriNode) Safi() MultiprotoSafi {
-	return BgpLsSafi
+	return linkStateNlriSafi(n.safi)
+}
+
+// Key returns a canonical map key for LinkStateNlriNode
+func (n *LinkStateNlriNode) Key() string {
+	return linkStateNlriKey(n.Safi(), n.Type(), n.ProtocolID, n.ID, nodeDescriptorsKey(n.LocalNodeDescriptors))
 }
 
 // LinkStateNlriDescriptorCode describes the type of link state nlri.
@@ -4449,7 +7205,9 @@ const (
 	LinkStateNlriRemoteNodeDescriptorsDescriptorCode LinkStateNlriDescriptorCode = 257
 )
 
-func deserializeNodeDescriptors(protocolID LinkStateNlriProtocolID, b []byte) ([]NodeDescriptor, error) {
+// deserializeNodeDescriptors decodes the node descriptors in b. Unknown
+// descriptors are preserved as NodeDescriptorUnknown unless opts.strict is set.
+func deserializeNodeDescriptors(protocolID LinkStateNlriProtocolID, b []byte, opts decodeOptions) ([]NodeDescriptor, error) {
 	descriptors := make([]NodeDescriptor, 0)
 
 	tooShortErr := &errWithNotification{
@@ -4472,6 +7230,19 @@ func deserializeNodeDescriptors(protocolID LinkStateNlriProtocolID, b []byte) ([
 		descriptorToDecode := b[4 : 4+descriptorLen]
 		b = b[4+descriptorLen:]
 
+		if v, ok := newExtension(extensionNodeDescriptor, descriptorType); ok {
+			descriptor := &NodeDescriptorExtension{Type: NodeDescriptorCode(descriptorType), Value: v}
+			err := descriptor.deserialize(descriptorToDecode)
+			if err != nil {
+				return nil, err
+			}
+			descriptors = append(descriptors, descriptor)
+			if len(b) == 0 {
+				break
+			}
+			continue
+		}
+
 		switch descriptorType {
 		case uint16(NodeDescriptorCodeASN):
 			descriptor := &NodeDescriptorASN{}
@@ -4580,11 +7351,16 @@ func deserializeNodeDescriptors(protocolID LinkStateNlriProtocolID, b []byte) ([
 			}
 			descriptors = append(descriptors, descriptor)
 		default:
-			return nil, &errWithNotification{
-				error:   errors.New("unknown link state node descriptor code"),
-				code:    NotifErrCodeUpdateMessage,
-				subcode: NotifErrSubcodeMalformedAttr,
+			if opts.strict {
+				return nil, &errWithNotification{
+					error:   errors.New("unknown link state node descriptor code"),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
 			}
+			descriptor := &NodeDescriptorUnknown{Type: NodeDescriptorCode(descriptorType)}
+			descriptor.deserialize(descriptorToDecode)
+			descriptors = append(descriptors, descriptor)
 		}
 
 		if len(b) == 0 {
@@ -4608,6 +7384,10 @@ func deserializeNodeDescriptors(protocolID LinkStateNlriProtocolID, b []byte) ([
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 */
 func (n *LinkStateNlriNode) deserialize(b []byte) error {
+	return n.deserializeWithOptions(b, decodeOptions{})
+}
+
+func (n *LinkStateNlriNode) deserializeWithOptions(b []byte, opts decodeOptions) error {
 	tooShortErr := &errWithNotification{
 		error:   errors.New("link state node nlri too short"),
 		code:    NotifErrCodeUpdateMessage,
@@ -4640,7 +7420,7 @@ func (n *LinkStateNlriNode) deserialize(b []byte) error {
 	}
 	b = b[4:]
 
-	descriptors, err := deserializeNodeDescriptors(n.ProtocolID, b)
+	descriptors, err := deserializeNodeDescriptors(n.ProtocolID, b, opts)
 	if err != nil {
 		return err
 	}
@@ -4650,25 +7430,34 @@ func (n *LinkStateNlriNode) deserialize(b []byte) error {
 }
 
 func (n *LinkStateNlriNode) serialize() ([]byte, error) {
-	nodes := make([]byte, 0, 512)
+	return serializeWithBuffer(n)
+}
+
+func (n *LinkStateNlriNode) serializeInto(buf *bytes.Buffer) error {
+	nlri := beginTLV(buf, uint16(LinkStateNlriNodeType))
+	writeLinkStateNlriHeader(buf, n.ProtocolID, n.ID)
+
+	nodes := beginTLV(buf, uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode))
 	for _, d := range n.LocalNodeDescriptors {
-		e, err := d.serialize()
+		err := serializeInto(buf, d)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		nodes = append(nodes, e...)
 	}
+	endTLV(buf, nodes)
 
-	b := make([]byte, 17)
-	binary.BigEndian.PutUint16(b[:2], uint16(LinkStateNlriNodeType))
-	binary.BigEndian.PutUint16(b[2:], uint16(len(nodes)+13))
-	b[4] = uint8(n.ProtocolID)
-	binary.BigEndian.PutUint64(b[5:], n.ID)
-	binary.BigEndian.PutUint16(b[13:], uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode))
-	binary.BigEndian.PutUint16(b[15:], uint16(len(nodes)))
-	b = append(b, nodes...)
+	endTLV(buf, nlri)
 
-	return b, nil
+	return nil
+}
+
+// writeLinkStateNlriHeader writes the protocol ID and identifier common to all
+// link state nlri.
+func writeLinkStateNlriHeader(buf *bytes.Buffer, p LinkStateNlriProtocolID, id uint64) {
+	var h [9]byte
+	h[0] = uint8(p)
+	binary.BigEndian.PutUint64(h[1:], id)
+	buf.Write(h[:])
 }
 
 // NodeDescriptor is a bgp-ls nlri node descriptor.
@@ -4931,8 +7720,8 @@ func (n *NodeDescriptorIgpRouterIDOspfPseudo) deserialize(b []byte) error {
 		}
 	}
 
-	n.DrRouterID = net.IP(b[:4])
-	n.DrInterfaceToLAN = net.IP(b[4:])
+	n.DrRouterID = copyIP(b[:4])
+	n.DrInterfaceToLAN = copyIP(b[4:])
 	return nil
 }
 
@@ -5012,7 +7801,53 @@ func (n *NodeDescriptorMemberASN) serialize() ([]byte, error) {
 	return b, nil
 }
 
-func deserializeLinkDescriptors(id LinkStateNlriProtocolID, b []byte) ([]LinkDescriptor, error) {
+// NodeDescriptorUnknown is a node descriptor of a type that is not otherwise supported,
+// e.g. non-standard descriptors carrying an IS-IS multi-instance identifier.
+// Value is the raw descriptor value. Unknown node descriptors are preserved as they
+// contribute to the identity of the nlri.
+type NodeDescriptorUnknown struct {
+	Type  NodeDescriptorCode
+	Value []byte
+}
+
+// Code returns the NodeDescriptorCode for NodeDescriptorUnknown.
+func (n *NodeDescriptorUnknown) Code() NodeDescriptorCode {
+	return n.Type
+}
+
+func (n *NodeDescriptorUnknown) deserialize(b []byte) error {
+	n.Value = make([]byte, len(b))
+	copy(n.Value, b)
+	return nil
+}
+
+func (n *NodeDescriptorUnknown) serialize() ([]byte, error) {
+	return serializeBgpLsTLV(uint16(n.Type), n.Value), nil
+}
+
+// NodeDescriptorExtension is a node descriptor decoded by the TLVCodec registered with
+// RegisterNodeDescriptor.
+type NodeDescriptorExtension struct {
+	Type  NodeDescriptorCode
+	Value TLVCodec
+}
+
+// Code returns the NodeDescriptorCode for NodeDescriptorExtension.
+func (n *NodeDescriptorExtension) Code() NodeDescriptorCode {
+	return n.Type
+}
+
+func (n *NodeDescriptorExtension) deserialize(b []byte) error {
+	return deserializeExtension(extensionNodeDescriptor, uint16(n.Type), n.Value, b)
+}
+
+func (n *NodeDescriptorExtension) serialize() ([]byte, error) {
+	return serializeExtension(extensionNodeDescriptor, uint16(n.Type), n.Value)
+}
+
+// deserializeLinkDescriptors decodes the link descriptors in b. Unknown
+// descriptors are preserved as LinkDescriptorUnknown unless opts.strict is set.
+func deserializeLinkDescriptors(id LinkStateNlriProtocolID, b []byte, opts decodeOptions) ([]LinkDescriptor, error) {
 	descriptors := make([]LinkDescriptor, 0)
 
 	tooShortErr := &errWithNotification{
@@ -5035,6 +7870,19 @@ func deserializeLinkDescriptors(id LinkStateNlriProtocolID, b []byte) ([]LinkDes
 		descriptorToDecode := b[4 : 4+descriptorLen]
 		b = b[4+descriptorLen:]
 
+		if v, ok := newExtension(extensionLinkDescriptor, descriptorType); ok {
+			descriptor := &LinkDescriptorExtension{Type: LinkDescriptorCode(descriptorType), Value: v}
+			err := descriptor.deserialize(descriptorToDecode)
+			if err != nil {
+				return nil, err
+			}
+			descriptors = append(descriptors, descriptor)
+			if len(b) == 0 {
+				break
+			}
+			continue
+		}
+
 		switch descriptorType {
 		case uint16(LinkDescriptorCodeLinkIDs):
 			descriptor := &LinkDescriptorLinkIDs{}
@@ -5079,11 +7927,16 @@ func deserializeLinkDescriptors(id LinkStateNlriProtocolID, b []byte) ([]LinkDes
 			}
 			descriptors = append(descriptors, descriptor)
 		default:
-			return nil, &errWithNotification{
-				error:   errors.New("unknown link state link descriptor code"),
-				code:    NotifErrCodeUpdateMessage,
-				subcode: NotifErrSubcodeMalformedAttr,
+			if opts.strict {
+				return nil, &errWithNotification{
+					error:   errors.New("unknown link state link descriptor code"),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
 			}
+			descriptor := &LinkDescriptorUnknown{Type: LinkDescriptorCode(descriptorType)}
+			descriptor.deserialize(descriptorToDecode)
+			descriptors = append(descriptors, descriptor)
 		}
 
 		if len(b) == 0 {
@@ -5101,6 +7954,49 @@ type LinkDescriptor interface {
 	deserialize(b []byte) error
 }
 
+// LinkDescriptorUnknown is a link descriptor of a type that is not otherwise supported.
+// Value is the raw descriptor value. Unknown link descriptors are preserved as they
+// contribute to the identity of the nlri.
+type LinkDescriptorUnknown struct {
+	Type  LinkDescriptorCode
+	Value []byte
+}
+
+// Code returns the LinkDescriptorCode for LinkDescriptorUnknown.
+func (l *LinkDescriptorUnknown) Code() LinkDescriptorCode {
+	return l.Type
+}
+
+func (l *LinkDescriptorUnknown) deserialize(b []byte) error {
+	l.Value = make([]byte, len(b))
+	copy(l.Value, b)
+	return nil
+}
+
+func (l *LinkDescriptorUnknown) serialize() ([]byte, error) {
+	return serializeBgpLsTLV(uint16(l.Type), l.Value), nil
+}
+
+// LinkDescriptorExtension is a link descriptor decoded by the TLVCodec registered with
+// RegisterLinkDescriptor.
+type LinkDescriptorExtension struct {
+	Type  LinkDescriptorCode
+	Value TLVCodec
+}
+
+// Code returns the LinkDescriptorCode for LinkDescriptorExtension.
+func (l *LinkDescriptorExtension) Code() LinkDescriptorCode {
+	return l.Type
+}
+
+func (l *LinkDescriptorExtension) deserialize(b []byte) error {
+	return deserializeExtension(extensionLinkDescriptor, uint16(l.Type), l.Value, b)
+}
+
+func (l *LinkDescriptorExtension) serialize() ([]byte, error) {
+	return serializeExtension(extensionLinkDescriptor, uint16(l.Type), l.Value)
+}
+
 // LinkDescriptorCode describes the type of link descriptor.
 //
 // https://tools.ietf.org/html/rfc7752#section-3.2.2 table 5
@@ -5333,6 +8229,7 @@ type LinkStateNlriLink struct {
 	LocalNodeDescriptors  []NodeDescriptor
 	RemoteNodeDescriptors []NodeDescriptor
 	LinkDescriptors       []LinkDescriptor
+	safi                  MultiprotoSafi
 }
 
 // Type returns the appropriate LinkStateNlriType for LinkStateNlriLink
@@ -5350,9 +8247,23 @@ func (l *LinkStateNlriLink) Afi() MultiprotoAfi {
 	return BgpLsAfi
 }
 
-// Safi returns the appropriate MultiprotoAfi for LinkStateNlriLink
+// Safi returns the MultiprotoSafi LinkStateNlriLink was received with, BgpLsSafi unless
+// it was decoded from BgpLsSpfSafi
 func (l *LinkStateNlriLink) Safi() MultiprotoSafi {
-	return BgpLsSafi
+	return linkStateNlriSafi(l.safi)
+}
+
+// Key returns a canonical map key for LinkStateNlriLink
+func (l *LinkStateNlriLink) Key() string {
+	links := make([]tlvSerializer, 0, len(l.LinkDescriptors))
+	for _, d := range l.LinkDescriptors {
+		links = append(links, d)
+	}
+
+	return linkStateNlriKey(l.Safi(), l.Type(), l.ProtocolID, l.ID,
+		nodeDescriptorsKey(l.LocalNodeDescriptors),
+		nodeDescriptorsKey(l.RemoteNodeDescriptors),
+		descriptorsKey(links))
 }
 
 /*
@@ -5372,6 +8283,10 @@ func (l *LinkStateNlriLink) Safi() MultiprotoSafi {
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 */
 func (l *LinkStateNlriLink) deserialize(b []byte) error {
+	return l.deserializeWithOptions(b, decodeOptions{})
+}
+
+func (l *LinkStateNlriLink) deserializeWithOptions(b []byte, opts decodeOptions) error {
 	tooShortErr := &errWithNotification{
 		error:   errors.New("link state link nlri too short"),
 		code:    NotifErrCodeUpdateMessage,
@@ -5400,7 +8315,7 @@ func (l *LinkStateNlriLink) deserialize(b []byte) error {
 		return tooShortErr
 	}
 	b = b[4:]
-	localNodeDescriptors, err := deserializeNodeDescriptors(l.ProtocolID, b[:localNodeDescriptorsLen])
+	localNodeDescriptors, err := deserializeNodeDescriptors(l.ProtocolID, b[:localNodeDescriptorsLen], opts)
 	if err != nil {
 		return err
 	}
@@ -5424,7 +8339,7 @@ func (l *LinkStateNlriLink) deserialize(b []byte) error {
 		return tooShortErr
 	}
 	b = b[4:]
-	remoteNodeDescriptors, err := deserializeNodeDescriptors(l.ProtocolID, b[:remoteNodeDescriptorsLen])
+	remoteNodeDescriptors, err := deserializeNodeDescriptors(l.ProtocolID, b[:remoteNodeDescriptorsLen], opts)
 	if err != nil {
 		return err
 	}
@@ -5438,7 +8353,7 @@ func (l *LinkStateNlriLink) deserialize(b []byte) error {
 	if len(b) < 4 {
 		return tooShortErr
 	}
-	LinkDescriptors, err := deserializeLinkDescriptors(l.ProtocolID, b)
+	LinkDescriptors, err := deserializeLinkDescriptors(l.ProtocolID, b, opts)
 	if err != nil {
 		return err
 	}
@@ -5448,113 +8363,656 @@ func (l *LinkStateNlriLink) deserialize(b []byte) error {
 }
 
 func (l *LinkStateNlriLink) serialize() ([]byte, error) {
-	localNodes := make([]byte, 0, 512)
+	return serializeWithBuffer(l)
+}
+
+func (l *LinkStateNlriLink) serializeInto(buf *bytes.Buffer) error {
+	if len(l.LocalNodeDescriptors) == 0 {
+		return errors.New("link nlri must have at least 1 local node descriptor")
+	}
+	if len(l.RemoteNodeDescriptors) == 0 {
+		return errors.New("link nlri must have at least 1 remote node descriptor")
+	}
+
+	nlri := beginTLV(buf, uint16(LinkStateNlriLinkType))
+	writeLinkStateNlriHeader(buf, l.ProtocolID, l.ID)
+
+	// local nodes
+	localNodes := beginTLV(buf, uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode))
 	for _, d := range l.LocalNodeDescriptors {
-		e, err := d.serialize()
+		err := serializeInto(buf, d)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		localNodes = append(localNodes, e...)
 	}
-	remoteNodes := make([]byte, 0, 512)
+	endTLV(buf, localNodes)
+
+	// remote nodes
+	remoteNodes := beginTLV(buf, uint16(LinkStateNlriRemoteNodeDescriptorsDescriptorCode))
 	for _, d := range l.RemoteNodeDescriptors {
-		e, err := d.serialize()
+		err := serializeInto(buf, d)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		remoteNodes = append(remoteNodes, e...)
 	}
-	links := make([]byte, 0, 512)
+	endTLV(buf, remoteNodes)
+
+	// links
 	for _, d := range l.LinkDescriptors {
-		e, err := d.serialize()
+		err := serializeInto(buf, d)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		links = append(links, e...)
 	}
 
-	b := make([]byte, 17)
-	binary.BigEndian.PutUint16(b[:2], uint16(LinkStateNlriLinkType))
-	binary.BigEndian.PutUint16(b[2:], uint16(len(localNodes)+len(remoteNodes)+len(links)+17))
-	b[4] = uint8(l.ProtocolID)
-	binary.BigEndian.PutUint64(b[5:], l.ID)
+	endTLV(buf, nlri)
 
-	// local nodes
-	binary.BigEndian.PutUint16(b[13:], uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode))
-	binary.BigEndian.PutUint16(b[15:], uint16(len(localNodes)))
-	b = append(b, localNodes...)
+	return nil
+}
 
-	// remote nodes
-	r := make([]byte, 4)
-	binary.BigEndian.PutUint16(r[:2], uint16(LinkStateNlriRemoteNodeDescriptorsDescriptorCode))
-	binary.BigEndian.PutUint16(r[2:], uint16(len(remoteNodes)))
-	b = append(b, r...)
-	b = append(b, remoteNodes...)
+// LinkStateNlriIPv4Prefix is a link state nlri.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2 figure 9
+type LinkStateNlriIPv4Prefix struct {
+	LinkStateNlriPrefix
+}
 
-	// links
-	b = append(b, links...)
+// Type returns the appropriate LinkStateNlriType for LinkStateNlriIPv4Prefix
+func (l *LinkStateNlriIPv4Prefix) Type() LinkStateNlriType {
+	return LinkStateNlriIPv4PrefixType
+}
+
+func (l *LinkStateNlriIPv4Prefix) serialize() ([]byte, error) {
+	return serializeWithBuffer(l)
+}
+
+func (l *LinkStateNlriIPv4Prefix) serializeInto(buf *bytes.Buffer) error {
+	return l.LinkStateNlriPrefix.serializeInto(buf, l.Type())
+}
+
+// Key returns a canonical map key for LinkStateNlriIPv4Prefix
+func (l *LinkStateNlriIPv4Prefix) Key() string {
+	return l.LinkStateNlriPrefix.key(l.Type())
+}
+
+// LinkStateNlriIPv6Prefix is a link state nlri.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2 figure 9
+type LinkStateNlriIPv6Prefix struct {
+	LinkStateNlriPrefix
+}
+
+// Type returns the appropriate LinkStateNlriType for LinkStateNlriIPv6Prefix
+func (l *LinkStateNlriIPv6Prefix) Type() LinkStateNlriType {
+	return LinkStateNlriIPv6PrefixType
+}
+
+func (l *LinkStateNlriIPv6Prefix) serialize() ([]byte, error) {
+	return serializeWithBuffer(l)
+}
+
+func (l *LinkStateNlriIPv6Prefix) serializeInto(buf *bytes.Buffer) error {
+	return l.LinkStateNlriPrefix.serializeInto(buf, l.Type())
+}
+
+// Key returns a canonical map key for LinkStateNlriIPv6Prefix
+func (l *LinkStateNlriIPv6Prefix) Key() string {
+	return l.LinkStateNlriPrefix.key(l.Type())
+}
+
+// LinkStateNlriPrefix is a link state nlri.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2 figure 9
+type LinkStateNlriPrefix struct {
+	ProtocolID           LinkStateNlriProtocolID
+	ID                   uint64
+	LocalNodeDescriptors []NodeDescriptor
+	PrefixDescriptors    []PrefixDescriptor
+	safi                 MultiprotoSafi
+}
+
+// Protocol returns the appropriate LinkStateNlriProtocolID for LinkStateNlriPrefix
+func (l *LinkStateNlriPrefix) Protocol() LinkStateNlriProtocolID {
+	return l.ProtocolID
+}
+
+// Afi returns the appropriate MultiprotoAfi for LinkStateNlriPrefix
+func (l *LinkStateNlriPrefix) Afi() MultiprotoAfi {
+	return BgpLsAfi
+}
+
+// Safi returns the MultiprotoSafi LinkStateNlriPrefix was received with, BgpLsSafi unless
+// it was decoded from BgpLsSpfSafi
+func (l *LinkStateNlriPrefix) Safi() MultiprotoSafi {
+	return linkStateNlriSafi(l.safi)
+}
+
+func (l *LinkStateNlriPrefix) key(t LinkStateNlriType) string {
+	prefixes := make([]tlvSerializer, 0, len(l.PrefixDescriptors))
+	for _, d := range l.PrefixDescriptors {
+		prefixes = append(prefixes, d)
+	}
+
+	return linkStateNlriKey(l.Safi(), t, l.ProtocolID, l.ID,
+		nodeDescriptorsKey(l.LocalNodeDescriptors),
+		descriptorsKey(prefixes))
+}
+
+/*
+	0                   1                   2                   3
+	0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+
+	|  Protocol-ID  |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                           Identifier                          |
+	|                            (64 bits)                          |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	//              Local Node Descriptors (variable)              //
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	//                Prefix Descriptors (variable)                //
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+func (l *LinkStateNlriPrefix) deserialize(b []byte) error {
+	return l.deserializeWithOptions(b, decodeOptions{})
+}
+
+func (l *LinkStateNlriPrefix) deserializeWithOptions(b []byte, opts decodeOptions) error {
+	tooShortErr := &errWithNotification{
+		error:   errors.New("link state prefix nlri too short"),
+		code:    NotifErrCodeUpdateMessage,
+		subcode: NotifErrSubcodeMalformedAttr,
+	}
+
+	if len(b) < 13 {
+		return tooShortErr
+	}
+
+	l.ProtocolID = LinkStateNlriProtocolID(b[0])
+	l.ID = binary.BigEndian.Uint64(b[1:9])
+	b = b[9:]
+
+	// local node descriptors TLV, mandatory
+	if binary.BigEndian.Uint16(b[:2]) != uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode) {
+		return &errWithNotification{
+			error:   errors.New("link state prefix nlri local node descriptors tlv type invalid"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	localNodeDescriptorsLen := int(binary.BigEndian.Uint16(b[2:4]))
+	if len(b[4:]) < localNodeDescriptorsLen {
+		return tooShortErr
+	}
+	b = b[4:]
+	localNodeDescriptors, err := deserializeNodeDescriptors(l.ProtocolID, b[:localNodeDescriptorsLen], opts)
+	if err != nil {
+		return err
+	}
+	l.LocalNodeDescriptors = localNodeDescriptors
+	b = b[localNodeDescriptorsLen:]
+
+	// prefix descriptors, optional
+	if len(b) == 0 {
+		return nil
+	}
+	if len(b) < 4 {
+		return tooShortErr
+	}
+	PrefixDescriptors, err := deserializePrefixDescriptors(l.ProtocolID, b, opts)
+	if err != nil {
+		return err
+	}
+	l.PrefixDescriptors = PrefixDescriptors
+
+	return nil
+}
+
+func (l *LinkStateNlriPrefix) serialize(t LinkStateNlriType) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	err := l.serializeInto(buf, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+func (l *LinkStateNlriPrefix) serializeInto(buf *bytes.Buffer, t LinkStateNlriType) error {
+	nlri := beginTLV(buf, uint16(t))
+	writeLinkStateNlriHeader(buf, l.ProtocolID, l.ID)
+
+	// local nodes
+	localNodes := beginTLV(buf, uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode))
+	for _, d := range l.LocalNodeDescriptors {
+		err := serializeInto(buf, d)
+		if err != nil {
+			return err
+		}
+	}
+	endTLV(buf, localNodes)
+
+	// prefixes, the address family of ip reachability information is that
+	// of the nlri type rather than inferred from the address
+	for _, d := range l.PrefixDescriptors {
+		if r, isReachability := d.(*PrefixDescriptorIPReachabilityInfo); isReachability && (t == LinkStateNlriIPv4PrefixType || t == LinkStateNlriIPv6PrefixType) {
+			b, err := r.serializeFamily(t == LinkStateNlriIPv6PrefixType)
+			if err != nil {
+				return err
+			}
+			buf.Write(b)
+			continue
+		}
+		err := serializeInto(buf, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	endTLV(buf, nlri)
+
+	return nil
+}
+
+// PrefixDescriptor is a bgp-ls prefix descriptor.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2.3
+type PrefixDescriptor interface {
+	Code() PrefixDescriptorCode
+	serialize() ([]byte, error)
+	deserialize(b []byte) error
+}
+
+// PrefixDescriptorUnknown is a prefix descriptor of a type that is not otherwise supported.
+// Value is the raw descriptor value. Unknown prefix descriptors are preserved as they
+// contribute to the identity of the nlri.
+type PrefixDescriptorUnknown struct {
+	Type  PrefixDescriptorCode
+	Value []byte
+}
+
+// Code returns the PrefixDescriptorCode for PrefixDescriptorUnknown.
+func (p *PrefixDescriptorUnknown) Code() PrefixDescriptorCode {
+	return p.Type
+}
+
+func (p *PrefixDescriptorUnknown) deserialize(b []byte) error {
+	p.Value = make([]byte, len(b))
+	copy(p.Value, b)
+	return nil
+}
+
+func (p *PrefixDescriptorUnknown) serialize() ([]byte, error) {
+	return serializeBgpLsTLV(uint16(p.Type), p.Value), nil
+}
+
+// PrefixDescriptorExtension is a prefix descriptor decoded by the TLVCodec registered with
+// RegisterPrefixDescriptor.
+type PrefixDescriptorExtension struct {
+	Type  PrefixDescriptorCode
+	Value TLVCodec
+}
+
+// Code returns the PrefixDescriptorCode for PrefixDescriptorExtension.
+func (p *PrefixDescriptorExtension) Code() PrefixDescriptorCode {
+	return p.Type
+}
+
+func (p *PrefixDescriptorExtension) deserialize(b []byte) error {
+	return deserializeExtension(extensionPrefixDescriptor, uint16(p.Type), p.Value, b)
+}
+
+func (p *PrefixDescriptorExtension) serialize() ([]byte, error) {
+	return serializeExtension(extensionPrefixDescriptor, uint16(p.Type), p.Value)
+}
+
+// PrefixDescriptorCode describes the type of prefix descriptor.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2.3
+type PrefixDescriptorCode uint16
+
+// PrefixDescriptorCode values
+const (
+	PrefixDescriptorCodeMultiTopologyID    PrefixDescriptorCode = 263
+	PrefixDescriptorCodeOspfRouteType      PrefixDescriptorCode = 264
+	PrefixDescriptorCodeIPReachabilityInfo PrefixDescriptorCode = 265
+)
+
+// deserializePrefixDescriptors decodes the prefix descriptors in b. Unknown
+// descriptors are preserved as PrefixDescriptorUnknown unless opts.strict is set.
+func deserializePrefixDescriptors(id LinkStateNlriProtocolID, b []byte, opts decodeOptions) ([]PrefixDescriptor, error) {
+	descriptors := make([]PrefixDescriptor, 0)
+
+	tooShortErr := &errWithNotification{
+		error:   errors.New("link state prefix descriptors too short"),
+		code:    NotifErrCodeUpdateMessage,
+		subcode: NotifErrSubcodeMalformedAttr,
+	}
+
+	for {
+		if len(b) < 4 {
+			return nil, tooShortErr
+		}
+
+		descriptorType := binary.BigEndian.Uint16(b[:2])
+		descriptorLen := int(binary.BigEndian.Uint16(b[2:4]))
+		if len(b[4:]) < descriptorLen {
+			return nil, tooShortErr
+		}
+
+		descriptorToDecode := b[4 : 4+descriptorLen]
+		b = b[4+descriptorLen:]
+
+		if v, ok := newExtension(extensionPrefixDescriptor, descriptorType); ok {
+			descriptor := &PrefixDescriptorExtension{Type: PrefixDescriptorCode(descriptorType), Value: v}
+			err := descriptor.deserialize(descriptorToDecode)
+			if err != nil {
+				return nil, err
+			}
+			descriptors = append(descriptors, descriptor)
+			if len(b) == 0 {
+				break
+			}
+			continue
+		}
+
+		switch descriptorType {
+		case uint16(PrefixDescriptorCodeMultiTopologyID):
+			descriptor := &PrefixDescriptorMultiTopologyID{}
+			err := descriptor.deserialize(descriptorToDecode)
+			if err != nil {
+				return nil, err
+			}
+			descriptors = append(descriptors, descriptor)
+		case uint16(PrefixDescriptorCodeOspfRouteType):
+			// the route type is meaningless for nlri of other protocols, it is
+			// otherwise reported by validateUpdateLinkStateAttrs
+			if opts.strict && !nlriProtocolIsOspf(id) {
+				return nil, &errWithNotification{
+					error:   fmt.Errorf("ospf route type prefix descriptor in nlri of non-ospf protocol %s", id),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
+			}
+			descriptor := &PrefixDescriptorOspfRouteType{}
+			err := descriptor.deserialize(descriptorToDecode)
+			if err != nil {
+				return nil, err
+			}
+			descriptors = append(descriptors, descriptor)
+		case uint16(PrefixDescriptorCodeIPReachabilityInfo):
+			descriptor := &PrefixDescriptorIPReachabilityInfo{}
+			err := descriptor.deserialize(descriptorToDecode)
+			if err != nil {
+				return nil, err
+			}
+			descriptors = append(descriptors, descriptor)
+		default:
+			if opts.strict {
+				return nil, &errWithNotification{
+					error:   errors.New("unknown link state prefix descriptor code"),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
+			}
+			descriptor := &PrefixDescriptorUnknown{Type: PrefixDescriptorCode(descriptorType)}
+			descriptor.deserialize(descriptorToDecode)
+			descriptors = append(descriptors, descriptor)
+		}
+
+		if len(b) == 0 {
+			break
+		}
+	}
+
+	return descriptors, nil
+}
+
+// PrefixDescriptorMultiTopologyID is a prefix descriptor contained in a bgp-ls nlri.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2.1.5
+type PrefixDescriptorMultiTopologyID struct {
+	IDs []uint16
+}
+
+// Code returns the appropriate PrefixDescriptorCode for PrefixDescriptorMultiTopologyID.
+func (p *PrefixDescriptorMultiTopologyID) Code() PrefixDescriptorCode {
+	return PrefixDescriptorCodeMultiTopologyID
+}
+
+func (p *PrefixDescriptorMultiTopologyID) deserialize(b []byte) error {
+	ids, err := deserializeMultiTopologyIDs(b)
+	if err != nil {
+		return err
+	}
+
+	p.IDs = ids
+	return nil
+}
+
+func (p *PrefixDescriptorMultiTopologyID) serialize() ([]byte, error) {
+	return serializeMultiTopologyIDs(uint16(p.Code()), p.IDs)
+}
+
+// PrefixDescriptorOspfRouteType is a prefix descriptor contained in a bgp-ls nlri.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2.3.1
+type PrefixDescriptorOspfRouteType struct {
+	RouteType OspfRouteType
+}
+
+// OspfRouteType describes the type of ospf route.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2.3.1
+type OspfRouteType uint8
+
+// OspfRouteType values
+const (
+	_ OspfRouteType = iota
+	OspfRouteTypeIntraArea
+	OspfRouteTypeInterArea
+	OspfRouteTypeExternal1
+	OspfRouteTypeExternal2
+	OspfRouteTypeNSSA1
+	OspfRouteTypeNSSA2
+)
+
+func (o OspfRouteType) String() string {
+	switch o {
+	case OspfRouteTypeIntraArea:
+		return "intra-area"
+	case OspfRouteTypeInterArea:
+		return "inter-area"
+	case OspfRouteTypeExternal1:
+		return "external-1"
+	case OspfRouteTypeExternal2:
+		return "external-2"
+	case OspfRouteTypeNSSA1:
+		return "nssa-1"
+	case OspfRouteTypeNSSA2:
+		return "nssa-2"
+	default:
+		return "unknown"
+	}
+}
+
+// IsExternal returns true if the route type is external, including nssa external.
+func (o OspfRouteType) IsExternal() bool {
+	switch o {
+	case OspfRouteTypeExternal1, OspfRouteTypeExternal2, OspfRouteTypeNSSA1, OspfRouteTypeNSSA2:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsIntraArea returns true if the route type is intra-area.
+func (o OspfRouteType) IsIntraArea() bool {
+	return o == OspfRouteTypeIntraArea
+}
+
+func (p *PrefixDescriptorOspfRouteType) String() string {
+	return p.RouteType.String()
+}
+
+// Code returns the appropriate PrefixDescriptorCode for PrefixDescriptorOspfRouteType.
+func (p *PrefixDescriptorOspfRouteType) Code() PrefixDescriptorCode {
+	return PrefixDescriptorCodeOspfRouteType
+}
+
+func (p *PrefixDescriptorOspfRouteType) deserialize(b []byte) error {
+	if len(b) != 1 {
+		return &errWithNotification{
+			error:   errors.New("invalid ospf route type prefix descriptor length"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	rt := int(b[0])
+	if rt < 1 || rt > 6 {
+		return &errWithNotification{
+			error:   errors.New("invalid ospf route type prefix descriptor value"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	p.RouteType = OspfRouteType(rt)
+	return nil
+}
+
+func (p *PrefixDescriptorOspfRouteType) serialize() ([]byte, error) {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint16(b[:2], uint16(p.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(1))
+	b[4] = uint8(p.RouteType)
+	return b, nil
+}
+
+// PrefixDescriptorIPReachabilityInfo is a prefix descriptor contained in a bgp-ls nlri.
+//
+// https://tools.ietf.org/html/rfc7752#section-3.2.3.2
+type PrefixDescriptorIPReachabilityInfo struct {
+	PrefixLength uint8
+	Prefix       net.IP
+}
+
+// Code returns the appropriate PrefixDescriptorCode for PrefixDescriptorIPReachabilityInfo.
+func (p *PrefixDescriptorIPReachabilityInfo) Code() PrefixDescriptorCode {
+	return PrefixDescriptorCodeIPReachabilityInfo
+}
+
+func (p *PrefixDescriptorIPReachabilityInfo) deserialize(b []byte) error {
+	if len(b) != 5 && len(b) != 17 {
+		return &errWithNotification{
+			error:   errors.New("invalid ip reachability info prefix descriptor"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+
+	p.PrefixLength = b[0]
+	b = b[1:]
+	p.Prefix = copyIP(b)
+	return nil
+}
+
+func (p *PrefixDescriptorIPReachabilityInfo) serialize() ([]byte, error) {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint16(b[:2], uint16(p.Code()))
+	b[4] = p.PrefixLength
+
+	addr := p.Prefix.To4()
+	if addr == nil {
+		addr = p.Prefix.To16()
+		if addr == nil {
+			return nil, errors.New("invalid address")
+		}
+		binary.BigEndian.PutUint16(b[2:], uint16(17))
+		b = append(b, addr...)
+		return b, nil
+	}
+	binary.BigEndian.PutUint16(b[2:], uint16(5))
+	b = append(b, addr...)
 
 	return b, nil
 }
 
-// LinkStateNlriIPv4Prefix is a link state nlri.
-//
-// https://tools.ietf.org/html/rfc7752#section-3.2 figure 9
-type LinkStateNlriIPv4Prefix struct {
-	LinkStateNlriPrefix
-}
-
-// Type returns the appropriate LinkStateNlriType for LinkStateNlriIPv4Prefix
-func (l *LinkStateNlriIPv4Prefix) Type() LinkStateNlriType {
-	return LinkStateNlriIPv4PrefixType
-}
-
-func (l *LinkStateNlriIPv4Prefix) serialize() ([]byte, error) {
-	return l.LinkStateNlriPrefix.serialize(l.Type())
-}
-
-// LinkStateNlriIPv6Prefix is a link state nlri.
-//
-// https://tools.ietf.org/html/rfc7752#section-3.2 figure 9
-type LinkStateNlriIPv6Prefix struct {
-	LinkStateNlriPrefix
-}
+// serializeFamily is serialize with the address family forced to IPv6 if ipv6
+// is set, otherwise IPv4, as serialize infers IPv4 from an IPv4-mapped IPv6
+// address. The prefix length must not exceed the length of the address.
+func (p *PrefixDescriptorIPReachabilityInfo) serializeFamily(ipv6 bool) ([]byte, error) {
+	addr := p.Prefix.To4()
+	if ipv6 {
+		addr = p.Prefix.To16()
+	}
+	if addr == nil {
+		return nil, fmt.Errorf("invalid address for ip reachability info of ipv6=%t prefix nlri: %s", ipv6, p.Prefix)
+	}
+	if int(p.PrefixLength) > len(addr)*8 {
+		return nil, fmt.Errorf("ip reachability info prefix length %d exceeds address length", p.PrefixLength)
+	}
 
-// Type returns the appropriate LinkStateNlriType for LinkStateNlriIPv6Prefix
-func (l *LinkStateNlriIPv6Prefix) Type() LinkStateNlriType {
-	return LinkStateNlriIPv6PrefixType
-}
+	b := make([]byte, 5, 5+len(addr))
+	binary.BigEndian.PutUint16(b[:2], uint16(p.Code()))
+	binary.BigEndian.PutUint16(b[2:], uint16(1+len(addr)))
+	b[4] = p.PrefixLength
 
-func (l *LinkStateNlriIPv6Prefix) serialize() ([]byte, error) {
-	return l.LinkStateNlriPrefix.serialize(l.Type())
+	return append(b, addr...), nil
 }
 
-// LinkStateNlriPrefix is a link state nlri.
+// LinkStateNlriSRv6SID is a link state nlri identifying an SRv6 SID of the
+// node described by LocalNodeDescriptors. The LINK_STATE attribute accompanying
+// it is decoded as node attributes, SRv6 SID attribute TLVs are preserved as
+// NodeAttrUnknown.
 //
-// https://tools.ietf.org/html/rfc7752#section-3.2 figure 9
-type LinkStateNlriPrefix struct {
+// https://www.rfc-editor.org/rfc/rfc9514#section-6
+type LinkStateNlriSRv6SID struct {
 	ProtocolID           LinkStateNlriProtocolID
 	ID                   uint64
 	LocalNodeDescriptors []NodeDescriptor
-	PrefixDescriptors    []PrefixDescriptor
+	SRv6SIDDescriptors   []SRv6SIDDescriptor
+	safi                 MultiprotoSafi
 }
 
-// Protocol returns the appropriate LinkStateNlriProtocolID for LinkStateNlriPrefix
-func (l *LinkStateNlriPrefix) Protocol() LinkStateNlriProtocolID {
+// Type returns the appropriate LinkStateNlriType for LinkStateNlriSRv6SID
+func (l *LinkStateNlriSRv6SID) Type() LinkStateNlriType {
+	return LinkStateNlriSRv6SIDType
+}
+
+// Protocol returns the appropriate LinkStateNlriProtocolID for LinkStateNlriSRv6SID
+func (l *LinkStateNlriSRv6SID) Protocol() LinkStateNlriProtocolID {
 	return l.ProtocolID
 }
 
-// Afi returns the appropriate MultiprotoAfi for LinkStateNlriPrefix
-func (l *LinkStateNlriPrefix) Afi() MultiprotoAfi {
+// Afi returns the appropriate MultiprotoAfi for LinkStateNlriSRv6SID
+func (l *LinkStateNlriSRv6SID) Afi() MultiprotoAfi {
 	return BgpLsAfi
 }
 
-// Safi returns the appropriate MultiprotoAfi for LinkStateNlriPrefix
-func (l *LinkStateNlriPrefix) Safi() MultiprotoSafi {
-	return BgpLsSafi
+// Safi returns the MultiprotoSafi LinkStateNlriSRv6SID was received with, BgpLsSafi unless
+// it was decoded from BgpLsSpfSafi
+func (l *LinkStateNlriSRv6SID) Safi() MultiprotoSafi {
+	return linkStateNlriSafi(l.safi)
+}
+
+// Key returns a canonical map key for LinkStateNlriSRv6SID
+func (l *LinkStateNlriSRv6SID) Key() string {
+	sids := make([]tlvSerializer, 0, len(l.SRv6SIDDescriptors))
+	for _, d := range l.SRv6SIDDescriptors {
+		sids = append(sids, d)
+	}
+
+	return linkStateNlriKey(l.Safi(), l.Type(), l.ProtocolID, l.ID,
+		nodeDescriptorsKey(l.LocalNodeDescriptors),
+		descriptorsKey(sids))
 }
 
 /*
+	https://www.rfc-editor.org/rfc/rfc9514#section-6
 	0                   1                   2                   3
 	0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 	+-+-+-+-+-+-+-+-+
@@ -5563,14 +9021,18 @@ func (l *LinkStateNlriPrefix) Safi() MultiprotoSafi {
 	|                           Identifier                          |
 	|                            (64 bits)                          |
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-	//              Local Node Descriptors (variable)              //
+	//               Local Node Descriptors (variable)             //
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-	//                Prefix Descriptors (variable)                //
+	//                SRv6 SID Descriptors (variable)              //
 	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 */
-func (l *LinkStateNlriPrefix) deserialize(b []byte) error {
+func (l *LinkStateNlriSRv6SID) deserialize(b []byte) error {
+	return l.deserializeWithOptions(b, decodeOptions{})
+}
+
+func (l *LinkStateNlriSRv6SID) deserializeWithOptions(b []byte, opts decodeOptions) error {
 	tooShortErr := &errWithNotification{
-		error:   errors.New("link state prefix nlri too short"),
+		error:   errors.New("link state srv6 sid nlri too short"),
 		code:    NotifErrCodeUpdateMessage,
 		subcode: NotifErrSubcodeMalformedAttr,
 	}
@@ -5586,7 +9048,7 @@ func (l *LinkStateNlriPrefix) deserialize(b []byte) error {
 	// local node descriptors TLV, mandatory
 	if binary.BigEndian.Uint16(b[:2]) != uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode) {
 		return &errWithNotification{
-			error:   errors.New("link state prefix nlri local node descriptors tlv type invalid"),
+			error:   errors.New("link state srv6 sid nlri local node descriptors tlv type invalid"),
 			code:    NotifErrCodeUpdateMessage,
 			subcode: NotifErrSubcodeMalformedAttr,
 		}
@@ -5597,90 +9059,119 @@ func (l *LinkStateNlriPrefix) deserialize(b []byte) error {
 		return tooShortErr
 	}
 	b = b[4:]
-	localNodeDescriptors, err := deserializeNodeDescriptors(l.ProtocolID, b[:localNodeDescriptorsLen])
+	localNodeDescriptors, err := deserializeNodeDescriptors(l.ProtocolID, b[:localNodeDescriptorsLen], opts)
 	if err != nil {
 		return err
 	}
 	l.LocalNodeDescriptors = localNodeDescriptors
 	b = b[localNodeDescriptorsLen:]
 
-	// prefix descriptors, optional
-	if len(b) == 0 {
-		return nil
-	}
+	// srv6 sid descriptors, the srv6 sid information tlv is mandatory
 	if len(b) < 4 {
 		return tooShortErr
 	}
-	PrefixDescriptors, err := deserializePrefixDescriptors(l.ProtocolID, b)
+	sidDescriptors, err := deserializeSRv6SIDDescriptors(b, opts)
 	if err != nil {
 		return err
 	}
-	l.PrefixDescriptors = PrefixDescriptors
+	var sidInfo bool
+	for _, d := range sidDescriptors {
+		if _, ok := d.(*SRv6SIDDescriptorSIDInformation); ok {
+			sidInfo = true
+		}
+	}
+	if !sidInfo {
+		return &errWithNotification{
+			error:   errors.New("link state srv6 sid nlri missing srv6 sid information tlv"),
+			code:    NotifErrCodeUpdateMessage,
+			subcode: NotifErrSubcodeMalformedAttr,
+		}
+	}
+	l.SRv6SIDDescriptors = sidDescriptors
 
 	return nil
 }
 
-func (l *LinkStateNlriPrefix) serialize(t LinkStateNlriType) ([]byte, error) {
-	localNodes := make([]byte, 0, 512)
+func (l *LinkStateNlriSRv6SID) serialize() ([]byte, error) {
+	return serializeWithBuffer(l)
+}
+
+func (l *LinkStateNlriSRv6SID) serializeInto(buf *bytes.Buffer) error {
+	nlri := beginTLV(buf, uint16(LinkStateNlriSRv6SIDType))
+	writeLinkStateNlriHeader(buf, l.ProtocolID, l.ID)
+
+	localNodes := beginTLV(buf, uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode))
 	for _, d := range l.LocalNodeDescriptors {
-		e, err := d.serialize()
+		err := serializeInto(buf, d)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		localNodes = append(localNodes, e...)
 	}
-	prefixes := make([]byte, 0, 512)
-	for _, d := range l.PrefixDescriptors {
-		e, err := d.serialize()
+	endTLV(buf, localNodes)
+
+	for _, d := range l.SRv6SIDDescriptors {
+		err := serializeInto(buf, d)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		prefixes = append(prefixes, e...)
 	}
 
-	b := make([]byte, 17)
-	binary.BigEndian.PutUint16(b[:2], uint16(t))
-	binary.BigEndian.PutUint16(b[2:], uint16(len(localNodes)+len(prefixes)+13))
-	b[4] = uint8(l.ProtocolID)
-	binary.BigEndian.PutUint64(b[5:], l.ID)
+	endTLV(buf, nlri)
 
-	// local nodes
-	binary.BigEndian.PutUint16(b[13:], uint16(LinkStateNlriLocalNodeDescriptorsDescriptorCode))
-	binary.BigEndian.PutUint16(b[15:], uint16(len(localNodes)))
-	b = append(b, localNodes...)
-
-	// prefixes
-	b = append(b, prefixes...)
-
-	return b, nil
+	return nil
 }
 
-// PrefixDescriptor is a bgp-ls prefix descriptor.
+// SRv6SIDDescriptor is a bgp-ls srv6 sid descriptor. SRv6 SID descriptors
+// identify the SID of an SRv6 SID nlri.
 //
-// https://tools.ietf.org/html/rfc7752#section-3.2.3
-type PrefixDescriptor interface {
-	Code() PrefixDescriptorCode
+// https://www.rfc-editor.org/rfc/rfc9514#section-6
+type SRv6SIDDescriptor interface {
+	Code() SRv6SIDDescriptorCode
 	serialize() ([]byte, error)
 	deserialize(b []byte) error
 }
 
-// PrefixDescriptorCode describes the type of prefix descriptor.
+// SRv6SIDDescriptorCode describes the type of srv6 sid descriptor.
 //
-// https://tools.ietf.org/html/rfc7752#section-3.2.3
-type PrefixDescriptorCode uint16
+// https://www.rfc-editor.org/rfc/rfc9514#section-6
+type SRv6SIDDescriptorCode uint16
 
-// PrefixDescriptorCode values
+// SRv6SIDDescriptorCode values
 const (
-	PrefixDescriptorCodeMultiTopologyID    PrefixDescriptorCode = 263
-	PrefixDescriptorCodeOspfRouteType      PrefixDescriptorCode = 264
-	PrefixDescriptorCodeIPReachabilityInfo PrefixDescriptorCode = 265
+	SRv6SIDDescriptorCodeMultiTopologyID SRv6SIDDescriptorCode = 263
+	SRv6SIDDescriptorCodeSIDInformation  SRv6SIDDescriptorCode = 518
 )
 
-func deserializePrefixDescriptors(id LinkStateNlriProtocolID, b []byte) ([]PrefixDescriptor, error) {
-	descriptors := make([]PrefixDescriptor, 0)
+// SRv6SIDDescriptorUnknown is an srv6 sid descriptor of a type that is not otherwise supported.
+// Value is the raw descriptor value. Unknown srv6 sid descriptors are preserved as they
+// contribute to the identity of the nlri.
+type SRv6SIDDescriptorUnknown struct {
+	Type  SRv6SIDDescriptorCode
+	Value []byte
+}
+
+// Code returns the SRv6SIDDescriptorCode for SRv6SIDDescriptorUnknown.
+func (s *SRv6SIDDescriptorUnknown) Code() SRv6SIDDescriptorCode {
+	return s.Type
+}
+
+func (s *SRv6SIDDescriptorUnknown) deserialize(b []byte) error {
+	s.Value = make([]byte, len(b))
+	copy(s.Value, b)
+	return nil
+}
+
+func (s *SRv6SIDDescriptorUnknown) serialize() ([]byte, error) {
+	return serializeBgpLsTLV(uint16(s.Type), s.Value), nil
+}
+
+// deserializeSRv6SIDDescriptors decodes the srv6 sid descriptors in b. Unknown
+// descriptors are preserved as SRv6SIDDescriptorUnknown unless opts.strict is set.
+func deserializeSRv6SIDDescriptors(b []byte, opts decodeOptions) ([]SRv6SIDDescriptor, error) {
+	descriptors := make([]SRv6SIDDescriptor, 0)
 
 	tooShortErr := &errWithNotification{
-		error:   errors.New("link state prefix descriptors too short"),
+		error:   errors.New("link state srv6 sid descriptors too short"),
 		code:    NotifErrCodeUpdateMessage,
 		subcode: NotifErrSubcodeMalformedAttr,
 	}
@@ -5700,33 +9191,31 @@ func deserializePrefixDescriptors(id LinkStateNlriProtocolID, b []byte) ([]Prefi
 		b = b[4+descriptorLen:]
 
 		switch descriptorType {
-		case uint16(PrefixDescriptorCodeMultiTopologyID):
-			descriptor := &PrefixDescriptorMultiTopologyID{}
-			err := descriptor.deserialize(descriptorToDecode)
-			if err != nil {
-				return nil, err
-			}
-			descriptors = append(descriptors, descriptor)
-		case uint16(PrefixDescriptorCodeOspfRouteType):
-			descriptor := &PrefixDescriptorOspfRouteType{}
+		case uint16(SRv6SIDDescriptorCodeMultiTopologyID):
+			descriptor := &SRv6SIDDescriptorMultiTopologyID{}
 			err := descriptor.deserialize(descriptorToDecode)
 			if err != nil {
 				return nil, err
 			}
 			descriptors = append(descriptors, descriptor)
-		case uint16(PrefixDescriptorCodeIPReachabilityInfo):
-			descriptor := &PrefixDescriptorIPReachabilityInfo{}
+		case uint16(SRv6SIDDescriptorCodeSIDInformation):
+			descriptor := &SRv6SIDDescriptorSIDInformation{}
 			err := descriptor.deserialize(descriptorToDecode)
 			if err != nil {
 				return nil, err
 			}
 			descriptors = append(descriptors, descriptor)
 		default:
-			return nil, &errWithNotification{
-				error:   errors.New("unknown link state prefix descriptor code"),
-				code:    NotifErrCodeUpdateMessage,
-				subcode: NotifErrSubcodeMalformedAttr,
+			if opts.strict {
+				return nil, &errWithNotification{
+					error:   errors.New("unknown link state srv6 sid descriptor code"),
+					code:    NotifErrCodeUpdateMessage,
+					subcode: NotifErrSubcodeMalformedAttr,
+				}
 			}
+			descriptor := &SRv6SIDDescriptorUnknown{Type: SRv6SIDDescriptorCode(descriptorType)}
+			descriptor.deserialize(descriptorToDecode)
+			descriptors = append(descriptors, descriptor)
 		}
 
 		if len(b) == 0 {
@@ -5737,137 +9226,64 @@ func deserializePrefixDescriptors(id LinkStateNlriProtocolID, b []byte) ([]Prefi
 	return descriptors, nil
 }
 
-// PrefixDescriptorMultiTopologyID is a prefix descriptor contained in a bgp-ls nlri.
+// SRv6SIDDescriptorMultiTopologyID is an srv6 sid descriptor contained in a bgp-ls nlri.
 //
-// https://tools.ietf.org/html/rfc7752#section-3.2.1.5
-type PrefixDescriptorMultiTopologyID struct {
+// https://www.rfc-editor.org/rfc/rfc9514#section-6
+type SRv6SIDDescriptorMultiTopologyID struct {
 	IDs []uint16
 }
 
-// Code returns the appropriate PrefixDescriptorCode for PrefixDescriptorMultiTopologyID.
-func (p *PrefixDescriptorMultiTopologyID) Code() PrefixDescriptorCode {
-	return PrefixDescriptorCodeMultiTopologyID
+// Code returns the appropriate SRv6SIDDescriptorCode for SRv6SIDDescriptorMultiTopologyID.
+func (s *SRv6SIDDescriptorMultiTopologyID) Code() SRv6SIDDescriptorCode {
+	return SRv6SIDDescriptorCodeMultiTopologyID
 }
 
-func (p *PrefixDescriptorMultiTopologyID) deserialize(b []byte) error {
+func (s *SRv6SIDDescriptorMultiTopologyID) deserialize(b []byte) error {
 	ids, err := deserializeMultiTopologyIDs(b)
 	if err != nil {
 		return err
 	}
 
-	p.IDs = ids
-	return nil
-}
-
-func (p *PrefixDescriptorMultiTopologyID) serialize() ([]byte, error) {
-	return serializeMultiTopologyIDs(uint16(p.Code()), p.IDs)
-}
-
-// PrefixDescriptorOspfRouteType is a prefix descriptor contained in a bgp-ls nlri.
-//
-// https://tools.ietf.org/html/rfc7752#section-3.2.3.1
-type PrefixDescriptorOspfRouteType struct {
-	RouteType OspfRouteType
-}
-
-// OspfRouteType describes the type of ospf route.
-//
-// https://tools.ietf.org/html/rfc7752#section-3.2.3.1
-type OspfRouteType uint8
-
-// OspfRouteType values
-const (
-	_ OspfRouteType = iota
-	OspfRouteTypeIntraArea
-	OspfRouteTypeInterArea
-	OspfRouteTypeExternal1
-	OspfRouteTypeExternal2
-	OspfRouteTypeNSSA1
-	OspfRouteTypeNSSA2
-)
-
-// Code returns the appropriate PrefixDescriptorCode for PrefixDescriptorOspfRouteType.
-func (p *PrefixDescriptorOspfRouteType) Code() PrefixDescriptorCode {
-	return PrefixDescriptorCodeOspfRouteType
-}
-
-func (p *PrefixDescriptorOspfRouteType) deserialize(b []byte) error {
-	if len(b) != 1 {
-		return &errWithNotification{
-			error:   errors.New("invalid ospf route type prefix descriptor length"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
-	}
-
-	rt := int(b[0])
-	if rt < 1 || rt > 6 {
-		return &errWithNotification{
-			error:   errors.New("invalid ospf route type prefix descriptor value"),
-			code:    NotifErrCodeUpdateMessage,
-			subcode: NotifErrSubcodeMalformedAttr,
-		}
-	}
-
-	p.RouteType = OspfRouteType(rt)
+	s.IDs = ids
 	return nil
 }
 
-func (p *PrefixDescriptorOspfRouteType) serialize() ([]byte, error) {
-	b := make([]byte, 5)
-	binary.BigEndian.PutUint16(b[:2], uint16(p.Code()))
-	binary.BigEndian.PutUint16(b[2:], uint16(1))
-	b[4] = uint8(p.RouteType)
-	return b, nil
+func (s *SRv6SIDDescriptorMultiTopologyID) serialize() ([]byte, error) {
+	return serializeMultiTopologyIDs(uint16(s.Code()), s.IDs)
 }
 
-// PrefixDescriptorIPReachabilityInfo is a prefix descriptor contained in a bgp-ls nlri.
+// SRv6SIDDescriptorSIDInformation is an srv6 sid descriptor contained in a bgp-ls nlri.
+// SID is the 16 octet SRv6 SID.
 //
-// https://tools.ietf.org/html/rfc7752#section-3.2.3.2
-type PrefixDescriptorIPReachabilityInfo struct {
-	PrefixLength uint8
-	Prefix       net.IP
+// https://www.rfc-editor.org/rfc/rfc9514#section-6.1
+type SRv6SIDDescriptorSIDInformation struct {
+	SID net.IP
 }
 
-// Code returns the appropriate PrefixDescriptorCode for PrefixDescriptorIPReachabilityInfo.
-func (p *PrefixDescriptorIPReachabilityInfo) Code() PrefixDescriptorCode {
-	return PrefixDescriptorCodeIPReachabilityInfo
+// Code returns the appropriate SRv6SIDDescriptorCode for SRv6SIDDescriptorSIDInformation.
+func (s *SRv6SIDDescriptorSIDInformation) Code() SRv6SIDDescriptorCode {
+	return SRv6SIDDescriptorCodeSIDInformation
 }
 
-func (p *PrefixDescriptorIPReachabilityInfo) deserialize(b []byte) error {
-	if len(b) != 5 && len(b) != 17 {
+func (s *SRv6SIDDescriptorSIDInformation) deserialize(b []byte) error {
+	if len(b) != 16 {
 		return &errWithNotification{
-			error:   errors.New("invalid ip reachability info prefix descriptor"),
+			error:   errors.New("invalid length for SRv6SIDDescriptorSIDInformation"),
 			code:    NotifErrCodeUpdateMessage,
 			subcode: NotifErrSubcodeMalformedAttr,
 		}
 	}
 
-	p.PrefixLength = b[0]
-	b = b[1:]
-	p.Prefix = net.IP(b)
+	s.SID = copyIP(b)
 	return nil
 }
 
-func (p *PrefixDescriptorIPReachabilityInfo) serialize() ([]byte, error) {
-	b := make([]byte, 5)
-	binary.BigEndian.PutUint16(b[:2], uint16(p.Code()))
-	b[4] = p.PrefixLength
-
-	addr := p.Prefix.To4()
-	if addr == nil {
-		addr = p.Prefix.To16()
-		if addr == nil {
-			return nil, errors.New("invalid address")
-		}
-		binary.BigEndian.PutUint16(b[2:], uint16(17))
-		b = append(b, addr...)
-		return b, nil
+func (s *SRv6SIDDescriptorSIDInformation) serialize() ([]byte, error) {
+	sid := s.SID.To16()
+	if sid == nil {
+		return nil, errors.New("invalid SID for SRv6SIDDescriptorSIDInformation")
 	}
-	binary.BigEndian.PutUint16(b[2:], uint16(5))
-	b = append(b, addr...)
-
-	return b, nil
+	return serializeBgpLsTLV(uint16(s.Code()), sid), nil
 }
 
 // PathAttrOrigin is a path attribute.
@@ -5875,6 +9291,7 @@ func (p *PrefixDescriptorIPReachabilityInfo) serialize() ([]byte, error) {
 // https://tools.ietf.org/html/rfc4271#section-5.1.1
 type PathAttrOrigin struct {
 	f      PathAttrFlags
+	raw    []byte
 	Origin OriginCode
 }
 
@@ -5888,6 +9305,12 @@ func (o *PathAttrOrigin) Type() PathAttrType {
 	return PathAttrOriginType
 }
 
+// RawBytes returns the on-wire encoding of PathAttrOrigin as received, including
+// the attribute header. It is nil unless CollectorConfig.RetainRawPathAttrs is set.
+func (o *PathAttrOrigin) RawBytes() []byte {
+	return o.raw
+}
+
 func (o *PathAttrOrigin) serialize() ([]byte, error) {
 	if o.Origin > 2 {
 		return nil, errors.New("invalid origin code value")
@@ -5949,9 +9372,13 @@ func (o OriginCode) String() string {
 	}
 }
 
-// AsPathSegment is contained in an as-path path attribute
+// AsPathSegment is contained in an as-path path attribute.
+// Equal returns true if the segment is equivalent to o, a set is equal to
+// another set containing the same asns irrespective of order and duplicates,
+// a sequence is equal to another sequence with the same asns in the same order.
 type AsPathSegment interface {
 	Type() AsPathSegmentType
+	Equal(o AsPathSegment) bool
 	serialize() ([]byte, error)
 	deserialize(b []byte) error
 }
@@ -5975,6 +9402,33 @@ func (a *AsPathSegmentSet) Type() AsPathSegmentType {
 	return AsPathSegmentSetType
 }
 
+// Equal returns true if o is an AsPathSegmentSet containing the same asns as a,
+// irrespective of order and duplicates.
+func (a *AsPathSegmentSet) Equal(o AsPathSegment) bool {
+	b, ok := o.(*AsPathSegmentSet)
+	if !ok {
+		return false
+	}
+
+	asns := make(map[uint16]bool, len(a.Set))
+	for _, asn := range a.Set {
+		asns[asn] = false
+	}
+	for _, asn := range b.Set {
+		if _, found := asns[asn]; !found {
+			return false
+		}
+		asns[asn] = true
+	}
+	for _, matched := range asns {
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (a *AsPathSegmentSet) serialize() ([]byte, error) {
 	b := make([]byte, 2)
 	b[0] = byte(AsPathSegmentSetType)
@@ -6013,6 +9467,23 @@ func (a *AsPathSegmentSequence) Type() AsPathSegmentType {
 	return AsPathSegmentSequenceType
 }
 
+// Equal returns true if o is an AsPathSegmentSequence containing the same asns
+// as a in the same order.
+func (a *AsPathSegmentSequence) Equal(o AsPathSegment) bool {
+	b, ok := o.(*AsPathSegmentSequence)
+	if !ok || len(a.Sequence) != len(b.Sequence) {
+		return false
+	}
+
+	for i, asn := range a.Sequence {
+		if b.Sequence[i] != asn {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (a *AsPathSegmentSequence) serialize() ([]byte, error) {
 	b := make([]byte, 2)
 	b[0] = byte(AsPathSegmentSequenceType)
@@ -6065,6 +9536,7 @@ func deserializeAsPathSegment(b []byte) ([]uint16, error) {
 // https://tools.ietf.org/html/rfc4271#section-5.1.2
 type PathAttrAsPath struct {
 	f        PathAttrFlags
+	raw      []byte
 	Segments []AsPathSegment
 }
 
@@ -6078,6 +9550,28 @@ func (a *PathAttrAsPath) Type() PathAttrType {
 	return PathAttrAsPathType
 }
 
+// RawBytes returns the on-wire encoding of PathAttrAsPath as received, including
+// the attribute header. It is nil unless CollectorConfig.RetainRawPathAttrs is set.
+func (a *PathAttrAsPath) RawBytes() []byte {
+	return a.raw
+}
+
+// Equal returns true if o contains segments equal to those of a in the same
+// order, see AsPathSegment.Equal.
+func (a *PathAttrAsPath) Equal(o *PathAttrAsPath) bool {
+	if len(a.Segments) != len(o.Segments) {
+		return false
+	}
+
+	for i, s := range a.Segments {
+		if !s.Equal(o.Segments[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (a *PathAttrAsPath) serialize() ([]byte, error) {
 	a.f = PathAttrFlags{
 		Transitive: true,
@@ -6179,6 +9673,7 @@ func (a *PathAttrAsPath) deserialize(f PathAttrFlags, b []byte) error {
 // https://tools.ietf.org/html/rfc4271#section-5.1.5
 type PathAttrLocalPref struct {
 	f          PathAttrFlags
+	raw        []byte
 	Preference uint32
 }
 
@@ -6192,6 +9687,12 @@ func (p *PathAttrLocalPref) Type() PathAttrType {
 	return PathAttrLocalPrefType
 }
 
+// RawBytes returns the on-wire encoding of PathAttrLocalPref as received, including
+// the attribute header. It is nil unless CollectorConfig.RetainRawPathAttrs is set.
+func (p *PathAttrLocalPref) RawBytes() []byte {
+	return p.raw
+}
+
 func (p *PathAttrLocalPref) serialize() ([]byte, error) {
 	p.f = PathAttrFlags{
 		Transitive: true,
@@ -1,8 +1,13 @@
 package bgpls
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -35,6 +40,32 @@ func TestPrefixAttrSourceRouterID(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestPrefixAttrFlexAlgoPrefixMetric(t *testing.T) {
+	p := &PrefixAttrFlexAlgoPrefixMetric{}
+	assert.Equal(t, p.Code(), PrefixAttrCodeFlexAlgoPrefixMetric)
+
+	// invalid len
+	err := p.deserialize([]byte{})
+	assert.NotNil(t, err)
+
+	err = p.deserialize([]byte{128, 128, 0, 0, 0, 0, 0, 10})
+	assert.Nil(t, err)
+	assert.Equal(t, p.Algorithm, uint8(128))
+	assert.True(t, p.External)
+	assert.Equal(t, p.Metric, uint32(10))
+
+	b, err := p.serialize()
+	if assert.Nil(t, err) {
+		assert.Equal(t, b, []byte{4, 20, 0, 8, 128, 128, 0, 0, 0, 0, 0, 10})
+	}
+
+	p.External = false
+	b, err = p.serialize()
+	if assert.Nil(t, err) {
+		assert.Equal(t, b[5], uint8(0))
+	}
+}
+
 func TestPrefixAttrFlagsIsIs(t *testing.T) {
 	p := &PrefixAttrFlagsIsIs{}
 	assert.Equal(t, p.Code(), PrefixAttrCodeFlags)
@@ -120,7 +151,25 @@ func TestPrefixAttrRange(t *testing.T) {
 	err = p.deserialize([]byte{0, 0, 0, 0, 4, 128, 0, 1, 1}, LinkStateNlriIsIsL1ProtocolID)
 	assert.NotNil(t, err)
 
+	// prefix sid flags must match the protocol of the range flags
+	p.Flags = &PrefixAttrRangeFlagsIsIs{}
+	p.PrefixSID = []*PrefixAttrPrefixSID{
+		{Flags: &PrefixAttrPrefixSIDFlagsOspf{}, SIDIndexLabel: &SIDIndexLabelLabel{Label: 2}},
+	}
+	_, err = p.serialize()
+	assert.NotNil(t, err)
+	p.Flags = &PrefixAttrRangeFlagsOspf{}
+	b, err := p.serialize()
+	if assert.Nil(t, err) {
+		err = p.deserialize(b[4:], LinkStateNlriOSPFv2ProtocolID)
+		assert.Nil(t, err)
+	}
+	p.PrefixSID[0].Flags = &PrefixAttrPrefixSIDFlagsIsIs{}
+	_, err = p.serialize()
+	assert.NotNil(t, err)
+
 	// err serializing prefix sid
+	p.Flags = &PrefixAttrRangeFlagsIsIs{}
 	p.PrefixSID = []*PrefixAttrPrefixSID{
 		&PrefixAttrPrefixSID{
 			Flags: nil,
@@ -221,11 +270,44 @@ func TestLinkAttrL2BundleMember(t *testing.T) {
 	l := &LinkAttrL2BundleMember{}
 
 	// err deserializing attrs
-	err := l.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0}, 0)
+	err := l.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0}, 0, decodeOptions{strict: true})
 	assert.NotNil(t, err)
 
+	// unknown attrs preserved
+	err = l.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0}, 0, decodeOptions{})
+	if assert.Nil(t, err) && assert.Len(t, l.LinkAttrs, 1) {
+		assert.Equal(t, l.LinkAttrs[0], &LinkAttrUnknown{Type: 0, Value: []byte{}})
+	}
+	l.LinkAttrs = nil
+
 	// invalid attrs
-	err = l.deserialize([]byte{0, 0, 0, 0, 1, 7, 0, 2, 0, 1}, LinkStateNlriOSPFv2ProtocolID)
+	err = l.deserialize([]byte{0, 0, 0, 0, 1, 7, 0, 2, 0, 1}, LinkStateNlriOSPFv2ProtocolID, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// nested attrs are confined to the member's length
+	sibling := []byte{4, 71, 0, 3, 0, 0, 20}
+	member := []byte{4, 148, 0, 11, 0, 0, 0, 1, 4, 71, 0, 3, 0, 0, 10}
+	_, links, _, err := deserializeLinkStateAttrs(append(member, sibling...), LinkStateNlriIsIsL2ProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	if assert.Nil(t, err) && assert.Len(t, links, 2) {
+		assert.Equal(t, links[0], &LinkAttrL2BundleMember{
+			MemberDescriptor: 1,
+			LinkAttrs:        []LinkAttr{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsWideType, Metric: 10}},
+		})
+		assert.Equal(t, links[1], &LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsWideType, Metric: 20})
+	}
+
+	// truncated member, sub-tlv extends beyond the member's length
+	truncated := append([]byte{}, member...)
+	truncated[3] = 9
+	_, _, _, err = deserializeLinkStateAttrs(append(truncated, sibling...), LinkStateNlriIsIsL2ProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	assert.NotNil(t, err)
+	err = l.deserialize(truncated[4:13], LinkStateNlriIsIsL2ProtocolID, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// member ends with a partial sub-tlv header
+	partial := append(append([]byte{}, member...), 4, 71)
+	partial[3] = 13
+	_, _, _, err = deserializeLinkStateAttrs(append(partial, sibling...), LinkStateNlriIsIsL2ProtocolID, LinkStateNlriLinkType, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err serializing link attrs
@@ -242,6 +324,116 @@ func TestFloat32Serialization(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestBandwidthBitsPerSecond(t *testing.T) {
+	l := &LinkAttrMaxLinkBandwidth{}
+
+	// 10Gbps is exactly representable
+	l.SetBitsPerSecond(10000000000)
+	assert.Equal(t, l.BytesPerSecond, float32(1250000000))
+	bps, err := l.BitsPerSecond()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bps, uint64(10000000000))
+
+	// 100Gbps is rounded to the nearest float32 and round trips after
+	// serialization
+	l.SetBitsPerSecond(100000000000)
+	b, err := l.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &LinkAttrMaxLinkBandwidth{}
+	err = m.deserialize(b[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bps, err = m.BitsPerSecond()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bps, uint64(99999997952))
+
+	// precision is lost beyond the float32 significand
+	l.SetBitsPerSecond(400000000000)
+	bps, err = l.BitsPerSecond()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bps, uint64(399999991808))
+	assert.InEpsilon(t, 400000000000, bps, 1.0/(1<<24))
+
+	// invalid values
+	l.BytesPerSecond = -1
+	_, err = l.BitsPerSecond()
+	assert.NotNil(t, err)
+	l.BytesPerSecond = float32(math.NaN())
+	_, err = l.BitsPerSecond()
+	assert.NotNil(t, err)
+	l.BytesPerSecond = float32(math.Inf(1))
+	_, err = l.BitsPerSecond()
+	assert.NotNil(t, err)
+	l.BytesPerSecond = math.MaxFloat32
+	_, err = l.BitsPerSecond()
+	assert.NotNil(t, err)
+
+	u := &LinkAttrUnreservedBandwidth{}
+	u.SetBitsPerSecond([8]uint64{1, 8, 16, 1000, 10000000000})
+	ubps, err := u.BitsPerSecond()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ubps, [8]uint64{1, 8, 16, 1000, 10000000000})
+	u.BytesPerSecond[7] = -1
+	_, err = u.BitsPerSecond()
+	assert.NotNil(t, err)
+}
+
+func TestLinkAttrIgpMetric(t *testing.T) {
+	cases := []struct {
+		attr    *LinkAttrIgpMetric
+		wire    []byte
+		wantErr bool
+	}{
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsSmallType, Metric: 0}, []byte{0}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsSmallType, Metric: 63}, []byte{0x3f}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsSmallType, Metric: 64}, nil, true},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricOspfType, Metric: 0}, []byte{0, 0}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricOspfType, Metric: 256}, []byte{1, 0}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricOspfType, Metric: 65535}, []byte{0xff, 0xff}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricOspfType, Metric: 65536}, nil, true},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsWideType, Metric: 0}, []byte{0, 0, 0}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsWideType, Metric: 65536}, []byte{1, 0, 0}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsWideType, Metric: 1<<24 - 1}, []byte{0xff, 0xff, 0xff}, false},
+		{&LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsWideType, Metric: 1 << 24}, nil, true},
+		{&LinkAttrIgpMetric{Type: 3}, nil, true},
+	}
+
+	for _, c := range cases {
+		b, err := c.attr.serialize()
+		if c.wantErr {
+			assert.NotNil(t, err)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, b[4:], c.wire)
+
+		// the type is preserved by the width regardless of the value
+		d := &LinkAttrIgpMetric{}
+		err = d.deserialize(b[4:])
+		assert.Nil(t, err)
+		assert.Equal(t, d, c.attr)
+	}
+
+	// the two most significant bits of an is-is small metric are ignored
+	d := &LinkAttrIgpMetric{}
+	err := d.deserialize([]byte{0xc1})
+	assert.Nil(t, err)
+	assert.Equal(t, d, &LinkAttrIgpMetric{Type: LinkAttrIgpMetricIsIsSmallType, Metric: 1})
+}
+
 func TestLinkAttrUniPacketLoss(t *testing.T) {
 	// overflows 3 octets
 	l := &LinkAttrUniPacketLoss{
@@ -276,6 +468,34 @@ func TestLinkAttrMinMaxUniLinkDelay(t *testing.T) {
 	l.MinDelay = time.Microsecond * 1 << 25
 	_, err = l.serialize()
 	assert.NotNil(t, err)
+
+	// A-flag set, min 1000us, max 0xffffff us
+	encoded := []byte{4, 91, 0, 8, 128, 0, 3, 232, 0, 255, 255, 255}
+	l = &LinkAttrMinMaxUniLinkDelay{}
+	err = l.deserialize(encoded[4:])
+	if assert.Nil(t, err) {
+		assert.True(t, l.Anomalous)
+		assert.Equal(t, l.MinDelay, time.Microsecond*1000)
+		assert.Equal(t, l.MaxDelay, time.Microsecond*maxUint24)
+	}
+	b, err := l.serialize()
+	if assert.Nil(t, err) {
+		assert.Equal(t, b, encoded)
+	}
+
+	// the A-flag does not leak into either delay, and the reserved octets
+	// are ignored on receipt
+	err = l.deserialize([]byte{255, 255, 255, 255, 255, 0, 0, 1})
+	if assert.Nil(t, err) {
+		assert.True(t, l.Anomalous)
+		assert.Equal(t, l.MinDelay, time.Microsecond*maxUint24)
+		assert.Equal(t, l.MaxDelay, time.Microsecond)
+	}
+	l.Anomalous = false
+	b, err = l.serialize()
+	if assert.Nil(t, err) {
+		assert.Equal(t, b[4:], []byte{0, 255, 255, 255, 0, 0, 0, 1})
+	}
 }
 
 func TestLinkAttrUniLinkDelay(t *testing.T) {
@@ -295,6 +515,10 @@ func TestMicrosecondDelaySerialization(t *testing.T) {
 	// overflows 3 octets
 	_, err = serializeMicrosecondDelay(time.Microsecond * 1 << 25)
 	assert.NotNil(t, err)
+
+	// negative
+	_, err = serializeMicrosecondDelay(-time.Microsecond)
+	assert.NotNil(t, err)
 }
 
 func TestLinkAttrPeerSetSID(t *testing.T) {
@@ -366,6 +590,126 @@ func TestLinkAttrPeerNodeSID(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestLinkAttrSRv6EndXSID(t *testing.T) {
+	l := &LinkAttrSRv6EndXSID{}
+	assert.Equal(t, l.Code(), LinkAttrCodeSRv6EndXSID)
+
+	// invalid len
+	err := l.deserialize([]byte{})
+	assert.NotNil(t, err)
+
+	// invalid sub-TLV
+	b := make([]byte, 23)
+	err = l.deserialize(b)
+	assert.NotNil(t, err)
+
+	// invalid SID
+	l = &LinkAttrSRv6EndXSID{}
+	_, err = l.serialize()
+	assert.NotNil(t, err)
+
+	// err serializing SRv6SIDStructure
+	l.SID = net.ParseIP("2001:db8::1")
+	l.SIDStructure = &SRv6SIDStructure{LocatorBlockLength: 255}
+	_, err = l.serialize()
+	assert.NotNil(t, err)
+
+	l = &LinkAttrSRv6EndXSID{
+		EndpointBehavior: 0x0039,
+		Backup:           true,
+		Set:              true,
+		Persistent:       true,
+		Algorithm:        128,
+		Weight:           10,
+		SID:              net.ParseIP("2001:db8::1"),
+		SIDStructure: &SRv6SIDStructure{
+			LocatorBlockLength: 40,
+			LocatorNodeLength:  24,
+			FunctionLength:     16,
+		},
+	}
+	b, err = l.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, linkAttrs, _, err := deserializeLinkStateAttrs(b, LinkStateNlriBgpProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, linkAttrs, 1) {
+		assert.Equal(t, linkAttrs[0], l)
+	}
+}
+
+func TestEndpointBehavior(t *testing.T) {
+	assert.Equal(t, "End.DT4", EndpointBehaviorEndDT4.String())
+	assert.Equal(t, "End.X with PSP & USP", EndpointBehavior(8).String())
+	assert.Equal(t, "unknown(13)", EndpointBehavior(13).String())
+	assert.True(t, EndpointBehaviorOpaque.Known())
+	assert.False(t, EndpointBehavior(0).Known())
+	assert.False(t, EndpointBehavior(0x0039).Known())
+}
+
+func TestLinkAttrSRv6PeerNodeSID(t *testing.T) {
+	l := &LinkAttrSRv6PeerNodeSID{}
+	assert.Equal(t, l.Code(), LinkAttrCodeSRv6PeerNodeSID)
+
+	// invalid len
+	err := l.deserialize([]byte{})
+	assert.NotNil(t, err)
+
+	// invalid peer router ID
+	_, err = l.serialize()
+	assert.NotNil(t, err)
+
+	l = &LinkAttrSRv6PeerNodeSID{
+		Backup:       true,
+		Set:          true,
+		Persistent:   true,
+		Weight:       10,
+		PeerASN:      64512,
+		PeerRouterID: net.ParseIP("172.16.0.1").To4(),
+	}
+	b, err := l.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, linkAttrs, _, err := deserializeLinkStateAttrs(b, LinkStateNlriBgpProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, linkAttrs, 1) {
+		assert.Equal(t, linkAttrs[0], l)
+	}
+}
+
+func TestNodeAttrSRv6EndpointBehavior(t *testing.T) {
+	n := &NodeAttrSRv6EndpointBehavior{}
+	assert.Equal(t, n.Code(), NodeAttrCodeSRv6EndpointBehavior)
+
+	// invalid len
+	err := n.deserialize([]byte{0, 1, 0})
+	assert.NotNil(t, err)
+
+	n = &NodeAttrSRv6EndpointBehavior{
+		EndpointBehavior: EndpointBehaviorEndDT46,
+		Flags:            0x80,
+		Algorithm:        128,
+	}
+	b, err := n.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b, []byte{0x04, 0xe2, 0, 4, 0, 20, 0x80, 128})
+	nodeAttrs, _, _, err := deserializeLinkStateAttrs(b, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriSRv6SIDType, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, nodeAttrs, 1) {
+		assert.Equal(t, nodeAttrs[0], n)
+	}
+}
+
 func TestLinkAttrLanAdjSID(t *testing.T) {
 	l := &LinkAttrLanAdjSID{}
 
@@ -557,6 +901,100 @@ func TestSIDIndexLabel(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestDeserializeExactLength(t *testing.T) {
+	cases := []struct {
+		name  string
+		fn    func(b []byte) error
+		valid []int
+	}{
+		{"LinkAttrAdjSID", func(b []byte) error {
+			return (&LinkAttrAdjSID{}).deserialize(b, LinkStateNlriOSPFv2ProtocolID)
+		}, []int{7, 8}},
+		{"LinkAttrLanAdjSID ospf", func(b []byte) error {
+			return (&LinkAttrLanAdjSID{}).deserialize(b, LinkStateNlriOSPFv2ProtocolID)
+		}, []int{11, 12}},
+		{"LinkAttrLanAdjSID isis", func(b []byte) error {
+			return (&LinkAttrLanAdjSID{}).deserialize(b, LinkStateNlriIsIsL2ProtocolID)
+		}, []int{13, 14}},
+		{"LinkAttrPeerNodeSID", (&LinkAttrPeerNodeSID{}).deserialize, []int{7, 8}},
+		{"LinkAttrPeerAdjSID", (&LinkAttrPeerAdjSID{}).deserialize, []int{7, 8}},
+		{"LinkAttrPeerSetSID", (&LinkAttrPeerSetSID{}).deserialize, []int{7, 8}},
+		{"PrefixAttrPrefixSID", func(b []byte) error {
+			return (&PrefixAttrPrefixSID{}).deserialize(b, LinkStateNlriOSPFv2ProtocolID)
+		}, []int{7, 8}},
+		{"LinkAttrUniLinkDelay", (&LinkAttrUniLinkDelay{}).deserialize, []int{4}},
+		{"LinkAttrMinMaxUniLinkDelay", (&LinkAttrMinMaxUniLinkDelay{}).deserialize, []int{8}},
+		{"LinkAttrUniDelayVariation", (&LinkAttrUniDelayVariation{}).deserialize, []int{4}},
+	}
+
+	for _, c := range cases {
+		for l := 0; l < 20; l++ {
+			err := c.fn(make([]byte, l))
+			msg := fmt.Sprintf("%s len %d", c.name, l)
+			valid := false
+			for _, v := range c.valid {
+				valid = valid || l == v
+			}
+			if valid {
+				assert.Nil(t, err, msg)
+			} else {
+				assert.NotNil(t, err, msg)
+			}
+		}
+	}
+}
+
+func TestSRv6SIDStructure(t *testing.T) {
+	s := &SRv6SIDStructure{}
+
+	// invalid len
+	err := s.deserialize([]byte{0})
+	assert.NotNil(t, err)
+
+	// exceeds 128 bits
+	s.LocatorBlockLength = 128
+	s.ArgumentLength = 1
+	_, err = s.serialize()
+	assert.NotNil(t, err)
+
+	s = &SRv6SIDStructure{
+		LocatorBlockLength: 40,
+		LocatorNodeLength:  24,
+		FunctionLength:     16,
+		ArgumentLength:     0,
+	}
+	b, err := s.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b, []byte{0x04, 0xe4, 0, 4, 40, 24, 16, 0})
+
+	// unknown sub-TLV is skipped
+	b = append([]byte{0, 1, 0, 1, 0}, b...)
+	d, err := deserializeSRv6SIDSubTLVs(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, d, s)
+
+	// no sub-TLVs
+	d, err = deserializeSRv6SIDSubTLVs(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, d)
+
+	// sub-TLV too short
+	_, err = deserializeSRv6SIDSubTLVs([]byte{0})
+	assert.NotNil(t, err)
+
+	// sub-TLV len exceeds attribute
+	_, err = deserializeSRv6SIDSubTLVs([]byte{0x04, 0xe4, 0, 4, 0})
+	assert.NotNil(t, err)
+
+	// invalid SRv6SIDStructure len
+	_, err = deserializeSRv6SIDSubTLVs([]byte{0x04, 0xe4, 0, 1, 0})
+	assert.NotNil(t, err)
+}
+
 func TestNodeAttrSRLocalBlock(t *testing.T) {
 	lb := &NodeAttrSRLocalBlock{
 		RangeSIDLabel: []RangeSIDLabel{
@@ -635,6 +1073,29 @@ func TestRangeSIDLabel(t *testing.T) {
 	// invalid sidLabel len
 	_, err = deserializeRangeSIDLabel([]byte{0, 0, 0, 4, 137, 0, 5, 0, 0, 0, 0, 0})
 	assert.NotNil(t, err)
+
+	// multiple ranges
+	valid := []byte{
+		1, 0, 2, 4, 137, 0, 3, 0, 0, 1,
+		0, 0, 3, 4, 137, 0, 4, 0, 0, 0, 2,
+	}
+	rsl, err := deserializeRangeSIDLabel(valid)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []RangeSIDLabel{
+			{RangeSize: 1<<16 | 2, SIDLabel: &SIDLabelLabel{Label: 1}},
+			{RangeSize: 3, SIDLabel: &SIDLabelSID{SID: 2}},
+		}, rsl)
+	}
+
+	// trailing range truncated at each length
+	for i := 1; i < 11; i++ {
+		_, err = deserializeRangeSIDLabel(valid[:len(valid)-i])
+		assert.NotNil(t, err)
+	}
+
+	// sidLabel len exceeds remaining bytes of a trailing range
+	_, err = deserializeRangeSIDLabel(append(valid[:10:10], 0, 0, 3, 4, 137, 0, 4, 0, 0, 0))
+	assert.NotNil(t, err)
 }
 
 func TestSIDLabel(t *testing.T) {
@@ -673,8 +1134,82 @@ func TestLinkStateNlriNode(t *testing.T) {
 	assert.NotNil(t, err)
 
 	// err deserializing node descriptors
-	err = n.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 4, 0, 0, 0, 0})
+	err = n.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 4, 2, 0, 0, 0})
 	assert.NotNil(t, err)
+
+	// unknown node descriptors preserved
+	err = n.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 6, 4, 0, 0, 2, 0, 1})
+	if assert.Nil(t, err) {
+		assert.Equal(t, n.LocalNodeDescriptors, []NodeDescriptor{&NodeDescriptorUnknown{Type: 1024, Value: []byte{0, 1}}})
+		b, err := n.serialize()
+		if assert.Nil(t, err) {
+			assert.Equal(t, b[4:], []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 6, 4, 0, 0, 2, 0, 1})
+		}
+	}
+
+	// no remote node descriptors TLV
+	n.LocalNodeDescriptors = []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}}
+	b, err := n.serialize()
+	if assert.Nil(t, err) {
+		assert.Len(t, b, 25)
+		assert.Equal(t, b[13:15], []byte{1, 0})
+	}
+}
+
+func TestLinkStateNlriKey(t *testing.T) {
+	a := &LinkStateNlriLink{
+		ProtocolID:            LinkStateNlriOSPFv2ProtocolID,
+		ID:                    1,
+		LocalNodeDescriptors:  []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}, &NodeDescriptorBgpLsID{ID: 1}},
+		RemoteNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64513}},
+		LinkDescriptors: []LinkDescriptor{
+			&LinkDescriptorIPv4InterfaceAddress{Address: net.ParseIP("172.16.1.1")},
+			&LinkDescriptorLinkIDs{LocalID: 1, RemoteID: 2},
+		},
+	}
+	b := &LinkStateNlriLink{
+		ProtocolID:            LinkStateNlriOSPFv2ProtocolID,
+		ID:                    1,
+		LocalNodeDescriptors:  []NodeDescriptor{&NodeDescriptorBgpLsID{ID: 1}, &NodeDescriptorASN{ASN: 64512}},
+		RemoteNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64513}},
+		LinkDescriptors: []LinkDescriptor{
+			&LinkDescriptorLinkIDs{LocalID: 1, RemoteID: 2},
+			&LinkDescriptorIPv4InterfaceAddress{Address: net.ParseIP("172.16.1.1").To4()},
+		},
+	}
+	assert.Equal(t, a.Key(), b.Key())
+
+	keys := make(map[string]LinkStateNlri)
+	keys[a.Key()] = a
+	keys[b.Key()] = b
+	assert.Len(t, keys, 1)
+
+	// local and remote descriptors are distinct
+	b.LocalNodeDescriptors, b.RemoteNodeDescriptors = b.RemoteNodeDescriptors, b.LocalNodeDescriptors
+	assert.NotEqual(t, a.Key(), b.Key())
+
+	// identifier
+	b.LocalNodeDescriptors, b.RemoteNodeDescriptors = b.RemoteNodeDescriptors, b.LocalNodeDescriptors
+	b.ID = 2
+	assert.NotEqual(t, a.Key(), b.Key())
+
+	// protocol
+	b.ID = 1
+	b.ProtocolID = LinkStateNlriIsIsL2ProtocolID
+	assert.NotEqual(t, a.Key(), b.Key())
+
+	// nlri type
+	n := &LinkStateNlriNode{ProtocolID: LinkStateNlriOSPFv2ProtocolID, ID: 1, LocalNodeDescriptors: a.LocalNodeDescriptors}
+	v4 := &LinkStateNlriIPv4Prefix{LinkStateNlriPrefix{ProtocolID: LinkStateNlriOSPFv2ProtocolID, ID: 1, LocalNodeDescriptors: a.LocalNodeDescriptors}}
+	v6 := &LinkStateNlriIPv6Prefix{LinkStateNlriPrefix{ProtocolID: LinkStateNlriOSPFv2ProtocolID, ID: 1, LocalNodeDescriptors: a.LocalNodeDescriptors}}
+	assert.NotEqual(t, n.Key(), v4.Key())
+	assert.NotEqual(t, v4.Key(), v6.Key())
+
+	// prefix descriptors
+	v4.PrefixDescriptors = []PrefixDescriptor{&PrefixDescriptorIPReachabilityInfo{PrefixLength: 24, Prefix: net.ParseIP("10.0.0.0")}}
+	k := v4.Key()
+	v4.PrefixDescriptors = []PrefixDescriptor{&PrefixDescriptorIPReachabilityInfo{PrefixLength: 24, Prefix: net.ParseIP("10.0.1.0")}}
+	assert.NotEqual(t, k, v4.Key())
 }
 
 func TestLinkStateNlriLink(t *testing.T) {
@@ -720,8 +1255,18 @@ func TestLinkStateNlriLink(t *testing.T) {
 	assert.NotNil(t, err)
 
 	// err deserializing link descriptors
-	err = l.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 1, 1, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 0})
+	err = l.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 1, 1, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 1, 2, 0, 0})
+	assert.NotNil(t, err)
+
+	// unknown link descriptors preserved unless strict
+	unknown := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 1, 1, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 0}
+	err = l.deserializeWithOptions(unknown, decodeOptions{strict: true})
 	assert.NotNil(t, err)
+	l = &LinkStateNlriLink{}
+	err = l.deserialize(unknown)
+	if assert.Nil(t, err) {
+		assert.Equal(t, l.LinkDescriptors, []LinkDescriptor{&LinkDescriptorUnknown{Type: 0, Value: []byte{}}})
+	}
 
 	// err serializing local node descriptors
 	l.LocalNodeDescriptors = []NodeDescriptor{&NodeDescriptorBgpRouterID{}}
@@ -735,10 +1280,27 @@ func TestLinkStateNlriLink(t *testing.T) {
 	assert.NotNil(t, err)
 
 	// err serializing link descriptors
-	l.RemoteNodeDescriptors = nil
+	l.LocalNodeDescriptors = []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}}
+	l.RemoteNodeDescriptors = []NodeDescriptor{&NodeDescriptorASN{ASN: 64513}}
 	l.LinkDescriptors = []LinkDescriptor{&LinkDescriptorIPv4NeighborAddress{}}
 	_, err = l.serialize()
 	assert.NotNil(t, err)
+
+	// no local node descriptors
+	l.LinkDescriptors = nil
+	l.LocalNodeDescriptors = nil
+	_, err = l.serialize()
+	assert.NotNil(t, err)
+
+	// no remote node descriptors
+	l.LocalNodeDescriptors = []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}}
+	l.RemoteNodeDescriptors = nil
+	_, err = l.serialize()
+	assert.NotNil(t, err)
+
+	l.RemoteNodeDescriptors = []NodeDescriptor{&NodeDescriptorASN{ASN: 64513}}
+	_, err = l.serialize()
+	assert.Nil(t, err)
 }
 
 func TestLinkStateNlriPrefix(t *testing.T) {
@@ -767,8 +1329,18 @@ func TestLinkStateNlriPrefix(t *testing.T) {
 	assert.NotNil(t, err)
 
 	// err deserializing prefix descriptors
-	err = p.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 0})
+	err = p.deserialize([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 1, 9, 0, 0})
+	assert.NotNil(t, err)
+
+	// unknown prefix descriptors preserved unless strict
+	unknown := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 8, 2, 0, 0, 4, 0, 0, 0, 1, 4, 0, 0, 1, 9}
+	err = p.deserializeWithOptions(unknown, decodeOptions{strict: true})
 	assert.NotNil(t, err)
+	p.PrefixDescriptors = nil
+	err = p.deserialize(unknown)
+	if assert.Nil(t, err) {
+		assert.Equal(t, p.PrefixDescriptors, []PrefixDescriptor{&PrefixDescriptorUnknown{Type: 1024, Value: []byte{9}}})
+	}
 
 	// err serializing node descriptors
 	p.LocalNodeDescriptors = []NodeDescriptor{&NodeDescriptorBgpRouterID{}}
@@ -780,6 +1352,27 @@ func TestLinkStateNlriPrefix(t *testing.T) {
 	p.PrefixDescriptors = []PrefixDescriptor{&PrefixDescriptorIPReachabilityInfo{}}
 	_, err = p.serialize(LinkStateNlriIPv4PrefixType)
 	assert.NotNil(t, err)
+
+	// ip reachability info family is that of the nlri type
+	p.LocalNodeDescriptors = []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}}
+	p.PrefixDescriptors = []PrefixDescriptor{&PrefixDescriptorIPReachabilityInfo{PrefixLength: 128, Prefix: net.ParseIP("::ffff:1.2.3.4")}}
+	b, err := p.serialize(LinkStateNlriIPv6PrefixType)
+	if assert.Nil(t, err) {
+		d := &LinkStateNlriPrefix{}
+		if assert.Nil(t, d.deserialize(b[4:])) {
+			assert.Equal(t, net.ParseIP("::ffff:1.2.3.4").To16(), d.PrefixDescriptors[0].(*PrefixDescriptorIPReachabilityInfo).Prefix)
+			assert.Len(t, d.PrefixDescriptors[0].(*PrefixDescriptorIPReachabilityInfo).Prefix, 16)
+		}
+	}
+
+	// no remote node descriptors TLV
+	p.LocalNodeDescriptors = []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}}
+	p.PrefixDescriptors = nil
+	b, err = p.serialize(LinkStateNlriIPv4PrefixType)
+	if assert.Nil(t, err) {
+		assert.Len(t, b, 25)
+		assert.Equal(t, b[13:15], []byte{1, 0})
+	}
 }
 
 func TestPathAttrMpUnreach(t *testing.T) {
@@ -840,29 +1433,163 @@ func TestPathAttrMpReach(t *testing.T) {
 	}
 	_, err = mp.serialize()
 	assert.NotNil(t, err)
-}
 
-func TestDeserializeLinkStateNlri(t *testing.T) {
-	// invalid afi/safi
-	_, err := deserializeLinkStateNlri(0, 0, []byte{})
+	// invalid next hop
+	mp.Nlri = nil
+	mp.NextHop = net.IP{1, 2, 3}
+	_, err = mp.serialize()
 	assert.NotNil(t, err)
+}
 
-	// len < 4
-	_, err = deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, []byte{0})
-	assert.NotNil(t, err)
+func TestPathAttrMpRawNlri(t *testing.T) {
+	ipv6Unicast := AfiSafi{Afi: 2, Safi: 1}
+	// 2001:db8::/32
+	prefix := []byte{32, 0x20, 0x01, 0x0d, 0xb8}
 
-	// invalid nlri len
-	_, err = deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, []byte{0, 0, 0, 10, 0})
+	reach := &PathAttrMpReach{
+		Afi:     ipv6Unicast.Afi,
+		Safi:    ipv6Unicast.Safi,
+		NextHop: net.ParseIP("2001:db8::1"),
+		RawNlri: prefix,
+	}
+	unreach := &PathAttrMpUnreach{
+		Afi:     ipv6Unicast.Afi,
+		Safi:    ipv6Unicast.Safi,
+		RawNlri: prefix,
+	}
+	var b []byte
+	for _, a := range []PathAttr{reach, unreach} {
+		ab, err := a.serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, ab...)
+	}
+
+	// rejected unless configured
+	_, _, err := deserializePathAttrs(b, decodeOptions{})
 	assert.NotNil(t, err)
 
-	// err deserializing each link state nlri type
-	for i := 1; i < 6; i++ {
-		_, err = deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, []byte{0, uint8(i), 0, 0})
-		assert.NotNil(t, err)
+	attrs, _, err := deserializePathAttrs(b, decodeOptions{families: []AfiSafi{ipv6Unicast}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, attrs, []PathAttr{reach, unreach})
+
+	// bgp-ls nlri are decoded regardless of the configured families
+	node := &LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+	}
+	lsReach := &PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{node}}
+	b, err = lsReach.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, _, err = deserializePathAttrs(b, decodeOptions{families: []AfiSafi{{Afi: BgpLsAfi, Safi: BgpLsSafi}}})
+	if err != nil {
+		t.Fatal(err)
 	}
+	assert.Equal(t, attrs, []PathAttr{lsReach})
 }
 
-func TestPathAttrOrigin(t *testing.T) {
+func TestPathAttrMpReachNextHop(t *testing.T) {
+	node := &LinkStateNlriNode{
+		ProtocolID: LinkStateNlriIsIsL2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{
+			&NodeDescriptorASN{ASN: 64512},
+		},
+	}
+
+	cases := []struct {
+		nextHop net.IP
+		nhLen   uint8
+	}{
+		{nil, 0},
+		{net.ParseIP("192.0.2.1"), 4},
+		{net.ParseIP("2001:db8::1"), 16},
+	}
+
+	for _, c := range cases {
+		mp := &PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, NextHop: c.nextHop, Nlri: []LinkStateNlri{node}}
+		b, err := mp.serialize()
+		if !assert.Nil(t, err) {
+			continue
+		}
+		// flags, type, len, afi, safi
+		assert.Equal(t, c.nhLen, b[6])
+
+		got := &PathAttrMpReach{}
+		err = got.deserialize(PathAttrFlags{Optional: true}, b[3:])
+		if assert.Nil(t, err) {
+			assert.True(t, c.nextHop.Equal(got.NextHop))
+			assert.Equal(t, []LinkStateNlri{node}, got.Nlri)
+		}
+	}
+
+	// global and link-local ipv6 next hop
+	b := []byte{0x40, 0x04, 0x47, 32}
+	b = append(b, net.ParseIP("2001:db8::1")...)
+	b = append(b, net.ParseIP("fe80::1")...)
+	b = append(b, 0)
+	nlri, err := node.serialize()
+	if !assert.Nil(t, err) {
+		return
+	}
+	b = append(b, nlri...)
+	mp := &PathAttrMpReach{}
+	err = mp.deserialize(PathAttrFlags{Optional: true}, b)
+	if assert.Nil(t, err) {
+		assert.Equal(t, net.ParseIP("2001:db8::1"), mp.NextHop)
+	}
+}
+
+func TestDeserializeLinkStateNlri(t *testing.T) {
+	// invalid afi/safi
+	_, err := deserializeLinkStateNlri(0, 0, []byte{}, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// len < 4
+	_, err = deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, []byte{0}, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// invalid nlri len
+	_, err = deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, []byte{0, 0, 0, 10, 0}, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// trailing bytes < 4 following a valid nlri
+	node, err := (&LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+	}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, append(node, 0, 1), decodeOptions{})
+	assert.NotNil(t, err)
+
+	// bgp-ls-spf safi
+	nlri, err := deserializeLinkStateNlri(BgpLsAfi, BgpLsSpfSafi, node, decodeOptions{})
+	assert.Nil(t, err)
+	if assert.Len(t, nlri, 1) {
+		assert.Equal(t, BgpLsSpfSafi, nlri[0].Safi())
+		// the same descriptors received with each safi are distinct objects
+		ls, err := deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, node, decodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, BgpLsSafi, ls[0].Safi())
+		assert.NotEqual(t, ls[0].Key(), nlri[0].Key())
+	}
+
+	// err deserializing each link state nlri type
+	for i := 1; i < 6; i++ {
+		_, err = deserializeLinkStateNlri(BgpLsAfi, BgpLsSafi, []byte{0, uint8(i), 0, 0}, decodeOptions{})
+		assert.NotNil(t, err)
+	}
+}
+
+func TestPathAttrOrigin(t *testing.T) {
 	cases := []struct {
 		c OriginCode
 		s string
@@ -945,6 +1672,276 @@ func TestPathAttrAsPath(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestOspfv2ExtendedPrefix(t *testing.T) {
+	p := &PrefixAttrOpaquePrefixAttribute{
+		Data: []byte{
+			1, 24, 0, 0xC0, // intra-area, /24, ipv4 unicast, A and N flags
+			10, 0, 1, 0,
+			0, 2, 0, 7, 0, 0, 0, 0, 0, 0, 100, 0, // prefix sid sub-tlv, padded
+			0, 9, 0, 1, 1, // unpadded final sub-tlv
+		},
+	}
+	data := append([]byte{}, p.Data...)
+
+	e, err := p.Ospfv2ExtendedPrefix()
+	if assert.Nil(t, err) {
+		assert.Equal(t, &Ospfv2ExtendedPrefix{
+			RouteType:     Ospfv2ExtendedPrefixRouteTypeIntraArea,
+			PrefixLength:  24,
+			AddressFamily: 0,
+			Attach:        true,
+			Node:          true,
+			Prefix:        net.ParseIP("10.0.1.0").To4(),
+			SubTLVs: []Ospfv2ExtendedPrefixSubTLV{
+				{Type: 2, Value: []byte{0, 0, 0, 0, 0, 0, 100}},
+				{Type: 9, Value: []byte{1}},
+			},
+		}, e)
+	}
+	assert.Equal(t, data, p.Data)
+
+	cases := []struct {
+		name string
+		b    []byte
+	}{
+		{"too short", []byte{1, 24, 0}},
+		{"unsupported af", []byte{1, 24, 1, 0, 10, 0, 1, 0}},
+		{"invalid prefix length", []byte{1, 33, 0, 0, 10, 0, 1, 0}},
+		{"prefix too short", []byte{1, 24, 0, 0, 10, 0, 1}},
+		{"sub-tlv header too short", []byte{1, 24, 0, 0, 10, 0, 1, 0, 0, 2}},
+		{"sub-tlv value too short", []byte{1, 24, 0, 0, 10, 0, 1, 0, 0, 2, 0, 4, 0}},
+	}
+	for _, c := range cases {
+		_, err := (&PrefixAttrOpaquePrefixAttribute{Data: c.b}).Ospfv2ExtendedPrefix()
+		assert.NotNil(t, err, c.name)
+	}
+}
+
+func TestOspfv3ExtendedPrefix(t *testing.T) {
+	p := &PrefixAttrOpaquePrefixAttribute{
+		Data: []byte{
+			0x07, 0, 0, 10, // flags, metric
+			64, 0x10, 0, 0, // prefix length, options
+			0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, // prefix
+			0, 1, 0, 1, 9, 0, 0, 0, // sub-tlv, padded
+		},
+	}
+	data := append([]byte{}, p.Data...)
+
+	e, err := p.Ospfv3ExtendedPrefix(Ospfv3ExtendedPrefixTypeExternal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &Ospfv3ExtendedPrefix{
+		Type:              Ospfv3ExtendedPrefixTypeExternal,
+		Metric:            10,
+		External:          true,
+		ForwardingAddress: true,
+		RouteTag:          true,
+		PrefixLength:      64,
+		Options:           PrefixAttrFlagsOSPFv3{DN: true},
+		Prefix:            net.ParseIP("2001:db8:0:1::"),
+		SubTLVs:           []Ospfv3ExtendedPrefixSubTLV{{Type: 1, Value: []byte{9}}},
+	}, e)
+	assert.Equal(t, data, p.Data)
+
+	// flags are only present in external-prefix tlvs
+	p.Data = p.Data[:16]
+	e, err = p.Ospfv3ExtendedPrefix(Ospfv3ExtendedPrefixTypeIntraArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Ospfv3ExtendedPrefixTypeIntraArea, e.Type)
+	assert.False(t, e.External)
+	assert.Equal(t, uint32(10), e.Metric)
+	assert.Len(t, e.SubTLVs, 0)
+
+	cases := []struct {
+		name string
+		t    Ospfv3ExtendedPrefixType
+		b    []byte
+	}{
+		{"unsupported type", 1, []byte{0, 0, 0, 1, 0, 0, 0, 0}},
+		{"value too short", Ospfv3ExtendedPrefixTypeInterArea, []byte{0, 0, 0, 1}},
+		{"invalid prefix length", Ospfv3ExtendedPrefixTypeInterArea, []byte{0, 0, 0, 1, 129, 0, 0, 0}},
+		{"prefix too short", Ospfv3ExtendedPrefixTypeInterArea, []byte{0, 0, 0, 1, 64, 0, 0, 0}},
+		{"sub-tlv too short", Ospfv3ExtendedPrefixTypeInterArea, []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, c := range cases {
+		_, err := (&PrefixAttrOpaquePrefixAttribute{Data: c.b}).Ospfv3ExtendedPrefix(c.t)
+		assert.NotNil(t, err, c.name)
+	}
+}
+
+func TestOpaqueTLVs(t *testing.T) {
+	RegisterLinkOpaqueTLVDecoder(1, func(v []byte) (interface{}, error) {
+		if len(v) != 4 {
+			return nil, errors.New("invalid length")
+		}
+		return binary.BigEndian.Uint32(v), nil
+	})
+	defer RegisterLinkOpaqueTLVDecoder(1, nil)
+
+	data := []byte{0, 1, 0, 4, 0, 0, 0, 7, 0, 2, 0, 1, 9, 0, 1, 0, 1, 0}
+	l := &LinkAttrOpaqueLinkAttr{Data: data}
+	tlvs, err := l.TLVs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []OpaqueTLV{
+		{Type: 1, Value: []byte{0, 0, 0, 7}, Decoded: uint32(7)},
+		{Type: 2, Value: []byte{9}},
+		{Type: 1, Value: []byte{0}, Err: errors.New("invalid length")},
+	}, tlvs)
+
+	// decoders are registered per opaque attribute
+	for _, f := range []func() ([]OpaqueTLV, error){
+		(&NodeAttrOpaqueNodeAttr{Data: data}).TLVs,
+		(&PrefixAttrOpaquePrefixAttribute{Data: data}).TLVs,
+	} {
+		tlvs, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assert.Len(t, tlvs, 3) {
+			assert.Nil(t, tlvs[0].Decoded)
+			assert.Nil(t, tlvs[0].Err)
+		}
+	}
+
+	_, err = (&LinkAttrOpaqueLinkAttr{Data: []byte{0, 1, 0}}).TLVs()
+	assert.NotNil(t, err)
+	_, err = (&LinkAttrOpaqueLinkAttr{Data: []byte{0, 1, 0, 2, 0}}).TLVs()
+	assert.NotNil(t, err)
+}
+
+type testTLVCodec struct {
+	v uint32
+}
+
+func (c *testTLVCodec) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, c.v)
+	return b, nil
+}
+
+func (c *testTLVCodec) UnmarshalBinary(b []byte) error {
+	if len(b) != 4 {
+		return errors.New("invalid length")
+	}
+	c.v = binary.BigEndian.Uint32(b)
+	return nil
+}
+
+func TestTLVExtensions(t *testing.T) {
+	newCodec := func() TLVCodec { return &testTLVCodec{} }
+	RegisterLinkAttr(1299, newCodec)
+	defer RegisterLinkAttr(1299, nil)
+	RegisterPrefixAttr(1299, newCodec)
+	defer RegisterPrefixAttr(1299, nil)
+	RegisterNodeAttr(NodeAttrCodeNodeName, newCodec)
+	defer RegisterNodeAttr(NodeAttrCodeNodeName, nil)
+	RegisterNodeDescriptor(520, newCodec)
+	defer RegisterNodeDescriptor(520, nil)
+
+	b := []byte{0x05, 0x13, 0, 4, 0, 0, 0, 7}
+	_, linkAttrs, _, err := deserializeLinkStateAttrs(b, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriLinkType, decodeOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &LinkAttrExtension{Type: 1299, Value: &testTLVCodec{v: 7}}
+	assert.Equal(t, []LinkAttr{want}, linkAttrs)
+	serialized, err := want.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, b, serialized)
+
+	// the factory for the nlri type is preferred for shared codes
+	_, _, prefixAttrs, err := deserializeLinkStateAttrs(b, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriIPv4PrefixType, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []PrefixAttr{&PrefixAttrExtension{Type: 1299, Value: &testTLVCodec{v: 7}}}, prefixAttrs)
+
+	// registered factories take precedence over supported attributes
+	nodeAttrs, _, _, err := deserializeLinkStateAttrs([]byte{0x04, 0x02, 0, 4, 0, 0, 0, 8}, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriNodeType, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []NodeAttr{&NodeAttrExtension{Type: NodeAttrCodeNodeName, Value: &testTLVCodec{v: 8}}}, nodeAttrs)
+
+	_, _, _, err = deserializeLinkStateAttrs([]byte{0x05, 0x13, 0, 1, 0}, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	assert.NotNil(t, err)
+
+	descriptors, err := deserializeNodeDescriptors(LinkStateNlriIsIsL2ProtocolID, []byte{0x02, 0x08, 0, 4, 0, 0, 0, 9, 0x02, 0x00, 0, 4, 0, 0, 0, 1}, decodeOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []NodeDescriptor{
+		&NodeDescriptorExtension{Type: 520, Value: &testTLVCodec{v: 9}},
+		&NodeDescriptorASN{ASN: 1},
+	}, descriptors)
+
+	_, err = (&LinkDescriptorExtension{Type: 300}).serialize()
+	assert.NotNil(t, err)
+
+	// otherwise the factory for another kind of attribute is used
+	RegisterLinkAttr(1299, nil)
+	_, _, prefixAttrs, err = deserializeLinkStateAttrs(b, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, prefixAttrs, 1)
+
+	// removed factories fall back to unknown attributes
+	RegisterPrefixAttr(1299, nil)
+	_, linkAttrs, _, err = deserializeLinkStateAttrs(b, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []LinkAttr{&LinkAttrUnknown{Type: 1299, Value: []byte{0, 0, 0, 7}}}, linkAttrs)
+}
+
+func TestAsPathSegmentEqual(t *testing.T) {
+	cases := []struct {
+		name  string
+		a     AsPathSegment
+		b     AsPathSegment
+		equal bool
+	}{
+		{"set same order", &AsPathSegmentSet{Set: []uint16{1, 2}}, &AsPathSegmentSet{Set: []uint16{1, 2}}, true},
+		{"set different order", &AsPathSegmentSet{Set: []uint16{1, 2, 3}}, &AsPathSegmentSet{Set: []uint16{3, 1, 2}}, true},
+		{"set duplicates", &AsPathSegmentSet{Set: []uint16{1, 2, 2}}, &AsPathSegmentSet{Set: []uint16{2, 1}}, true},
+		{"set missing asn", &AsPathSegmentSet{Set: []uint16{1, 2}}, &AsPathSegmentSet{Set: []uint16{1}}, false},
+		{"set extra asn", &AsPathSegmentSet{Set: []uint16{1}}, &AsPathSegmentSet{Set: []uint16{1, 2}}, false},
+		{"sequence same order", &AsPathSegmentSequence{Sequence: []uint16{1, 2}}, &AsPathSegmentSequence{Sequence: []uint16{1, 2}}, true},
+		{"sequence different order", &AsPathSegmentSequence{Sequence: []uint16{1, 2}}, &AsPathSegmentSequence{Sequence: []uint16{2, 1}}, false},
+		{"sequence different length", &AsPathSegmentSequence{Sequence: []uint16{1, 1}}, &AsPathSegmentSequence{Sequence: []uint16{1}}, false},
+		{"set and sequence", &AsPathSegmentSet{Set: []uint16{1}}, &AsPathSegmentSequence{Sequence: []uint16{1}}, false},
+		{"sequence and set", &AsPathSegmentSequence{Sequence: []uint16{1}}, &AsPathSegmentSet{Set: []uint16{1}}, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.equal, c.a.Equal(c.b), c.name)
+		assert.Equal(t, c.equal, c.b.Equal(c.a), c.name)
+	}
+
+	a := &PathAttrAsPath{Segments: []AsPathSegment{
+		&AsPathSegmentSequence{Sequence: []uint16{1, 2}},
+		&AsPathSegmentSet{Set: []uint16{3, 4}},
+	}}
+	b := &PathAttrAsPath{Segments: []AsPathSegment{
+		&AsPathSegmentSequence{Sequence: []uint16{1, 2}},
+		&AsPathSegmentSet{Set: []uint16{4, 3}},
+	}}
+	assert.True(t, a.Equal(b))
+	b.Segments = b.Segments[:1]
+	assert.False(t, a.Equal(b))
+	b.Segments = []AsPathSegment{a.Segments[1], a.Segments[0]}
+	assert.False(t, a.Equal(b))
+}
+
 func TestPathAttrLocalPref(t *testing.T) {
 	lp := &PathAttrLocalPref{}
 	assert.Equal(t, lp.Type(), PathAttrLocalPrefType)
@@ -982,6 +1979,27 @@ func TestIPTlvSerialization(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestDeserializeIPNoAlias(t *testing.T) {
+	buff := []byte{10, 0, 0, 1}
+	v4, err := deserializeIPv4Addr(buff)
+	assert.Nil(t, err)
+	copy(buff, []byte{0, 0, 0, 0})
+	assert.True(t, v4.Equal(net.ParseIP("10.0.0.1")))
+
+	buff = []byte(net.ParseIP("2001:db8::1"))
+	v6, err := deserializeIPv6Addr(buff)
+	assert.Nil(t, err)
+	copy(buff, make([]byte, 16))
+	assert.True(t, v6.Equal(net.ParseIP("2001:db8::1")))
+
+	r := &PrefixDescriptorIPReachabilityInfo{}
+	buff = []byte{24, 10, 0, 1, 0}
+	assert.Nil(t, r.deserialize(buff))
+	copy(buff, make([]byte, 5))
+	assert.Equal(t, r.PrefixLength, uint8(24))
+	assert.True(t, r.Prefix.Equal(net.ParseIP("10.0.1.0")))
+}
+
 func TestDeserializeLinkStateAttrs(t *testing.T) {
 	// err on attr deserialization
 	cases := []struct {
@@ -1032,6 +2050,18 @@ func TestDeserializeLinkStateAttrs(t *testing.T) {
 			uint16(NodeAttrCodeSRMSPref),
 			[]byte{},
 		},
+		{
+			uint16(NodeAttrCodeSpfCapability),
+			[]byte{},
+		},
+		{
+			uint16(NodeAttrCodeSpfStatus),
+			[]byte{},
+		},
+		{
+			uint16(NodeAttrCodeSRv6EndpointBehavior),
+			[]byte{0, 0, 0},
+		},
 		{
 			uint16(LinkAttrCodeAdminGroup),
 			[]byte{0, 0},
@@ -1096,6 +2126,14 @@ func TestDeserializeLinkStateAttrs(t *testing.T) {
 			uint16(LinkAttrCodePeerSetSID),
 			[]byte{},
 		},
+		{
+			uint16(LinkAttrCodeSRv6EndXSID),
+			[]byte{},
+		},
+		{
+			uint16(LinkAttrCodeSRv6PeerNodeSID),
+			[]byte{},
+		},
 		{
 			uint16(LinkAttrCodeAdjSID),
 			[]byte{},
@@ -1176,6 +2214,10 @@ func TestDeserializeLinkStateAttrs(t *testing.T) {
 			uint16(PrefixAttrCodeSourceRouterID),
 			[]byte{},
 		},
+		{
+			uint16(PrefixAttrCodeFlexAlgoPrefixMetric),
+			[]byte{},
+		},
 		{
 			uint16(0),
 			[]byte{0, 0, 0},
@@ -1187,7 +2229,7 @@ func TestDeserializeLinkStateAttrs(t *testing.T) {
 		binary.BigEndian.PutUint16(b[:2], uint16(c.a))
 		binary.BigEndian.PutUint16(b[2:], uint16(len(c.b)))
 		b = append(b, c.b...)
-		_, _, _, err := deserializeLinkStateAttrs(b, 0)
+		_, _, _, err := deserializeLinkStateAttrs(b, 0, LinkStateNlriNodeType, decodeOptions{strict: true})
 		assert.NotNil(t, err)
 	}
 
@@ -1200,24 +2242,113 @@ func TestDeserializeLinkStateAttrs(t *testing.T) {
 		b := make([]byte, 4)
 		binary.BigEndian.PutUint16(b, uint16(PrefixAttrCodeFlags))
 		binary.BigEndian.PutUint16(b[2:], uint16(0))
-		_, _, _, err := deserializeLinkStateAttrs(b, p)
+		_, _, _, err := deserializeLinkStateAttrs(b, p, LinkStateNlriNodeType, decodeOptions{strict: true})
+		assert.NotNil(t, err)
+	}
+
+	// cases for spf status with varying nlri type
+	nlriTypes := []LinkStateNlriType{
+		LinkStateNlriNodeType, LinkStateNlriLinkType,
+		LinkStateNlriIPv4PrefixType, LinkStateNlriIPv6PrefixType, 0,
+	}
+	for _, nt := range nlriTypes {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint16(b, uint16(NodeAttrCodeSpfStatus))
+		binary.BigEndian.PutUint16(b[2:], uint16(2))
+		b = append(b, 0, 0)
+		_, _, _, err := deserializeLinkStateAttrs(b, LinkStateNlriDirectProtocolID, nt, decodeOptions{strict: true})
 		assert.NotNil(t, err)
 	}
 }
 
+func TestDeserializeLinkStateAttrsUnknown(t *testing.T) {
+	b := []byte{0xff, 0xff, 0, 2, 1, 2}
+
+	// strict
+	_, _, _, err := deserializeLinkStateAttrs(b, LinkStateNlriOSPFv2ProtocolID, LinkStateNlriNodeType, decodeOptions{strict: true})
+	assert.NotNil(t, err)
+
+	// no nlri type
+	_, _, _, err = deserializeLinkStateAttrs(b, LinkStateNlriOSPFv2ProtocolID, 0, decodeOptions{})
+	assert.NotNil(t, err)
+
+	node, _, _, err := deserializeLinkStateAttrs(b, LinkStateNlriOSPFv2ProtocolID, LinkStateNlriNodeType, decodeOptions{})
+	if assert.Nil(t, err) && assert.Len(t, node, 1) {
+		assert.Equal(t, node[0], &NodeAttrUnknown{Type: 0xffff, Value: []byte{1, 2}})
+		assert.Equal(t, node[0].Code(), NodeAttrCode(0xffff))
+		s, err := node[0].serialize()
+		assert.Nil(t, err)
+		assert.Equal(t, s, b)
+	}
+
+	_, link, _, err := deserializeLinkStateAttrs(b, LinkStateNlriOSPFv2ProtocolID, LinkStateNlriLinkType, decodeOptions{})
+	if assert.Nil(t, err) && assert.Len(t, link, 1) {
+		assert.Equal(t, link[0], &LinkAttrUnknown{Type: 0xffff, Value: []byte{1, 2}})
+		assert.Equal(t, link[0].Code(), LinkAttrCode(0xffff))
+		s, err := link[0].serialize()
+		assert.Nil(t, err)
+		assert.Equal(t, s, b)
+	}
+
+	for _, nlriType := range []LinkStateNlriType{LinkStateNlriIPv4PrefixType, LinkStateNlriIPv6PrefixType} {
+		_, _, prefix, err := deserializeLinkStateAttrs(b, LinkStateNlriOSPFv2ProtocolID, nlriType, decodeOptions{})
+		if assert.Nil(t, err) && assert.Len(t, prefix, 1) {
+			assert.Equal(t, prefix[0], &PrefixAttrUnknown{Type: 0xffff, Value: []byte{1, 2}})
+			assert.Equal(t, prefix[0].Code(), PrefixAttrCode(0xffff))
+			s, err := prefix[0].serialize()
+			assert.Nil(t, err)
+			assert.Equal(t, s, b)
+		}
+	}
+
+	// value does not alias the input
+	node, _, _, err = deserializeLinkStateAttrs(b, LinkStateNlriOSPFv2ProtocolID, LinkStateNlriNodeType, decodeOptions{})
+	if assert.Nil(t, err) {
+		b[4] = 0
+		assert.Equal(t, node[0].(*NodeAttrUnknown).Value, []byte{1, 2})
+	}
+}
+
+func TestDecodeLinkStateAttr(t *testing.T) {
+	ls := &PathAttrLinkState{
+		LinkAttrs: []LinkAttr{&LinkAttrIgpMetric{Metric: 10, Type: LinkAttrIgpMetricOspfType}},
+	}
+	b, err := ls.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// invalid flags
+	_, err = DecodeLinkStateAttr(PathAttrFlags{}, b[3:], LinkStateNlriOSPFv2ProtocolID)
+	assert.NotNil(t, err)
+
+	// invalid data
+	_, err = DecodeLinkStateAttr(ls.Flags(), []byte{0}, LinkStateNlriOSPFv2ProtocolID)
+	assert.NotNil(t, err)
+
+	// unknown attr
+	_, err = DecodeLinkStateAttr(ls.Flags(), []byte{0xff, 0xff, 0, 0}, LinkStateNlriOSPFv2ProtocolID)
+	assert.NotNil(t, err)
+
+	decoded, err := DecodeLinkStateAttr(ls.Flags(), b[3:], LinkStateNlriOSPFv2ProtocolID)
+	if assert.Nil(t, err) {
+		assert.Equal(t, ls, decoded)
+	}
+}
+
 func TestPathAttrLinkState(t *testing.T) {
 	ls := &PathAttrLinkState{}
 	assert.Equal(t, ls.Flags(), PathAttrFlags{})
 	assert.Equal(t, ls.Type(), PathAttrLinkStateType)
-	err := ls.deserialize(PathAttrFlags{}, []byte{}, 0)
+	err := ls.deserialize(PathAttrFlags{}, []byte{}, 0, 0, decodeOptions{})
 	assert.Nil(t, err)
 
 	// 0 > len < 4
-	err = ls.deserialize(PathAttrFlags{}, []byte{0}, 0)
+	err = ls.deserialize(PathAttrFlags{}, []byte{0}, 0, 0, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid attr len
-	err = ls.deserialize(PathAttrFlags{}, []byte{0, 0, 0, 100, 0}, 0)
+	err = ls.deserialize(PathAttrFlags{}, []byte{0, 0, 0, 100, 0}, 0, 0, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// node attrs err on serialization
@@ -1335,7 +2466,13 @@ func TestDeserializePathAttrs(t *testing.T) {
 	// bytes < attrLen
 	b := make([]byte, 4)
 	b[2] = uint8(100)
-	_, err := deserializePathAttrs(b)
+	_, _, err := deserializePathAttrs(b, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// truncated attribute length
+	_, _, err = deserializePathAttrs([]byte{0x40, uint8(PathAttrOriginType)}, decodeOptions{})
+	assert.NotNil(t, err)
+	_, _, err = deserializePathAttrs([]byte{0x50, uint8(PathAttrOriginType), 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// origin errors
@@ -1348,13 +2485,13 @@ func TestDeserializePathAttrs(t *testing.T) {
 	}
 	// bad origin code
 	b[3] = 3
-	_, err = deserializePathAttrs(b)
+	_, _, err = deserializePathAttrs(b, decodeOptions{})
 	assert.NotNil(t, err)
 	// set to valid origin code
 	b[3] = 2
 	// set flags to invalid value
 	b[0] = 0
-	_, err = deserializePathAttrs(b)
+	_, _, err = deserializePathAttrs(b, decodeOptions{})
 	assert.NotNil(t, err)
 
 	cases := []struct {
@@ -1397,10 +2534,10 @@ func TestDeserializePathAttrs(t *testing.T) {
 		}
 		b = b[:len(b)-c.bytesToRemove]
 		b[2] = uint8(len(b) - 3)
-		_, err = deserializePathAttrs(b)
+		_, _, err = deserializePathAttrs(b, decodeOptions{})
 		assert.NotNil(t, err)
 		b[0] = c.invalidFlags
-		_, err = deserializePathAttrs(b)
+		_, _, err = deserializePathAttrs(b, decodeOptions{})
 		assert.NotNil(t, err)
 	}
 
@@ -1412,10 +2549,10 @@ func TestDeserializePathAttrs(t *testing.T) {
 	}
 	b = append(b, 0)
 	b[2] = 1
-	_, err = deserializePathAttrs(b)
+	_, _, err = deserializePathAttrs(b, decodeOptions{})
 	assert.NotNil(t, err)
 	b[0] = 0
-	_, err = deserializePathAttrs(b)
+	_, _, err = deserializePathAttrs(b, decodeOptions{})
 	assert.NotNil(t, err)
 }
 
@@ -1452,6 +2589,67 @@ func TestUpdateSerialization(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestSpfAttrs(t *testing.T) {
+	cases := []struct {
+		nlriType LinkStateNlriType
+		b        []byte
+		node     []NodeAttr
+		link     []LinkAttr
+		prefix   []PrefixAttr
+	}{
+		{
+			nlriType: LinkStateNlriNodeType,
+			b:        []byte{0x04, 0x9c, 0, 1, 0, 0x04, 0xa0, 0, 1, 2},
+			node: []NodeAttr{
+				&NodeAttrSpfCapability{Algorithm: 0},
+				&NodeAttrSpfStatus{Status: SpfStatusNoTransit},
+			},
+		},
+		{
+			nlriType: LinkStateNlriLinkType,
+			b:        []byte{0x04, 0xa0, 0, 1, 1},
+			link:     []LinkAttr{&LinkAttrSpfStatus{Status: SpfStatusUnreachable}},
+		},
+		{
+			nlriType: LinkStateNlriIPv6PrefixType,
+			b:        []byte{0x04, 0xa0, 0, 1, 1},
+			prefix:   []PrefixAttr{&PrefixAttrSpfStatus{Status: SpfStatusUnreachable}},
+		},
+	}
+
+	for _, c := range cases {
+		node, link, prefix, err := deserializeLinkStateAttrs(c.b, LinkStateNlriDirectProtocolID, c.nlriType, decodeOptions{strict: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, node, c.node)
+		assert.Equal(t, link, c.link)
+		assert.Equal(t, prefix, c.prefix)
+
+		var b []byte
+		for _, a := range c.node {
+			ab, err := a.serialize()
+			assert.Nil(t, err)
+			b = append(b, ab...)
+		}
+		for _, a := range c.link {
+			ab, err := a.serialize()
+			assert.Nil(t, err)
+			b = append(b, ab...)
+		}
+		for _, a := range c.prefix {
+			ab, err := a.serialize()
+			assert.Nil(t, err)
+			b = append(b, ab...)
+		}
+		assert.Equal(t, b, c.b)
+	}
+
+	assert.Equal(t, "unreachable", SpfStatusUnreachable.String())
+	assert.Equal(t, "no-transit", SpfStatusNoTransit.String())
+	assert.Equal(t, "unknown(3)", SpfStatus(3).String())
+}
+
 func TestNodeAttrs(t *testing.T) {
 	attrs := []NodeAttr{
 		&NodeAttrMultiTopologyID{
@@ -1486,66 +2684,103 @@ func TestNodeAttrs(t *testing.T) {
 
 func TestDeserializeLinkDescriptors(t *testing.T) {
 	// len < 4
-	_, err := deserializeLinkDescriptors(0, []byte{})
+	_, err := deserializeLinkDescriptors(0, []byte{}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid descriptor len
-	_, err = deserializeLinkDescriptors(0, []byte{0, 0, 0, 10, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{0, 0, 0, 10, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing link ids
-	_, err = deserializeLinkDescriptors(0, []byte{1, 2, 0, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{1, 2, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing ipv4 int address
-	_, err = deserializeLinkDescriptors(0, []byte{1, 3, 0, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{1, 3, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing ipv4 neighbor address
-	_, err = deserializeLinkDescriptors(0, []byte{1, 4, 0, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{1, 4, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing ipv6 int address
-	_, err = deserializeLinkDescriptors(0, []byte{1, 5, 0, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{1, 5, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing ipv6 neighbor address
-	_, err = deserializeLinkDescriptors(0, []byte{1, 6, 0, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{1, 6, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing multi topo ids
-	_, err = deserializeLinkDescriptors(0, []byte{1, 7, 0, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{1, 7, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid link descriptor code
-	_, err = deserializeLinkDescriptors(0, []byte{0, 0, 0, 0})
+	_, err = deserializeLinkDescriptors(0, []byte{0, 0, 0, 0}, decodeOptions{strict: true})
 	assert.NotNil(t, err)
+
+	// unknown link descriptor preserved
+	descriptors, err := deserializeLinkDescriptors(0, []byte{4, 0, 0, 1, 9}, decodeOptions{})
+	if assert.Nil(t, err) && assert.Len(t, descriptors, 1) {
+		assert.Equal(t, descriptors[0], &LinkDescriptorUnknown{Type: 1024, Value: []byte{9}})
+		assert.Equal(t, descriptors[0].Code(), LinkDescriptorCode(1024))
+		b, err := descriptors[0].serialize()
+		assert.Nil(t, err)
+		assert.Equal(t, b, []byte{4, 0, 0, 1, 9})
+	}
 }
 
 func TestDeserializePrefixDescriptors(t *testing.T) {
 	// len < 4
-	_, err := deserializePrefixDescriptors(0, []byte{})
+	_, err := deserializePrefixDescriptors(0, []byte{}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid descriptor len
-	_, err = deserializePrefixDescriptors(0, []byte{0, 0, 0, 10, 0})
+	_, err = deserializePrefixDescriptors(0, []byte{0, 0, 0, 10, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing multi topo id
-	_, err = deserializePrefixDescriptors(0, []byte{1, 7, 0, 0})
+	_, err = deserializePrefixDescriptors(0, []byte{1, 7, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing ospf route type
-	_, err = deserializePrefixDescriptors(0, []byte{1, 8, 0, 0})
+	_, err = deserializePrefixDescriptors(LinkStateNlriOSPFv2ProtocolID, []byte{1, 8, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
+	// ospf route type is only valid for ospf nlri
+	routeType := []byte{1, 8, 0, 1, uint8(OspfRouteTypeIntraArea)}
+	for _, id := range []LinkStateNlriProtocolID{LinkStateNlriOSPFv2ProtocolID, LinkStateNlriOSPFv3ProtocolID} {
+		_, err = deserializePrefixDescriptors(id, routeType, decodeOptions{})
+		assert.Nil(t, err)
+	}
+	for _, id := range []LinkStateNlriProtocolID{LinkStateNlriIsIsL1ProtocolID, LinkStateNlriIsIsL2ProtocolID, LinkStateNlriDirectProtocolID} {
+		// preserved unless strict, see validateUpdateLinkStateAttrs
+		descriptors, err := deserializePrefixDescriptors(id, routeType, decodeOptions{})
+		assert.Nil(t, err)
+		assert.Len(t, descriptors, 1)
+		_, err = deserializePrefixDescriptors(id, routeType, decodeOptions{strict: true})
+		if assert.IsType(t, &errWithNotification{}, err) {
+			assert.Equal(t, NotifErrSubcodeMalformedAttr, err.(*errWithNotification).subcode)
+		}
+	}
+
 	// err deserializing ip reachability info
-	_, err = deserializePrefixDescriptors(0, []byte{1, 9, 0, 0})
+	_, err = deserializePrefixDescriptors(0, []byte{1, 9, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid prefix descriptor code
-	_, err = deserializePrefixDescriptors(0, []byte{0, 0, 0, 0})
+	_, err = deserializePrefixDescriptors(0, []byte{0, 0, 0, 0}, decodeOptions{strict: true})
 	assert.NotNil(t, err)
+
+	// unknown prefix descriptor preserved
+	descriptors, err := deserializePrefixDescriptors(0, []byte{4, 0, 0, 1, 9}, decodeOptions{})
+	if assert.Nil(t, err) && assert.Len(t, descriptors, 1) {
+		assert.Equal(t, descriptors[0], &PrefixDescriptorUnknown{Type: 1024, Value: []byte{9}})
+		assert.Equal(t, descriptors[0].Code(), PrefixDescriptorCode(1024))
+		b, err := descriptors[0].serialize()
+		assert.Nil(t, err)
+		assert.Equal(t, b, []byte{4, 0, 0, 1, 9})
+	}
 }
 
 func TestPrefixDescriptors(t *testing.T) {
@@ -1579,20 +2814,179 @@ func TestPrefixDescriptors(t *testing.T) {
 	_, err := r.serialize()
 	assert.NotNil(t, err)
 
+	// ipv4-mapped ipv6 address
+	r = &PrefixDescriptorIPReachabilityInfo{PrefixLength: 128, Prefix: net.ParseIP("::ffff:1.2.3.4")}
+	b, err := r.serializeFamily(true)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []byte{1, 9, 0, 17, 128}, b[:5])
+		assert.Equal(t, []byte(net.ParseIP("::ffff:1.2.3.4").To16()), b[5:])
+	}
+	b, err = r.serialize()
+	if assert.Nil(t, err) {
+		assert.Len(t, b, 9)
+	}
+
+	// prefix length exceeds ipv4 address
+	r.PrefixLength = 33
+	_, err = r.serializeFamily(false)
+	assert.NotNil(t, err)
+
+	// ipv6 address for ipv4
+	r = &PrefixDescriptorIPReachabilityInfo{PrefixLength: 32, Prefix: net.ParseIP("2601::")}
+	_, err = r.serializeFamily(false)
+	assert.NotNil(t, err)
+
 	// invalid route type
 	o := &PrefixDescriptorOspfRouteType{}
 	err = o.deserialize([]byte{0})
 	assert.NotNil(t, err)
 }
 
-func TestLinkDescriptors(t *testing.T) {
-	descriptors := []LinkDescriptor{
-		&LinkDescriptorLinkIDs{
-			LocalID:  uint32(2),
-			RemoteID: uint32(3),
-		},
-		&LinkDescriptorIPv4InterfaceAddress{
-			Address: net.ParseIP("1.1.1.1").To4(),
+func TestDeserializeSRv6SIDDescriptors(t *testing.T) {
+	// len < 4
+	_, err := deserializeSRv6SIDDescriptors([]byte{}, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// invalid descriptor len
+	_, err = deserializeSRv6SIDDescriptors([]byte{0, 0, 0, 10, 0}, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// err deserializing multi topo id
+	_, err = deserializeSRv6SIDDescriptors([]byte{1, 7, 0, 0}, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// err deserializing sid information
+	_, err = deserializeSRv6SIDDescriptors([]byte{2, 6, 0, 4, 0, 0, 0, 0}, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// invalid srv6 sid descriptor code
+	_, err = deserializeSRv6SIDDescriptors([]byte{0, 0, 0, 0}, decodeOptions{strict: true})
+	assert.NotNil(t, err)
+
+	// unknown srv6 sid descriptor preserved
+	descriptors, err := deserializeSRv6SIDDescriptors([]byte{4, 0, 0, 1, 9}, decodeOptions{})
+	if assert.Nil(t, err) && assert.Len(t, descriptors, 1) {
+		assert.Equal(t, descriptors[0], &SRv6SIDDescriptorUnknown{Type: 1024, Value: []byte{9}})
+		assert.Equal(t, descriptors[0].Code(), SRv6SIDDescriptorCode(1024))
+		b, err := descriptors[0].serialize()
+		assert.Nil(t, err)
+		assert.Equal(t, b, []byte{4, 0, 0, 1, 9})
+	}
+
+	// round trip
+	expected := []SRv6SIDDescriptor{
+		&SRv6SIDDescriptorSIDInformation{SID: net.ParseIP("2001:db8::1")},
+		&SRv6SIDDescriptorMultiTopologyID{IDs: []uint16{2}},
+	}
+	var b []byte
+	for _, d := range expected {
+		db, err := d.serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, db...)
+	}
+	descriptors, err = deserializeSRv6SIDDescriptors(b, decodeOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, descriptors, expected)
+
+	// invalid sid
+	_, err = (&SRv6SIDDescriptorSIDInformation{}).serialize()
+	assert.NotNil(t, err)
+}
+
+func TestLinkStateNlriSRv6SID(t *testing.T) {
+	sid := &LinkStateNlriSRv6SID{
+		ProtocolID:           LinkStateNlriIsIsL2ProtocolID,
+		ID:                   1,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+		SRv6SIDDescriptors: []SRv6SIDDescriptor{
+			&SRv6SIDDescriptorMultiTopologyID{IDs: []uint16{2}},
+			&SRv6SIDDescriptorSIDInformation{SID: net.ParseIP("2001:db8::1")},
+		},
+	}
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrAsPath{},
+			&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, NextHop: net.ParseIP("172.16.0.1").To4(), Nlri: []LinkStateNlri{sid}},
+			&PathAttrLinkState{
+				NodeAttrs: []NodeAttr{&NodeAttrSRv6EndpointBehavior{EndpointBehavior: EndpointBehaviorEndDT6, Algorithm: 128}},
+				LinkAttrs: []LinkAttr{&LinkAttrSRv6PeerNodeSID{PeerASN: 64513, PeerRouterID: net.ParseIP("172.16.1.2").To4()}},
+			},
+		},
+	}
+	b, err := u.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := messagesFromBytes(b, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, msgs, 1) {
+		got := msgs[0].(*UpdateMessage)
+		assert.Equal(t, u.PathAttrs[2].(*PathAttrMpReach).Nlri, got.PathAttrs[2].(*PathAttrMpReach).Nlri)
+		assert.Equal(t, u.PathAttrs[3].(*PathAttrLinkState).NodeAttrs, got.PathAttrs[3].(*PathAttrLinkState).NodeAttrs)
+		assert.Equal(t, u.PathAttrs[3].(*PathAttrLinkState).LinkAttrs, got.PathAttrs[3].(*PathAttrLinkState).LinkAttrs)
+		assert.Nil(t, validateUpdateLinkStateAttrs(got))
+		assert.Nil(t, got.Validate())
+		assert.Equal(t, sid.Key(), got.PathAttrs[2].(*PathAttrMpReach).Nlri[0].Key())
+	}
+
+	// the srv6 sid information tlv is mandatory
+	sid.SRv6SIDDescriptors = sid.SRv6SIDDescriptors[:1]
+	b, err = sid.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, (&LinkStateNlriSRv6SID{}).deserialize(b[4:]))
+	sid.SRv6SIDDescriptors = nil
+	b, err = sid.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, (&LinkStateNlriSRv6SID{}).deserialize(b[4:]))
+	assert.NotNil(t, (&LinkStateNlriSRv6SID{}).deserialize(b[4:12]))
+}
+
+func TestOspfRouteType(t *testing.T) {
+	cases := []struct {
+		r         OspfRouteType
+		s         string
+		external  bool
+		intraArea bool
+	}{
+		{OspfRouteTypeIntraArea, "intra-area", false, true},
+		{OspfRouteTypeInterArea, "inter-area", false, false},
+		{OspfRouteTypeExternal1, "external-1", true, false},
+		{OspfRouteTypeExternal2, "external-2", true, false},
+		{OspfRouteTypeNSSA1, "nssa-1", true, false},
+		{OspfRouteTypeNSSA2, "nssa-2", true, false},
+		{OspfRouteType(0), "unknown", false, false},
+		{OspfRouteType(7), "unknown", false, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.r.String(), c.s)
+		assert.Equal(t, c.r.IsExternal(), c.external)
+		assert.Equal(t, c.r.IsIntraArea(), c.intraArea)
+		p := &PrefixDescriptorOspfRouteType{RouteType: c.r}
+		assert.Equal(t, p.String(), c.s)
+	}
+}
+
+func TestLinkDescriptors(t *testing.T) {
+	descriptors := []LinkDescriptor{
+		&LinkDescriptorLinkIDs{
+			LocalID:  uint32(2),
+			RemoteID: uint32(3),
+		},
+		&LinkDescriptorIPv4InterfaceAddress{
+			Address: net.ParseIP("1.1.1.1").To4(),
 		},
 		&LinkDescriptorIPv4NeighborAddress{
 			Address: net.ParseIP("2.2.2.2").To4(),
@@ -1619,27 +3013,40 @@ func TestLinkDescriptors(t *testing.T) {
 
 func TestDeserializeNodeDescriptors(t *testing.T) {
 	// too short
-	_, err := deserializeNodeDescriptors(0, []byte{0})
+	_, err := deserializeNodeDescriptors(0, []byte{0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// invalid descriptor len
-	_, err = deserializeNodeDescriptors(0, []byte{0, 0, 0, 10, 0})
+	_, err = deserializeNodeDescriptors(0, []byte{0, 0, 0, 10, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err deserializing node descriptors
-	for i := 512; i < 519; i++ {
+	for i := 512; i < 518; i++ {
 		b := make([]byte, 2)
 		binary.BigEndian.PutUint16(b, uint16(i))
-		_, err = deserializeNodeDescriptors(0, append(b, []byte{0, 0}...))
+		_, err = deserializeNodeDescriptors(0, append(b, []byte{0, 0}...), decodeOptions{})
 		assert.NotNil(t, err)
 	}
 
+	// unknown descriptor rejected in strict mode
+	_, err = deserializeNodeDescriptors(LinkStateNlriIsIsL2ProtocolID, []byte{2, 6, 0, 0}, decodeOptions{strict: true})
+	assert.NotNil(t, err)
+
+	// unknown descriptor preserved
+	descriptors, err := deserializeNodeDescriptors(LinkStateNlriIsIsL2ProtocolID, []byte{2, 6, 0, 0, 2, 3, 0, 6, 0, 0, 0, 0, 0, 1}, decodeOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, descriptors, []NodeDescriptor{
+			&NodeDescriptorUnknown{Type: 518, Value: []byte{}},
+			&NodeDescriptorIgpRouterIDIsIsNonPseudo{IsoNodeID: 1},
+		})
+	}
+
 	// err igp router id is-is
-	_, err = deserializeNodeDescriptors(LinkStateNlriIsIsL1ProtocolID, []byte{2, 3, 0, 0})
+	_, err = deserializeNodeDescriptors(LinkStateNlriIsIsL1ProtocolID, []byte{2, 3, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 
 	// err igp router id ospf
-	_, err = deserializeNodeDescriptors(LinkStateNlriOSPFv2ProtocolID, []byte{2, 3, 0, 0})
+	_, err = deserializeNodeDescriptors(LinkStateNlriOSPFv2ProtocolID, []byte{2, 3, 0, 0}, decodeOptions{})
 	assert.NotNil(t, err)
 }
 
@@ -1695,13 +3102,112 @@ func TestNodeDescriptors(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
-func TestUpdateMessage(t *testing.T) {
+func TestValidateUpdateLinkStateAttrs(t *testing.T) {
+	node := &LinkStateNlriNode{}
+	link := &LinkStateNlriLink{}
+	prefix := &LinkStateNlriIPv6Prefix{}
+	sid := &LinkStateNlriSRv6SID{}
+	ospfRouteType := func(id LinkStateNlriProtocolID) LinkStateNlri {
+		p := &LinkStateNlriIPv6Prefix{}
+		p.ProtocolID = id
+		p.PrefixDescriptors = []PrefixDescriptor{&PrefixDescriptorOspfRouteType{RouteType: OspfRouteTypeIntraArea}}
+		return p
+	}
+
+	cases := []struct {
+		nlri  []LinkStateNlri
+		ls    *PathAttrLinkState
+		valid bool
+	}{
+		{[]LinkStateNlri{node}, &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{}}}, true},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrIgpMetric{}}}, true},
+		{[]LinkStateNlri{prefix}, &PathAttrLinkState{PrefixAttrs: []PrefixAttr{&PrefixAttrPrefixMetric{}}}, true},
+		{[]LinkStateNlri{node}, nil, true},
+		{[]LinkStateNlri{node}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrIgpMetric{}}}, false},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{}}}, false},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrLocalIPv4RouterID{}, &NodeAttrLocalIPv6RouterID{}}}, true},
+		{[]LinkStateNlri{prefix}, &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrLocalIPv4RouterID{}}}, false},
+		{[]LinkStateNlri{sid}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrSRv6PeerNodeSID{}}}, true},
+		{[]LinkStateNlri{sid}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrIgpMetric{}}}, false},
+		{[]LinkStateNlri{node}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrSRv6PeerNodeSID{}}}, false},
+		{[]LinkStateNlri{node, link}, &PathAttrLinkState{PrefixAttrs: []PrefixAttr{&PrefixAttrPrefixMetric{}}}, false},
+		{nil, &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{}}}, false},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrSRv6EndXSID{EndpointBehavior: EndpointBehaviorEndX}}}, true},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrSRv6EndXSID{EndpointBehavior: 34}}}, true},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrSRv6EndXSID{EndpointBehavior: 0x0039}}}, true},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrSRv6EndXSID{EndpointBehavior: EndpointBehaviorEndDT4}}}, false},
+		{[]LinkStateNlri{link}, &PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrSRv6EndXSID{}}}, false},
+		{[]LinkStateNlri{ospfRouteType(LinkStateNlriOSPFv3ProtocolID)}, nil, true},
+		{[]LinkStateNlri{ospfRouteType(LinkStateNlriIsIsL2ProtocolID)}, nil, false},
+	}
+
+	for _, c := range cases {
+		u := &UpdateMessage{
+			PathAttrs: []PathAttr{&PathAttrMpReach{Nlri: c.nlri}},
+		}
+		if c.ls != nil {
+			u.PathAttrs = append(u.PathAttrs, c.ls)
+		}
+		err := validateUpdateLinkStateAttrs(u)
+		if c.valid {
+			assert.Nil(t, err)
+		} else {
+			assert.NotNil(t, err)
+		}
+	}
+}
+
+func TestLinkUpdateLocalRouterIDs(t *testing.T) {
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrAsPath{},
+			&PathAttrMpReach{
+				Afi:     BgpLsAfi,
+				Safi:    BgpLsSafi,
+				NextHop: net.ParseIP("172.16.0.1").To4(),
+				Nlri: []LinkStateNlri{
+					&LinkStateNlriLink{
+						ProtocolID:            LinkStateNlriOSPFv2ProtocolID,
+						LocalNodeDescriptors:  []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+						RemoteNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64513}},
+					},
+				},
+			},
+			&PathAttrLinkState{
+				NodeAttrs: []NodeAttr{
+					&NodeAttrLocalIPv4RouterID{Address: net.ParseIP("172.16.1.1").To4()},
+					&NodeAttrLocalIPv6RouterID{Address: net.ParseIP("2001:db8::1")},
+				},
+			},
+		},
+	}
+	b, err := u.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := messagesFromBytes(b, decodeOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, m, 1) {
+		got := m[0].(*UpdateMessage)
+		assert.Nil(t, validateUpdateLinkStateAttrs(got))
+		assert.Nil(t, got.Validate())
+		assert.Equal(t, u.PathAttrs[3].(*PathAttrLinkState).NodeAttrs, got.PathAttrs[3].(*PathAttrLinkState).NodeAttrs)
+	}
+}
+
+// fullTopologyPathAttrs returns path attributes carrying every supported nlri
+// and link state attribute type.
+func fullTopologyPathAttrs() []PathAttr {
 	var adminGroup [32]bool
 	adminGroup[31] = true
 	var unreservedBW [8]float32
 	unreservedBW[0] = 10000
 
-	attrs := []PathAttr{
+	return []PathAttr{
 		&PathAttrMpUnreach{
 			Afi:  BgpLsAfi,
 			Safi: BgpLsSafi,
@@ -2116,10 +3622,18 @@ func TestUpdateMessage(t *testing.T) {
 				&PrefixAttrSourceRouterID{
 					RouterID: net.ParseIP("172.16.1.1").To4(),
 				},
+				&PrefixAttrFlexAlgoPrefixMetric{
+					Algorithm: 128,
+					External:  true,
+					Metric:    100,
+				},
 			},
 		},
 	}
+}
 
+func TestUpdateMessage(t *testing.T) {
+	attrs := fullTopologyPathAttrs()
 	u := &UpdateMessage{
 		PathAttrs: attrs,
 	}
@@ -2131,7 +3645,7 @@ func TestUpdateMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	m, err := messagesFromBytes(b)
+	m, err := messagesFromBytes(b, decodeOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2153,3 +3667,1059 @@ func TestUpdateMessage(t *testing.T) {
 		assert.Equal(t, a, um.PathAttrs[i])
 	}
 }
+
+func TestPackUpdateMessages(t *testing.T) {
+	routes := make([]LinkStateRoute, 0)
+	nodeLS := &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{Name: "node"}}}
+	for i := 0; i < 400; i++ {
+		routes = append(routes, LinkStateRoute{
+			Nlri: &LinkStateNlriNode{
+				ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+				ID:                   uint64(i),
+				LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+			},
+			LinkState: nodeLS,
+		})
+	}
+	routes = append(routes, LinkStateRoute{
+		Nlri: &LinkStateNlriNode{
+			ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+			LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64513}},
+		},
+		LinkState: &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{Name: "other"}}},
+	})
+	routes = append(routes, LinkStateRoute{
+		Nlri: &LinkStateNlriNode{
+			ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+			LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64514}},
+		},
+	})
+
+	updates, err := PackUpdateMessages(routes, &PathAttrOrigin{Origin: OriginCodeIGP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 400 * 25 byte nlri require 3 updates, plus 1 for each distinct attr set
+	if !assert.Len(t, updates, 5) {
+		t.FailNow()
+	}
+
+	seen := 0
+	for i, u := range updates {
+		b, err := u.serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, len(b) <= maxMessageLen)
+
+		m, err := messagesFromBytes(b, decodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, m[0], u)
+
+		if assert.IsType(t, &PathAttrOrigin{}, u.PathAttrs[0]) && assert.IsType(t, &PathAttrMpReach{}, u.PathAttrs[1]) {
+			mp := u.PathAttrs[1].(*PathAttrMpReach)
+			for _, n := range mp.Nlri {
+				assert.Equal(t, routes[seen].Nlri, n)
+				seen++
+			}
+		}
+
+		switch i {
+		case 4:
+			assert.Len(t, u.PathAttrs, 2)
+		default:
+			if assert.Len(t, u.PathAttrs, 3) {
+				assert.Equal(t, routes[seen-1].LinkState, u.PathAttrs[2])
+			}
+		}
+	}
+	assert.Equal(t, seen, len(routes))
+
+	// nlri that cannot fit
+	_, err = packUpdateMessages(routes[:1], 40)
+	assert.NotNil(t, err)
+
+	// missing nlri
+	_, err = PackUpdateMessages([]LinkStateRoute{{}})
+	assert.NotNil(t, err)
+
+	// err serializing nlri
+	_, err = PackUpdateMessages([]LinkStateRoute{{Nlri: &LinkStateNlriNode{LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorBgpRouterID{}}}}})
+	assert.NotNil(t, err)
+
+	// err serializing link state
+	_, err = PackUpdateMessages([]LinkStateRoute{{Nlri: routes[0].Nlri, LinkState: &PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{}}}}})
+	assert.NotNil(t, err)
+}
+
+func TestUpdateMessageEndOfRIB(t *testing.T) {
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi},
+		},
+	}
+	family, ok := u.EndOfRIB()
+	assert.True(t, ok)
+	assert.Equal(t, AfiSafi{Afi: BgpLsAfi, Safi: BgpLsSafi}, family)
+
+	// withdrawn routes
+	u.PathAttrs[0].(*PathAttrMpUnreach).RawNlri = []byte{1}
+	_, ok = u.EndOfRIB()
+	assert.False(t, ok)
+
+	// other path attributes
+	u.PathAttrs = []PathAttr{
+		&PathAttrOrigin{Origin: OriginCodeIGP},
+		&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi},
+	}
+	_, ok = u.EndOfRIB()
+	assert.False(t, ok)
+
+	// errors handled according to an UpdateErrorPolicy
+	u.PathAttrs = u.PathAttrs[1:]
+	u.errs = []error{errors.New("test")}
+	_, ok = u.EndOfRIB()
+	assert.False(t, ok)
+
+	// ipv4 unicast
+	b, err := (&UpdateMessage{}).serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := messagesFromBytes(b, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	family, ok = m[0].(*UpdateMessage).EndOfRIB()
+	assert.True(t, ok)
+	assert.Equal(t, AfiSafi{Afi: IPv4Afi, Safi: UnicastSafi}, family)
+	family, ok = m[0].(*UpdateMessage).Clone().EndOfRIB()
+	assert.True(t, ok)
+	assert.Equal(t, AfiSafi{Afi: IPv4Afi, Safi: UnicastSafi}, family)
+
+	// ipv4 unicast withdrawn routes and nlri
+	for _, body := range [][]byte{
+		{0, 2, 8, 10, 0, 0},
+		{0, 0, 0, 0, 8, 10},
+	} {
+		m, err = messagesFromBytes(prependHeader(body, UpdateMessageType), decodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := m[0].(*UpdateMessage)
+		assert.Len(t, u.PathAttrs, 0)
+		_, ok = u.EndOfRIB()
+		assert.False(t, ok)
+		_, ok = u.Clone().EndOfRIB()
+		assert.False(t, ok)
+	}
+}
+
+func TestUpdateMessageLinkStateObjects(t *testing.T) {
+	node := &LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+	}
+	withdrawn := &LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64513}},
+	}
+	nodeAttrs := []NodeAttr{&NodeAttrNodeName{Name: "a"}}
+
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{node}},
+			&PathAttrLinkState{NodeAttrs: nodeAttrs},
+			&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{withdrawn}},
+		},
+	}
+	assert.Equal(t, []LinkStateObject{
+		{Nlri: withdrawn, Withdrawn: true},
+		{Nlri: node, NodeAttrs: nodeAttrs},
+	}, u.LinkStateObjects())
+
+	// without LINK_STATE
+	u.PathAttrs = u.PathAttrs[:2]
+	assert.Equal(t, []LinkStateObject{{Nlri: node}}, u.LinkStateObjects())
+
+	// no link state nlri
+	assert.Len(t, (&UpdateMessage{}).LinkStateObjects(), 0)
+}
+
+func TestDiffLinkStateObjects(t *testing.T) {
+	node := func(asn uint32) LinkStateNlri {
+		return &LinkStateNlriNode{
+			ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+			LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: asn}},
+		}
+	}
+	named := func(asn uint32, name string) LinkStateObject {
+		return LinkStateObject{Nlri: node(asn), NodeAttrs: []NodeAttr{&NodeAttrNodeName{Name: name}}}
+	}
+
+	prev := []LinkStateObject{
+		named(1, "a"),
+		named(2, "b"),
+		named(3, "c"),
+		{Nlri: node(4), NodeAttrs: []NodeAttr{}},
+	}
+	curr := []LinkStateObject{
+		named(5, "e"),
+		named(3, "c"),
+		named(2, "b2"),
+		{Nlri: node(4)},
+		// withdrawn objects are ignored
+		{Nlri: node(6), Withdrawn: true},
+	}
+
+	added, removed, modified := DiffLinkStateObjects(prev, curr)
+	assert.Equal(t, []LinkStateObject{named(5, "e")}, added)
+	assert.Equal(t, []LinkStateObject{named(1, "a")}, removed)
+	assert.Equal(t, []LinkStateObject{named(2, "b2")}, modified)
+
+	// the last object with a key takes precedence
+	added, removed, modified = DiffLinkStateObjects(nil, []LinkStateObject{named(1, "a"), named(1, "b")})
+	assert.Equal(t, []LinkStateObject{named(1, "b")}, added)
+	assert.Len(t, removed, 0)
+	assert.Len(t, modified, 0)
+
+	assert.True(t, named(1, "a").Equal(named(1, "a")))
+	assert.False(t, named(1, "a").Equal(named(2, "a")))
+	assert.False(t, named(1, "a").Equal(LinkStateObject{Nlri: node(1), Withdrawn: true}))
+	assert.False(t, named(1, "a").Equal(LinkStateObject{}))
+
+	// attributes are compared irrespective of order and address form
+	a := LinkStateObject{Nlri: node(1), NodeAttrs: []NodeAttr{
+		&NodeAttrNodeName{Name: "a"},
+		&NodeAttrLocalIPv4RouterID{Address: net.ParseIP("172.16.1.1")},
+	}}
+	b := LinkStateObject{Nlri: node(1), NodeAttrs: []NodeAttr{
+		&NodeAttrLocalIPv4RouterID{Address: net.ParseIP("172.16.1.1").To4()},
+		&NodeAttrNodeName{Name: "a"},
+	}}
+	added, removed, modified = DiffLinkStateObjects([]LinkStateObject{a}, []LinkStateObject{b})
+	assert.Len(t, added, 0)
+	assert.Len(t, removed, 0)
+	assert.Len(t, modified, 0)
+	assert.False(t, named(1, "a").Equal(a))
+}
+
+func TestUpdateMessageValidate(t *testing.T) {
+	u, err := NewNodeUpdate(LinkStateNlriIsIsL2ProtocolID, 64512,
+		&NodeDescriptorIgpRouterIDIsIsNonPseudo{IsoNodeID: 1},
+		&NodeAttrNodeName{Name: "r1"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, u.Validate())
+	assert.Nil(t, (&UpdateMessage{}).Validate())
+
+	isis := &LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriIsIsL2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+	}
+	ospf := &LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+	}
+
+	cases := []struct {
+		name  string
+		attrs []PathAttr
+		errs  int
+	}{
+		{
+			"duplicate attr",
+			[]PathAttr{
+				&PathAttrOrigin{Origin: OriginCodeIGP},
+				&PathAttrOrigin{Origin: OriginCodeIGP},
+			},
+			1,
+		},
+		{
+			"missing origin and as path",
+			[]PathAttr{
+				&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{isis}},
+			},
+			2,
+		},
+		{
+			"link state without mp reach",
+			[]PathAttr{
+				&PathAttrOrigin{Origin: OriginCodeIGP},
+				&PathAttrAsPath{},
+				&PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{Name: "r1"}}},
+			},
+			3,
+		},
+		{
+			"mixed protocols",
+			[]PathAttr{
+				&PathAttrOrigin{Origin: OriginCodeIGP},
+				&PathAttrAsPath{},
+				&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{isis, ospf}},
+				&PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrNodeName{Name: "r1"}}},
+			},
+			1,
+		},
+		{
+			"link attrs for node nlri",
+			[]PathAttr{
+				&PathAttrOrigin{Origin: OriginCodeIGP},
+				&PathAttrAsPath{},
+				&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{isis}},
+				&PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrIgpMetric{Metric: 1}}},
+			},
+			1,
+		},
+		{
+			"serialize error",
+			[]PathAttr{
+				&PathAttrOrigin{Origin: OriginCodeIGP},
+				&PathAttrAsPath{},
+				&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{isis}},
+				&PathAttrLinkState{NodeAttrs: []NodeAttr{&NodeAttrOpaqueNodeAttr{}}},
+			},
+			1,
+		},
+		{
+			"nil attr",
+			[]PathAttr{nil},
+			1,
+		},
+	}
+
+	for _, c := range cases {
+		errs := (&UpdateMessage{PathAttrs: c.attrs}).Validate()
+		assert.Len(t, errs, c.errs, c.name)
+	}
+}
+
+func TestUpdateMessageLinkStateProtocol(t *testing.T) {
+	link := func(protocol LinkStateNlriProtocolID) *LinkStateNlriLink {
+		return &LinkStateNlriLink{
+			ProtocolID:            protocol,
+			LocalNodeDescriptors:  []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+			RemoteNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+		}
+	}
+	prefix := func(protocol LinkStateNlriProtocolID) *LinkStateNlriIPv4Prefix {
+		return &LinkStateNlriIPv4Prefix{
+			LinkStateNlriPrefix: LinkStateNlriPrefix{
+				ProtocolID:           protocol,
+				LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+				PrefixDescriptors: []PrefixDescriptor{
+					&PrefixDescriptorIPReachabilityInfo{Prefix: net.ParseIP("10.0.0.0").To4(), PrefixLength: 8},
+				},
+			},
+		}
+	}
+	adjSID := func(f LinkAttrAdjSIDFlags) LinkAttr {
+		return &LinkAttrAdjSID{Flags: f, SIDIndexLabel: &SIDIndexLabelLabel{Label: 2}}
+	}
+	prefixSID := func(f PrefixAttrPrefixSIDFlags) PrefixAttr {
+		return &PrefixAttrPrefixSID{Flags: f, SIDIndexLabel: &SIDIndexLabelLabel{Label: 2}}
+	}
+
+	cases := []struct {
+		name  string
+		nlri  LinkStateNlri
+		ls    *PathAttrLinkState
+		valid bool
+	}{
+		{"isis adj sid", link(LinkStateNlriIsIsL2ProtocolID), &PathAttrLinkState{LinkAttrs: []LinkAttr{adjSID(&LinkAttrAdjSIDFlagsIsIs{})}}, true},
+		{"ospf adj sid", link(LinkStateNlriOSPFv2ProtocolID), &PathAttrLinkState{LinkAttrs: []LinkAttr{adjSID(&LinkAttrAdjSIDFlagsOspf{})}}, true},
+		{"ospf adj sid isis nlri", link(LinkStateNlriIsIsL2ProtocolID), &PathAttrLinkState{LinkAttrs: []LinkAttr{adjSID(&LinkAttrAdjSIDFlagsOspf{})}}, false},
+		{"isis adj sid bgp nlri", link(LinkStateNlriBgpProtocolID), &PathAttrLinkState{LinkAttrs: []LinkAttr{adjSID(&LinkAttrAdjSIDFlagsIsIs{})}}, false},
+		{
+			"ospf bundle member adj sid isis nlri",
+			link(LinkStateNlriIsIsL2ProtocolID),
+			&PathAttrLinkState{LinkAttrs: []LinkAttr{&LinkAttrL2BundleMember{MemberDescriptor: 1, LinkAttrs: []LinkAttr{adjSID(&LinkAttrAdjSIDFlagsOspf{})}}}},
+			false,
+		},
+		{"isis prefix sid", prefix(LinkStateNlriIsIsL1ProtocolID), &PathAttrLinkState{PrefixAttrs: []PrefixAttr{prefixSID(&PrefixAttrPrefixSIDFlagsIsIs{})}}, true},
+		{"isis prefix sid ospf nlri", prefix(LinkStateNlriOSPFv3ProtocolID), &PathAttrLinkState{PrefixAttrs: []PrefixAttr{prefixSID(&PrefixAttrPrefixSIDFlagsIsIs{})}}, false},
+		{
+			"ospf range isis nlri",
+			prefix(LinkStateNlriIsIsL2ProtocolID),
+			&PathAttrLinkState{PrefixAttrs: []PrefixAttr{&PrefixAttrRange{Flags: &PrefixAttrRangeFlagsOspf{}, RangeSize: 1}}},
+			false,
+		},
+		{"ospfv2 prefix flags", prefix(LinkStateNlriOSPFv2ProtocolID), &PathAttrLinkState{PrefixAttrs: []PrefixAttr{&PrefixAttrFlagsOSPFv2{}}}, true},
+		{"ospfv2 prefix flags ospfv3 nlri", prefix(LinkStateNlriOSPFv3ProtocolID), &PathAttrLinkState{PrefixAttrs: []PrefixAttr{&PrefixAttrFlagsOSPFv2{}}}, false},
+		{"isis prefix flags ospfv2 nlri", prefix(LinkStateNlriOSPFv2ProtocolID), &PathAttrLinkState{PrefixAttrs: []PrefixAttr{&PrefixAttrFlagsIsIs{}}}, false},
+	}
+
+	for _, c := range cases {
+		u := &UpdateMessage{
+			PathAttrs: []PathAttr{
+				&PathAttrOrigin{Origin: OriginCodeIGP},
+				&PathAttrAsPath{},
+				&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, NextHop: net.ParseIP("172.16.1.1").To4(), Nlri: []LinkStateNlri{c.nlri}},
+				c.ls,
+			},
+		}
+		_, err := u.serialize()
+		if c.valid {
+			assert.Nil(t, err, c.name)
+		} else if assert.NotNil(t, err, c.name) {
+			assert.True(t, strings.Contains(err.Error(), "inconsistent"), c.name)
+		}
+	}
+
+	// the link state attribute is decoded according to the first preceding nlri
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{link(LinkStateNlriOSPFv2ProtocolID)}},
+			&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, NextHop: net.ParseIP("172.16.1.1").To4(), Nlri: []LinkStateNlri{link(LinkStateNlriIsIsL2ProtocolID)}},
+			&PathAttrLinkState{LinkAttrs: []LinkAttr{adjSID(&LinkAttrAdjSIDFlagsIsIs{})}},
+		},
+	}
+	_, err := u.serialize()
+	assert.NotNil(t, err)
+
+	// no preceding nlri
+	u.PathAttrs = []PathAttr{u.PathAttrs[2], u.PathAttrs[1]}
+	_, err = u.serialize()
+	assert.NotNil(t, err)
+}
+
+func TestNewNodeUpdate(t *testing.T) {
+	u, err := NewNodeUpdate(LinkStateNlriIsIsL2ProtocolID, 64512,
+		&NodeDescriptorIgpRouterIDIsIsNonPseudo{IsoNodeID: 1},
+		&NodeAttrNodeName{Name: "r1"},
+		&NodeAttrSRMSPref{Preference: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := u.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := messagesFromBytes(b, decodeOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, m, 1) {
+		got := m[0].(*UpdateMessage)
+		assert.Nil(t, validateUpdateLinkStateAttrs(got))
+		assert.Equal(t, got.PathAttrs, u.PathAttrs)
+	}
+
+	// no attrs
+	u, err = NewNodeUpdate(LinkStateNlriBgpProtocolID, 64512, &NodeDescriptorBgpRouterID{RouterID: net.ParseIP("172.16.1.1").To4()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.PathAttrs, 3)
+
+	// router ID inconsistent with protocol
+	_, err = NewNodeUpdate(LinkStateNlriOSPFv2ProtocolID, 64512, &NodeDescriptorIgpRouterIDIsIsNonPseudo{IsoNodeID: 1})
+	assert.NotNil(t, err)
+	_, err = NewNodeUpdate(LinkStateNlriOSPFv2ProtocolID, 64512, nil)
+	assert.NotNil(t, err)
+
+	// attr fails to serialize
+	_, err = NewNodeUpdate(LinkStateNlriOSPFv2ProtocolID, 64512,
+		&NodeDescriptorIgpRouterIDOspfNonPseudo{RouterID: net.ParseIP("172.16.1.1").To4()},
+		&NodeAttrOpaqueNodeAttr{},
+	)
+	assert.NotNil(t, err)
+}
+
+func TestUpdateMessageMaxLen(t *testing.T) {
+	nlri := make([]LinkStateNlri, 0)
+	for i := 0; i < 200; i++ {
+		nlri = append(nlri, &LinkStateNlriNode{
+			ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+			ID:                   uint64(i),
+			LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+		})
+	}
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: nlri,
+			},
+		},
+	}
+
+	// 200 * 25 byte nlri exceeds 4096
+	_, err := u.serialize()
+	assert.NotNil(t, err)
+
+	b, err := u.serializeWithMaxLen(65535)
+	if assert.Nil(t, err) {
+		assert.True(t, len(b) > maxMessageLen)
+	}
+
+	u.PathAttrs[0].(*PathAttrMpReach).Nlri = nlri[:100]
+	b, err = u.serialize()
+	if assert.Nil(t, err) {
+		assert.True(t, len(b) <= maxMessageLen)
+	}
+
+	_, err = u.serializeWithMaxLen(len(b) - 1)
+	assert.NotNil(t, err)
+}
+
+// malformedLinkStateUpdate returns a serialized update message body
+// containing a link state path attribute with invalid flags
+func malformedLinkStateUpdate(t testing.TB) []byte {
+	ls := &PathAttrLinkState{
+		NodeAttrs: []NodeAttr{&NodeAttrNodeName{Name: "node"}},
+	}
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: []LinkStateNlri{
+					&LinkStateNlriNode{
+						ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+						LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+					},
+				},
+			},
+			ls,
+		},
+	}
+	b, err := u.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lsb, err := ls.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// link state is serialized last, set the transitive flag
+	b = b[19:]
+	b[len(b)-len(lsb)] |= 0x40
+	return b
+}
+
+func TestUpdateErrorPolicyOptionalAttr(t *testing.T) {
+	b := malformedLinkStateUpdate(t)
+
+	// session reset
+	u := &UpdateMessage{}
+	err := u.deserializeWithOptions(b, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// attribute discard
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{OptionalAttr: UpdateErrorActionAttributeDiscard},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.errs, 1)
+	if assert.Len(t, u.PathAttrs, 2) {
+		assert.IsType(t, &PathAttrOrigin{}, u.PathAttrs[0])
+		assert.IsType(t, &PathAttrMpReach{}, u.PathAttrs[1])
+	}
+
+	// treat as withdraw
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{OptionalAttr: UpdateErrorActionTreatAsWithdraw},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.errs, 1)
+	if assert.Len(t, u.PathAttrs, 1) && assert.IsType(t, &PathAttrMpUnreach{}, u.PathAttrs[0]) {
+		unreach := u.PathAttrs[0].(*PathAttrMpUnreach)
+		assert.Equal(t, unreach.Afi, BgpLsAfi)
+		assert.Equal(t, unreach.Safi, BgpLsSafi)
+		assert.Len(t, unreach.Nlri, 1)
+		_, err = unreach.serialize()
+		assert.Nil(t, err)
+	}
+}
+
+func TestTreatAsWithdraw(t *testing.T) {
+	node := &LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+	}
+
+	// no nlri
+	attrs := treatAsWithdraw([]PathAttr{&PathAttrOrigin{}})
+	assert.Len(t, attrs, 0)
+
+	// existing unreach is extended
+	unreach := &PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{node}}
+	attrs = treatAsWithdraw([]PathAttr{
+		&PathAttrOrigin{},
+		unreach,
+		&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{node}},
+	})
+	assert.Equal(t, attrs, []PathAttr{unreach})
+	assert.Len(t, unreach.Nlri, 2)
+
+	// unreach of another address family is not extended
+	rawUnreach := &PathAttrMpUnreach{Afi: 2, Safi: 1, RawNlri: []byte{0}}
+	attrs = treatAsWithdraw([]PathAttr{
+		rawUnreach,
+		&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: []LinkStateNlri{node}},
+	})
+	assert.Equal(t, attrs, []PathAttr{rawUnreach, &PathAttrMpUnreach{
+		f:    PathAttrFlags{Optional: true},
+		Afi:  BgpLsAfi,
+		Safi: BgpLsSafi,
+		Nlri: []LinkStateNlri{node},
+	}})
+
+	// raw nlri
+	attrs = treatAsWithdraw([]PathAttr{
+		rawUnreach,
+		&PathAttrMpReach{Afi: 2, Safi: 1, RawNlri: []byte{1}},
+	})
+	assert.Equal(t, attrs, []PathAttr{rawUnreach})
+	assert.Equal(t, rawUnreach.RawNlri, []byte{0, 1})
+}
+
+func TestUpdateErrorActionString(t *testing.T) {
+	assert.Equal(t, UpdateErrorActionSessionReset.String(), "session reset")
+	assert.Equal(t, UpdateErrorActionTreatAsWithdraw.String(), "treat-as-withdraw")
+	assert.Equal(t, UpdateErrorActionAttributeDiscard.String(), "attribute discard")
+	assert.Equal(t, UpdateErrorAction(10).String(), "unknown")
+}
+
+func TestLinkStateNlriProtocolID(t *testing.T) {
+	assert.Equal(t, LinkStateNlriIsIsL1ProtocolID.String(), "isis-l1")
+	assert.Equal(t, LinkStateNlriOSPFv3ProtocolID.String(), "ospfv3")
+	assert.Equal(t, LinkStateNlriBgpProtocolID.String(), "bgp")
+	assert.Equal(t, LinkStateNlriProtocolID(0).String(), "unknown(0)")
+
+	for p := LinkStateNlriProtocolID(0); p <= LinkStateNlriBgpProtocolID+1; p++ {
+		assert.Equal(t, p.IsIGP(), p.IsIsIs() || p.IsOSPF(), p.String())
+		assert.Equal(t, p.IsIsIs(), p == LinkStateNlriIsIsL1ProtocolID || p == LinkStateNlriIsIsL2ProtocolID, p.String())
+		assert.Equal(t, p.IsOSPF(), p == LinkStateNlriOSPFv2ProtocolID || p == LinkStateNlriOSPFv3ProtocolID, p.String())
+		assert.Equal(t, p.IsBGP(), p == LinkStateNlriBgpProtocolID, p.String())
+	}
+	assert.False(t, LinkStateNlriDirectProtocolID.IsIGP())
+	assert.False(t, LinkStateNlriStaticProtocolID.IsIGP())
+}
+
+func TestUpdateMessageClone(t *testing.T) {
+	u := &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrMpReach{
+				Afi:  BgpLsAfi,
+				Safi: BgpLsSafi,
+				Nlri: []LinkStateNlri{
+					&LinkStateNlriNode{
+						ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+						LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+					},
+				},
+			},
+			&PathAttrLinkState{
+				NodeAttrs: []NodeAttr{
+					&NodeAttrLocalIPv4RouterID{Address: net.ParseIP("172.16.1.1").To4()},
+					&NodeAttrOpaqueNodeAttr{Data: []byte{1, 2, 3}},
+				},
+			},
+		},
+	}
+
+	c := u.Clone()
+	assert.Equal(t, c, u)
+
+	reach := u.PathAttrs[1].(*PathAttrMpReach)
+	reach.Nlri[0].(*LinkStateNlriNode).LocalNodeDescriptors[0].(*NodeDescriptorASN).ASN = 64513
+	ls := u.PathAttrs[2].(*PathAttrLinkState)
+	ls.NodeAttrs[0].(*NodeAttrLocalIPv4RouterID).Address[3] = 2
+	ls.NodeAttrs[1].(*NodeAttrOpaqueNodeAttr).Data[0] = 9
+
+	cReach := c.PathAttrs[1].(*PathAttrMpReach)
+	assert.Equal(t, cReach.Nlri[0].(*LinkStateNlriNode).LocalNodeDescriptors[0].(*NodeDescriptorASN).ASN, uint32(64512))
+	cLs := c.PathAttrs[2].(*PathAttrLinkState)
+	assert.True(t, cLs.NodeAttrs[0].(*NodeAttrLocalIPv4RouterID).Address.Equal(net.ParseIP("172.16.1.1")))
+	assert.Equal(t, cLs.NodeAttrs[1].(*NodeAttrOpaqueNodeAttr).Data, []byte{1, 2, 3})
+}
+
+func TestPathAttrRawBytes(t *testing.T) {
+	u := &UpdateMessage{PathAttrs: fullTopologyPathAttrs()}
+	msg, err := u.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header, withdrawn routes len and path attribute len
+	b := msg[23:]
+
+	attrs, _, err := deserializePathAttrs(b, decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range attrs {
+		assert.Nil(t, a.RawBytes())
+	}
+
+	attrs, _, err = deserializePathAttrs(b, decodeOptions{retainRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw []byte
+	for _, a := range attrs {
+		raw = append(raw, a.RawBytes()...)
+	}
+	assert.Equal(t, raw, b)
+
+	// raw bytes do not alias the input or a clone
+	b[0] = ^b[0]
+	assert.NotEqual(t, attrs[0].RawBytes()[0], b[0])
+	c := (&UpdateMessage{PathAttrs: attrs}).Clone()
+	c.PathAttrs[0].RawBytes()[0] = b[0]
+	assert.NotEqual(t, attrs[0].RawBytes()[0], b[0])
+}
+
+func TestUpdateErrorPolicyMpReach(t *testing.T) {
+	node := &LinkStateNlriNode{
+		ProtocolID:           LinkStateNlriOSPFv2ProtocolID,
+		LocalNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}},
+	}
+	nb, err := node.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reach := &PathAttrMpReach{
+		Afi:  BgpLsAfi,
+		Safi: BgpLsSafi,
+		Nlri: []LinkStateNlri{node, node},
+	}
+	rb, err := reach.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := &PathAttrLinkState{
+		NodeAttrs: []NodeAttr{&NodeAttrNodeName{Name: "node"}},
+	}
+	lsb, err := ls.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(rb)+len(lsb)))
+	b = append(b, rb...)
+	b = append(b, lsb...)
+
+	// the second nlri has an unknown type
+	secondType := 4 + 3 + 5 + len(nb) + 1
+	b[secondType] = 99
+
+	// session reset
+	u := &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{})
+	assert.NotNil(t, err)
+
+	// attribute discard is not permitted
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{MpReach: UpdateErrorActionAttributeDiscard},
+	})
+	assert.NotNil(t, err)
+
+	// treat as withdraw
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{MpReach: UpdateErrorActionTreatAsWithdraw},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.errs, 1)
+	if assert.Len(t, u.PathAttrs, 1) && assert.IsType(t, &PathAttrMpUnreach{}, u.PathAttrs[0]) {
+		assert.Equal(t, u.PathAttrs[0].(*PathAttrMpUnreach).Nlri, []LinkStateNlri{node})
+	}
+
+	// invalid flags
+	b[secondType] = uint8(LinkStateNlriNodeType)
+	b[4] |= 0x40
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{})
+	assert.NotNil(t, err)
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{MpReach: UpdateErrorActionTreatAsWithdraw},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.errs, 1)
+	if assert.Len(t, u.PathAttrs, 1) && assert.IsType(t, &PathAttrMpUnreach{}, u.PathAttrs[0]) {
+		assert.Len(t, u.PathAttrs[0].(*PathAttrMpUnreach).Nlri, 2)
+	}
+
+	// nlri cannot be located
+	b = b[:len(b)-len(lsb)-1]
+	binary.BigEndian.PutUint16(b[2:], uint16(len(rb)-1))
+	b[6]--
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{MpReach: UpdateErrorActionTreatAsWithdraw},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestUpdateErrorPolicyDuplicateAttr(t *testing.T) {
+	u := gracefulRestartNode()
+	u.PathAttrs = append(u.PathAttrs, &PathAttrOrigin{Origin: OriginCodeIncomplete})
+	b, err := u.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = b[19:]
+
+	// session reset
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{})
+	if assert.IsType(t, &errWithNotification{}, err) {
+		assert.Equal(t, NotifErrSubcodeMalformedAttr, err.(*errWithNotification).subcode)
+	}
+
+	// attribute discard keeps the first occurrence
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{DuplicateAttr: UpdateErrorActionAttributeDiscard},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.errs, 1)
+	if assert.Len(t, u.PathAttrs, 2) && assert.IsType(t, &PathAttrOrigin{}, u.PathAttrs[0]) {
+		assert.Equal(t, u.PathAttrs[0].(*PathAttrOrigin).Origin, OriginCodeIGP)
+	}
+
+	// treat as withdraw
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{DuplicateAttr: UpdateErrorActionTreatAsWithdraw},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.errs, 1)
+	if assert.Len(t, u.PathAttrs, 1) {
+		assert.IsType(t, &PathAttrMpUnreach{}, u.PathAttrs[0])
+	}
+
+	// duplicate unrecognized attributes are also discarded
+	unknown := []byte{0xc0, 99, 1, 0, 0xc0, 99, 1, 0}
+	binary.BigEndian.PutUint16(b[2:], binary.BigEndian.Uint16(b[2:])+uint16(len(unknown)))
+	b = append(b, unknown...)
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b, decodeOptions{
+		policy: UpdateErrorPolicy{DuplicateAttr: UpdateErrorActionAttributeDiscard},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, u.errs, 2)
+
+	// a repeated MP_REACH_NLRI always resets the session
+	u = gracefulRestartNode()
+	u.PathAttrs = append(u.PathAttrs, u.PathAttrs[1])
+	b, err = u.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u = &UpdateMessage{}
+	err = u.deserializeWithOptions(b[19:], decodeOptions{
+		policy: UpdateErrorPolicy{
+			MpReach:       UpdateErrorActionTreatAsWithdraw,
+			DuplicateAttr: UpdateErrorActionAttributeDiscard,
+		},
+	})
+	if assert.IsType(t, &errWithNotification{}, err) {
+		assert.Equal(t, NotifErrSubcodeMalformedAttr, err.(*errWithNotification).subcode)
+	}
+}
+
+func benchmarkUpdateMessage() *UpdateMessage {
+	nlri := make([]LinkStateNlri, 0, 32)
+	for i := 0; i < 32; i++ {
+		nlri = append(nlri, &LinkStateNlriLink{
+			ProtocolID:            LinkStateNlriOSPFv2ProtocolID,
+			LocalNodeDescriptors:  []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}, &NodeDescriptorBgpLsID{ID: 1}},
+			RemoteNodeDescriptors: []NodeDescriptor{&NodeDescriptorASN{ASN: 64512}, &NodeDescriptorBgpLsID{ID: 1}},
+			LinkDescriptors: []LinkDescriptor{
+				&LinkDescriptorIPv4InterfaceAddress{Address: net.IPv4(172, 16, byte(i), 1).To4()},
+				&LinkDescriptorLinkIDs{LocalID: uint32(i), RemoteID: uint32(i + 1)},
+			},
+		})
+	}
+
+	return &UpdateMessage{
+		PathAttrs: []PathAttr{
+			&PathAttrOrigin{Origin: OriginCodeIGP},
+			&PathAttrAsPath{Segments: []AsPathSegment{&AsPathSegmentSequence{Sequence: []uint16{64512}}}},
+			&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi, Nlri: nlri},
+			&PathAttrLinkState{
+				LinkAttrs: []LinkAttr{
+					&LinkAttrMaxLinkBandwidth{BytesPerSecond: 1.25e9},
+					&LinkAttrTEDefaultMetric{Metric: 10},
+					&LinkAttrIgpMetric{Metric: 10, Type: LinkAttrIgpMetricOspfType},
+					&LinkAttrLinkName{Name: "link"},
+				},
+			},
+		},
+	}
+}
+
+func BenchmarkUpdateMessageSerialize(b *testing.B) {
+	u := benchmarkUpdateMessage()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := u.serialize(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPathAttrMpReachSerialize(b *testing.B) {
+	reach := benchmarkUpdateMessage().PathAttrs[2].(*PathAttrMpReach)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reach.serialize(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPathAttrMpUnreachSerialize(b *testing.B) {
+	reach := benchmarkUpdateMessage().PathAttrs[2].(*PathAttrMpReach)
+	unreach := &PathAttrMpUnreach{Afi: reach.Afi, Safi: reach.Safi, Nlri: reach.Nlri}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := unreach.serialize(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFullTopologyUpdateSerialize(b *testing.B) {
+	u := &UpdateMessage{PathAttrs: fullTopologyPathAttrs()}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := u.serialize(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeserializePathAttrs(b *testing.B) {
+	u := &UpdateMessage{PathAttrs: fullTopologyPathAttrs()}
+	msg, err := u.serialize()
+	if err != nil {
+		b.Fatal(err)
+	}
+	// header, withdrawn routes len and path attribute len
+	attrs := msg[23:]
+	b.SetBytes(int64(len(attrs)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := deserializePathAttrs(attrs, decodeOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateMessageWellKnownAttrs(t *testing.T) {
+	body := func(u *UpdateMessage) []byte {
+		b, err := u.serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b[19:]
+	}
+	assertMissing := func(b []byte, attrType uint8) {
+		u := &UpdateMessage{}
+		err := u.deserializeWithOptions(b, decodeOptions{requireWellKnown: true})
+		if assert.IsType(t, &errWithNotification{}, err) {
+			n := err.(*errWithNotification)
+			assert.Equal(t, NotifErrCodeUpdateMessage, n.code)
+			assert.Equal(t, NotifErrSubcodeMissingWellKnownAttr, n.subcode)
+			assert.Equal(t, []byte{attrType}, n.data)
+		}
+	}
+
+	// missing AS_PATH
+	node := gracefulRestartNode()
+	b := body(node)
+	assertMissing(b, uint8(PathAttrAsPathType))
+	u := &UpdateMessage{}
+	assert.Nil(t, u.deserializeWithOptions(b, decodeOptions{}))
+
+	// missing ORIGIN
+	node.PathAttrs[0] = &PathAttrAsPath{}
+	assertMissing(body(node), uint8(PathAttrOriginType))
+
+	node.PathAttrs = append(node.PathAttrs, &PathAttrOrigin{Origin: OriginCodeIGP})
+	u = &UpdateMessage{}
+	assert.Nil(t, u.deserializeWithOptions(body(node), decodeOptions{requireWellKnown: true}))
+
+	// withdrawals and End-of-RIB do not require well-known attributes
+	for _, u := range []*UpdateMessage{
+		{PathAttrs: []PathAttr{&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi}}},
+		{PathAttrs: []PathAttr{&PathAttrMpReach{Afi: BgpLsAfi, Safi: BgpLsSafi}}},
+		{},
+	} {
+		assert.Nil(t, (&UpdateMessage{}).deserializeWithOptions(body(u), decodeOptions{requireWellKnown: true}))
+	}
+
+	// IPv4 unicast nlri require NEXT_HOP
+	b = body(&UpdateMessage{PathAttrs: []PathAttr{&PathAttrOrigin{Origin: OriginCodeIGP}, &PathAttrAsPath{}}})
+	b = append(b, 24, 10, 0, 0)
+	assertMissing(b, pathAttrNextHopType)
+
+	nextHop := []byte{0x40, pathAttrNextHopType, 4, 10, 0, 0, 1}
+	pathAttrLen := binary.BigEndian.Uint16(b[2:])
+	binary.BigEndian.PutUint16(b[2:], pathAttrLen+uint16(len(nextHop)))
+	b = append(b[:4+pathAttrLen], append(nextHop, b[4+pathAttrLen:]...)...)
+	u = &UpdateMessage{}
+	assert.Nil(t, u.deserializeWithOptions(b, decodeOptions{requireWellKnown: true}))
+}
+
+func BenchmarkMessagesFromBytes(b *testing.B) {
+	u := &UpdateMessage{PathAttrs: fullTopologyPathAttrs()}
+	msg, err := u.serialize()
+	if err != nil {
+		b.Fatal(err)
+	}
+	const numUpdates = 100
+	msgs := bytes.Repeat(msg, numUpdates)
+	b.SetBytes(int64(len(msgs)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m, err := messagesFromBytes(msgs, decodeOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(m) != numUpdates {
+			b.Fatalf("expected %d messages, got %d", numUpdates, len(m))
+		}
+	}
+}
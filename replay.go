@@ -0,0 +1,298 @@
+package bgpls
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// MRT record types and BGP4MP subtypes carrying bgp messages.
+//
+// https://tools.ietf.org/html/rfc6396#section-4.4
+const (
+	mrtTypeBGP4MP   = 16
+	mrtTypeBGP4MPET = 17
+
+	bgp4mpSubtypeMessage    = 1
+	bgp4mpSubtypeMessageAS4 = 4
+
+	// maxMRTMessageRecordLen is the length of a BGP4MP_ET MESSAGE_AS4 record
+	// of IPv6 peers carrying a bgp message of maxExtendedMessageLen, i.e. the
+	// microsecond timestamp, AS numbers, interface index, address family,
+	// addresses and message.
+	maxMRTMessageRecordLen = 4 + 4*2 + 2 + 2 + 16*2 + maxExtendedMessageLen
+)
+
+// ReplayConfig is the configuration for Replay.
+// Neighbor is the neighbor replayed events are associated with. Only messages received from
+// Neighbor.Address are replayed, unless it is unset in which case messages received from all
+// peers in the recording are replayed. StrictAttrValidation, RequireWellKnownAttrs,
+// UpdateErrorPolicy and AddressFamilies apply to decoding as they do for a live neighbor.
+// Speed scales the pace at which messages are replayed relative to the recording, e.g. 1
+// replays at the recorded pace and 10 ten times as fast. If unset, messages are replayed
+// without delay.
+type ReplayConfig struct {
+	Neighbor *NeighborConfig
+	Speed    float64
+}
+
+// Replay reads bgp messages recorded in MRT format from r and sends the events a neighbor in
+// EstablishedState generates for them on events, i.e. EventNeighborUpdateReceived,
+// EventNeighborUpdateWarning, EventNeighborEndOfRIB and EventNeighborNotificationReceived. A
+// message that fails to decode results in an EventNeighborErr, replay continues with the next
+// message. The Timestamp of each event is the time the message was recorded.
+//
+// Messages are read from BGP4MP and BGP4MP_ET records of the MESSAGE and MESSAGE_AS4
+// subtypes, messages sent by the recording speaker and other records are skipped. OPEN
+// messages set the PeerRouterID of subsequent EventNeighborUpdateReceived. Messages may be
+// up to the extended message length of RFC 8654.
+//
+// Replay returns nil once r is exhausted, or ctx.Err() if ctx is done first.
+//
+// https://tools.ietf.org/html/rfc6396
+func Replay(ctx context.Context, r io.Reader, config *ReplayConfig, events chan<- Event) error {
+	if config.Neighbor == nil {
+		return errors.New("replay neighbor config is nil")
+	}
+	if config.Speed < 0 {
+		return errors.New("replay speed cannot be negative")
+	}
+
+	opts := decodeOptions{
+		strict:           config.Neighbor.StrictAttrValidation,
+		policy:           config.Neighbor.UpdateErrorPolicy,
+		families:         config.Neighbor.AddressFamilies,
+		requireWellKnown: config.Neighbor.RequireWellKnownAttrs,
+		// a recording may contain extended messages
+		//
+		// https://tools.ietf.org/html/rfc8654
+		maxLen: maxExtendedMessageLen,
+	}
+
+	send := func(e Event, t time.Time) error {
+		e.(interface{ setTimestamp(time.Time) }).setTimestamp(t)
+		select {
+		case events <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var peerRouterID net.IP
+	var first time.Time
+	start := time.Now()
+	for {
+		rec, err := readMRTRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.message == nil {
+			continue
+		}
+		if config.Neighbor.Address != nil && !config.Neighbor.Address.Equal(rec.peer) {
+			continue
+		}
+
+		if config.Speed > 0 {
+			if first.IsZero() {
+				first = rec.t
+			}
+			delay := time.Until(start.Add(time.Duration(float64(rec.t.Sub(first)) / config.Speed)))
+			if delay > 0 {
+				t := time.NewTimer(delay)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+
+		messages, err := messagesFromBytes(rec.message, opts)
+		if err == nil && len(messages) != 1 {
+			err = errors.New("mrt record does not contain a single bgp message")
+		}
+		if err != nil {
+			err = send(newEventNeighborErr(config.Neighbor, err), rec.t)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var replayed []Event
+		switch m := messages[0].(type) {
+		case *openMessage:
+			peerRouterID = bgpIDToIP(m.bgpID)
+		case *UpdateMessage:
+			warnings := append([]error(nil), m.errs...)
+			if err := validateUpdateLinkStateAttrs(m); err != nil {
+				if config.Neighbor.StrictAttrValidation {
+					replayed = append(replayed, newEventNeighborErr(config.Neighbor, err))
+					break
+				}
+				warnings = append(warnings, err)
+			}
+			for _, err := range warnings {
+				replayed = append(replayed, newEventNeighborUpdateWarning(config.Neighbor, err, m))
+			}
+			replayed = append(replayed, newEventNeighborUpdateReceived(config.Neighbor, peerRouterID, m))
+			if family, ok := m.EndOfRIB(); ok {
+				replayed = append(replayed, newEventNeighborEndOfRIB(config.Neighbor, family, false))
+			}
+		case *NotificationMessage:
+			replayed = append(replayed, newEventNeighborNotificationReceived(config.Neighbor, m))
+		}
+
+		for _, e := range replayed {
+			err := send(e, rec.t)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// mrtRecord is an MRT record, message is nil unless it is a bgp message
+// received from peer.
+type mrtRecord struct {
+	t       time.Time
+	peer    net.IP
+	message []byte
+}
+
+// readMRTRecord reads the next record from r. io.EOF is returned if r ends on
+// a record boundary, otherwise io.ErrUnexpectedEOF.
+func readMRTRecord(r io.Reader) (*mrtRecord, error) {
+	/*
+		https://tools.ietf.org/html/rfc6396#section-2
+		0                   1                   2                   3
+		0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                           Timestamp                           |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|             Type              |            Subtype            |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                             Length                            |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      Message... (variable)
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	*/
+	header := make([]byte, 12)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	t := binary.BigEndian.Uint32(header)
+	recordType := binary.BigEndian.Uint16(header[4:])
+	subtype := binary.BigEndian.Uint16(header[6:])
+	length := binary.BigEndian.Uint32(header[8:])
+
+	rec := &mrtRecord{t: time.Unix(int64(t), 0)}
+	if (recordType != mrtTypeBGP4MP && recordType != mrtTypeBGP4MPET) ||
+		(subtype != bgp4mpSubtypeMessage && subtype != bgp4mpSubtypeMessageAS4) {
+		// skipped without allocating, other records may be large
+		_, err := io.CopyN(io.Discard, r, int64(length))
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return rec, nil
+	}
+
+	// the length of a corrupt record is not trusted to allocate
+	if length > maxMRTMessageRecordLen {
+		return nil, fmt.Errorf("mrt bgp4mp record length %d exceeds maximum of %d", length, maxMRTMessageRecordLen)
+	}
+	b := make([]byte, length)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	/*
+		https://tools.ietf.org/html/rfc6396#section-3
+		Extended Timestamp MRT Header
+
+		0                   1                   2                   3
+		0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                           Timestamp                           |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|             Type              |            Subtype            |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                             Length                            |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      Microsecond Timestamp                    |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      Message... (variable)
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	*/
+	if recordType == mrtTypeBGP4MPET {
+		if len(b) < 4 {
+			return nil, errors.New("mrt record too short")
+		}
+		rec.t = time.Unix(int64(t), int64(binary.BigEndian.Uint32(b))*int64(time.Microsecond))
+		b = b[4:]
+	}
+
+	/*
+		https://tools.ietf.org/html/rfc6396#section-4.4.2
+		0                   1                   2                   3
+		0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|         Peer AS Number        |        Local AS Number        |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|        Interface Index        |        Address Family         |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      Peer IP Address (variable)               |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      Local IP Address (variable)              |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                    BGP Message... (variable)
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+		The MESSAGE_AS4 subtype differs only in the length of the AS
+		numbers, which are 4 octets.
+	*/
+	asLen := 2
+	if subtype == bgp4mpSubtypeMessageAS4 {
+		asLen = 4
+	}
+	if len(b) < asLen*2+4 {
+		return nil, errors.New("mrt bgp4mp record too short")
+	}
+	b = b[asLen*2+2:]
+	var ipLen int
+	switch afi := binary.BigEndian.Uint16(b); afi {
+	case uint16(IPv4Afi):
+		ipLen = 4
+	case uint16(IPv6Afi):
+		ipLen = 16
+	default:
+		return nil, fmt.Errorf("invalid mrt bgp4mp address family %d", afi)
+	}
+	b = b[2:]
+	if len(b) < ipLen*2 {
+		return nil, errors.New("mrt bgp4mp record too short")
+	}
+	rec.peer = copyIP(b[:ipLen])
+	rec.message = b[ipLen*2:]
+
+	return rec, nil
+}
@@ -0,0 +1,155 @@
+package bgpls
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mrtMessage returns a BGP4MP_ET MESSAGE_AS4 record of m received from peer.
+func mrtMessage(t *testing.T, ts time.Time, peer net.IP, m Message) []byte {
+	msg, err := m.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mrtMessageBytes(ts, peer, msg)
+}
+
+// mrtMessageBytes returns a BGP4MP_ET MESSAGE_AS4 record of the serialized
+// message msg received from peer.
+func mrtMessageBytes(ts time.Time, peer net.IP, msg []byte) []byte {
+	body := make([]byte, 16)
+	binary.BigEndian.PutUint32(body, uint32(ts.Nanosecond()/1000))
+	binary.BigEndian.PutUint32(body[4:], 64512)
+	binary.BigEndian.PutUint32(body[8:], 64513)
+	binary.BigEndian.PutUint16(body[14:], uint16(IPv4Afi))
+	body = append(body, peer.To4()...)
+	body = append(body, net.ParseIP("172.16.0.2").To4()...)
+	body = append(body, msg...)
+
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b, uint32(ts.Unix()))
+	binary.BigEndian.PutUint16(b[4:], mrtTypeBGP4MPET)
+	binary.BigEndian.PutUint16(b[6:], bgp4mpSubtypeMessageAS4)
+	binary.BigEndian.PutUint32(b[8:], uint32(len(body)))
+	return append(b, body...)
+}
+
+func TestReplay(t *testing.T) {
+	peer := net.ParseIP("172.16.0.1")
+	conf := &NeighborConfig{
+		Address:  peer,
+		ASN:      64512,
+		HoldTime: time.Second * 30,
+	}
+	ts := time.Unix(1600000000, 123456000)
+
+	open, err := newOpenMessage(64512, time.Second*30, net.ParseIP("1.1.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	b = append(b, mrtMessage(t, ts, peer, open)...)
+	b = append(b, mrtMessage(t, ts, peer, &keepAliveMessage{})...)
+	// a record of another type is skipped
+	b = append(b, []byte{0, 0, 0, 0, 0, 13, 0, 1, 0, 0, 0, 1, 0}...)
+	// messages from other peers are skipped
+	b = append(b, mrtMessage(t, ts, net.ParseIP("172.16.0.3"), gracefulRestartNode())...)
+	b = append(b, mrtMessage(t, ts.Add(time.Second), peer, gracefulRestartNode())...)
+	b = append(b, mrtMessage(t, ts.Add(time.Second*2), peer, &UpdateMessage{
+		PathAttrs: []PathAttr{&PathAttrMpUnreach{Afi: BgpLsAfi, Safi: BgpLsSafi}},
+	})...)
+	b = append(b, mrtMessage(t, ts.Add(time.Second*3), peer, &NotificationMessage{Code: NotifErrCodeCease})...)
+
+	events := make(chan Event, 16)
+	err = Replay(context.Background(), bytes.NewReader(b), &ReplayConfig{Neighbor: conf, Speed: 1000}, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(events)
+
+	var replayed []Event
+	for e := range events {
+		replayed = append(replayed, e)
+	}
+	if assert.Len(t, replayed, 4) {
+		if assert.IsType(t, &EventNeighborUpdateReceived{}, replayed[0]) {
+			e := replayed[0].(*EventNeighborUpdateReceived)
+			assert.Equal(t, ts.Add(time.Second), e.Timestamp())
+			assert.Equal(t, conf, e.Neighbor())
+			assert.True(t, net.ParseIP("1.1.1.1").Equal(e.PeerRouterID))
+			assert.Len(t, e.Message.PathAttrs, 2)
+		}
+		assert.IsType(t, &EventNeighborUpdateReceived{}, replayed[1])
+		if assert.IsType(t, &EventNeighborEndOfRIB{}, replayed[2]) {
+			assert.Equal(t, ts.Add(time.Second*2), replayed[2].Timestamp())
+		}
+		assert.IsType(t, &EventNeighborNotificationReceived{}, replayed[3])
+	}
+
+	// truncated record
+	err = Replay(context.Background(), bytes.NewReader(b[:len(b)-1]), &ReplayConfig{Neighbor: conf}, make(chan Event, 16))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// recorded pace
+	b = append(mrtMessage(t, ts, peer, gracefulRestartNode()), mrtMessage(t, ts.Add(time.Hour), peer, gracefulRestartNode())...)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	events = make(chan Event, 16)
+	err = Replay(ctx, bytes.NewReader(b), &ReplayConfig{Neighbor: conf, Speed: 1}, events)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Len(t, events, 1)
+
+	err = Replay(context.Background(), bytes.NewReader(b), &ReplayConfig{}, events)
+	assert.NotNil(t, err)
+
+	// a message record length beyond any bgp message is rejected before
+	// reading the record
+	b = mrtMessage(t, ts, peer, gracefulRestartNode())
+	binary.BigEndian.PutUint32(b[8:], 1<<31)
+	err = Replay(context.Background(), bytes.NewReader(b), &ReplayConfig{Neighbor: conf}, events)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, io.ErrUnexpectedEOF, err)
+
+	// skipped records are not read into memory
+	b = []byte{0, 0, 0, 0, 0, 13, 0, 1, 0x80, 0, 0, 0}
+	err = Replay(context.Background(), bytes.NewReader(b), &ReplayConfig{Neighbor: conf}, events)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestReplayExtendedMessage(t *testing.T) {
+	peer := net.ParseIP("172.16.0.1")
+	conf := &NeighborConfig{
+		Address:  peer,
+		ASN:      64512,
+		HoldTime: time.Second * 30,
+	}
+
+	u := gracefulRestartNode()
+	u.PathAttrs = append(u.PathAttrs, &PathAttrLinkState{
+		NodeAttrs: []NodeAttr{&NodeAttrOpaqueNodeAttr{Data: make([]byte, maxMessageLen)}},
+	})
+	msg, err := u.serializeWithMaxLen(maxExtendedMessageLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, len(msg) > maxMessageLen)
+
+	events := make(chan Event, 1)
+	err = Replay(context.Background(), bytes.NewReader(mrtMessageBytes(time.Now(), peer, msg)), &ReplayConfig{Neighbor: conf}, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, events, 1) {
+		e := <-events
+		if assert.IsType(t, &EventNeighborUpdateReceived{}, e) {
+			assert.Equal(t, u.PathAttrs, e.(*EventNeighborUpdateReceived).Message.PathAttrs)
+		}
+	}
+}